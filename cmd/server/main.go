@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -28,17 +29,6 @@ import (
 	"github.com/wared2003/freekiosk-hub/internal/api"
 )
 
-type ApiKeyTransport struct {
-	Transport http.RoundTripper
-	ApiKey    string
-}
-
-func (t *ApiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// On ajoute le header à chaque requête sortante
-	req.Header.Add("X-Api-Key", t.ApiKey)
-	return t.Transport.RoundTrip(req)
-}
-
 func main() {
 	// 1. Configuration & Logger initialization
 	cfg := config.Load()
@@ -53,12 +43,14 @@ func main() {
 	defer stop()
 
 	var httpClient *http.Client
+	var tsNode *network.TailscaleNode
 
 	// 2. Network Management (Tailscale vs Standard)
 	if cfg.TSAuthKey != "" {
 		slog.Info("🔐 Tailscale auth key detected, connecting to tailnet...")
 
-		tsNode, err := network.InitTailscale(cfg.TSAuthKey, "freekiosk-hub-server")
+		var err error
+		tsNode, err = network.InitTailscale(cfg.TSAuthKey, cfg.TSHostname)
 		if err != nil {
 			slog.Error("❌ Failed to initialize Tailscale", "error", err)
 			os.Exit(1)
@@ -74,14 +66,27 @@ func main() {
 		httpClient = tsNode.Client
 	} else {
 		slog.Warn("⚠️ No Tailscale key found. Using standard network stack.")
-		httpClient = &http.Client{
-			Timeout: 15 * time.Second,
-		}
+		// Le délai des requêtes vers les kiosques est appliqué tablette par tablette (KIOSK_TIMEOUT)
+		httpClient = &http.Client{}
+	}
+
+	if !cfg.PublicListener && (tsNode == nil || !cfg.TSServeUI) {
+		slog.Error("❌ PUBLIC_LISTENER=false requires TS_AUTHKEY and TS_SERVE_UI=true, the web UI would be unreachable")
+		os.Exit(1)
 	}
 
-	httpClient.Transport = &ApiKeyTransport{
-		Transport: httpClient.Transport,
-		ApiKey:    cfg.KioskApiKey,
+	// Adresse du hub donnée aux tablettes pour les médias et sites hébergés
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "localhost:" + cfg.ServerPort
+		if tsNode != nil {
+			if name := tsNode.DNSName(); name != "" {
+				cfg.BaseURL = name
+				if cfg.TSContentPort != "80" {
+					cfg.BaseURL += ":" + cfg.TSContentPort
+				}
+			}
+		}
+		slog.Info("🔗 BASE_URL derived automatically", "base_url", cfg.BaseURL)
 	}
 
 	// 3. Database connection
@@ -96,7 +101,21 @@ func main() {
 	tabletRepo := repositories.NewTabletRepository(db)
 	reportRepo := repositories.NewReportRepository(db)
 	groupRepo := repositories.NewGroupRepository(db)
-	kioskClient := clients.NewKioskClient(httpClient)
+	auditRepo := repositories.NewAuditRepository(db)
+	emergencyRepo := repositories.NewEmergencyRepository(db)
+	presetRepo := repositories.NewPresetRepository(db)
+	siteRepo := repositories.NewSiteRepository(db)
+	mediaRepo := repositories.NewMediaRepository(db)
+	announcementRepo := repositories.NewAnnouncementRepository(db)
+	snapshotRepo := repositories.NewSnapshotRepository(db)
+	tamperRepo := repositories.NewTamperRepository(db)
+	brightnessRepo := repositories.NewBrightnessRepository(db)
+	appRepo := repositories.NewAppRepository(db)
+	snippetRepo := repositories.NewSnippetRepository(db)
+	tabletTLSRepo := repositories.NewTabletTLSRepository(db)
+	tabletKeyRepo := repositories.NewTabletKeyRepository(db)
+	customFieldRepo := repositories.NewCustomFieldRepository(db)
+	viewRepo := repositories.NewDashboardViewRepository(db)
 
 	// Ensure tables exist
 	if err := tabletRepo.InitTable(); err != nil {
@@ -111,15 +130,120 @@ func main() {
 		slog.Error("Échec initialisation table groups", "err", err)
 		os.Exit(1)
 	}
+	if err := auditRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize audit_log table", "error", err)
+		os.Exit(1)
+	}
+	if err := emergencyRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize emergencies tables", "error", err)
+		os.Exit(1)
+	}
+	if err := presetRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize presets table", "error", err)
+		os.Exit(1)
+	}
+	if err := siteRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize sites tables", "error", err)
+		os.Exit(1)
+	}
+	if err := mediaRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize media table", "error", err)
+		os.Exit(1)
+	}
+	if err := announcementRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize announcements tables", "error", err)
+		os.Exit(1)
+	}
+	if err := snapshotRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize snapshots tables", "error", err)
+		os.Exit(1)
+	}
+	if err := tamperRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize tamper tables", "error", err)
+		os.Exit(1)
+	}
+	if err := brightnessRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize brightness policies table", "error", err)
+		os.Exit(1)
+	}
+	if err := appRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize group apps table", "error", err)
+		os.Exit(1)
+	}
+	if err := snippetRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize snippets tables", "error", err)
+		os.Exit(1)
+	}
+	if err := tabletTLSRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize tablet TLS table", "error", err)
+		os.Exit(1)
+	}
+	if err := tabletKeyRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize tablet keys table", "error", err)
+		os.Exit(1)
+	}
+	if err := customFieldRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize custom fields tables", "error", err)
+		os.Exit(1)
+	}
+	if err := viewRepo.InitTable(); err != nil {
+		slog.Error("❌ Failed to initialize dashboard views table", "error", err)
+		os.Exit(1)
+	}
 	slog.Info("✅ Database schema is ready")
 
-	mediaService := services.NewMediaService(cfg.MediaDir, cfg.BaseURL)
+	// HTTPS vers les kiosques : vérification et certificat client propres à chaque tablette
+	kioskTLS, err := services.NewKioskTLSService(tabletTLSRepo, auditRepo, cfg.TLSDir, tsNode != nil)
+	if err != nil {
+		slog.Error("❌ Failed to initialize kiosk TLS", "dir", cfg.TLSDir, "error", err)
+		os.Exit(1)
+	}
+	transport, ok := httpClient.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	kioskTLS.Wrap(transport)
+
+	// Clé d'API propre à chaque tablette, KIOSK_API_KEY sinon
+	kioskKeys, err := services.NewKioskKeyService(tabletKeyRepo, tabletRepo, auditRepo, cfg.KioskApiKey, cfg.MasterKey,
+		filepath.Join(filepath.Dir(cfg.DBPath), ".master-key"))
+	if err != nil {
+		slog.Error("❌ Failed to initialize tablet API keys", "error", err)
+		os.Exit(1)
+	}
+	// Hôte, port et délai propres à chaque tablette
+	kioskConns := services.NewKioskConnectionService(tabletRepo, auditRepo, cfg.KioskTimeout)
+	httpClient.Transport = kioskConns.Transport(kioskKeys.Transport(transport))
+	kioskClient := clients.NewKioskClient(httpClient, kioskTLS.Scheme)
+
+	mediaService := services.NewMediaService(mediaRepo, presetRepo, emergencyRepo, announcementRepo, cfg.MediaDir, cfg.BaseURL, services.MediaLimits{
+		MaxFileSize:         cfg.MediaMaxFile,
+		Quota:               cfg.MediaQuota,
+		AccessRetentionDays: cfg.RetentionDays,
+	}, services.MediaSigning{
+		Key:        cfg.MediaSigningKey,
+		TTL:        cfg.MediaURLTTL,
+		BindTablet: cfg.MediaURLBind,
+		Public:     cfg.MediaPublic,
+	})
+	if cfg.MediaScrub > 0 {
+		go mediaService.RunScrubber(ctx, cfg.MediaScrub)
+	}
 
 	// 5. Monitoring Service initialization
+	// Sans Tailscale, la présence réseau des tablettes reste inconnue
+	var prober services.TailnetProber
+	if tsNode != nil {
+		prober = tsNode
+	}
+	// Les rapports suivent l'appareil quand son IP change
+	deviceIdentity := services.NewDeviceIdentityService(tabletRepo, auditRepo, prober)
 	monitorSvc := services.NewMonitorService(
 		tabletRepo,
 		reportRepo,
 		kioskClient,
+		prober,
+		deviceIdentity,
 		cfg.MaxWorkers,
 		cfg.KioskPort,
 		cfg.PollInterval,
@@ -140,15 +264,54 @@ func main() {
 
 	e := echo.New()
 	e.Renderer = &api.TemplRenderer{}
-	api.NewRouter(e, db.DB, tabletRepo, reportRepo, groupRepo, monitorSvc, kioskClient, *cfg, mediaService)
-	e.Static("/media", cfg.MediaDir)
-	go func() {
-		slog.Info("🌐 Web Server starting", "port", cfg.ServerPort)
-		if err := e.Start(":" + cfg.ServerPort); err != nil && err != http.ErrServerClosed {
-			slog.Error("❌ Server failed", "error", err)
-			os.Exit(1)
+	server := api.NewRouter(e, db.DB, tabletRepo, reportRepo, groupRepo, auditRepo, emergencyRepo, presetRepo, siteRepo, announcementRepo, snapshotRepo, tamperRepo, brightnessRepo, appRepo, snippetRepo, monitorSvc, kioskClient, *cfg, mediaService, kioskTLS, kioskKeys, kioskConns, customFieldRepo, deviceIdentity, viewRepo)
+	go server.AnnouncementSvc.RunScheduler(ctx)
+	go server.SnapshotSvc.RunScheduler(ctx)
+	if cfg.PublicListener {
+		go func() {
+			slog.Info("🌐 Web Server starting", "port", cfg.ServerPort)
+			if err := e.Start(":" + cfg.ServerPort); err != nil && err != http.ErrServerClosed {
+				slog.Error("❌ Server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+	} else {
+		slog.Info("🔒 Public listener disabled, the web UI is only served on the tailnet")
+	}
+
+	// Les tablettes récupèrent les sites et médias hébergés directement via le tailnet
+	if tsNode != nil {
+		ln, err := tsNode.Server.Listen("tcp", ":"+cfg.TSContentPort)
+		if err != nil {
+			slog.Error("❌ Failed to listen on tailnet", "port", cfg.TSContentPort, "error", err)
+		} else {
+			go func() {
+				slog.Info("🌐 Tailnet content server starting", "port", cfg.TSContentPort)
+				if err := http.Serve(ln, api.ContentOnlyHandler(e)); err != nil {
+					slog.Error("❌ Tailnet content server stopped", "error", err)
+				}
+			}()
+		}
+
+		// Interface complète en HTTPS sur le nom MagicDNS, certificat émis par Tailscale
+		if cfg.TSServeUI {
+			tlsLn, err := tsNode.Server.ListenTLS("tcp", ":"+cfg.TSHTTPSPort)
+			if err != nil {
+				slog.Error("❌ Failed to serve the web UI over HTTPS on tailnet", "port", cfg.TSHTTPSPort, "error", err)
+				os.Exit(1)
+			}
+			url := "https://" + tsNode.DNSName()
+			if cfg.TSHTTPSPort != "443" {
+				url += ":" + cfg.TSHTTPSPort
+			}
+			go func() {
+				slog.Info("🔐 Tailnet HTTPS web server starting", "url", url)
+				if err := http.Serve(tlsLn, e); err != nil {
+					slog.Error("❌ Tailnet HTTPS web server stopped", "error", err)
+				}
+			}()
 		}
-	}()
+	}
 
 	slog.Info("🌐 Hub is fully operational. Waiting for interrupt signals...")
 	<-ctx.Done()
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const adminUserKey = "admin_user"
+
+// requireAdmin protège les routes sensibles par HTTP Basic ; sans compte configuré, elles sont désactivées
+func requireAdmin(users map[string]string) echo.MiddlewareFunc {
+	if len(users) == 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				return echo.NewHTTPError(http.StatusForbidden, "Admin features are disabled: set ADMIN_USERS to enable them")
+			}
+		}
+	}
+
+	return middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Realm: "FreeKiosk Hub admin",
+		Validator: func(user, password string, c echo.Context) (bool, error) {
+			expected, ok := users[user]
+			if !ok {
+				// Comparaison factice pour ne pas révéler les comptes existants par le temps de réponse
+				subtle.ConstantTimeCompare([]byte(password), []byte(password))
+				return false, nil
+			}
+			if subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 {
+				return false, nil
+			}
+			c.Set(adminUserKey, user)
+			return true, nil
+		},
+	})
+}
+
+// adminActor identifie l'administrateur authentifié dans le journal d'audit
+func adminActor(c echo.Context) string {
+	if user, ok := c.Get(adminUserKey).(string); ok {
+		return user + " (" + c.RealIP() + ")"
+	}
+	return c.RealIP()
+}
@@ -0,0 +1,318 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Attente maximale entre deux étapes d'une séquence
+const maxStepDelay = 10 * time.Minute
+
+type AnnouncementHandler struct {
+	annRepo      repositories.AnnouncementRepository
+	annService   services.AnnouncementService
+	groupRepo    repositories.GroupRepository
+	auditRepo    repositories.AuditRepository
+	mediaService services.MediaService
+	ttsService   services.TTSService
+}
+
+func NewAnnouncementHandler(
+	anr repositories.AnnouncementRepository,
+	as services.AnnouncementService,
+	gr repositories.GroupRepository,
+	ar repositories.AuditRepository,
+	mes services.MediaService,
+	tts services.TTSService,
+) *AnnouncementHandler {
+	return &AnnouncementHandler{annRepo: anr, annService: as, groupRepo: gr, auditRepo: ar, mediaService: mes, ttsService: tts}
+}
+
+func (h *AnnouncementHandler) loadData() (ui.AnnouncementsData, error) {
+	data := ui.AnnouncementsData{Runs: h.annService.Runs(), Engine: h.ttsService.Engine()}
+
+	announcements, err := h.annRepo.GetAll()
+	if err != nil {
+		return data, err
+	}
+	for _, a := range announcements {
+		steps, err := h.annRepo.GetSteps(a.ID)
+		if err != nil {
+			return data, err
+		}
+		schedules, err := h.annRepo.GetSchedules(a.ID)
+		if err != nil {
+			return data, err
+		}
+		data.Items = append(data.Items, ui.AnnouncementView{Announcement: a, Steps: steps, Schedules: schedules})
+	}
+
+	data.Groups, _ = h.groupRepo.GetAll()
+	data.Audio, _ = h.mediaService.List("audio")
+	data.History, _ = h.auditRepo.GetByAction("announcement.", 15)
+	return data, nil
+}
+
+// GET /announcements
+func (h *AnnouncementHandler) HandleAnnouncements(c echo.Context) error {
+	data, err := h.loadData()
+	if err != nil {
+		slog.Error("database error: failed to fetch announcements", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return ui.AnnouncementsContent(data).Render(c.Request().Context(), c.Response().Writer)
+	}
+	return c.Render(http.StatusOK, "", ui.AnnouncementsPage(data))
+}
+
+// GET /announcements/new
+func (h *AnnouncementHandler) HandleNew(c echo.Context) error {
+	audio, _ := h.mediaService.List("audio")
+	return c.Render(http.StatusOK, "", ui.AnnouncementFormModal(repositories.Announcement{Repeat: 1}, nil, audio))
+}
+
+// GET /announcements/:id/edit
+func (h *AnnouncementHandler) HandleEdit(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	a, err := h.annRepo.GetByID(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Announcement not found")
+	}
+	steps, err := h.annRepo.GetSteps(id)
+	if err != nil {
+		slog.Error("database error: failed to fetch announcement steps", "id", id, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+	audio, _ := h.mediaService.List("audio")
+	return c.Render(http.StatusOK, "", ui.AnnouncementFormModal(*a, steps, audio))
+}
+
+// parseSteps relit les listes parallèles step_* envoyées par le formulaire
+func parseSteps(c echo.Context) ([]repositories.AnnouncementStep, error) {
+	form, err := c.FormParams()
+	if err != nil {
+		return nil, err
+	}
+	kinds, media, texts, langs, delays := form["step_kind"], form["step_media"], form["step_text"], form["step_lang"], form["step_delay"]
+	if len(texts) != len(kinds) || len(langs) != len(kinds) || len(delays) != len(kinds) {
+		return nil, fmt.Errorf("malformed steps")
+	}
+
+	steps := make([]repositories.AnnouncementStep, 0, len(kinds))
+	for i, kind := range kinds {
+		delay, err := strconv.ParseFloat(delays[i], 64)
+		if err != nil || delay < 0 || delay > maxStepDelay.Seconds() {
+			return nil, fmt.Errorf("step %d: wait must be between 0 and %.0f seconds", i+1, maxStepDelay.Seconds())
+		}
+		step := repositories.AnnouncementStep{Kind: kind, DelayMs: int(math.Round(delay * 1000))}
+
+		switch kind {
+		case repositories.StepMedia:
+			// Sans fichier audio dans la bibliothèque, le select est vide et step_media absent
+			if i >= len(media) {
+				return nil, fmt.Errorf("step %d: pick a sound from the library", i+1)
+			}
+			mediaID, err := strconv.ParseInt(media[i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("step %d: pick a sound from the library", i+1)
+			}
+			step.MediaID = &mediaID
+		case repositories.StepTTS:
+			step.Text = strings.TrimSpace(texts[i])
+			step.Lang = strings.TrimSpace(langs[i])
+			if step.Text == "" {
+				return nil, fmt.Errorf("step %d: text to speak is empty", i+1)
+			}
+			if step.Lang == "" {
+				step.Lang = "en"
+			}
+		case repositories.StepPause:
+		default:
+			return nil, fmt.Errorf("step %d: unknown kind %q", i+1, kind)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// POST /announcements/save
+func (h *AnnouncementHandler) HandleSave(c echo.Context) error {
+	c.Response().Header().Set("HX-Reswap", "none")
+
+	id, _ := strconv.ParseInt(c.FormValue("id"), 10, 64)
+	repeat, _ := strconv.Atoi(c.FormValue("repeat"))
+	volume, _ := strconv.Atoi(c.FormValue("volume"))
+
+	a := &repositories.Announcement{
+		ID:     id,
+		Name:   strings.TrimSpace(c.FormValue("name")),
+		Repeat: min(max(repeat, 1), 20),
+		Volume: min(max(volume, 0), 100),
+	}
+	if a.Name == "" {
+		return ui.Toast("Name is required", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	steps, err := parseSteps(c)
+	if err != nil {
+		return ui.Toast(err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	if len(steps) == 0 {
+		return ui.Toast("Add at least one step", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	if err := h.annRepo.Save(a, steps); err != nil {
+		slog.Error("database error: failed to save announcement", "name", a.Name, "err", err)
+		return ui.Toast("Failed to save announcement", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	slog.Info("resource saved: announcement", "id", a.ID, "name", a.Name, "steps", len(steps))
+
+	c.Response().Header().Del("HX-Reswap")
+	ui.Toast(fmt.Sprintf("✅ %s saved", a.Name), "success").Render(c.Request().Context(), c.Response().Writer)
+	return h.HandleAnnouncements(c)
+}
+
+// DELETE /announcements/:id
+func (h *AnnouncementHandler) HandleDelete(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	if err := h.annRepo.Delete(id); err != nil {
+		slog.Error("database error: failed to delete announcement", "id", id, "err", err)
+		return c.String(http.StatusInternalServerError, "Deletion failed")
+	}
+
+	slog.Info("resource deleted: announcement removed", "id", id)
+	return c.NoContent(http.StatusOK)
+}
+
+// POST /announcements/:id/play (group_id, 0 = toute la flotte)
+func (h *AnnouncementHandler) HandlePlay(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	groupID, _ := strconv.ParseInt(c.FormValue("group_id"), 10, 64)
+	run, err := h.annService.Play(id, services.Target{GroupID: groupID, All: groupID == 0}, c.RealIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAnnouncementBusy):
+			return ui.Toast("Some of these tablets are already playing an announcement", "error").Render(c.Request().Context(), c.Response().Writer)
+		case errors.Is(err, services.ErrGroupNotFound), errors.Is(err, services.ErrInvalidTarget):
+			return ui.Toast("No tablet to play on", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+		slog.Error("announcement: play failed", "id", id, "err", err)
+		return ui.Toast("Error: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	c.Response().Header().Set("HX-Trigger", "announcement-started")
+	return ui.Toast(fmt.Sprintf("📢 %s playing on %d tablet(s)", run.Name, run.Tablets), "success").Render(c.Request().Context(), c.Response().Writer)
+}
+
+// GET /announcements/runs
+func (h *AnnouncementHandler) HandleRuns(c echo.Context) error {
+	return ui.AnnouncementRuns(h.annService.Runs()).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// POST /announcements/runs/:run/stop
+func (h *AnnouncementHandler) HandleStop(c echo.Context) error {
+	runID, err := strconv.ParseInt(c.Param("run"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	if err := h.annService.Stop(runID, c.RealIP()); err != nil {
+		ui.Toast("This announcement has already finished", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	return h.HandleRuns(c)
+}
+
+// POST /announcements/:id/schedules
+func (h *AnnouncementHandler) HandleAddSchedule(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	c.Response().Header().Set("HX-Reswap", "none")
+	at, err := time.Parse("15:04", c.FormValue("at"))
+	if err != nil {
+		return ui.Toast("Invalid time", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	form, _ := c.FormParams()
+	var days []string
+	for _, d := range form["days"] {
+		if n, err := strconv.Atoi(d); err == nil && n >= 0 && n <= 6 {
+			days = append(days, d)
+		}
+	}
+	groupID, _ := strconv.ParseInt(c.FormValue("group_id"), 10, 64)
+
+	schedule := &repositories.AnnouncementSchedule{
+		AnnouncementID: id,
+		GroupID:        groupID,
+		At:             at.Format("15:04"),
+		Days:           strings.Join(days, ","),
+		Enabled:        true,
+	}
+	if err := h.annRepo.CreateSchedule(schedule); err != nil {
+		slog.Error("database error: failed to create announcement schedule", "id", id, "err", err)
+		return ui.Toast("Failed to save schedule", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	slog.Info("resource created: announcement schedule", "announcement", id, "at", schedule.At, "days", schedule.Days)
+
+	c.Response().Header().Del("HX-Reswap")
+	return h.HandleAnnouncements(c)
+}
+
+// POST /announcements/schedules/:sid/toggle
+func (h *AnnouncementHandler) HandleToggleSchedule(c echo.Context) error {
+	sid, err := strconv.ParseInt(c.Param("sid"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	// La case n'est envoyée par htmx que lorsqu'elle est cochée
+	enabled := c.FormValue("enabled") != ""
+	if err := h.annRepo.SetScheduleEnabled(sid, enabled); err != nil {
+		slog.Error("database error: failed to toggle schedule", "id", sid, "err", err)
+		return ui.Toast("Failed to update schedule", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// DELETE /announcements/schedules/:sid
+func (h *AnnouncementHandler) HandleDeleteSchedule(c echo.Context) error {
+	sid, err := strconv.ParseInt(c.Param("sid"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	if err := h.annRepo.DeleteSchedule(sid); err != nil {
+		slog.Error("database error: failed to delete schedule", "id", sid, "err", err)
+		return c.String(http.StatusInternalServerError, "Deletion failed")
+	}
+	return c.NoContent(http.StatusOK)
+}
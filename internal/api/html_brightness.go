@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type BrightnessHandler struct {
+	groupRepo     repositories.GroupRepository
+	brightnessSvc services.BrightnessService
+}
+
+func NewBrightnessHandler(gr repositories.GroupRepository, bs services.BrightnessService) *BrightnessHandler {
+	return &BrightnessHandler{groupRepo: gr, brightnessSvc: bs}
+}
+
+// GET /groups/:id/brightness
+func (h *BrightnessHandler) HandleModal(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	group, err := h.groupRepo.GetByID(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Group not found")
+	}
+	policy, err := h.brightnessSvc.Policy(id)
+	if err != nil {
+		slog.Error("database error: failed to fetch brightness policy", "group", id, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	return ui.BrightnessPolicyModal(*group, *policy).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// formClock normalise une heure HH:MM saisie ; vide reste vide
+func formClock(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return "", err
+	}
+	return t.Format("15:04"), nil
+}
+
+// POST /groups/:id/brightness
+func (h *BrightnessHandler) HandleSave(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	fail := func(msg string) error {
+		c.Response().Header().Set("HX-Reswap", "none")
+		return ui.Toast(msg, "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	nightStart, err1 := formClock(c.FormValue("night_start"))
+	nightEnd, err2 := formClock(c.FormValue("night_end"))
+	if err1 != nil || err2 != nil {
+		return fail("Invalid night hours")
+	}
+	nightBrightness, _ := strconv.Atoi(c.FormValue("night_brightness"))
+	idleAfter, _ := strconv.Atoi(c.FormValue("idle_after"))
+	idleBrightness, _ := strconv.Atoi(c.FormValue("idle_brightness"))
+	hysteresis, _ := strconv.Atoi(c.FormValue("hysteresis"))
+
+	policy := &repositories.BrightnessPolicy{
+		GroupID:         id,
+		Enabled:         c.FormValue("enabled") != "",
+		Curve:           c.FormValue("curve"),
+		NightStart:      nightStart,
+		NightEnd:        nightEnd,
+		NightBrightness: nightBrightness,
+		IdleAfterMin:    idleAfter,
+		IdleBrightness:  idleBrightness,
+		Hysteresis:      hysteresis,
+	}
+
+	if err := h.brightnessSvc.SavePolicy(policy, c.RealIP()); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidCurve):
+			return fail("Invalid curve: use lux:% points, e.g. 0:15,300:70,1000:100")
+		case errors.Is(err, services.ErrInvalidNightRange):
+			return fail("Night mode needs both a start and an end time")
+		case errors.Is(err, services.ErrInvalidBrightness):
+			return fail("Brightness values must be between 0 and 100")
+		}
+		slog.Error("database error: failed to save brightness policy", "group", id, "err", err)
+		return fail("Failed to save brightness policy")
+	}
+
+	msg := "💡 Brightness policy disabled"
+	if policy.Enabled {
+		msg = fmt.Sprintf("💡 Brightness policy enabled (%s)", policy.Curve)
+	}
+	return ui.Toast(msg, "success").Render(c.Request().Context(), c.Response().Writer)
+}
@@ -1,48 +1,92 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
 
-	"github.com/wared2003/freekiosk-hub/internal/models"
-	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
 	"github.com/wared2003/freekiosk-hub/ui"
 
 	"github.com/labstack/echo/v4"
 )
 
 type HtmlHomeHandler struct {
-	tabletRepo repositories.TabletRepository
-	reportRepo repositories.ReportRepository
-	groupRepo  repositories.GroupRepository
+	fleet services.FleetViewService
 }
 
-func NewHtmlHomeHandler(tr repositories.TabletRepository, rr repositories.ReportRepository, gr repositories.GroupRepository) *HtmlHomeHandler {
-	return &HtmlHomeHandler{
-		tabletRepo: tr,
-		reportRepo: rr,
-		groupRepo:  gr,
-	}
+func NewHtmlHomeHandler(fs services.FleetViewService) *HtmlHomeHandler {
+	return &HtmlHomeHandler{fleet: fs}
 }
 
 func (h *HtmlHomeHandler) HandleIndex(c echo.Context) error {
-	tablets, _ := h.tabletRepo.GetAll()
-
-	var displayList []models.TabletDisplay
-	for _, t := range tablets {
-		report, _ := h.reportRepo.GetLatestByTablet(int64(t.ID), true)
-		groups, _ := h.groupRepo.GetGroupsByTablet(int64(t.ID))
-		displayList = append(displayList, models.TabletDisplay{
-			Tablet:     t,
-			LastReport: report,
-			Groups:     groups,
-		})
+	filter := services.ParseFleetFilter(c.QueryParams())
+	page, err := h.fleet.List(filter)
+	if err != nil {
+		slog.Error("database error: failed to fetch fleet", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
 	}
 
 	if c.QueryParam("refresh") == "true" {
-		return ui.DashboardGrid(displayList).Render(c.Request().Context(), c.Response().Writer)
+		return ui.DashboardGrid(*page).Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	views, err := h.fleet.Views()
+	if err != nil {
+		slog.Error("database error: failed to fetch dashboard views", "err", err)
 	}
 
 	FullPage := c.Request().Header.Get("HX-Request") != "true"
 
-	return c.Render(http.StatusOK, "", ui.Dashboard(displayList, FullPage))
+	return c.Render(http.StatusOK, "", ui.Dashboard(*page, views, FullPage))
+}
+
+// POST /views
+// Le formulaire de filtre est joint à la requête : la vue enregistre le filtre affiché
+func (h *HtmlHomeHandler) HandleSaveView(c echo.Context) error {
+	form, err := c.FormParams()
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid form")
+	}
+	view, err := h.fleet.SaveView(c.FormValue("view_name"), services.ParseFleetFilter(form), adminActor(c))
+	if err != nil {
+		c.Response().Header().Set("HX-Reswap", "none")
+		switch {
+		case errors.Is(err, services.ErrInvalidViewName):
+			return ui.Toast("The view name must be between 1 and 64 characters", "error").Render(c.Request().Context(), c.Response().Writer)
+		case errors.Is(err, services.ErrViewNameTaken):
+			return ui.Toast("A view with this name already exists", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+		slog.Error("database error: failed to save dashboard view", "err", err)
+		return ui.Toast("Failed to save view", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	ui.Toast(fmt.Sprintf("✅ View %s saved", view.Name), "success").Render(c.Request().Context(), c.Response().Writer)
+	return h.renderViews(c)
+}
+
+// DELETE /views/:id
+func (h *HtmlHomeHandler) HandleDeleteView(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	if err := h.fleet.DeleteView(id, adminActor(c)); err != nil && !errors.Is(err, services.ErrViewNotFound) {
+		slog.Error("database error: failed to delete dashboard view", "id", id, "err", err)
+		c.Response().Header().Set("HX-Reswap", "none")
+		return ui.Toast("Failed to delete view", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	return h.renderViews(c)
+}
+
+func (h *HtmlHomeHandler) renderViews(c echo.Context) error {
+	views, err := h.fleet.Views()
+	if err != nil {
+		slog.Error("database error: failed to fetch dashboard views", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+	return ui.DashboardViews(views).Render(c.Request().Context(), c.Response().Writer)
 }
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type EmergencyHandler struct {
+	emService    services.EmergencyService
+	groupRepo    repositories.GroupRepository
+	auditRepo    repositories.AuditRepository
+	mediaService services.MediaService
+}
+
+func NewEmergencyHandler(es services.EmergencyService, gr repositories.GroupRepository, ar repositories.AuditRepository, mes services.MediaService) *EmergencyHandler {
+	return &EmergencyHandler{emService: es, groupRepo: gr, auditRepo: ar, mediaService: mes}
+}
+
+func (h *EmergencyHandler) renderContent(c echo.Context) error {
+	active, err := h.emService.Active()
+	if err != nil {
+		slog.Error("database error: failed to fetch active emergency", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	groups, _ := h.groupRepo.GetAll()
+	sounds, _ := h.mediaService.Sounds()
+	history, _ := h.auditRepo.GetByAction("emergency.", 20)
+
+	data := ui.EmergencyData{
+		Active:  active,
+		Groups:  groups,
+		Sounds:  sounds,
+		History: history,
+		PageURL: h.emService.AlertPageURL(),
+	}
+
+	if c.Request().Header.Get("HX-Request") == "true" {
+		// Les toasts ont parfois déjà été écrits : on n'utilise pas c.Render pour ne pas réécrire le status
+		return ui.EmergencyContent(data).Render(c.Request().Context(), c.Response().Writer)
+	}
+	return c.Render(http.StatusOK, "", ui.EmergencyPage(data))
+}
+
+// GET /emergency
+func (h *EmergencyHandler) HandleEmergency(c echo.Context) error {
+	return h.renderContent(c)
+}
+
+// POST /emergency/trigger
+func (h *EmergencyHandler) HandleTrigger(c echo.Context) error {
+	form, _ := c.FormParams()
+
+	var groupIDs []int64
+	if c.FormValue("scope") == "groups" {
+		for _, raw := range form["group_ids"] {
+			id, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return ui.Toast("Invalid group selection", "error").Render(c.Request().Context(), c.Response().Writer)
+			}
+			groupIDs = append(groupIDs, id)
+		}
+		if len(groupIDs) == 0 {
+			return ui.Toast("Select at least one group", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+	}
+
+	opts := services.EmergencyOptions{
+		GroupIDs: groupIDs,
+		Message:  c.FormValue("message"),
+		AlertURL: c.FormValue("alert_url"),
+		SoundURL: c.FormValue("sound_url"),
+		Speak:    c.FormValue("speak") == "on",
+		Actor:    c.RealIP(),
+	}
+
+	if opts.Message == "" && opts.AlertURL == "" {
+		return ui.Toast("A message or an alert URL is required", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	_, report, err := h.emService.Trigger(opts)
+	if err != nil {
+		if errors.Is(err, repositories.ErrEmergencyActive) {
+			return ui.Toast("An emergency is already active", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+		slog.Error("emergency: trigger failed", "err", err)
+		return ui.Toast("Error: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	c.Response().Header().Set("HX-Trigger", "emergency")
+	ui.Toast(fmt.Sprintf("🚨 Emergency broadcast: %s", report.Summary), "success").Render(c.Request().Context(), c.Response().Writer)
+	return h.renderContent(c)
+}
+
+// POST /emergency/clear
+func (h *EmergencyHandler) HandleAllClear(c echo.Context) error {
+	report, err := h.emService.AllClear(c.RealIP())
+	if err != nil {
+		if errors.Is(err, services.ErrNoActiveEmergency) {
+			return ui.Toast("No active emergency", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+		slog.Error("emergency: all clear failed", "err", err)
+		return ui.Toast("Error: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	c.Response().Header().Set("HX-Trigger", "emergency")
+	for _, res := range report.Results {
+		if !res.Executed {
+			ui.Toast(fmt.Sprintf("❌ %s: restore incomplete", res.Name), "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+	}
+	ui.Toast(fmt.Sprintf("✅ All clear: %s", report.Summary), "success").Render(c.Request().Context(), c.Response().Writer)
+	return h.renderContent(c)
+}
+
+// GET /emergency/banner
+func (h *EmergencyHandler) HandleBanner(c echo.Context) error {
+	active, err := h.emService.Active()
+	if err != nil {
+		return c.NoContent(http.StatusOK)
+	}
+	return c.Render(http.StatusOK, "", ui.EmergencyBanner(active))
+}
+
+// GET /emergency/page : page affichée par les tablettes pendant l'alerte
+func (h *EmergencyHandler) HandleAlertPage(c echo.Context) error {
+	active, _ := h.emService.Active()
+	return c.Render(http.StatusOK, "", ui.EmergencyAlertPage(active))
+}
@@ -1,22 +1,27 @@
 package api
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
 
 	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/internal/sse"
 	"github.com/wared2003/freekiosk-hub/ui"
 
 	"github.com/labstack/echo/v4"
 )
 
 type GroupHandler struct {
-	groupRepo repositories.GroupRepository
+	groupRepo  repositories.GroupRepository
+	presetRepo repositories.PresetRepository
+	kService   services.KioskService
 }
 
-func NewGroupHandler(gr repositories.GroupRepository) *GroupHandler {
-	return &GroupHandler{groupRepo: gr}
+func NewGroupHandler(gr repositories.GroupRepository, pr repositories.PresetRepository, ks services.KioskService) *GroupHandler {
+	return &GroupHandler{groupRepo: gr, presetRepo: pr, kService: ks}
 }
 
 // GET /groups
@@ -108,6 +113,7 @@ func (h *GroupHandler) HandleDeleteGroup(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "Deletion failed")
 	}
 
+	sse.Instance.InvalidateGroups()
 	slog.Info("resource deleted: group removed", "id", id)
 	return c.NoContent(http.StatusOK)
 }
@@ -148,7 +154,34 @@ func (h *GroupHandler) HandleToggleGroup(c echo.Context) error {
 		h.groupRepo.AddTabletToGroup(tID, gID)
 		slog.Info("tablet added to group", "tablet", tID, "group", gID)
 	}
+	sse.Instance.InvalidateGroups()
 
 	c.Response().Header().Set("HX-Trigger", "update")
 	return c.NoContent(http.StatusOK)
 }
+
+// GET /groups/:id/navigate-modal
+func (h *GroupHandler) HandleGroupNavigateModal(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	presets, _ := h.presetRepo.GetAll()
+	return ui.NavigateModal(fmt.Sprintf("/groups/%d/command/navigate", id), "", presets).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// POST /groups/:id/command/navigate
+func (h *GroupHandler) HandleGroupNavigate(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return ui.Toast("Invalid group ID", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	newURL, err := parseKioskURL(c.FormValue("url"))
+	if err != nil {
+		return ui.Toast(err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	return renderNavigate(c, h.kService, services.Target{GroupID: id}, newURL)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IdentityHandler struct {
+	tabletRepo repositories.TabletRepository
+	identity   services.DeviceIdentityService
+}
+
+func NewIdentityHandler(tr repositories.TabletRepository, ids services.DeviceIdentityService) *IdentityHandler {
+	return &IdentityHandler{tabletRepo: tr, identity: ids}
+}
+
+// GET /tablets/:id/identity
+func (h *IdentityHandler) HandleModal(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	tablet, err := h.tabletRepo.GetByID(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Tablet not found")
+	}
+	addresses, err := h.identity.Addresses(id)
+	if err != nil {
+		slog.Error("database error: failed to fetch tablet addresses", "tablet", id, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+	candidates, err := h.identity.Candidates(id)
+	if err != nil {
+		slog.Error("database error: failed to fetch merge candidates", "tablet", id, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	return ui.IdentityModal(*tablet, addresses, candidates).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// POST /tablets/:id/merge
+// La tablette affichée est le doublon : elle est fusionnée dans celle choisie, qui garde son IP
+func (h *IdentityHandler) HandleMerge(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	into, err := strconv.ParseInt(c.FormValue("into"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid target")
+	}
+
+	if err := h.identity.Merge(into, id, adminActor(c)); err != nil {
+		c.Response().Header().Set("HX-Reswap", "none")
+		msg := "Merge failed"
+		switch {
+		case errors.Is(err, services.ErrMergeIntoSelf):
+			msg = "Choose another tablet"
+		case errors.Is(err, services.ErrTabletNotFound):
+			msg = "Tablet not found"
+		default:
+			slog.Error("database error: failed to merge tablets", "survivor", into, "duplicate", id, "err", err)
+		}
+		return ui.Toast(msg, "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	c.Response().Header().Set("HX-Redirect", fmt.Sprintf("/tablets/%d", into))
+	return c.NoContent(http.StatusOK)
+}
+
+// POST /tablets/:id/identity/forget
+func (h *IdentityHandler) HandleForget(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	if err := h.identity.Forget(id, adminActor(c)); err != nil {
+		c.Response().Header().Set("HX-Reswap", "none")
+		if !errors.Is(err, services.ErrTabletNotFound) {
+			slog.Error("database error: failed to forget device identity", "tablet", id, "err", err)
+		}
+		return ui.Toast("Failed to forget the device identity", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	c.Response().Header().Set("HX-Trigger", "update")
+	return h.HandleModal(c)
+}
@@ -0,0 +1,308 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/internal/sse"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ImportHandler struct {
+	tabletRepo repositories.TabletRepository
+	keySvc     services.KioskKeyService
+	connSvc    services.KioskConnectionService
+	tlsSvc     services.KioskTLSService
+	inventory  services.InventoryService
+}
+
+func NewImportHandler(tr repositories.TabletRepository, ks services.KioskKeyService, cs services.KioskConnectionService, ts services.KioskTLSService, inv services.InventoryService) *ImportHandler {
+	return &ImportHandler{tabletRepo: tr, keySvc: ks, connSvc: cs, tlsSvc: ts, inventory: inv}
+}
+
+// importLine est une tablette à importer ; les champs vides gardent la valeur existante
+type importLine struct {
+	ip      string
+	name    string
+	key     string
+	host    string
+	port    string
+	timeout string
+	scheme  string
+
+	// inventory contient les champs d'inventaire présents sur la ligne, fixes ou personnalisés ;
+	// une valeur vide efface le champ
+	inventory map[string]string
+}
+
+// set range une colonne nommée de la ligne
+func (l *importLine) set(name, value string) {
+	switch name {
+	case "ip":
+		l.ip = value
+	case "name":
+		l.name = value
+	case "host":
+		l.host = value
+	case "port":
+		l.port = value
+	case "timeout":
+		l.timeout = value
+	case "scheme":
+		l.scheme = value
+	case "key":
+		l.key = value
+	default:
+		if l.inventory == nil {
+			l.inventory = make(map[string]string)
+		}
+		l.inventory[name] = value
+	}
+}
+
+// parseImportLine lit "adresse[:port] [clé] [host=…] [port=…] [timeout=…] [scheme=…] [key=…] [location=…] [<champ>=…]"
+func parseImportLine(line string, defaults importLine) (importLine, bool) {
+	fields := strings.Fields(strings.ReplaceAll(line, ",", " "))
+	if len(fields) == 0 {
+		return importLine{}, false
+	}
+
+	l := defaults
+	l.ip = fields[0]
+	if host, port, err := net.SplitHostPort(fields[0]); err == nil {
+		l.ip, l.port = host, port
+	}
+	for _, f := range fields[1:] {
+		name, value, ok := strings.Cut(f, "=")
+		if !ok {
+			l.key = f
+			continue
+		}
+		if name != "ip" {
+			l.set(name, value)
+		}
+	}
+	return l, true
+}
+
+// parseImportCSV lit un fichier au format de l'export (/tablets/export.csv), en-tête compris ;
+// une cellule vide garde la valeur par défaut du formulaire, sauf pour l'inventaire
+func parseImportCSV(text string, defaults importLine) ([]importLine, error) {
+	records, err := csv.NewReader(strings.NewReader(text)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	header := records[0]
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	var lines []importLine
+	for _, record := range records[1:] {
+		l := defaults
+		for i, value := range record {
+			if i >= len(header) || header[i] == "" {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if value == "" && slices.Contains([]string{"key", "port", "timeout", "scheme"}, header[i]) {
+				continue
+			}
+			l.set(header[i], value)
+		}
+		if l.ip != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines, nil
+}
+
+// GET /admin/import
+func (h *ImportHandler) HandleImportPage(c echo.Context) error {
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return ui.AdminImportContent().Render(c.Request().Context(), c.Response().Writer)
+	}
+	return c.Render(http.StatusOK, "", ui.AdminImport())
+}
+
+// POST /api/v1/tablets/import
+func (h *ImportHandler) HandleBulkImport(c echo.Context) error {
+	defaults := importLine{
+		key:     strings.TrimSpace(c.FormValue("api_key")),
+		port:    strings.TrimSpace(c.FormValue("port")),
+		timeout: strings.TrimSpace(c.FormValue("timeout")),
+		scheme:  c.FormValue("scheme"),
+	}
+
+	tablets, err := h.tabletRepo.GetAll()
+	if err != nil {
+		slog.Error("database error: failed to fetch tablets", "err", err)
+		return ui.Toast("Erreur de base de données", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	known := make(map[string]bool, len(tablets))
+	for _, t := range tablets {
+		known[t.IP] = true
+	}
+
+	// Un texte commençant par l'en-tête "ip,…" est un CSV exporté par le hub
+	var parsed []importLine
+	text := strings.TrimSpace(c.FormValue("ips"))
+	if strings.HasPrefix(text, "ip,") {
+		if parsed, err = parseImportCSV(text, defaults); err != nil {
+			return ui.ImportResult(0, 0, 0, []string{"CSV illisible : " + err.Error()}).Render(c.Request().Context(), c.Response().Writer)
+		}
+	} else {
+		for _, raw := range strings.Split(text, "\n") {
+			if l, ok := parseImportLine(raw, defaults); ok {
+				parsed = append(parsed, l)
+			}
+		}
+	}
+
+	var created, existing, keys int
+	var errs []string
+	var lines []importLine
+	for _, l := range parsed {
+		if known[l.ip] {
+			existing++
+		} else {
+			name := l.name
+			if name == "" {
+				name = l.ip
+			}
+			if err := h.tabletRepo.Save(&repositories.Tablet{IP: l.ip, Name: name}); err != nil {
+				slog.Error("database error: failed to import tablet", "ip", l.ip, "err", err)
+				errs = append(errs, fmt.Sprintf("%s : échec de l'enregistrement", l.ip))
+				continue
+			}
+			known[l.ip] = true
+			created++
+		}
+		lines = append(lines, l)
+	}
+
+	// Les identifiants des nouvelles tablettes ne sont connus qu'après l'enregistrement
+	tablets, err = h.tabletRepo.GetAll()
+	if err != nil {
+		slog.Error("database error: failed to fetch tablets", "err", err)
+		return ui.Toast("Erreur de base de données", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	byIP := make(map[string]repositories.Tablet, len(tablets))
+	for _, t := range tablets {
+		byIP[t.IP] = t
+	}
+	actor := adminActor(c)
+	for _, l := range lines {
+		t, ok := byIP[l.ip]
+		if !ok {
+			continue
+		}
+		if err := h.applyConnection(t, l, actor); err != nil {
+			errs = append(errs, fmt.Sprintf("%s : %s", l.ip, err))
+		}
+		if err := h.applyInventory(t, l, actor); err != nil {
+			errs = append(errs, fmt.Sprintf("%s : %s", l.ip, err))
+		}
+		if l.key == "" {
+			continue
+		}
+		if err := h.keySvc.SetKey(t.ID, l.key, actor); err != nil {
+			errs = append(errs, fmt.Sprintf("%s : clé refusée (16 caractères minimum, sans espace)", l.ip))
+			continue
+		}
+		keys++
+	}
+
+	if created > 0 {
+		sse.Instance.Publish(sse.Event{Type: sse.EventFleet})
+	}
+	return ui.ImportResult(created, existing, keys, errs).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// applyConnection complète le profil de connexion et le schéma de la tablette avec ceux de la ligne
+func (h *ImportHandler) applyConnection(t repositories.Tablet, l importLine, actor string) error {
+	if l.host != "" || l.port != "" || l.timeout != "" {
+		if l.host != "" {
+			t.Host = l.host
+		}
+		if l.port != "" {
+			t.Port = l.port
+		}
+		if l.timeout != "" {
+			sec, err := strconv.Atoi(l.timeout)
+			if err != nil {
+				return errors.New("délai invalide")
+			}
+			t.TimeoutSec = sec
+		}
+		if err := h.connSvc.Save(&t, actor); err != nil {
+			if errors.Is(err, services.ErrInvalidConnection) {
+				return errors.New("hôte, port ou délai invalide")
+			}
+			slog.Error("database error: failed to save tablet connection", "tablet", t.ID, "err", err)
+			return errors.New("profil de connexion non enregistré")
+		}
+	}
+
+	if l.scheme == "" {
+		return nil
+	}
+	settings, err := h.tlsSvc.Settings(t.ID)
+	if err != nil {
+		slog.Error("database error: failed to fetch tablet TLS settings", "tablet", t.ID, "err", err)
+		return errors.New("schéma non enregistré")
+	}
+	settings.Scheme = l.scheme
+	if err := h.tlsSvc.Save(settings, actor); err != nil {
+		return errors.New("schéma invalide (http ou https)")
+	}
+	return nil
+}
+
+// applyInventory complète la fiche d'inventaire et les champs personnalisés de la tablette avec ceux de la ligne
+func (h *ImportHandler) applyInventory(t repositories.Tablet, l importLine, actor string) error {
+	if len(l.inventory) == 0 {
+		return nil
+	}
+
+	custom := make(map[string]string)
+	for name, value := range l.inventory {
+		switch name {
+		case "location":
+			t.Location = value
+		case "asset_tag":
+			t.AssetTag = value
+		case "serial":
+			t.Serial = value
+		case "owner":
+			t.Owner = value
+		case "install_date":
+			t.InstallDate = value
+		case "notes":
+			t.Notes = value
+		default:
+			custom[name] = value
+		}
+	}
+
+	if err := h.inventory.SaveInventory(&t, custom, actor); err != nil {
+		var fe *services.FieldError
+		if errors.As(err, &fe) {
+			return fmt.Errorf("valeur invalide pour %s", fe.Field)
+		}
+		slog.Error("database error: failed to save tablet inventory", "tablet", t.ID, "err", err)
+		return errors.New("inventaire non enregistré")
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type InventoryHandler struct {
+	inventory  services.InventoryService
+	tabletRepo repositories.TabletRepository
+	fleet      services.FleetViewService
+}
+
+func NewInventoryHandler(inv services.InventoryService, tr repositories.TabletRepository, fs services.FleetViewService) *InventoryHandler {
+	return &InventoryHandler{inventory: inv, tabletRepo: tr, fleet: fs}
+}
+
+// GET /tablets/:id/inventory
+func (h *InventoryHandler) HandleModal(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	tablet, err := h.tabletRepo.GetByID(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Tablet not found")
+	}
+	fields, err := h.inventory.TabletFields(id)
+	if err != nil {
+		slog.Error("database error: failed to fetch custom fields", "tablet", id, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	return ui.InventoryModal(*tablet, fields).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// POST /tablets/:id/inventory
+func (h *InventoryHandler) HandleSave(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	tablet, err := h.tabletRepo.GetByID(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Tablet not found")
+	}
+
+	fail := func(msg string) error {
+		c.Response().Header().Set("HX-Reswap", "none")
+		return ui.Toast(msg, "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	form, err := c.FormParams()
+	if err != nil {
+		return fail("Invalid form")
+	}
+	tablet.TabletInventory = repositories.TabletInventory{
+		Location:    form.Get("location"),
+		AssetTag:    form.Get("asset_tag"),
+		Serial:      form.Get("serial"),
+		Owner:       form.Get("owner"),
+		InstallDate: form.Get("install_date"),
+		Notes:       form.Get("notes"),
+	}
+	custom := make(map[string]string)
+	for key, values := range form {
+		if name, ok := strings.CutPrefix(key, "field."); ok && len(values) > 0 {
+			custom[name] = values[0]
+		}
+	}
+
+	if err := h.inventory.SaveInventory(tablet, custom, adminActor(c)); err != nil {
+		var fe *services.FieldError
+		if errors.As(err, &fe) {
+			return fail("Invalid value for " + fe.Field)
+		}
+		slog.Error("database error: failed to save tablet inventory", "tablet", id, "err", err)
+		return fail("Failed to save the inventory")
+	}
+
+	c.Response().Header().Set("HX-Trigger", "update")
+	return ui.Toast("🏷️ Inventory saved", "success").Render(c.Request().Context(), c.Response().Writer)
+}
+
+// GET /tablets/export.csv
+func (h *InventoryHandler) HandleExport(c echo.Context) error {
+	// L'export reprend le filtre et le tri du tableau de bord, toutes pages confondues
+	tablets, err := h.fleet.Matching(services.ParseFleetFilter(c.QueryParams()))
+	if err != nil {
+		slog.Error("database error: failed to fetch tablets", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+	header, rows, err := h.inventory.Rows(tablets)
+	if err != nil {
+		slog.Error("database error: failed to fetch inventory", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	// Mêmes colonnes que l'import CSV : le fichier peut être modifié puis réimporté
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="tablets.csv"`)
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(c.Response().Writer)
+	w.Write(append([]string{"ip", "name", "host", "port", "timeout"}, header...))
+	for i, t := range tablets {
+		timeout := ""
+		if t.TimeoutSec > 0 {
+			timeout = strconv.Itoa(t.TimeoutSec)
+		}
+		w.Write(append([]string{t.IP, t.Name, t.Host, t.Port, timeout}, rows[i]...))
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func (h *InventoryHandler) renderFields(c echo.Context) error {
+	fields, err := h.inventory.Fields()
+	if err != nil {
+		slog.Error("database error: failed to fetch custom fields", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	data := ui.FieldsData{Fields: fields, Admin: adminActor(c)}
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return ui.FieldsContent(data).Render(c.Request().Context(), c.Response().Writer)
+	}
+	return c.Render(http.StatusOK, "", ui.FieldsPage(data))
+}
+
+// GET /fields
+func (h *InventoryHandler) HandleFields(c echo.Context) error {
+	return h.renderFields(c)
+}
+
+// POST /fields et POST /fields/:id
+func (h *InventoryHandler) HandleSaveField(c echo.Context) error {
+	f := &repositories.CustomField{
+		Name:       c.FormValue("name"),
+		Label:      c.FormValue("label"),
+		Type:       c.FormValue("type"),
+		Options:    c.FormValue("options"),
+		Searchable: c.FormValue("searchable") != "",
+	}
+	if idStr := c.Param("id"); idStr != "" {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Invalid ID")
+		}
+		f.ID = id
+	}
+
+	if err := h.inventory.SaveField(f, adminActor(c)); err != nil {
+		c.Response().Header().Set("HX-Reswap", "none")
+		msg := "Failed to save the field"
+		switch {
+		case errors.Is(err, services.ErrInvalidField):
+			msg = "Invalid field: lowercase name (letters, digits, _), a label, and options for a list"
+		case errors.Is(err, services.ErrFieldNameTaken):
+			msg = "A field with this name already exists"
+		case errors.Is(err, services.ErrFieldNotFound):
+			msg = "Field not found"
+		default:
+			slog.Error("database error: failed to save custom field", "err", err)
+		}
+		return ui.Toast(msg, "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	ui.Toast("Field "+f.Name+" saved", "success").Render(c.Request().Context(), c.Response().Writer)
+	return h.renderFields(c)
+}
+
+// DELETE /fields/:id
+func (h *InventoryHandler) HandleDeleteField(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	if err := h.inventory.DeleteField(id, adminActor(c)); err != nil && !errors.Is(err, services.ErrFieldNotFound) {
+		slog.Error("database error: failed to delete custom field", "field", id, "err", err)
+		c.Response().Header().Set("HX-Reswap", "none")
+		return ui.Toast("Failed to delete the field", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	return h.renderFields(c)
+}
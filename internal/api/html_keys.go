@@ -0,0 +1,191 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type KeysHandler struct {
+	keySvc     services.KioskKeyService
+	tabletRepo repositories.TabletRepository
+	fleetKey   bool
+}
+
+func NewKeysHandler(ks services.KioskKeyService, tr repositories.TabletRepository, fleetKey bool) *KeysHandler {
+	return &KeysHandler{keySvc: ks, tabletRepo: tr, fleetKey: fleetKey}
+}
+
+// renderKeys affiche la page, avec éventuellement des clés déchiffrées dans une fenêtre
+func (h *KeysHandler) renderKeys(c echo.Context, revealed *ui.RevealedKeys) error {
+	statuses, err := h.keySvc.Statuses()
+	if err != nil {
+		slog.Error("database error: failed to fetch tablet keys", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	data := ui.KeysData{Statuses: statuses, FleetKey: h.fleetKey, Admin: adminActor(c), Revealed: revealed}
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return ui.KeysContent(data).Render(c.Request().Context(), c.Response().Writer)
+	}
+	return c.Render(http.StatusOK, "", ui.KeysPage(data))
+}
+
+// GET /keys
+func (h *KeysHandler) HandleKeys(c echo.Context) error {
+	return h.renderKeys(c, nil)
+}
+
+// tablet charge la tablette de l'URL ; en cas d'échec, la réponse d'erreur est déjà écrite
+func (h *KeysHandler) tablet(c echo.Context) (*repositories.Tablet, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	t, err := h.tabletRepo.GetByID(id)
+	if err != nil {
+		return nil, c.String(http.StatusNotFound, "Tablet not found")
+	}
+	return t, nil
+}
+
+// GET /keys/:id/set
+func (h *KeysHandler) HandleSetForm(c echo.Context) error {
+	t, err := h.tablet(c)
+	if t == nil {
+		return err
+	}
+	return ui.KeyFormModal(*t, false).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// GET /keys/:id/rotate
+func (h *KeysHandler) HandleRotateForm(c echo.Context) error {
+	t, err := h.tablet(c)
+	if t == nil {
+		return err
+	}
+	return ui.KeyFormModal(*t, true).Render(c.Request().Context(), c.Response().Writer)
+}
+
+func (h *KeysHandler) fail(c echo.Context, msg string) error {
+	c.Response().Header().Set("HX-Reswap", "none")
+	return ui.Toast(msg, "error").Render(c.Request().Context(), c.Response().Writer)
+}
+
+// POST /keys/:id/set
+func (h *KeysHandler) HandleSet(c echo.Context) error {
+	t, err := h.tablet(c)
+	if t == nil {
+		return err
+	}
+
+	if err := h.keySvc.SetKey(t.ID, c.FormValue("key"), adminActor(c)); err != nil {
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			return h.fail(c, "API keys need at least 16 characters and no spaces")
+		}
+		slog.Error("database error: failed to save tablet key", "tablet", t.ID, "err", err)
+		return h.fail(c, "Failed to save the key")
+	}
+
+	ui.Toast(fmt.Sprintf("🔑 Key saved for %s", t.Name), "success").Render(c.Request().Context(), c.Response().Writer)
+	return h.renderKeys(c, nil)
+}
+
+// DELETE /keys/:id
+func (h *KeysHandler) HandleClear(c echo.Context) error {
+	t, err := h.tablet(c)
+	if t == nil {
+		return err
+	}
+
+	if err := h.keySvc.ClearKey(t.ID, adminActor(c)); err != nil {
+		slog.Error("database error: failed to clear tablet key", "tablet", t.ID, "err", err)
+		return h.fail(c, "Failed to remove the key")
+	}
+	return h.renderKeys(c, nil)
+}
+
+// POST /keys/:id/rotate
+func (h *KeysHandler) HandleRotate(c echo.Context) error {
+	t, err := h.tablet(c)
+	if t == nil {
+		return err
+	}
+
+	key, err := h.keySvc.StartRotation(t.ID, c.FormValue("key"), adminActor(c))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			return h.fail(c, "API keys need at least 16 characters and no spaces")
+		}
+		slog.Error("database error: failed to start key rotation", "tablet", t.ID, "err", err)
+		return h.fail(c, "Failed to start the rotation")
+	}
+
+	return h.renderKeys(c, &ui.RevealedKeys{
+		Title: "New key for " + t.Name,
+		Keys:  []ui.RevealedKey{{Name: t.Name, Next: key}},
+	})
+}
+
+// POST /keys/rotate-all
+func (h *KeysHandler) HandleRotateAll(c echo.Context) error {
+	tablets, err := h.tabletRepo.GetAll()
+	if err != nil {
+		slog.Error("database error: failed to fetch tablets", "err", err)
+		return h.fail(c, "Failed to start the rotation")
+	}
+
+	revealed := &ui.RevealedKeys{Title: "New keys"}
+	for _, t := range tablets {
+		key, err := h.keySvc.StartRotation(t.ID, "", adminActor(c))
+		if err != nil {
+			slog.Error("keys: failed to start rotation", "tablet", t.ID, "err", err)
+			continue
+		}
+		revealed.Keys = append(revealed.Keys, ui.RevealedKey{Name: t.Name, Next: key})
+	}
+	return h.renderKeys(c, revealed)
+}
+
+// POST /keys/:id/cancel
+func (h *KeysHandler) HandleCancel(c echo.Context) error {
+	t, err := h.tablet(c)
+	if t == nil {
+		return err
+	}
+
+	if err := h.keySvc.CancelRotation(t.ID, adminActor(c)); err != nil && !errors.Is(err, services.ErrNoRotation) {
+		slog.Error("database error: failed to cancel key rotation", "tablet", t.ID, "err", err)
+		return h.fail(c, "Failed to cancel the rotation")
+	}
+	return h.renderKeys(c, nil)
+}
+
+// GET /keys/:id/reveal
+func (h *KeysHandler) HandleReveal(c echo.Context) error {
+	t, err := h.tablet(c)
+	if t == nil {
+		return err
+	}
+
+	current, next, err := h.keySvc.Reveal(t.ID, adminActor(c))
+	if err != nil {
+		if errors.Is(err, services.ErrNoTabletKey) {
+			return h.fail(c, "This tablet uses the fleet key")
+		}
+		slog.Error("keys: failed to reveal tablet key", "tablet", t.ID, "err", err)
+		return h.fail(c, "Failed to read the key")
+	}
+	return ui.KeyRevealModal(ui.RevealedKeys{
+		Title: "Keys of " + t.Name,
+		Keys:  []ui.RevealedKey{{Name: t.Name, Current: current, Next: next}},
+	}).Render(c.Request().Context(), c.Response().Writer)
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type LifecycleHandler struct {
+	tabletRepo repositories.TabletRepository
+	lifecycle  services.TabletLifecycleService
+}
+
+func NewLifecycleHandler(tr repositories.TabletRepository, ls services.TabletLifecycleService) *LifecycleHandler {
+	return &LifecycleHandler{tabletRepo: tr, lifecycle: ls}
+}
+
+// GET /tablets/:id/manage
+func (h *LifecycleHandler) HandleModal(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	tablet, err := h.tabletRepo.GetByID(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Tablet not found")
+	}
+	return ui.ManageModal(*tablet).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// respond affiche le résultat d'une action et rafraîchit la page de la tablette
+func (h *LifecycleHandler) respond(c echo.Context, err error, success string) error {
+	if err != nil {
+		c.Response().Header().Set("HX-Reswap", "none")
+		msg := "Action failed"
+		switch {
+		case errors.Is(err, services.ErrTabletNotFound):
+			msg = "Tablet not found"
+		case errors.Is(err, services.ErrInvalidTabletName):
+			msg = "The name must be between 1 and 64 characters"
+		case errors.Is(err, services.ErrInvalidMaintenance):
+			msg = "Maintenance must end in the future, within 7 days"
+		default:
+			slog.Error("database error: tablet lifecycle action failed", "path", c.Path(), "tablet", c.Param("id"), "err", err)
+		}
+		return ui.Toast(msg, "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	c.Response().Header().Set("HX-Trigger", "update")
+	return ui.Toast(success, "success").Render(c.Request().Context(), c.Response().Writer)
+}
+
+// POST /tablets/:id/rename
+func (h *LifecycleHandler) HandleRename(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	return h.respond(c, h.lifecycle.Rename(id, c.FormValue("name"), adminActor(c)), "✏️ Tablet renamed")
+}
+
+// POST /tablets/:id/maintenance
+func (h *LifecycleHandler) HandleMaintenance(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	minutes, err := strconv.Atoi(c.FormValue("duration"))
+	if err != nil {
+		return h.respond(c, services.ErrInvalidMaintenance, "")
+	}
+	until := time.Now().Add(time.Duration(minutes) * time.Minute)
+	return h.respond(c, h.lifecycle.StartMaintenance(id, until, c.FormValue("note"), adminActor(c)), "🔧 Maintenance started")
+}
+
+// POST /tablets/:id/maintenance/end
+func (h *LifecycleHandler) HandleEndMaintenance(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	return h.respond(c, h.lifecycle.EndMaintenance(id, adminActor(c)), "Maintenance ended")
+}
+
+// POST /tablets/:id/retire
+func (h *LifecycleHandler) HandleRetire(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	return h.respond(c, h.lifecycle.Retire(id, adminActor(c)), "📦 Tablet retired")
+}
+
+// POST /tablets/:id/reactivate
+func (h *LifecycleHandler) HandleReactivate(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	return h.respond(c, h.lifecycle.Reactivate(id, adminActor(c)), "Tablet back in service")
+}
+
+// DELETE /tablets/:id
+func (h *LifecycleHandler) HandleDelete(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	if err := h.lifecycle.Delete(id, adminActor(c)); err != nil {
+		return h.respond(c, err, "")
+	}
+	c.Response().Header().Set("HX-Redirect", "/")
+	return c.NoContent(http.StatusOK)
+}
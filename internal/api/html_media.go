@@ -0,0 +1,253 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type MediaHandler struct {
+	mediaService services.MediaService
+	identity     services.DeviceIdentityService
+}
+
+func NewMediaHandler(mes services.MediaService, ids services.DeviceIdentityService) *MediaHandler {
+	return &MediaHandler{mediaService: mes, identity: ids}
+}
+
+func (h *MediaHandler) loadLibrary(collection string) (ui.LibraryData, error) {
+	data := ui.LibraryData{Collection: collection, Collections: services.MediaCollections}
+
+	used, quota, err := h.mediaService.Storage()
+	if err != nil {
+		return data, err
+	}
+	data.Used, data.Quota = used, quota
+
+	media, err := h.mediaService.List(collection)
+	if err != nil {
+		return data, err
+	}
+
+	for _, m := range media {
+		usage, err := h.mediaService.Usage(&m)
+		if err != nil {
+			slog.Warn("data integrity: could not compute media usage", "id", m.ID, "err", err)
+		}
+		access, err := h.mediaService.LastAccess(&m)
+		if err != nil {
+			slog.Warn("database error: could not fetch media access log", "id", m.ID, "err", err)
+		}
+		mediaURL := h.mediaService.URL(&m)
+		// Copiée depuis la bibliothèque, l'URL n'est liée à aucune tablette : seule son expiration la borne
+		data.Items = append(data.Items, ui.LibraryItem{
+			Media:     m,
+			URL:       mediaURL,
+			SignedURL: h.mediaService.SignURL(mediaURL, 0),
+			Usage:     usage,
+			Access:    access,
+		})
+	}
+	return data, nil
+}
+
+// GET /library
+func (h *MediaHandler) HandleLibrary(c echo.Context) error {
+	data, err := h.loadLibrary(c.QueryParam("collection"))
+	if err != nil {
+		slog.Error("database error: failed to fetch media", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return ui.LibraryContent(data).Render(c.Request().Context(), c.Response().Writer)
+	}
+	return c.Render(http.StatusOK, "", ui.LibraryPage(data))
+}
+
+// POST /library/upload
+func (h *MediaHandler) HandleUpload(c echo.Context) error {
+	c.Response().Header().Set("HX-Reswap", "none")
+
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["files"]) == 0 {
+		return ui.Toast("No file selected", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	uploaded := 0
+	for _, file := range form.File["files"] {
+		src, err := file.Open()
+		if err != nil {
+			ui.Toast(fmt.Sprintf("❌ %s: unreadable", file.Filename), "error").Render(c.Request().Context(), c.Response().Writer)
+			continue
+		}
+
+		m, err := h.mediaService.Upload(file.Filename, src, services.UploadOptions{
+			Uploader: c.RealIP(),
+			Tags:     c.FormValue("tags"),
+		})
+		src.Close()
+
+		switch {
+		case errors.Is(err, services.ErrMediaDuplicate):
+			ui.Toast(fmt.Sprintf("⚠️ %s is already in the library as %s", file.Filename, m.Name), "error").Render(c.Request().Context(), c.Response().Writer)
+		case err != nil:
+			slog.Error("media upload failed", "file", file.Filename, "err", err)
+			ui.Toast(fmt.Sprintf("❌ %s: %s", file.Filename, err.Error()), "error").Render(c.Request().Context(), c.Response().Writer)
+		default:
+			uploaded++
+		}
+	}
+
+	if uploaded == 0 {
+		return nil
+	}
+
+	c.Response().Header().Del("HX-Reswap")
+	ui.Toast(fmt.Sprintf("✅ %d file(s) added to the library", uploaded), "success").Render(c.Request().Context(), c.Response().Writer)
+	return h.HandleLibrary(c)
+}
+
+// GET /library/:id/edit
+func (h *MediaHandler) HandleEdit(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	m, err := h.mediaService.Get(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Media not found")
+	}
+	return c.Render(http.StatusOK, "", ui.MediaEditModal(*m))
+}
+
+// POST /library/:id
+func (h *MediaHandler) HandleUpdate(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	if err := h.mediaService.Update(id, c.FormValue("name"), c.FormValue("tags")); err != nil {
+		slog.Error("database error: failed to update media", "id", id, "err", err)
+		c.Response().Header().Set("HX-Reswap", "none")
+		return ui.Toast("Failed to save media", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	slog.Info("resource updated: media modified", "id", id)
+	ui.Toast("✅ Media updated", "success").Render(c.Request().Context(), c.Response().Writer)
+	return h.HandleLibrary(c)
+}
+
+// DELETE /library/:id?force=1
+func (h *MediaHandler) HandleDelete(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	err = h.mediaService.Delete(id, c.QueryParam("force") == "1")
+	if err != nil {
+		c.Response().Header().Set("HX-Reswap", "none")
+		if errors.Is(err, services.ErrMediaInUse) {
+			return ui.Toast("This file is still referenced — use “Delete anyway” to force", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+		slog.Error("database error: failed to delete media", "id", id, "err", err)
+		return ui.Toast("Deletion failed", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// POST /library/scrub
+func (h *MediaHandler) HandleScrub(c echo.Context) error {
+	report, err := h.mediaService.Scrub()
+	if err != nil {
+		slog.Error("media scrub failed", "err", err)
+		c.Response().Header().Set("HX-Reswap", "none")
+		return ui.Toast("Scrub failed: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	level := "success"
+	if report.Missing > 0 || report.Corrupt > 0 {
+		level = "error"
+	}
+	ui.Toast("🧹 "+report.String(), level).Render(c.Request().Context(), c.Response().Writer)
+	return h.HandleLibrary(c)
+}
+
+// GET /media/:dir/:file
+// Les URLs générées par le hub portent ?v=<empreinte> : tant que l'empreinte correspond, le fichier ne
+// change jamais et les tablettes peuvent le garder en cache. Sans elle, le client revalide via l'ETag.
+func (h *MediaHandler) HandleServe(c echo.Context) error {
+	// Adresse réelle de la connexion : les tablettes joignent le hub directement, et un en-tête
+	// X-Real-Ip ne doit pas suffire à se faire passer pour une autre tablette
+	ip := echo.ExtractIPDirect()(c.Request())
+
+	tabletID, err := h.mediaService.VerifyURL(c.Param("dir"), c.Param("file"), c.QueryParams())
+	if err != nil {
+		slog.Warn("media: rejected request", "path", c.Request().URL.Path, "ip", ip, "err", err)
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	// L'adresse de la tablette peut avoir changé, ou passer par un nom d'hôte ou le tailnet
+	if tabletID > 0 && !h.identity.IsDevice(c.Request().Context(), tabletID, ip) {
+		slog.Warn("media: signed URL presented by another device", "path", c.Request().URL.Path, "ip", ip, "tablet", tabletID)
+		return echo.NewHTTPError(http.StatusForbidden, "media_url_bound_to_another_tablet")
+	}
+
+	m, err := h.mediaService.Resolve(c.Param("dir"), c.Param("file"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Media not found")
+	}
+
+	req := c.Request()
+	ranged := req.Header.Get("Range") != ""
+	path, encoding := h.mediaService.Variant(m, req.Header.Get("Accept-Encoding"), ranged)
+
+	f, err := os.Open(path)
+	if err != nil {
+		slog.Warn("data integrity: media file unreadable", "id", m.ID, "path", path, "err", err)
+		return echo.NewHTTPError(http.StatusNotFound, "Media not found")
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	header := c.Response().Header()
+	header.Set("Content-Type", m.MimeType)
+	header.Set("Vary", "Accept-Encoding")
+	etag := m.SHA256
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+		etag += "-" + encoding
+	}
+	header.Set("ETag", `"`+etag+`"`)
+
+	// Seule la version exacte émise par URL() rend la réponse immuable : un préfixe quelconque ne suffit pas
+	if v := c.QueryParam("v"); v != "" && v == services.MediaVersion(m) {
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		header.Set("Cache-Control", "no-cache")
+	}
+
+	http.ServeContent(c.Response(), req, m.FileName, info.ModTime(), f)
+
+	// Une reprise de lecture (Range qui ne part pas du début) n'est pas un nouveau téléchargement
+	if req.Method == http.MethodGet && (!ranged || strings.HasPrefix(req.Header.Get("Range"), "bytes=0-")) {
+		h.mediaService.LogAccess(m, ip, c.Response().Status, c.Response().Size)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type PresetHandler struct {
+	presetRepo    repositories.PresetRepository
+	presetService services.PresetService
+}
+
+func NewPresetHandler(pr repositories.PresetRepository, ps services.PresetService) *PresetHandler {
+	return &PresetHandler{presetRepo: pr, presetService: ps}
+}
+
+// GET /presets
+func (h *PresetHandler) HandlePresets(c echo.Context) error {
+	presets, err := h.presetRepo.GetAll()
+	if err != nil {
+		slog.Error("database error: failed to fetch presets", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	usage, err := h.presetService.Usage()
+	if err != nil {
+		slog.Warn("data integrity: could not compute preset usage", "err", err)
+		usage = map[int64][]repositories.Tablet{}
+	}
+
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return ui.PresetsContent(presets, usage).Render(c.Request().Context(), c.Response().Writer)
+	}
+	return c.Render(http.StatusOK, "", ui.PresetsPage(presets, usage))
+}
+
+// GET /presets/new
+func (h *PresetHandler) HandleNewPreset(c echo.Context) error {
+	return c.Render(http.StatusOK, "", ui.PresetFormModal(&repositories.Preset{}))
+}
+
+// GET /presets/edit/:id
+func (h *PresetHandler) HandleEditPreset(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	preset, err := h.presetRepo.GetByID(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Preset not found")
+	}
+	return c.Render(http.StatusOK, "", ui.PresetFormModal(preset))
+}
+
+// POST /presets/save
+func (h *PresetHandler) HandleSavePreset(c echo.Context) error {
+	id, _ := strconv.ParseInt(c.FormValue("id"), 10, 64)
+
+	// En cas d'erreur on ne remplace pas la page, seul le toast s'affiche
+	c.Response().Header().Set("HX-Reswap", "none")
+
+	presetURL, err := parseKioskURL(strings.TrimSpace(c.FormValue("url")))
+	if err != nil {
+		return ui.Toast(err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	title := strings.TrimSpace(c.FormValue("title"))
+	if title == "" {
+		return ui.Toast("Title is required", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	preset := &repositories.Preset{
+		ID:        id,
+		Title:     title,
+		URL:       presetURL,
+		Tags:      strings.Join(repositories.Preset{Tags: c.FormValue("tags")}.TagList(), ","),
+		Thumbnail: strings.TrimSpace(c.FormValue("thumbnail")),
+	}
+
+	if preset.ID == 0 {
+		_, err = h.presetRepo.Create(preset)
+		slog.Info("resource created: new preset added", "title", preset.Title)
+	} else {
+		err = h.presetRepo.Update(preset)
+		slog.Info("resource updated: preset modified", "id", preset.ID, "title", preset.Title)
+	}
+	if err != nil {
+		slog.Error("database error: failed to save preset", "err", err, "title", preset.Title)
+		return ui.Toast("Failed to save preset", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	// L'enregistrement n'est pas bloqué : on prévient simplement si l'URL ne répond pas
+	if err := h.presetService.Check(preset); err != nil {
+		slog.Error("database error: failed to store preset check", "id", preset.ID, "err", err)
+	}
+	c.Response().Header().Del("HX-Reswap")
+	if !preset.Reachable {
+		ui.Toast(fmt.Sprintf("⚠️ %s saved, but unreachable from the hub: %s", preset.Title, preset.CheckError), "error").Render(c.Request().Context(), c.Response().Writer)
+	} else {
+		ui.Toast(fmt.Sprintf("✅ %s saved", preset.Title), "success").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	return h.HandlePresets(c)
+}
+
+// DELETE /presets/:id
+func (h *PresetHandler) HandleDeletePreset(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	if err := h.presetRepo.Delete(id); err != nil {
+		slog.Error("database error: failed to delete preset", "id", id, "err", err)
+		return c.String(http.StatusInternalServerError, "Deletion failed")
+	}
+
+	slog.Info("resource deleted: preset removed", "id", id)
+	return c.NoContent(http.StatusOK)
+}
+
+// POST /presets/:id/check
+func (h *PresetHandler) HandleCheckPreset(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	preset, err := h.presetRepo.GetByID(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Preset not found")
+	}
+
+	if err := h.presetService.Check(preset); err != nil {
+		slog.Error("database error: failed to store preset check", "id", id, "err", err)
+	}
+
+	return ui.PresetReachability(*preset).Render(c.Request().Context(), c.Response().Writer)
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RemoteHandler struct {
+	tabletRepo repositories.TabletRepository
+	groupRepo  repositories.GroupRepository
+	remoteSvc  services.RemoteService
+}
+
+func NewRemoteHandler(tr repositories.TabletRepository, gr repositories.GroupRepository, rs services.RemoteService) *RemoteHandler {
+	return &RemoteHandler{tabletRepo: tr, groupRepo: gr, remoteSvc: rs}
+}
+
+// GET /tablets/:id/remote
+func (h *RemoteHandler) HandleModal(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	tablet, err := h.tabletRepo.GetByID(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Tablet not found")
+	}
+	apps, err := h.remoteSvc.Apps(id)
+	if err != nil {
+		slog.Error("database error: failed to fetch tablet apps", "tablet", id, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	return ui.RemoteModal(ui.RemoteData{TabletID: id, TabletName: tablet.Name, Apps: apps}).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// POST /tablets/:id/remote/:action
+func (h *RemoteHandler) HandleKey(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return ui.Toast("invalid tablet id", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	action := c.Param("action")
+	report, err := h.remoteSvc.Send(id, action, c.RealIP())
+	if errors.Is(err, services.ErrInvalidRemoteAction) {
+		return ui.Toast("Unknown remote action: "+action, "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	if err != nil {
+		return ui.Toast("Error: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	// Pas de toast à chaque touche : seuls les échecs sont signalés
+	for _, res := range report.Results {
+		if !res.Executed {
+			ui.Toast(fmt.Sprintf("❌ %s: %s failed", res.Name, action), "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+	}
+	return nil
+}
+
+// POST /tablets/:id/apps/:app/launch
+func (h *RemoteHandler) HandleLaunch(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return ui.Toast("invalid tablet id", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	appID, err := strconv.ParseInt(c.Param("app"), 10, 64)
+	if err != nil {
+		return ui.Toast("invalid app id", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	report, app, err := h.remoteSvc.Launch(id, appID, c.RealIP())
+	if errors.Is(err, services.ErrAppNotFound) {
+		return ui.Toast("This app is not available on this tablet", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	if err != nil {
+		return ui.Toast("Error: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	for _, res := range report.Results {
+		if res.Executed {
+			ui.Toast(fmt.Sprintf("🚀 %s: %s launched", res.Name, app.Label), "success").Render(c.Request().Context(), c.Response().Writer)
+		} else {
+			ui.Toast(fmt.Sprintf("❌ %s: failed to launch %s", res.Name, app.Label), "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+	}
+	return nil
+}
+
+func (h *RemoteHandler) renderGroupApps(c echo.Context, groupID int64) error {
+	apps, err := h.remoteSvc.GroupApps(groupID)
+	if err != nil {
+		slog.Error("database error: failed to fetch group apps", "group", groupID, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+	return ui.GroupAppList(groupID, apps).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// GET /groups/:id/apps
+func (h *RemoteHandler) HandleGroupApps(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	group, err := h.groupRepo.GetByID(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Group not found")
+	}
+	apps, err := h.remoteSvc.GroupApps(id)
+	if err != nil {
+		slog.Error("database error: failed to fetch group apps", "group", id, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	return ui.GroupAppsModal(*group, apps).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// POST /groups/:id/apps
+func (h *RemoteHandler) HandleAddApp(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	app := &repositories.GroupApp{GroupID: id, Label: c.FormValue("label"), Package: c.FormValue("package")}
+	if err := h.remoteSvc.AddApp(app, c.RealIP()); err != nil {
+		c.Response().Header().Set("HX-Reswap", "none")
+		switch {
+		case errors.Is(err, services.ErrInvalidPackage):
+			return ui.Toast("Invalid package name, e.g. com.example.app", "error").Render(c.Request().Context(), c.Response().Writer)
+		case errors.Is(err, services.ErrDuplicateApp):
+			return ui.Toast("This app is already in the group", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+		slog.Error("database error: failed to add group app", "group", id, "err", err)
+		return ui.Toast("Failed to add app", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	return h.renderGroupApps(c, id)
+}
+
+// DELETE /groups/:id/apps/:app
+func (h *RemoteHandler) HandleDeleteApp(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	appID, err := strconv.ParseInt(c.Param("app"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	if err := h.remoteSvc.DeleteApp(appID, c.RealIP()); err != nil && !errors.Is(err, services.ErrAppNotFound) {
+		slog.Error("database error: failed to delete group app", "app", appID, "err", err)
+		c.Response().Header().Set("HX-Reswap", "none")
+		return ui.Toast("Failed to remove app", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	return h.renderGroupApps(c, id)
+}
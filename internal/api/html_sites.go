@@ -0,0 +1,264 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SiteHandler struct {
+	siteRepo    repositories.SiteRepository
+	tabletRepo  repositories.TabletRepository
+	groupRepo   repositories.GroupRepository
+	siteService services.SiteService
+	kService    services.KioskService
+}
+
+func NewSiteHandler(sr repositories.SiteRepository, tr repositories.TabletRepository, gr repositories.GroupRepository, ss services.SiteService, ks services.KioskService) *SiteHandler {
+	return &SiteHandler{siteRepo: sr, tabletRepo: tr, groupRepo: gr, siteService: ss, kService: ks}
+}
+
+func (h *SiteHandler) loadViews() ([]ui.SiteView, error) {
+	sites, err := h.siteRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]ui.SiteView, 0, len(sites))
+	for _, site := range sites {
+		versions, err := h.siteRepo.GetVersions(site.ID)
+		if err != nil {
+			return nil, err
+		}
+		viewers, err := h.siteService.Viewers(site.Slug)
+		if err != nil {
+			slog.Warn("data integrity: could not compute site viewers", "site", site.Slug, "err", err)
+		}
+		view := ui.SiteView{Site: site, Versions: versions, Viewers: viewers}
+		if site.CurrentVersion > 0 {
+			view.URL = h.siteService.VersionURL(site.Slug, site.CurrentVersion)
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// GET /sites
+func (h *SiteHandler) HandleSites(c echo.Context) error {
+	views, err := h.loadViews()
+	if err != nil {
+		slog.Error("database error: failed to fetch sites", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+	groups, _ := h.groupRepo.GetAll()
+
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return ui.SitesContent(views, groups).Render(c.Request().Context(), c.Response().Writer)
+	}
+	return c.Render(http.StatusOK, "", ui.SitesPage(views, groups))
+}
+
+// uploadArchive lit le zip du formulaire et l'extrait en nouvelle version du site
+func (h *SiteHandler) uploadArchive(c echo.Context, siteID int64) (*repositories.SiteVersion, error) {
+	file, err := c.FormFile("archive")
+	if err != nil {
+		return nil, fmt.Errorf("zip archive is required")
+	}
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	return h.siteService.UploadVersion(siteID, src, file.Size, strings.TrimSpace(c.FormValue("note")))
+}
+
+// POST /sites
+func (h *SiteHandler) HandleCreateSite(c echo.Context) error {
+	c.Response().Header().Set("HX-Reswap", "none")
+
+	site, err := h.siteService.Create(c.FormValue("name"))
+	if err != nil {
+		slog.Error("database error: failed to create site", "err", err)
+		return ui.Toast("Could not create site: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	v, err := h.uploadArchive(c, site.ID)
+	if err != nil {
+		// Un site sans version n'a aucun intérêt : on annule la création
+		_ = h.siteService.Delete(site.ID, c.RealIP())
+		return ui.Toast("Upload failed: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	if _, err := h.siteService.Activate(site.ID, v.Version, c.RealIP()); err != nil {
+		return ui.Toast("Activation failed: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	slog.Info("resource created: new site added", "slug", site.Slug)
+	c.Response().Header().Del("HX-Reswap")
+	ui.Toast(fmt.Sprintf("✅ %s published (v%d)", site.Name, v.Version), "success").Render(c.Request().Context(), c.Response().Writer)
+	return h.HandleSites(c)
+}
+
+// POST /sites/:id/upload
+func (h *SiteHandler) HandleUploadVersion(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	c.Response().Header().Set("HX-Reswap", "none")
+	v, err := h.uploadArchive(c, id)
+	if err != nil {
+		slog.Error("site upload failed", "site_id", id, "err", err)
+		return ui.Toast("Upload failed: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	c.Response().Header().Del("HX-Reswap")
+	ui.Toast(fmt.Sprintf("📦 Version v%d uploaded (%d files) — activate it to go live", v.Version, v.Files), "success").Render(c.Request().Context(), c.Response().Writer)
+	return h.HandleSites(c)
+}
+
+// POST /sites/:id/activate/:version
+func (h *SiteHandler) HandleActivate(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid version")
+	}
+
+	report, err := h.siteService.Activate(id, version, c.RealIP())
+	return h.renderSwitch(c, fmt.Sprintf("v%d activated", version), report, err)
+}
+
+// POST /sites/:id/rollback
+func (h *SiteHandler) HandleRollback(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	report, err := h.siteService.Rollback(id, c.RealIP())
+	return h.renderSwitch(c, "Rolled back", report, err)
+}
+
+func (h *SiteHandler) renderSwitch(c echo.Context, label string, report *services.ActionReport, err error) error {
+	if err != nil {
+		c.Response().Header().Set("HX-Reswap", "none")
+		switch {
+		case errors.Is(err, services.ErrNoPrevVersion):
+			return ui.Toast("No previous version to roll back to", "error").Render(c.Request().Context(), c.Response().Writer)
+		case errors.Is(err, services.ErrSiteNotFound), errors.Is(err, services.ErrVersionNotFound):
+			return ui.Toast("Site or version not found", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+		slog.Error("site switch failed", "err", err)
+		return ui.Toast("Error: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	for _, res := range report.Results {
+		if !res.Executed {
+			ui.Toast(fmt.Sprintf("❌ %s: %s", res.Name, res.Error), "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+	}
+	ui.Toast(fmt.Sprintf("✅ %s — %s", label, report.Summary), "success").Render(c.Request().Context(), c.Response().Writer)
+	return h.HandleSites(c)
+}
+
+// POST /sites/:id/push : affiche la version courante sur un groupe (ou toute la flotte)
+func (h *SiteHandler) HandlePush(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	site, err := h.siteRepo.GetByID(id)
+	if err != nil || site.CurrentVersion == 0 {
+		return ui.Toast("Site not found or not published", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	groupID, _ := strconv.ParseInt(c.FormValue("group_id"), 10, 64)
+	target := services.Target{GroupID: groupID}
+	if groupID == 0 {
+		tablets, err := h.tabletRepo.GetAll()
+		if err != nil || len(tablets) == 0 {
+			return ui.Toast("No tablet to push to", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+		for _, t := range tablets {
+			target.TabletIDs = append(target.TabletIDs, t.ID)
+		}
+	}
+
+	return renderNavigate(c, h.kService, target, h.siteService.VersionURL(site.Slug, site.CurrentVersion))
+}
+
+// DELETE /sites/:id
+func (h *SiteHandler) HandleDeleteSite(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	if err := h.siteService.Delete(id, c.RealIP()); err != nil {
+		slog.Error("database error: failed to delete site", "id", id, "err", err)
+		return c.String(http.StatusInternalServerError, "Deletion failed")
+	}
+
+	slog.Info("resource deleted: site removed", "id", id)
+	return c.NoContent(http.StatusOK)
+}
+
+// GET /sites/:slug/:version/* : sert les fichiers statiques aux tablettes.
+// :version vaut "v<N>" (immuable, cache long) ou "current" (toujours la version active).
+func (h *SiteHandler) HandleServe(c echo.Context) error {
+	site, err := h.siteRepo.GetBySlug(c.Param("slug"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	raw := c.Param("version")
+	version := site.CurrentVersion
+	immutable := false
+	if raw != "current" {
+		n, err := strconv.Atoi(strings.TrimPrefix(raw, "v"))
+		if err != nil || !strings.HasPrefix(raw, "v") {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		version, immutable = n, true
+	}
+	if version == 0 {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	// "/sites/x/v1" sans slash final casserait les chemins relatifs de la page
+	if c.Param("*") == "" && !strings.HasSuffix(c.Request().URL.Path, "/") {
+		return c.Redirect(http.StatusMovedPermanently, c.Request().URL.Path+"/")
+	}
+
+	rel := path.Clean("/" + c.Param("*"))
+	file := filepath.Join(h.siteService.Dir(site.Slug, version), filepath.FromSlash(rel))
+	if info, err := os.Stat(file); err == nil && info.IsDir() {
+		file = filepath.Join(file, "index.html")
+	}
+
+	if immutable {
+		c.Response().Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Response().Header().Set("Cache-Control", "no-cache")
+	}
+	return c.File(file)
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Nombre de photos affichées dans la galerie d'une tablette
+const snapshotGallerySize = 48
+
+type SnapshotHandler struct {
+	snapService  services.SnapshotService
+	mediaService services.MediaService
+	retention    services.SnapshotRetention
+}
+
+func NewSnapshotHandler(ss services.SnapshotService, mes services.MediaService, retention services.SnapshotRetention) *SnapshotHandler {
+	return &SnapshotHandler{snapService: ss, mediaService: mes, retention: retention}
+}
+
+func (h *SnapshotHandler) items(tabletID int64) ([]ui.SnapshotItem, error) {
+	snaps, err := h.snapService.List(tabletID, snapshotGallerySize)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]ui.SnapshotItem, 0, len(snaps))
+	for _, snap := range snaps {
+		m, err := h.snapService.Photo(snap)
+		if err != nil {
+			continue
+		}
+		items = append(items, ui.SnapshotItem{Snapshot: snap, URL: h.mediaService.SignURL(h.mediaService.URL(m), 0)})
+	}
+	return items, nil
+}
+
+func (h *SnapshotHandler) retentionLabel() string {
+	var parts []string
+	if h.retention.PerTablet > 0 {
+		parts = append(parts, fmt.Sprintf("last %d", h.retention.PerTablet))
+	}
+	if h.retention.Days > 0 {
+		parts = append(parts, fmt.Sprintf("%d days", h.retention.Days))
+	}
+	if len(parts) == 0 {
+		return "Snapshots are kept until deleted"
+	}
+	return "Kept: " + strings.Join(parts, ", ")
+}
+
+func (h *SnapshotHandler) renderGallery(c echo.Context, tabletID int64) error {
+	items, err := h.items(tabletID)
+	if err != nil {
+		slog.Error("database error: failed to fetch snapshots", "tablet", tabletID, "err", err)
+		return ui.Toast("Failed to load snapshots", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	return ui.SnapshotGallery(tabletID, items).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// GET /tablets/:id/snapshots
+func (h *SnapshotHandler) HandleModal(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	items, err := h.items(id)
+	if err != nil {
+		slog.Error("database error: failed to fetch snapshots", "tablet", id, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+	schedule, err := h.snapService.GetSchedule(id)
+	if err != nil {
+		slog.Error("database error: failed to fetch snapshot schedule", "tablet", id, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	return ui.SnapshotModal(ui.SnapshotData{
+		TabletID:  id,
+		Items:     items,
+		Schedule:  *schedule,
+		Retention: h.retentionLabel(),
+	}).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// POST /tablets/:id/snapshots
+func (h *SnapshotHandler) HandleCapture(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	if _, err := h.snapService.Capture(id, c.FormValue("camera"), "manual", c.RealIP()); err != nil {
+		c.Response().Header().Set("HX-Reswap", "none")
+		switch {
+		case errors.Is(err, services.ErrSnapshotBusy):
+			return ui.Toast("A snapshot is already being taken on this tablet", "error").Render(c.Request().Context(), c.Response().Writer)
+		case errors.Is(err, services.ErrInvalidCamera):
+			return ui.Toast("Unknown camera", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+		slog.Error("snapshot: capture failed", "tablet", id, "err", err)
+		return ui.Toast("Snapshot failed: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	return h.renderGallery(c, id)
+}
+
+// DELETE /tablets/:id/snapshots/:sid
+func (h *SnapshotHandler) HandleDelete(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	sid, err := strconv.ParseInt(c.Param("sid"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	if err := h.snapService.Delete(sid, c.RealIP()); err != nil && !errors.Is(err, services.ErrSnapshotNotFound) {
+		slog.Error("snapshot: delete failed", "id", sid, "err", err)
+		c.Response().Header().Set("HX-Reswap", "none")
+		return ui.Toast("Failed to delete snapshot", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	return h.renderGallery(c, id)
+}
+
+// POST /tablets/:id/snapshots/schedule
+func (h *SnapshotHandler) HandleSchedule(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	interval, _ := strconv.Atoi(c.FormValue("interval"))
+	schedule := &repositories.SnapshotSchedule{
+		TabletID:        id,
+		Camera:          c.FormValue("camera"),
+		IntervalMinutes: max(interval, 0),
+		Enabled:         interval > 0,
+	}
+	if err := h.snapService.SaveSchedule(schedule); err != nil {
+		slog.Error("snapshot: failed to save schedule", "tablet", id, "err", err)
+		return ui.Toast("Failed to save schedule", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	msg := "Periodic snapshots disabled"
+	if schedule.Enabled {
+		msg = fmt.Sprintf("📸 %s camera every %d min", schedule.Camera, schedule.IntervalMinutes)
+	}
+	return ui.Toast(msg, "success").Render(c.Request().Context(), c.Response().Writer)
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Exécutions affichées dans l'historique
+const snippetRunHistory = 20
+
+type SnippetHandler struct {
+	snippetSvc services.SnippetService
+	tabletRepo repositories.TabletRepository
+	groupRepo  repositories.GroupRepository
+}
+
+func NewSnippetHandler(ss services.SnippetService, tr repositories.TabletRepository, gr repositories.GroupRepository) *SnippetHandler {
+	return &SnippetHandler{snippetSvc: ss, tabletRepo: tr, groupRepo: gr}
+}
+
+// GET /snippets
+func (h *SnippetHandler) HandleSnippets(c echo.Context) error {
+	snippets, err := h.snippetSvc.List()
+	if err != nil {
+		slog.Error("database error: failed to fetch snippets", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+	runs, err := h.snippetSvc.Runs(snippetRunHistory)
+	if err != nil {
+		slog.Error("database error: failed to fetch snippet runs", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	data := ui.SnippetsData{Snippets: snippets, Runs: runs, Admin: adminActor(c)}
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return ui.SnippetsContent(data).Render(c.Request().Context(), c.Response().Writer)
+	}
+	return c.Render(http.StatusOK, "", ui.SnippetsPage(data))
+}
+
+// GET /snippets/new
+func (h *SnippetHandler) HandleNew(c echo.Context) error {
+	return ui.SnippetFormModal(repositories.Snippet{}).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// GET /snippets/:id/edit
+func (h *SnippetHandler) HandleEdit(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	snippet, err := h.snippetSvc.Get(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Snippet not found")
+	}
+	return ui.SnippetFormModal(*snippet).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// POST /snippets/save
+func (h *SnippetHandler) HandleSave(c echo.Context) error {
+	c.Response().Header().Set("HX-Reswap", "none")
+
+	id, _ := strconv.ParseInt(c.FormValue("id"), 10, 64)
+	snippet := &repositories.Snippet{
+		ID:          id,
+		Name:        c.FormValue("name"),
+		Description: strings.TrimSpace(c.FormValue("description")),
+		Code:        c.FormValue("code"),
+		Params:      c.FormValue("params"),
+	}
+
+	if err := h.snippetSvc.Save(snippet, adminActor(c)); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidSnippet):
+			return ui.Toast("Name and code are required", "error").Render(c.Request().Context(), c.Response().Writer)
+		case errors.Is(err, services.ErrInvalidParamName):
+			return ui.Toast("Parameter names may only contain letters, digits and _", "error").Render(c.Request().Context(), c.Response().Writer)
+		case errors.Is(err, services.ErrDuplicateSnippet):
+			return ui.Toast("A snippet with this name already exists", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+		slog.Error("database error: failed to save snippet", "name", snippet.Name, "err", err)
+		return ui.Toast("Failed to save snippet", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	c.Response().Header().Del("HX-Reswap")
+	ui.Toast(fmt.Sprintf("✅ %s saved", snippet.Name), "success").Render(c.Request().Context(), c.Response().Writer)
+	return h.HandleSnippets(c)
+}
+
+// DELETE /snippets/:id
+func (h *SnippetHandler) HandleDelete(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	if err := h.snippetSvc.Delete(id, adminActor(c)); err != nil && !errors.Is(err, services.ErrSnippetNotFound) {
+		slog.Error("database error: failed to delete snippet", "id", id, "err", err)
+		c.Response().Header().Set("HX-Reswap", "none")
+		return ui.Toast("Failed to delete snippet", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// GET /snippets/:id/run
+func (h *SnippetHandler) HandleRunModal(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	snippet, err := h.snippetSvc.Get(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Snippet not found")
+	}
+	tablets, _ := h.tabletRepo.GetAll()
+	groups, _ := h.groupRepo.GetAll()
+	return ui.SnippetRunModal(*snippet, tablets, groups).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// parseTarget lit "tablet:<id>" ou "group:<id>" et renvoie la cible avec son nom pour l'historique
+func (h *SnippetHandler) parseTarget(v string) (services.Target, string, error) {
+	kind, idStr, _ := strings.Cut(v, ":")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return services.Target{}, "", services.ErrInvalidTarget
+	}
+	switch kind {
+	case "tablet":
+		t, err := h.tabletRepo.GetByID(id)
+		if err != nil {
+			return services.Target{}, "", services.ErrTabletNotFound
+		}
+		return services.Target{TabletID: id}, t.Name, nil
+	case "group":
+		g, err := h.groupRepo.GetByID(id)
+		if err != nil {
+			return services.Target{}, "", services.ErrGroupNotFound
+		}
+		return services.Target{GroupID: id}, "group " + g.Name, nil
+	}
+	return services.Target{}, "", services.ErrInvalidTarget
+}
+
+// POST /snippets/:id/run
+func (h *SnippetHandler) HandleRun(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	target, label, err := h.parseTarget(c.FormValue("target"))
+	if err != nil {
+		c.Response().Header().Set("HX-Reswap", "none")
+		return ui.Toast("Pick a tablet or a group", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	form, _ := c.FormParams()
+	values := make(map[string]string)
+	for key, v := range form {
+		if name, ok := strings.CutPrefix(key, "param_"); ok && len(v) > 0 {
+			values[name] = v[0]
+		}
+	}
+
+	run, err := h.snippetSvc.Run(id, values, target, label, adminActor(c))
+	if err != nil {
+		c.Response().Header().Set("HX-Reswap", "none")
+		switch {
+		case errors.Is(err, services.ErrSnippetNotFound):
+			return ui.Toast("Snippet not found", "error").Render(c.Request().Context(), c.Response().Writer)
+		case errors.Is(err, services.ErrTabletNotFound), errors.Is(err, services.ErrGroupNotFound):
+			return ui.Toast("Target not found", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+		slog.Error("snippets: run failed", "snippet", id, "err", err)
+		return ui.Toast("Error: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	return ui.SnippetRunResult(*run, services.RunResults(*run)).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// GET /snippets/runs/:run
+func (h *SnippetHandler) HandleRunDetails(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("run"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	run, err := h.snippetSvc.GetRun(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Run not found")
+	}
+	return ui.SnippetRunDetailsModal(*run, services.RunResults(*run)).Render(c.Request().Context(), c.Response().Writer)
+}
@@ -1,8 +1,8 @@
 package api
 
 import (
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -19,12 +19,17 @@ type HtmlTabletHandler struct {
 	tabletRepo   repositories.TabletRepository
 	reportRepo   repositories.ReportRepository
 	groupRepo    repositories.GroupRepository
+	presetRepo   repositories.PresetRepository
 	kService     services.KioskService
 	mediaService services.MediaService
+	ttsService   services.TTSService
+	tamperSvc    services.TamperService
+	tlsSvc       services.KioskTLSService
+	inventory    services.InventoryService
 }
 
-func NewHtmlTabletHandler(tr repositories.TabletRepository, rr repositories.ReportRepository, gr repositories.GroupRepository, ks services.KioskService, mes services.MediaService) *HtmlTabletHandler {
-	return &HtmlTabletHandler{tabletRepo: tr, reportRepo: rr, groupRepo: gr, kService: ks, mediaService: mes}
+func NewHtmlTabletHandler(tr repositories.TabletRepository, rr repositories.ReportRepository, gr repositories.GroupRepository, pr repositories.PresetRepository, ks services.KioskService, mes services.MediaService, tts services.TTSService, tamper services.TamperService, ts services.KioskTLSService, inv services.InventoryService) *HtmlTabletHandler {
+	return &HtmlTabletHandler{tabletRepo: tr, reportRepo: rr, groupRepo: gr, presetRepo: pr, kService: ks, mediaService: mes, ttsService: tts, tamperSvc: tamper, tlsSvc: ts, inventory: inv}
 }
 
 func (h *HtmlTabletHandler) HandleDetails(c echo.Context) error {
@@ -45,10 +50,16 @@ func (h *HtmlTabletHandler) HandleDetails(c echo.Context) error {
 
 	groups, _ := h.groupRepo.GetGroupsByTablet(id)
 
+	fields, _ := h.inventory.TabletFields(id)
+
 	td := models.TabletDisplay{
 		Tablet:     *tablet,
 		LastReport: lastReport,
 		Groups:     groups,
+
+		TamperAlerts: h.tamperSvc.OpenCount(id),
+		Plaintext:    h.tlsSvc.Plaintext(id),
+		Fields:       fields,
 	}
 
 	if c.Request().Header.Get("HX-Request") != "true" {
@@ -136,11 +147,15 @@ func (h *HtmlTabletHandler) HandleNavigateModal(c echo.Context) error {
 	idParam := c.Param("id")
 	id, _ := strconv.ParseInt(idParam, 10, 64)
 
-	// On peut optionnellement récupérer l'URL actuelle depuis la DB/Cache
-	// pour pré-remplir l'input
+	// On pré-remplit l'input avec l'URL remontée par le dernier rapport
 	currentURL := ""
+	if last, err := h.reportRepo.GetLatestByTablet(id, true); err == nil {
+		currentURL = last.CurrentURL
+	}
+
+	presets, _ := h.presetRepo.GetAll()
 
-	return ui.NavigateModal(id, currentURL).Render(c.Request().Context(), c.Response().Writer)
+	return ui.NavigateModal(fmt.Sprintf("/tablets/%d/command/navigate", id), currentURL, presets).Render(c.Request().Context(), c.Response().Writer)
 }
 
 func (h *HtmlTabletHandler) HandleNavigate(c echo.Context) error {
@@ -150,25 +165,39 @@ func (h *HtmlTabletHandler) HandleNavigate(c echo.Context) error {
 		return ui.Toast("Invalid tablet ID", "error").Render(c.Request().Context(), c.Response().Writer)
 	}
 
-	newURL := c.FormValue("url")
-	if newURL == "" {
-		return ui.Toast("URL cannot be empty", "error").Render(c.Request().Context(), c.Response().Writer)
+	newURL, err := parseKioskURL(c.FormValue("url"))
+	if err != nil {
+		return ui.Toast(err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
 	}
 
-	parsedURL, err := url.ParseRequestURI(newURL)
+	return renderNavigate(c, h.kService, services.Target{TabletID: id}, newURL)
+}
+
+// parseKioskURL valide une URL destinée à la webview d'un kiosque
+func parseKioskURL(raw string) (string, error) {
+	if raw == "" {
+		return "", fmt.Errorf("URL cannot be empty")
+	}
+
+	parsedURL, err := url.ParseRequestURI(raw)
 	if err != nil {
-		return ui.Toast("Invalid URL format", "error").Render(c.Request().Context(), c.Response().Writer)
+		return "", fmt.Errorf("Invalid URL format")
 	}
 
 	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return ui.Toast("Forbidden protocol: Use HTTP or HTTPS", "error").Render(c.Request().Context(), c.Response().Writer)
+		return "", fmt.Errorf("Forbidden protocol: Use HTTP or HTTPS")
 	}
+	return parsedURL.String(), nil
+}
 
-	report, err := h.kService.Navigate(services.Target{TabletID: id}, parsedURL.String())
+// renderNavigate envoie l'URL à la cible et écrit un toast par tablette
+func renderNavigate(c echo.Context, ks services.KioskService, t services.Target, newURL string) error {
+	report, err := ks.Navigate(t, newURL)
 	if err != nil {
 		return ui.Toast("Error: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
 	}
 
+	c.Response().Header().Set("HX-Trigger", "update")
 	for _, res := range report.Results {
 		if res.Executed {
 			ui.Toast(fmt.Sprintf("🌐 %s: URL updated!", res.Name), "success").Render(c.Request().Context(), c.Response().Writer)
@@ -176,7 +205,6 @@ func (h *HtmlTabletHandler) HandleNavigate(c echo.Context) error {
 			ui.Toast(fmt.Sprintf("❌ %s: Update failed", res.Name), "error").Render(c.Request().Context(), c.Response().Writer)
 		}
 	}
-	c.Response().Header().Set("HX-Trigger", "update")
 	return nil
 }
 
@@ -277,7 +305,7 @@ func (h *HtmlTabletHandler) HandleScreenSaver(c echo.Context) error {
 
 func (h *HtmlTabletHandler) HandleSoundModal(c echo.Context) error {
 	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
-	sounds, err := h.mediaService.List()
+	sounds, err := h.mediaService.Sounds()
 	if err != nil {
 		return ui.Toast("Impossible de charger la bibliothèque", "error").Render(c.Request().Context(), c.Response().Writer)
 	}
@@ -298,12 +326,14 @@ func (h *HtmlTabletHandler) HandleUploadSound(c echo.Context) error {
 	}
 	defer src.Close()
 
-	_, err = h.mediaService.Upload(file.Filename, src.(io.ReadSeeker))
-	if err != nil {
+	m, err := h.mediaService.Upload(file.Filename, src, services.UploadOptions{Collection: "audio", Uploader: c.RealIP()})
+	if errors.Is(err, services.ErrMediaDuplicate) {
+		ui.Toast(fmt.Sprintf("Déjà présent dans la bibliothèque : %s", m.Name), "error").Render(c.Request().Context(), c.Response().Writer)
+	} else if err != nil {
 		return ui.Toast(err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
 	}
 
-	sounds, _ := h.mediaService.List()
+	sounds, _ := h.mediaService.Sounds()
 
 	return ui.TabSoundList(sounds, id).Render(c.Request().Context(), c.Response().Writer)
 }
@@ -352,7 +382,8 @@ func (h *HtmlTabletHandler) HandleStopSound(c echo.Context) error {
 	return nil
 }
 
-func (h *HtmlTabletHandler) HandleGtslTTSSound(c echo.Context) error {
+// POST /tablets/:id/command/tts
+func (h *HtmlTabletHandler) HandleTTS(c echo.Context) error {
 	// 1. Get Tablet ID from URL
 	idParam := c.Param("id")
 	id, err := strconv.ParseInt(idParam, 10, 64)
@@ -379,11 +410,7 @@ func (h *HtmlTabletHandler) HandleGtslTTSSound(c echo.Context) error {
 		volume = 100 // Default volume
 	}
 
-	safeText := url.QueryEscape(text)
-	safeLang := url.QueryEscape(lang)
-	ttsURL := fmt.Sprintf("https://translate.google.com/translate_tts?ie=UTF-8&tl=%s&client=tw-ob&q=%s", safeLang, safeText)
-
-	report, err := h.kService.PlayAudio(services.Target{TabletID: id}, ttsURL, loop, volume)
+	report, err := h.ttsService.Announce(services.Target{TabletID: id}, text, c.FormValue("voice"), lang, loop, volume)
 	if err != nil {
 		return ui.Toast("Service Error: "+err.Error(), "error").Render(c.Request().Context(), c.Response().Writer)
 	}
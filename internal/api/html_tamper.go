@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type TamperHandler struct {
+	tamperSvc services.TamperService
+	cfg       services.TamperConfig
+}
+
+func NewTamperHandler(ts services.TamperService, cfg services.TamperConfig) *TamperHandler {
+	return &TamperHandler{tamperSvc: ts, cfg: cfg}
+}
+
+// GET /tamper
+func (h *TamperHandler) HandleTamper(c echo.Context) error {
+	events, err := h.tamperSvc.Events(100)
+	if err != nil {
+		slog.Error("database error: failed to fetch tamper events", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	data := ui.TamperData{Events: events, Angle: h.cfg.AngleDeg, Camera: h.cfg.Camera}
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return ui.TamperContent(data).Render(c.Request().Context(), c.Response().Writer)
+	}
+	return c.Render(http.StatusOK, "", ui.TamperPage(data))
+}
+
+// POST /tamper/:id/ack (?relearn=true pour accepter la nouvelle position)
+func (h *TamperHandler) HandleAcknowledge(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	relearn := c.QueryParam("relearn") == "true"
+	if err := h.tamperSvc.Acknowledge(id, c.RealIP(), relearn); err != nil {
+		c.Response().Header().Set("HX-Reswap", "none")
+		if errors.Is(err, services.ErrTamperEventNotFound) {
+			return ui.Toast("Alert not found", "error").Render(c.Request().Context(), c.Response().Writer)
+		}
+		slog.Error("tamper: acknowledge failed", "id", id, "err", err)
+		return ui.Toast("Failed to acknowledge alert", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	e, err := h.tamperSvc.Event(id)
+	if err != nil {
+		return c.NoContent(http.StatusOK)
+	}
+	return ui.TamperEventRow(*e).Render(c.Request().Context(), c.Response().Writer)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type TabletTLSHandler struct {
+	tabletRepo repositories.TabletRepository
+	tlsSvc     services.KioskTLSService
+	connSvc    services.KioskConnectionService
+}
+
+func NewTabletTLSHandler(tr repositories.TabletRepository, ts services.KioskTLSService, cs services.KioskConnectionService) *TabletTLSHandler {
+	return &TabletTLSHandler{tabletRepo: tr, tlsSvc: ts, connSvc: cs}
+}
+
+// GET /tablets/:id/tls
+func (h *TabletTLSHandler) HandleModal(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	tablet, err := h.tabletRepo.GetByID(id)
+	if err != nil {
+		return c.String(http.StatusNotFound, "Tablet not found")
+	}
+	settings, err := h.tlsSvc.Settings(id)
+	if err != nil {
+		slog.Error("database error: failed to fetch tablet TLS settings", "tablet", id, "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	return ui.TabletTLSModal(*tablet, *settings).Render(c.Request().Context(), c.Response().Writer)
+}
+
+// POST /tablets/:id/tls
+func (h *TabletTLSHandler) HandleSave(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	fail := func(msg string) error {
+		c.Response().Header().Set("HX-Reswap", "none")
+		return ui.Toast(msg, "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+
+	timeout := 0
+	if v := c.FormValue("timeout"); v != "" {
+		if timeout, err = strconv.Atoi(v); err != nil {
+			return fail("The timeout must be a number of seconds")
+		}
+	}
+	conn := &repositories.Tablet{
+		ID:         id,
+		Host:       c.FormValue("host"),
+		Port:       c.FormValue("port"),
+		TimeoutSec: timeout,
+		KeySource:  c.FormValue("key_source"),
+	}
+	if err := h.connSvc.Save(conn, adminActor(c)); err != nil {
+		if errors.Is(err, services.ErrInvalidConnection) {
+			return fail("Invalid host, port (1-65535) or timeout (0-300 s)")
+		}
+		slog.Error("database error: failed to save tablet connection", "tablet", id, "err", err)
+		return fail("Failed to save connection settings")
+	}
+
+	settings := &repositories.TabletTLS{
+		TabletID:   id,
+		Scheme:     c.FormValue("scheme"),
+		Verify:     c.FormValue("verify"),
+		CAPEM:      c.FormValue("ca_pem"),
+		ClientCert: c.FormValue("client_cert") != "",
+	}
+	if err := h.tlsSvc.Save(settings, adminActor(c)); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidCAPEM):
+			return fail("Paste at least one PEM certificate for the pinned CA")
+		case errors.Is(err, services.ErrInvalidTLSSettings):
+			return fail("Invalid scheme or verification mode")
+		}
+		slog.Error("database error: failed to save tablet TLS settings", "tablet", id, "err", err)
+		return fail("Failed to save connection settings")
+	}
+
+	msg := "🔒 HTTPS enabled (" + settings.Verify + ")"
+	if settings.Scheme == "http" {
+		msg = "⚠️ Tablet reached over plaintext HTTP"
+	}
+	return ui.Toast(msg, "success").Render(c.Request().Context(), c.Response().Writer)
+}
+
+// POST /tablets/:id/tls/forget
+func (h *TabletTLSHandler) HandleForget(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+
+	c.Response().Header().Set("HX-Reswap", "none")
+	if err := h.tlsSvc.ForgetFingerprint(id, adminActor(c)); err != nil {
+		slog.Error("database error: failed to forget tablet fingerprint", "tablet", id, "err", err)
+		return ui.Toast("Failed to forget the fingerprint", "error").Render(c.Request().Context(), c.Response().Writer)
+	}
+	return ui.Toast("Fingerprint forgotten: the next certificate presented will be pinned", "success").Render(c.Request().Context(), c.Response().Writer)
+}
+
+// GET /tls/ca.pem
+func (h *TabletTLSHandler) HandleCACert(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="freekiosk-hub-ca.pem"`)
+	return c.Blob(http.StatusOK, "application/x-pem-file", h.tlsSvc.CACertPEM())
+}
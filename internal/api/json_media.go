@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MediaJSONHandler expose l'envoi par morceaux utilisé par le navigateur pour les gros fichiers
+type MediaJSONHandler struct {
+	mediaService services.MediaService
+}
+
+func NewMediaJSONHandler(mes services.MediaService) *MediaJSONHandler {
+	return &MediaJSONHandler{mediaService: mes}
+}
+
+// UploadResponse renvoie l'état de la session et, une fois le fichier complet, le média créé
+type UploadResponse struct {
+	*services.UploadSession
+	Done  bool                `json:"done"`
+	Media *repositories.Media `json:"media,omitempty"`
+	Error string              `json:"error,omitempty"`
+}
+
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrUploadOffset), errors.Is(err, services.ErrMediaDuplicate):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrFileTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, services.ErrChecksumMismatch), errors.Is(err, services.ErrUnsupportedMedia):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// POST /library/uploads
+func (h *MediaJSONHandler) HandleStartUpload(c echo.Context) error {
+	size, err := strconv.ParseInt(c.FormValue("size"), 10, 64)
+	if err != nil || c.FormValue("name") == "" {
+		return c.JSON(http.StatusBadRequest, UploadResponse{Error: "name and size are required"})
+	}
+
+	session, err := h.mediaService.StartUpload(c.FormValue("name"), size, services.UploadOptions{
+		Uploader: c.RealIP(),
+		Tags:     c.FormValue("tags"),
+		SHA256:   c.FormValue("sha256"),
+	})
+	if err != nil {
+		return c.JSON(uploadErrorStatus(err), UploadResponse{Error: err.Error()})
+	}
+	return c.JSON(http.StatusCreated, UploadResponse{UploadSession: session})
+}
+
+// GET /library/uploads/:id : point de reprise après une coupure
+func (h *MediaJSONHandler) HandleUploadStatus(c echo.Context) error {
+	session, err := h.mediaService.GetUpload(c.Param("id"))
+	if err != nil {
+		return c.JSON(uploadErrorStatus(err), UploadResponse{Error: err.Error()})
+	}
+	return c.JSON(http.StatusOK, UploadResponse{UploadSession: session})
+}
+
+// PUT /library/uploads/:id?offset=N : le corps de la requête est le morceau brut
+func (h *MediaJSONHandler) HandleUploadChunk(c echo.Context) error {
+	offset, err := strconv.ParseInt(c.QueryParam("offset"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, UploadResponse{Error: "invalid offset"})
+	}
+
+	session, err := h.mediaService.WriteChunk(c.Param("id"), offset, c.Request().Body)
+	if err != nil {
+		return c.JSON(uploadErrorStatus(err), UploadResponse{UploadSession: session, Error: err.Error()})
+	}
+	if session.Received < session.Size {
+		return c.JSON(http.StatusOK, UploadResponse{UploadSession: session})
+	}
+
+	m, err := h.mediaService.CompleteUpload(session.ID)
+	if err != nil {
+		slog.Error("media upload failed", "file", session.Name, "err", err)
+		return c.JSON(uploadErrorStatus(err), UploadResponse{UploadSession: session, Done: true, Media: m, Error: err.Error()})
+	}
+	return c.JSON(http.StatusOK, UploadResponse{UploadSession: session, Done: true, Media: m})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/internal/sse"
+
+	"github.com/labstack/echo/v4"
+)
+
+type MetricsHandler struct {
+	tabletRepo repositories.TabletRepository
+	reportRepo repositories.ReportRepository
+	inventory  services.InventoryService
+}
+
+func NewMetricsHandler(tr repositories.TabletRepository, rr repositories.ReportRepository, inv services.InventoryService) *MetricsHandler {
+	return &MetricsHandler{tabletRepo: tr, reportRepo: rr, inventory: inv}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promLabels écrit les labels d'une tablette au format d'exposition Prometheus
+func promLabels(t repositories.Tablet, inventory map[string]string) string {
+	labels := []string{
+		fmt.Sprintf(`tablet_id="%d"`, t.ID),
+		fmt.Sprintf(`name="%s"`, labelEscaper.Replace(t.Name)),
+		fmt.Sprintf(`ip="%s"`, labelEscaper.Replace(t.IP)),
+	}
+	names := make([]string, 0, len(inventory))
+	for name := range inventory {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(inventory[name])))
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// GET /metrics
+// Chaque série porte les labels d'inventaire de la tablette (emplacement, n° d'inventaire, champs personnalisés)
+func (h *MetricsHandler) HandleMetrics(c echo.Context) error {
+	tablets, err := h.tabletRepo.GetAll()
+	if err != nil {
+		slog.Error("database error: failed to fetch tablets", "err", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Internal Server Error")
+	}
+	reports, _ := h.reportRepo.GetLatestAll(true)
+	latest := make(map[int64]repositories.TabletReport, len(reports))
+	for _, r := range reports {
+		latest[r.TabletID] = r
+	}
+	labels := h.inventory.Labels(tablets)
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	w := c.Response().Writer
+
+	metric := func(name, help, kind string, value func(t repositories.Tablet) (float64, bool)) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, t := range tablets {
+			if v, ok := value(t); ok {
+				fmt.Fprintf(w, "%s%s %s\n", name, promLabels(t, labels[t.ID]), strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		}
+	}
+
+	metric("freekiosk_tablet_info", "Tablet inventory, always 1.", "gauge", func(t repositories.Tablet) (float64, bool) {
+		return 1, true
+	})
+	metric("freekiosk_tablet_online", "Whether the tablet answered its last poll.", "gauge", func(t repositories.Tablet) (float64, bool) {
+		if t.Online {
+			return 1, true
+		}
+		return 0, true
+	})
+	metric("freekiosk_tablet_last_seen_timestamp_seconds", "Last time the tablet answered a poll.", "gauge", func(t repositories.Tablet) (float64, bool) {
+		return float64(t.LastSeen.Unix()), !t.LastSeen.IsZero()
+	})
+	metric("freekiosk_tablet_battery_percent", "Battery level from the last successful report.", "gauge", func(t repositories.Tablet) (float64, bool) {
+		r, ok := latest[t.ID]
+		return float64(r.BatteryLevel), ok
+	})
+	metric("freekiosk_tablet_wifi_signal_dbm", "WiFi signal strength from the last successful report.", "gauge", func(t repositories.Tablet) (float64, bool) {
+		r, ok := latest[t.ID]
+		return float64(r.WifiSignalStrength), ok && r.WifiConnected
+	})
+
+	// Compteurs du flux temps réel, sans étiquette de tablette
+	stats := sse.Instance.Stats()
+	hubMetric := func(name, help, kind string, v uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, v)
+	}
+	hubMetric("freekiosk_sse_subscribers", "Open event stream connections.", "gauge", uint64(stats.Subscribers))
+	hubMetric("freekiosk_sse_events_published_total", "Events published to the event hub.", "counter", stats.Published)
+	hubMetric("freekiosk_sse_events_dropped_total", "Events dropped for subscribers that fell behind.", "counter", stats.Dropped)
+	hubMetric("freekiosk_sse_events_replayed_total", "Events replayed to clients reconnecting with Last-Event-ID.", "counter", stats.Replayed)
+	return nil
+}
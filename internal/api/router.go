@@ -4,7 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
-	"strconv"
+	"net/http"
 	"strings"
 
 	"github.com/wared2003/freekiosk-hub/internal/clients"
@@ -24,10 +24,31 @@ type ApiServer struct {
 	TabletRepo   repositories.TabletRepository
 	ReportRepo   repositories.ReportRepository
 	GroupRepo    repositories.GroupRepository
+	AuditRepo    repositories.AuditRepository
+	EmergRepo    repositories.EmergencyRepository
+	PresetRepo   repositories.PresetRepository
+	SiteRepo     repositories.SiteRepository
+	AnnRepo      repositories.AnnouncementRepository
+	SnapRepo     repositories.SnapshotRepository
+	TamperRepo   repositories.TamperRepository
+	BrightRepo   repositories.BrightnessRepository
+	AppRepo      repositories.AppRepository
+	SnippetRepo  repositories.SnippetRepository
 	MonitorSvc   services.MonitorService
 	KioskClient  clients.KioskClient
 	Cfg          config.Config
 	MediaService services.MediaService
+	KioskTLS     services.KioskTLSService
+	KioskKeys    services.KioskKeyService
+	KioskConns   services.KioskConnectionService
+
+	CustomFieldRepo repositories.CustomFieldRepository
+	DeviceIdentity  services.DeviceIdentityService
+	ViewRepo        repositories.DashboardViewRepository
+
+	// Créés avec les routes ; leurs planificateurs sont lancés par main avec le contexte du serveur
+	AnnouncementSvc services.AnnouncementService
+	SnapshotSvc     services.SnapshotService
 }
 
 // NewRouter initialise le serveur, les handlers et les routes
@@ -35,10 +56,26 @@ func NewRouter(e *echo.Echo, db *sql.DB,
 	tr repositories.TabletRepository,
 	rr repositories.ReportRepository,
 	gr repositories.GroupRepository,
+	ar repositories.AuditRepository,
+	er repositories.EmergencyRepository,
+	pr repositories.PresetRepository,
+	sr repositories.SiteRepository,
+	anr repositories.AnnouncementRepository,
+	snr repositories.SnapshotRepository,
+	tmr repositories.TamperRepository,
+	brr repositories.BrightnessRepository,
+	apr repositories.AppRepository,
+	spr repositories.SnippetRepository,
 	ms services.MonitorService,
 	ks clients.KioskClient,
 	cfg config.Config,
 	mes services.MediaService,
+	kts services.KioskTLSService,
+	kks services.KioskKeyService,
+	kcs services.KioskConnectionService,
+	cfr repositories.CustomFieldRepository,
+	dis services.DeviceIdentityService,
+	vr repositories.DashboardViewRepository,
 
 ) *ApiServer {
 	s := &ApiServer{
@@ -47,10 +84,27 @@ func NewRouter(e *echo.Echo, db *sql.DB,
 		TabletRepo:   tr,
 		ReportRepo:   rr,
 		GroupRepo:    gr,
+		AuditRepo:    ar,
+		EmergRepo:    er,
+		PresetRepo:   pr,
+		SiteRepo:     sr,
+		AnnRepo:      anr,
+		SnapRepo:     snr,
+		TamperRepo:   tmr,
+		BrightRepo:   brr,
+		AppRepo:      apr,
+		SnippetRepo:  spr,
 		MonitorSvc:   ms,
 		KioskClient:  ks,
 		Cfg:          cfg,
 		MediaService: mes,
+		KioskTLS:     kts,
+		KioskKeys:    kks,
+		KioskConns:   kcs,
+
+		CustomFieldRepo: cfr,
+		DeviceIdentity:  dis,
+		ViewRepo:        vr,
 	}
 
 	s.setupMiddlewares()
@@ -69,7 +123,7 @@ func (s *ApiServer) setupMiddlewares() {
 		LogError:    true,
 		LogRemoteIP: true,
 		Skipper: func(c echo.Context) bool {
-			return strings.Contains(c.Path(), "/sse")
+			return strings.Contains(c.Path(), "/sse") || c.Path() == "/api/v1/events"
 		},
 		HandleError: true, // Pour que les erreurs passent aussi par ici
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
@@ -101,20 +155,83 @@ func (s *ApiServer) setupMiddlewares() {
 
 func (s *ApiServer) setupRoutes() {
 
-	kService := services.NewKioskService(s.TabletRepo, s.GroupRepo, s.KioskClient, s.Cfg.KioskPort)
+	kService := services.NewKioskService(s.TabletRepo, s.GroupRepo, s.KioskClient, s.Cfg.KioskPort, s.MediaService)
+
+	// L'inventaire sert aux exports, aux métriques et aux alertes
+	inventoryService := services.NewInventoryService(s.CustomFieldRepo, s.TabletRepo, s.AuditRepo)
+	fleetService := services.NewFleetViewService(s.TabletRepo, s.ReportRepo, s.GroupRepo, s.ViewRepo, s.AuditRepo, s.KioskTLS)
+	inventoryH := NewInventoryHandler(inventoryService, s.TabletRepo, fleetService)
+	metricsH := NewMetricsHandler(s.TabletRepo, s.ReportRepo, inventoryService)
+
+	homeH := NewHtmlHomeHandler(fleetService)
+	ttsService := services.NewTTSService(services.TTSConfig{
+		Engine:    s.Cfg.TTSEngine,
+		Binary:    s.Cfg.TTSBinary,
+		Voice:     s.Cfg.TTSVoice,
+		ModelsDir: s.Cfg.TTSModelsDir,
+	}, s.MediaService, kService)
+	snapRetention := services.SnapshotRetention{Days: s.Cfg.SnapshotRetentionDays, PerTablet: s.Cfg.SnapshotMaxPerTablet}
+	s.SnapshotSvc = services.NewSnapshotService(s.SnapRepo, s.TabletRepo, s.AuditRepo, kService, s.MediaService, snapRetention)
+	snapshotH := NewSnapshotHandler(s.SnapshotSvc, s.MediaService, snapRetention)
+
+	// La détection d'effraction analyse chaque rapport du moniteur
+	tamperCfg := services.TamperConfig{
+		AngleDeg:     float64(s.Cfg.TamperAngle),
+		WatchNetwork: s.Cfg.TamperWatchNetwork,
+		Camera:       s.Cfg.TamperCamera,
+	}
+	tamperService := services.NewTamperService(s.TamperRepo, s.AuditRepo, s.SnapshotSvc, inventoryService, tamperCfg)
+	s.MonitorSvc.AddObserver(tamperService)
+	tamperH := NewTamperHandler(tamperService, tamperCfg)
+
+	// Les politiques de luminosité sont réévaluées à chaque rapport
+	brightnessService := services.NewBrightnessService(s.BrightRepo, s.AuditRepo, kService)
+	s.MonitorSvc.AddObserver(brightnessService)
+	brightnessH := NewBrightnessHandler(s.GroupRepo, brightnessService)
+
+	remoteService := services.NewRemoteService(s.AppRepo, s.AuditRepo, kService)
+	remoteH := NewRemoteHandler(s.TabletRepo, s.GroupRepo, remoteService)
+
+	snippetService := services.NewSnippetService(s.SnippetRepo, s.AuditRepo, kService)
+	snippetH := NewSnippetHandler(snippetService, s.TabletRepo, s.GroupRepo)
+
+	tabletH := NewHtmlTabletHandler(s.TabletRepo, s.ReportRepo, s.GroupRepo, s.PresetRepo, kService, s.MediaService, ttsService, tamperService, s.KioskTLS, inventoryService)
+	groupH := NewGroupHandler(s.GroupRepo, s.PresetRepo, kService)
+
+	presetService := services.NewPresetService(s.PresetRepo, s.TabletRepo, s.ReportRepo, s.MediaService)
+	presetH := NewPresetHandler(s.PresetRepo, presetService)
+
+	emService := services.NewEmergencyService(s.EmergRepo, s.TabletRepo, s.ReportRepo, s.GroupRepo, s.AuditRepo, kService, s.Cfg.BaseURL)
+	emergencyH := NewEmergencyHandler(emService, s.GroupRepo, s.AuditRepo, s.MediaService)
+
+	siteService := services.NewSiteService(s.SiteRepo, s.TabletRepo, s.ReportRepo, s.AuditRepo, kService, s.Cfg.MediaDir, s.Cfg.BaseURL)
+	siteH := NewSiteHandler(s.SiteRepo, s.TabletRepo, s.GroupRepo, siteService, kService)
 
-	homeH := NewHtmlHomeHandler(s.TabletRepo, s.ReportRepo, s.GroupRepo)
-	tabletH := NewHtmlTabletHandler(s.TabletRepo, s.ReportRepo, s.GroupRepo, kService, s.MediaService)
-	groupH := NewGroupHandler(s.GroupRepo)
+	s.AnnouncementSvc = services.NewAnnouncementService(s.AnnRepo, s.ReportRepo, s.EmergRepo, s.AuditRepo, kService, ttsService, s.MediaService)
+	announcementH := NewAnnouncementHandler(s.AnnRepo, s.AnnouncementSvc, s.GroupRepo, s.AuditRepo, s.MediaService, ttsService)
+
+	mediaH := NewMediaHandler(s.MediaService, s.DeviceIdentity)
+	mediaJsonH := NewMediaJSONHandler(s.MediaService)
 
 	systemJsonH := NewSystemJSONHandler(s.DB)
 
 	// --- 2. ROUTES PUBLIQUES / SYSTÈME ---
 	s.Echo.GET("/health", systemJsonH.HandleHealthCheck)
+	s.Echo.GET("/metrics", metricsH.HandleMetrics)
 
 	s.Echo.GET("/", homeH.HandleIndex)
+	s.Echo.POST("/views", homeH.HandleSaveView)
+	s.Echo.DELETE("/views/:id", homeH.HandleDeleteView)
+	tlsH := NewTabletTLSHandler(s.TabletRepo, s.KioskTLS, s.KioskConns)
+	identityH := NewIdentityHandler(s.TabletRepo, s.DeviceIdentity)
+	lifecycleH := NewLifecycleHandler(s.TabletRepo, services.NewTabletLifecycleService(s.TabletRepo, s.AuditRepo))
+	keysH := NewKeysHandler(s.KioskKeys, s.TabletRepo, s.Cfg.KioskApiKey != "")
+	importH := NewImportHandler(s.TabletRepo, s.KioskKeys, s.KioskConns, s.KioskTLS, inventoryService)
+	s.Echo.GET("/tls/ca.pem", tlsH.HandleCACert)
+
 	tablets := s.Echo.Group("/tablets")
 	{
+		tablets.GET("/export.csv", inventoryH.HandleExport)
 		tablets.GET("/:id", tabletH.HandleDetails)
 		tablets.GET("/:id/groups-selection", groupH.HandleTabletGroupsSelection)
 		tablets.POST("/:tabletID/groups/:groupID/toggle", groupH.HandleToggleGroup)
@@ -134,9 +251,40 @@ func (s *ApiServer) setupRoutes() {
 		//e.DELETE("/sound/:filename", tabletH.HandleDeleteSound)
 
 		tablets.POST("/:id/command/play-sound", tabletH.HandlePlaySound)
-		tablets.POST("/:id/command/gtsl-tts", tabletH.HandleGtslTTSSound)
+		tablets.POST("/:id/command/tts", tabletH.HandleTTS)
 		tablets.POST("/:id/command/stop-sound", tabletH.HandleStopSound)
 
+		tablets.GET("/:id/snapshots", snapshotH.HandleModal)
+		tablets.POST("/:id/snapshots", snapshotH.HandleCapture)
+		tablets.DELETE("/:id/snapshots/:sid", snapshotH.HandleDelete)
+		tablets.POST("/:id/snapshots/schedule", snapshotH.HandleSchedule)
+
+		// Le profil de connexion décide où part la clé de la tablette : changer d'hôte, repasser en HTTP
+		// ou oublier l'empreinte épinglée est réservé aux administrateurs
+		tablets.GET("/:id/tls", tlsH.HandleModal, requireAdmin(s.Cfg.AdminUsers))
+		tablets.POST("/:id/tls", tlsH.HandleSave, requireAdmin(s.Cfg.AdminUsers))
+		tablets.POST("/:id/tls/forget", tlsH.HandleForget, requireAdmin(s.Cfg.AdminUsers))
+
+		tablets.GET("/:id/inventory", inventoryH.HandleModal)
+		tablets.POST("/:id/inventory", inventoryH.HandleSave)
+
+		// La fusion supprime un enregistrement : réservée aux administrateurs
+		tablets.GET("/:id/identity", identityH.HandleModal)
+		tablets.POST("/:id/identity/forget", identityH.HandleForget, requireAdmin(s.Cfg.AdminUsers))
+		tablets.POST("/:id/merge", identityH.HandleMerge, requireAdmin(s.Cfg.AdminUsers))
+
+		tablets.GET("/:id/manage", lifecycleH.HandleModal)
+		tablets.POST("/:id/rename", lifecycleH.HandleRename)
+		tablets.POST("/:id/maintenance", lifecycleH.HandleMaintenance)
+		tablets.POST("/:id/maintenance/end", lifecycleH.HandleEndMaintenance)
+		tablets.POST("/:id/retire", lifecycleH.HandleRetire)
+		tablets.POST("/:id/reactivate", lifecycleH.HandleReactivate)
+		tablets.DELETE("/:id", lifecycleH.HandleDelete, requireAdmin(s.Cfg.AdminUsers))
+
+		tablets.GET("/:id/remote", remoteH.HandleModal)
+		tablets.POST("/:id/remote/:action", remoteH.HandleKey)
+		tablets.POST("/:id/apps/:app/launch", remoteH.HandleLaunch)
+
 	}
 
 	groupRoutes := s.Echo.Group("/groups")
@@ -146,9 +294,130 @@ func (s *ApiServer) setupRoutes() {
 		groupRoutes.GET("/edit/:id", groupH.HandleEditGroup)
 		groupRoutes.POST("/save", groupH.HandleSaveGroup)
 		groupRoutes.DELETE("/:id", groupH.HandleDeleteGroup)
+		groupRoutes.GET("/:id/navigate-modal", groupH.HandleGroupNavigateModal)
+		groupRoutes.POST("/:id/command/navigate", groupH.HandleGroupNavigate)
+		groupRoutes.GET("/:id/brightness", brightnessH.HandleModal)
+		groupRoutes.POST("/:id/brightness", brightnessH.HandleSave)
+		groupRoutes.GET("/:id/apps", remoteH.HandleGroupApps)
+		groupRoutes.POST("/:id/apps", remoteH.HandleAddApp)
+		groupRoutes.DELETE("/:id/apps/:app", remoteH.HandleDeleteApp)
+	}
+
+	presetRoutes := s.Echo.Group("/presets")
+	{
+		presetRoutes.GET("", presetH.HandlePresets)
+		presetRoutes.GET("/new", presetH.HandleNewPreset)
+		presetRoutes.GET("/edit/:id", presetH.HandleEditPreset)
+		presetRoutes.POST("/save", presetH.HandleSavePreset)
+		presetRoutes.DELETE("/:id", presetH.HandleDeletePreset)
+		presetRoutes.POST("/:id/check", presetH.HandleCheckPreset)
+	}
+
+	emergencyRoutes := s.Echo.Group("/emergency")
+	{
+		emergencyRoutes.GET("", emergencyH.HandleEmergency)
+		emergencyRoutes.POST("/trigger", emergencyH.HandleTrigger)
+		emergencyRoutes.POST("/clear", emergencyH.HandleAllClear)
+		emergencyRoutes.GET("/banner", emergencyH.HandleBanner)
+		emergencyRoutes.GET("/page", emergencyH.HandleAlertPage)
 	}
 
-	// s.Echo.GET("/admin/import", adminPageH.HandleImportPage)
+	libraryRoutes := s.Echo.Group("/library")
+	{
+		libraryRoutes.GET("", mediaH.HandleLibrary)
+		// Les envois directs restent bornés par la taille max d'un fichier ; les gros fichiers passent par les morceaux
+		libraryRoutes.POST("/upload", mediaH.HandleUpload, middleware.BodyLimit(fmt.Sprintf("%dM", s.Cfg.MediaMaxFile>>20+1)))
+		libraryRoutes.POST("/uploads", mediaJsonH.HandleStartUpload)
+		libraryRoutes.GET("/uploads/:id", mediaJsonH.HandleUploadStatus)
+		libraryRoutes.PUT("/uploads/:id", mediaJsonH.HandleUploadChunk, middleware.BodyLimit("64M"))
+		libraryRoutes.POST("/scrub", mediaH.HandleScrub)
+		libraryRoutes.GET("/:id/edit", mediaH.HandleEdit)
+		libraryRoutes.POST("/:id", mediaH.HandleUpdate)
+		libraryRoutes.DELETE("/:id", mediaH.HandleDelete)
+	}
+
+	// Fichiers servis aux tablettes (Range, ETag, variantes compressées, journal d'accès)
+	mediaRoutes := s.Echo.Group("/media")
+	{
+		mediaRoutes.GET("/:dir/:file", mediaH.HandleServe)
+		mediaRoutes.HEAD("/:dir/:file", mediaH.HandleServe)
+	}
+
+	tamperRoutes := s.Echo.Group("/tamper")
+	{
+		tamperRoutes.GET("", tamperH.HandleTamper)
+		tamperRoutes.POST("/:id/ack", tamperH.HandleAcknowledge)
+	}
+
+	announcementRoutes := s.Echo.Group("/announcements")
+	{
+		announcementRoutes.GET("", announcementH.HandleAnnouncements)
+		announcementRoutes.GET("/new", announcementH.HandleNew)
+		announcementRoutes.GET("/:id/edit", announcementH.HandleEdit)
+		announcementRoutes.POST("/save", announcementH.HandleSave)
+		announcementRoutes.DELETE("/:id", announcementH.HandleDelete)
+		announcementRoutes.POST("/:id/play", announcementH.HandlePlay)
+		announcementRoutes.GET("/runs", announcementH.HandleRuns)
+		announcementRoutes.POST("/runs/:run/stop", announcementH.HandleStop)
+		announcementRoutes.POST("/:id/schedules", announcementH.HandleAddSchedule)
+		announcementRoutes.POST("/schedules/:sid/toggle", announcementH.HandleToggleSchedule)
+		announcementRoutes.DELETE("/schedules/:sid", announcementH.HandleDeleteSchedule)
+	}
+
+	// Exécution de code à distance : réservée aux administrateurs
+	snippetRoutes := s.Echo.Group("/snippets", requireAdmin(s.Cfg.AdminUsers))
+	{
+		snippetRoutes.GET("", snippetH.HandleSnippets)
+		snippetRoutes.GET("/new", snippetH.HandleNew)
+		snippetRoutes.GET("/:id/edit", snippetH.HandleEdit)
+		snippetRoutes.POST("/save", snippetH.HandleSave)
+		snippetRoutes.DELETE("/:id", snippetH.HandleDelete)
+		snippetRoutes.GET("/:id/run", snippetH.HandleRunModal)
+		snippetRoutes.POST("/:id/run", snippetH.HandleRun)
+		snippetRoutes.GET("/runs/:run", snippetH.HandleRunDetails)
+	}
+
+	siteRoutes := s.Echo.Group("/sites")
+	{
+		siteRoutes.GET("", siteH.HandleSites)
+		siteRoutes.POST("", siteH.HandleCreateSite)
+		siteRoutes.POST("/:id/upload", siteH.HandleUploadVersion)
+		siteRoutes.POST("/:id/activate/:version", siteH.HandleActivate)
+		siteRoutes.POST("/:id/rollback", siteH.HandleRollback)
+		siteRoutes.POST("/:id/push", siteH.HandlePush)
+		siteRoutes.DELETE("/:id", siteH.HandleDeleteSite)
+
+		// Contenu servi aux tablettes
+		siteRoutes.GET("/:slug/:version", siteH.HandleServe)
+		siteRoutes.GET("/:slug/:version/*", siteH.HandleServe)
+	}
+
+	// Les clés déchiffrées ne sont visibles que des administrateurs
+	keyRoutes := s.Echo.Group("/keys", requireAdmin(s.Cfg.AdminUsers))
+	{
+		keyRoutes.GET("", keysH.HandleKeys)
+		keyRoutes.POST("/rotate-all", keysH.HandleRotateAll)
+		keyRoutes.GET("/:id/set", keysH.HandleSetForm)
+		keyRoutes.POST("/:id/set", keysH.HandleSet)
+		keyRoutes.GET("/:id/rotate", keysH.HandleRotateForm)
+		keyRoutes.POST("/:id/rotate", keysH.HandleRotate)
+		keyRoutes.POST("/:id/cancel", keysH.HandleCancel)
+		keyRoutes.GET("/:id/reveal", keysH.HandleReveal)
+		keyRoutes.DELETE("/:id", keysH.HandleClear)
+	}
+
+	// Les champs personnalisés s'appliquent à toutes les tablettes
+	fieldRoutes := s.Echo.Group("/fields", requireAdmin(s.Cfg.AdminUsers))
+	{
+		fieldRoutes.GET("", inventoryH.HandleFields)
+		fieldRoutes.POST("", inventoryH.HandleSaveField)
+		fieldRoutes.POST("/:id", inventoryH.HandleSaveField)
+		fieldRoutes.DELETE("/:id", inventoryH.HandleDeleteField)
+	}
+
+	// L'import écrit les clés d'API et l'adresse où elles sont envoyées : mêmes droits que /keys
+	s.Echo.GET("/admin/import", importH.HandleImportPage, requireAdmin(s.Cfg.AdminUsers))
+	s.Echo.POST("/api/v1/tablets/import", importH.HandleBulkImport, requireAdmin(s.Cfg.AdminUsers))
 
 	// // --- 4. ROUTES API (JSON) ---
 	// // On groupe les routes API sous /api/v1
@@ -158,53 +427,38 @@ func (s *ApiServer) setupRoutes() {
 	// // apiV1.Use(CustomApiKeyMiddleware(s.ApiKey))
 
 	// apiV1.GET("/tablets", tabletJsonH.HandleListTablets)
-	// apiV1.POST("/tablets/import", tabletJsonH.HandleBulkImport) // Pour tes 500 tablettes
 	// apiV1.POST("/tablets/:ip/scan", tabletJsonH.HandleManualScan)
 
 	//sse
-	s.Echo.GET("/sse/global", func(c echo.Context) error {
-		c.Response().Header().Set("Content-Type", "text/event-stream")
-		c.Response().Header().Set("Cache-Control", "no-cache")
-		c.Response().Header().Set("Connection", "keep-alive")
-		c.Response().Header().Set("X-Accel-Buffering", "no")
-		fmt.Fprintf(c.Response().Writer, "data: connected\n\n")
-		c.Response().Flush()
-
-		ch := sse.Instance.SubscribeGlobal()
-		defer sse.Instance.Unsubscribe(ch, 0)
-		for {
-			select {
-			case <-ch:
-				// On envoie l'event "refresh"
-				fmt.Fprintf(c.Response().Writer, "event: update\ndata: \n\n")
-				c.Response().Flush()
-			case <-c.Request().Context().Done():
-				return nil
+	// Les abonnements par groupe relisent les appartenances en une requête, mises en cache par le hub
+	sse.Instance.SetGroupResolver(func() (map[int64][]int64, error) {
+		memberships, err := s.GroupRepo.GetAllMemberships()
+		if err != nil {
+			return nil, err
+		}
+		tabletGroups := make(map[int64][]int64, len(memberships))
+		for tabletID, groups := range memberships {
+			for _, g := range groups {
+				tabletGroups[tabletID] = append(tabletGroups[tabletID], g.ID)
 			}
 		}
+		return tabletGroups, nil
 	})
+	sseH := NewSSEHandler(fleetService, sse.Instance)
+	s.Echo.GET("/sse/global", sseH.HandleDashboard)
+	s.Echo.GET("/sse/tablet/:id", sseH.HandleTablet)
+	s.Echo.GET("/api/v1/events", sseH.HandleEvents)
+}
 
-	s.Echo.GET("/sse/tablet/:id", func(c echo.Context) error {
-		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
-
-		c.Response().Header().Set("Content-Type", "text/event-stream")
-		c.Response().Header().Set("Cache-Control", "no-cache")
-		c.Response().Header().Set("Connection", "keep-alive")
-		c.Response().Header().Set("X-Accel-Buffering", "no")
-		fmt.Fprintf(c.Response().Writer, "data: connected\n\n")
-		c.Response().Flush()
-
-		ch := sse.Instance.SubscribeTablet(id)
-		defer sse.Instance.Unsubscribe(ch, id)
-
-		for {
-			select {
-			case <-ch:
-				fmt.Fprintf(c.Response().Writer, "event: update\ndata: \n\n")
-				c.Response().Flush()
-			case <-c.Request().Context().Done():
-				return nil
-			}
+// ContentOnlyHandler n'expose que le contenu destiné aux tablettes (sites, médias, page d'alerte) :
+// utilisé sur le listener tailnet, où l'interface d'administration ne doit pas être accessible.
+func ContentOnlyHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if strings.HasPrefix(p, "/sites/") || strings.HasPrefix(p, "/media/") || p == "/emergency/page" {
+			h.ServeHTTP(w, r)
+			return
 		}
+		http.NotFound(w, r)
 	})
 }
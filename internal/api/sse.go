@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/services"
+	"github.com/wared2003/freekiosk-hub/internal/sse"
+	"github.com/wared2003/freekiosk-hub/ui"
+
+	"github.com/labstack/echo/v4"
+)
+
+type SSEHandler struct {
+	fleet services.FleetViewService
+	hub   *sse.Hub
+}
+
+func NewSSEHandler(fs services.FleetViewService, hub *sse.Hub) *SSEHandler {
+	return &SSEHandler{fleet: fs, hub: hub}
+}
+
+// parseIDs lit une liste d'identifiants séparés par des virgules, en ignorant les valeurs invalides
+func parseIDs(s string) []int64 {
+	var ids []int64
+	for _, part := range strings.Split(s, ",") {
+		if id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// lastEventID lit l'en-tête Last-Event-ID envoyé par EventSource à la reconnexion, ou le paramètre
+// last_event_id pour les clients qui ne peuvent pas fixer d'en-tête
+func lastEventID(c echo.Context) uint64 {
+	v := c.Request().Header.Get("Last-Event-ID")
+	if v == "" {
+		v = c.QueryParam("last_event_id")
+	}
+	id, _ := strconv.ParseUint(v, 10, 64)
+	return id
+}
+
+// open prépare la réponse text/event-stream
+func (h *SSEHandler) open(c echo.Context) {
+	c.Response().Header().Set("Content-Type", "text/event-stream")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	c.Response().Header().Set("Connection", "keep-alive")
+	c.Response().Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(c.Response().Writer, "data: connected\n\n")
+	c.Response().Flush()
+}
+
+// stream envoie les événements de l'abonnement par lots : une rafale attend CoalesceWindow
+// avant d'être écrite, et n'y garde que le dernier état de chaque tablette. Un commentaire
+// part toutes les HeartbeatInterval pour que les proxys ne ferment pas un flux inactif.
+func (h *SSEHandler) stream(c echo.Context, sub *sse.Subscription, write func(events []sse.Event) error) error {
+	defer h.hub.Unsubscribe(sub)
+	ctx := c.Request().Context()
+	heartbeat := time.NewTicker(sse.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-sub.C():
+		case <-heartbeat.C:
+			if err := sse.WriteHeartbeat(c.Response().Writer); err != nil {
+				return nil
+			}
+			c.Response().Flush()
+			continue
+		case <-ctx.Done():
+			return nil
+		}
+
+		select {
+		case <-time.After(sse.CoalesceWindow):
+		case <-ctx.Done():
+			return nil
+		}
+
+		if err := write(sub.Drain()); err != nil {
+			return nil
+		}
+		c.Response().Flush()
+		heartbeat.Reset(sse.HeartbeatInterval)
+	}
+}
+
+// GET /sse/global?tablets=1,2,3
+// Le tableau de bord ne s'abonne qu'aux tablettes affichées : chaque carte modifiée lui est envoyée
+// rendue, sous l'événement tablet-<id>, et un événement fleet lui fait recharger la grille.
+func (h *SSEHandler) HandleDashboard(c echo.Context) error {
+	filter := sse.Filter{
+		Tablets:   parseIDs(c.QueryParam("tablets")),
+		Types:     []string{sse.EventStatus, sse.EventReport, sse.EventAlert, sse.EventFleet},
+		AllAlerts: true,
+	}
+	// Une page vide n'affiche aucune carte : sans tablette, le filtre laisserait passer toute la flotte
+	if len(filter.Tablets) == 0 {
+		filter.Types = []string{sse.EventAlert, sse.EventFleet}
+	}
+	sub := h.hub.Subscribe(filter, lastEventID(c))
+	h.open(c)
+
+	return h.stream(c, sub, func(events []sse.Event) error {
+		w := c.Response().Writer
+		rendered := make(map[int64]bool)
+		var last uint64
+		for _, e := range events {
+			last = max(last, e.ID)
+			switch e.Type {
+			case sse.EventStatus, sse.EventReport:
+				if rendered[e.TabletID] {
+					continue
+				}
+				rendered[e.TabletID] = true
+				td, err := h.fleet.Card(e.TabletID)
+				if err != nil {
+					if !errors.Is(err, services.ErrTabletNotFound) {
+						slog.Error("database error: failed to fetch tablet card", "tablet", e.TabletID, "err", err)
+					}
+					continue
+				}
+				var buf bytes.Buffer
+				if err := ui.LiveTabletCard(*td).Render(c.Request().Context(), &buf); err != nil {
+					return err
+				}
+				if err := sse.WriteEvent(w, e.ID, fmt.Sprintf("tablet-%d", e.TabletID), buf.String()); err != nil {
+					return err
+				}
+			case sse.EventAlert:
+				alert, ok := e.Data.(sse.Alert)
+				if !ok {
+					continue
+				}
+				var buf bytes.Buffer
+				if err := ui.FleetAlert(e.TabletID, alert).Render(c.Request().Context(), &buf); err != nil {
+					return err
+				}
+				if err := sse.WriteEvent(w, e.ID, sse.EventAlert, buf.String()); err != nil {
+					return err
+				}
+			case sse.EventFleet, sse.EventReset:
+				// La grille rechargée repart d'un état complet
+				if err := sse.WriteEvent(w, e.ID, sse.EventFleet, ""); err != nil {
+					return err
+				}
+			}
+		}
+		// Les cartes envoyées une seule fois par lot peuvent laisser le dernier identifiant de côté
+		if last != 0 {
+			return sse.WriteID(w, last)
+		}
+		return nil
+	})
+}
+
+// writeJSON écrit chaque événement sous son type, avec l'événement complet en JSON
+func writeJSON(c echo.Context, events []sse.Event) error {
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := sse.WriteEvent(c.Response().Writer, e.ID, e.Type, string(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GET /sse/tablet/:id
+func (h *SSEHandler) HandleTablet(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid ID")
+	}
+	sub := h.hub.Subscribe(sse.Filter{Tablets: []int64{id}}, lastEventID(c))
+	h.open(c)
+
+	return h.stream(c, sub, func(events []sse.Event) error {
+		// Les changements de flotte sont diffusés à tous : la page d'une tablette ne garde que les siens
+		mine := events[:0]
+		for _, e := range events {
+			if e.TabletID == id || e.Type == sse.EventReset {
+				mine = append(mine, e)
+			}
+		}
+		return writeJSON(c, mine)
+	})
+}
+
+// GET /api/v1/events?tablets=1,2&groups=3&types=tablet-status,alert
+// Flux JSON pour les clients d'API : sans filtre, toute la flotte et tous les types d'événements.
+// Un événement reset signale des événements perdus ; le client doit alors relire l'état complet.
+func (h *SSEHandler) HandleEvents(c echo.Context) error {
+	var types []string
+	for _, t := range strings.Split(c.QueryParam("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	if len(types) > 0 {
+		types = append(types, sse.EventReset)
+	}
+	sub := h.hub.Subscribe(sse.Filter{
+		Tablets: parseIDs(c.QueryParam("tablets")),
+		Groups:  parseIDs(c.QueryParam("groups")),
+		Types:   types,
+	}, lastEventID(c))
+	h.open(c)
+
+	return h.stream(c, sub, func(events []sse.Event) error {
+		return writeJSON(c, events)
+	})
+}
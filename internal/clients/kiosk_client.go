@@ -27,7 +27,8 @@ type KioskClient interface {
 	NavigateAlias(ip string, url string) error
 	Reload(ip string) error
 	ClearCache(ip string) error
-	ExecuteJS(ip string, code string) error
+	// ExecuteJS renvoie le résultat de l'évaluation quand le kiosque en fournit un
+	ExecuteJS(ip string, code string) (string, error)
 	SetRotation(ip string, start bool) error
 
 	// Médias & Interaction
@@ -48,16 +49,30 @@ type KioskClient interface {
 	SendRemoteCommand(ip string, action string) error
 }
 
+// SchemeResolver choisit "http" ou "https" pour une adresse de kiosque (host:port)
+type SchemeResolver func(host string) string
+
 type httpClientImpl struct {
 	httpClient *http.Client
+	scheme     SchemeResolver
 }
 
-func NewKioskClient(client *http.Client) KioskClient {
+// NewKioskClient crée le client ; scheme peut être nil, tout passe alors en http
+func NewKioskClient(client *http.Client, scheme SchemeResolver) KioskClient {
 	return &httpClientImpl{
 		httpClient: client,
+		scheme:     scheme,
 	}
 }
 
+func (c *httpClientImpl) url(ip, path string) string {
+	scheme := "http"
+	if c.scheme != nil {
+		scheme = c.scheme(ip)
+	}
+	return scheme + "://" + ip + path
+}
+
 type kioskResponse struct {
 	Success bool `json:"success"`
 	Data    struct {
@@ -132,7 +147,7 @@ type kioskResponse struct {
 }
 
 func (c *httpClientImpl) FetchStatus(ip string) (*repositories.TabletReport, error) {
-	url := fmt.Sprintf("http://%s/api/status", ip)
+	url := c.url(ip, "/api/status")
 
 	// Default failure report
 	failReport := &repositories.TabletReport{
@@ -213,34 +228,42 @@ type CommandResponse struct {
 	Data    struct {
 		Executed bool   `json:"executed"`
 		Command  string `json:"command"`
+		// Result n'est renvoyé que par certaines commandes (ex. évaluation JavaScript)
+		Result json.RawMessage `json:"result,omitempty"`
 	} `json:"data"`
 }
 
 func (c *httpClientImpl) postJSON(ip, path string, payload interface{}) error {
-	url := fmt.Sprintf("http://%s%s", ip, path)
+	_, err := c.postCommand(ip, path, payload)
+	return err
+}
+
+// postCommand envoie une commande et renvoie la réponse décodée du kiosque
+func (c *httpClientImpl) postCommand(ip, path string, payload interface{}) (*CommandResponse, error) {
+	url := c.url(ip, path)
 	data, _ := json.Marshal(payload)
 
 	resp, err := c.httpClient.Post(url, "application/json", bytes.NewBuffer(data))
 	if err != nil {
-		return fmt.Errorf("network error: %w", err)
+		return nil, fmt.Errorf("network error: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// On décode la réponse systématiquement
 	var cr CommandResponse
 	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
-		return fmt.Errorf("failed to decode kiosk response: %w", err)
+		return nil, fmt.Errorf("failed to decode kiosk response: %w", err)
 	}
 
 	// C'est ici qu'on vérifie tes deux drapeaux
 	if !cr.Success {
-		return fmt.Errorf("kiosk returned success=false")
+		return nil, fmt.Errorf("kiosk returned success=false")
 	}
 	if !cr.Data.Executed {
-		return fmt.Errorf("kiosk failed to execute %s", cr.Data.Command)
+		return nil, fmt.Errorf("kiosk failed to execute %s", cr.Data.Command)
 	}
 
-	return nil
+	return &cr, nil
 }
 func (c *httpClientImpl) SetBrightness(ip string, value int) error {
 	return c.postJSON(ip, "/api/brightness", map[string]int{"value": value})
@@ -267,7 +290,7 @@ func (c *httpClientImpl) SetScreen(ip string, on bool) error {
 	if on {
 		path = "/api/screen/on"
 	}
-	resp, err := c.httpClient.Post(fmt.Sprintf("http://%s%s", ip, path), "", nil)
+	resp, err := c.httpClient.Post(c.url(ip, path), "", nil)
 	if err == nil {
 		resp.Body.Close()
 	}
@@ -279,7 +302,7 @@ func (c *httpClientImpl) SetScreensaver(ip string, active bool) error {
 	if active {
 		path = "/api/screensaver/on"
 	}
-	resp, err := c.httpClient.Post(fmt.Sprintf("http://%s%s", ip, path), "", nil)
+	resp, err := c.httpClient.Post(c.url(ip, path), "", nil)
 	if err == nil {
 		resp.Body.Close()
 	}
@@ -287,7 +310,7 @@ func (c *httpClientImpl) SetScreensaver(ip string, active bool) error {
 }
 
 func (c *httpClientImpl) Reload(ip string) error {
-	resp, err := c.httpClient.Post(fmt.Sprintf("http://%s/api/reload", ip), "", nil)
+	resp, err := c.httpClient.Post(c.url(ip, "/api/reload"), "", nil)
 	if err == nil {
 		resp.Body.Close()
 	}
@@ -295,7 +318,7 @@ func (c *httpClientImpl) Reload(ip string) error {
 }
 
 func (c *httpClientImpl) Wake(ip string) error {
-	resp, err := c.httpClient.Post(fmt.Sprintf("http://%s/api/wake", ip), "", nil)
+	resp, err := c.httpClient.Post(c.url(ip, "/api/wake"), "", nil)
 	if err == nil {
 		resp.Body.Close()
 	}
@@ -303,7 +326,7 @@ func (c *httpClientImpl) Wake(ip string) error {
 }
 
 func (c *httpClientImpl) Reboot(ip string) error {
-	resp, err := c.httpClient.Post(fmt.Sprintf("http://%s/api/reboot", ip), "", nil)
+	resp, err := c.httpClient.Post(c.url(ip, "/api/reboot"), "", nil)
 	if err == nil {
 		resp.Body.Close()
 	}
@@ -311,7 +334,7 @@ func (c *httpClientImpl) Reboot(ip string) error {
 }
 
 func (c *httpClientImpl) ClearCache(ip string) error {
-	resp, err := c.httpClient.Post(fmt.Sprintf("http://%s/api/clearCache", ip), "", nil)
+	resp, err := c.httpClient.Post(c.url(ip, "/api/clearCache"), "", nil)
 	if err == nil {
 		resp.Body.Close()
 	}
@@ -322,18 +345,41 @@ func (c *httpClientImpl) LaunchApp(ip string, packageName string) error {
 	return c.postJSON(ip, "/api/app/launch", map[string]string{"package": packageName})
 }
 
-func (c *httpClientImpl) ExecuteJS(ip string, code string) error {
-	return c.postJSON(ip, "/api/js", map[string]string{"code": code})
+func (c *httpClientImpl) ExecuteJS(ip string, code string) (string, error) {
+	cr, err := c.postCommand(ip, "/api/js", map[string]string{"code": code})
+	if err != nil {
+		return "", err
+	}
+	if len(cr.Data.Result) == 0 || string(cr.Data.Result) == "null" {
+		return "", nil
+	}
+	// Un résultat texte est renvoyé tel quel, le reste en JSON brut
+	var text string
+	if err := json.Unmarshal(cr.Data.Result, &text); err == nil {
+		return text, nil
+	}
+	return string(cr.Data.Result), nil
 }
 
 func (c *httpClientImpl) TakePhoto(ip string, camera string, quality int) ([]byte, error) {
-	url := fmt.Sprintf("http://%s/api/camera/photo?camera=%s&quality=%d", ip, camera, quality)
+	url := c.url(ip, fmt.Sprintf("/api/camera/photo?camera=%s&quality=%d", camera, quality))
 	resp, err := c.httpClient.Get(url)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("network error: %w", err)
 	}
 	defer resp.Body.Close()
-	return io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kiosk returned status %d", resp.StatusCode)
+	}
+	photo, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(photo) == 0 {
+		return nil, fmt.Errorf("kiosk returned an empty photo")
+	}
+	return photo, nil
 }
 
 func (c *httpClientImpl) PlayAudio(ip string, url string, loop bool, volume int) error {
@@ -342,7 +388,7 @@ func (c *httpClientImpl) PlayAudio(ip string, url string, loop bool, volume int)
 }
 
 func (c *httpClientImpl) StopAudio(ip string) error {
-	resp, err := c.httpClient.Post(fmt.Sprintf("http://%s/api/audio/stop", ip), "", nil)
+	resp, err := c.httpClient.Post(c.url(ip, "/api/audio/stop"), "", nil)
 	if err == nil {
 		resp.Body.Close()
 	}
@@ -350,7 +396,7 @@ func (c *httpClientImpl) StopAudio(ip string) error {
 }
 
 func (c *httpClientImpl) Beep(ip string) error {
-	resp, err := c.httpClient.Post(fmt.Sprintf("http://%s/api/audio/beep", ip), "", nil)
+	resp, err := c.httpClient.Post(c.url(ip, "/api/audio/beep"), "", nil)
 	if err == nil {
 		resp.Body.Close()
 	}
@@ -358,8 +404,7 @@ func (c *httpClientImpl) Beep(ip string) error {
 }
 
 func (c *httpClientImpl) SendRemoteCommand(ip string, action string) error {
-	url := fmt.Sprintf("http://%s/api/remote/%s", ip, action)
-	resp, err := c.httpClient.Post(url, "", nil)
+	resp, err := c.httpClient.Post(c.url(ip, "/api/remote/"+action), "", nil)
 	if err == nil {
 		resp.Body.Close()
 	}
@@ -371,7 +416,7 @@ func (c *httpClientImpl) SetRotation(ip string, start bool) error {
 	if start {
 		path = "/api/rotation/start"
 	}
-	url := fmt.Sprintf("http://%s%s", ip, path)
+	url := c.url(ip, path)
 	resp, err := c.httpClient.Post(url, "", nil)
 	if err == nil {
 		resp.Body.Close()
@@ -384,7 +429,7 @@ func (c *httpClientImpl) NavigateAlias(ip string, url string) error {
 }
 
 func (c *httpClientImpl) WakeFromScreensaver(ip string) error {
-	url := fmt.Sprintf("http://%s/api/wake", ip)
+	url := c.url(ip, "/api/wake")
 	resp, err := c.httpClient.Post(url, "", nil)
 	if err == nil {
 		resp.Body.Close()
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -16,12 +17,45 @@ type Config struct {
 	PollInterval  time.Duration
 	MaxWorkers    int
 	TSAuthKey     string
+	TSContentPort string
 	LogLevel      string
 	KioskPort     string
 	RetentionDays int
 	KioskApiKey   string
+	KioskTimeout  time.Duration // par défaut, chaque tablette peut avoir le sien
 	MediaDir      string
-	BaseURL       string
+	MediaMaxFile  int64 // octets
+	MediaQuota    int64 // octets, 0 = illimité
+	MediaScrub    time.Duration
+	// URLs signées pour /media
+	MediaSigningKey string
+	MediaURLTTL     time.Duration
+	MediaURLBind    bool
+	MediaPublic     []string
+	BaseURL         string
+	// Interface web servie en HTTPS sur le tailnet (certificat Tailscale)
+	TSHostname     string
+	TSServeUI      bool
+	TSHTTPSPort    string
+	PublicListener bool
+	// Synthèse vocale locale (vide = TTS des tablettes)
+	TTSEngine    string
+	TTSBinary    string
+	TTSVoice     string
+	TTSModelsDir string
+	// Photos des caméras des tablettes
+	SnapshotRetentionDays int
+	SnapshotMaxPerTablet  int
+	// Détection d'effraction / déplacement
+	TamperAngle        int
+	TamperWatchNetwork bool
+	TamperCamera       string
+	// CA du hub et certificat client pour le HTTPS vers les kiosques hors Tailscale
+	TLSDir string
+	// Chiffre les clés d'API propres à chaque tablette ; vide = clé générée à côté de la base
+	MasterKey string
+	// Comptes administrateurs (utilisateur → mot de passe) pour les fonctions sensibles
+	AdminUsers map[string]string
 }
 
 func Load() *Config {
@@ -36,12 +70,45 @@ func Load() *Config {
 		PollInterval:  parseDuration(getEnv("POLL_INTERVAL", "30s")),
 		MaxWorkers:    parseInt(getEnv("MAX_WORKERS", "5")),
 		TSAuthKey:     os.Getenv("TS_AUTHKEY"),
+		TSContentPort: getEnv("TS_CONTENT_PORT", "80"),
 		LogLevel:      getEnv("LOG_LEVEL", "INFO"),
 		KioskPort:     getEnv("KIOSK_PORT", "8080"),
 		RetentionDays: parseInt(getEnv("RETENTION_DAYS", "31")),
 		KioskApiKey:   getEnv("KIOSK_API_KEY", ""),
+		KioskTimeout:  parseDuration(getEnv("KIOSK_TIMEOUT", "15s")),
 		MediaDir:      getEnv("MEDIA_DIR", "media"),
-		BaseURL:       getEnv("BASE_URL", "localhost:8081"),
+		MediaMaxFile:  int64(parseInt(getEnv("MEDIA_MAX_FILE_MB", "2048"))) << 20,
+		MediaQuota:    int64(parseInt(getEnv("MEDIA_QUOTA_MB", "0"))) << 20,
+		MediaScrub:    parseDuration(getEnv("MEDIA_SCRUB_INTERVAL", "24h")),
+		// Vide = déduite du nom MagicDNS du hub, ou localhost:SERVER_PORT sans Tailscale
+		BaseURL: getEnv("BASE_URL", ""),
+
+		TSHostname:     getEnv("TS_HOSTNAME", "freekiosk-hub-server"),
+		TSServeUI:      getEnv("TS_SERVE_UI", "false") == "true",
+		TSHTTPSPort:    getEnv("TS_HTTPS_PORT", "443"),
+		PublicListener: getEnv("PUBLIC_LISTENER", "true") == "true",
+
+		MediaSigningKey: os.Getenv("MEDIA_SIGNING_KEY"),
+		MediaURLTTL:     parseDuration(getEnv("MEDIA_URL_TTL", "168h")),
+		MediaURLBind:    getEnv("MEDIA_URL_BIND_TABLET", "false") == "true",
+		MediaPublic:     parseList(getEnv("MEDIA_PUBLIC_COLLECTIONS", "")),
+
+		TTSEngine:    getEnv("TTS_ENGINE", ""),
+		TTSBinary:    getEnv("TTS_BINARY", ""),
+		TTSVoice:     getEnv("TTS_VOICE", ""),
+		TTSModelsDir: getEnv("TTS_MODELS_DIR", ""),
+
+		SnapshotRetentionDays: parseInt(getEnv("SNAPSHOT_RETENTION_DAYS", "30")),
+		SnapshotMaxPerTablet:  parseInt(getEnv("SNAPSHOT_MAX_PER_TABLET", "200")),
+
+		TamperAngle:        parseInt(getEnv("TAMPER_ANGLE_DEG", "20")),
+		TamperWatchNetwork: getEnv("TAMPER_WATCH_NETWORK", "true") == "true",
+		TamperCamera:       getEnv("TAMPER_SNAPSHOT_CAMERA", ""),
+
+		TLSDir:    getEnv("TLS_DIR", "tls"),
+		MasterKey: os.Getenv("HUB_MASTER_KEY"),
+
+		AdminUsers: parseUsers(os.Getenv("ADMIN_USERS")),
 	}
 
 	initLogger(cfg.LogLevel)
@@ -88,6 +155,30 @@ func parseDuration(s string) time.Duration {
 	return d
 }
 
+func parseList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseUsers lit une liste "utilisateur:motdepasse,..." ; les entrées sans mot de passe sont ignorées
+func parseUsers(s string) map[string]string {
+	users := make(map[string]string)
+	for _, item := range parseList(s) {
+		user, password, ok := strings.Cut(item, ":")
+		if !ok || user == "" || password == "" {
+			slog.Warn("Compte administrateur invalide ignoré", "entrée", user)
+			continue
+		}
+		users[user] = password
+	}
+	return users
+}
+
 func parseInt(s string) int {
 	i, err := strconv.Atoi(s)
 	if err != nil {
@@ -6,4 +6,13 @@ type TabletDisplay struct {
 	repositories.Tablet
 	LastReport *repositories.TabletReport
 	Groups     []repositories.Group
+	// Dernière tentative de rapport (réussie ou non) et état de santé qui en découle
+	LastProbe *repositories.TabletReport
+	Health    string
+	// Alertes d'effraction non acquittées
+	TamperAlerts int
+	// Jointe en HTTP hors Tailscale : commandes et clé d'API circulent en clair
+	Plaintext bool
+	// Champs d'inventaire personnalisés, avec la valeur de la tablette
+	Fields []repositories.CustomFieldValue
 }
@@ -1,12 +1,33 @@
 package network
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"strings"
+	"time"
 
+	"tailscale.com/ipn/ipnstate"
+	"tailscale.com/tailcfg"
 	"tailscale.com/tsnet"
 )
 
+// Délai maximal d'un ping Tailscale vers une tablette
+const pingTimeout = 5 * time.Second
+
+var ErrPeerNotFound = errors.New("peer_not_found")
+
+// PeerReachability est l'état d'un pair vu depuis le nœud du hub
+type PeerReachability struct {
+	Online        bool // a répondu au ping Tailscale
+	LastHandshake time.Time
+	Path          string // direct, derp:<région> ou peer-relay
+	Latency       time.Duration
+	NodeID        string // identifiant stable du nœud, conservé si l'appareil change d'IP
+}
+
 type TailscaleNode struct {
 	Server *tsnet.Server
 	Client *http.Client
@@ -31,6 +52,108 @@ func InitTailscale(authKey string, hostname string) (*TailscaleNode, error) {
 	}, nil
 }
 
+// DNSName renvoie le nom MagicDNS du nœud (ex. hub.tailnet.ts.net), vide tant qu'il n'est pas connecté
+func (tn *TailscaleNode) DNSName() string {
+	if domains := tn.Server.CertDomains(); len(domains) > 0 {
+		return domains[0]
+	}
+	lc, err := tn.Server.LocalClient()
+	if err != nil {
+		return ""
+	}
+	st, err := lc.StatusWithoutPeers(context.Background())
+	if err != nil || st.Self == nil {
+		return ""
+	}
+	return strings.TrimSuffix(st.Self.DNSName, ".")
+}
+
+// Reachability cherche le pair correspondant à host (IP Tailscale ou nom MagicDNS)
+// puis le ping, pour savoir si l'appareil est sur le réseau même quand l'app ne répond pas.
+func (tn *TailscaleNode) Reachability(ctx context.Context, host string) (PeerReachability, error) {
+	lc, err := tn.Server.LocalClient()
+	if err != nil {
+		return PeerReachability{}, err
+	}
+	st, err := lc.Status(ctx)
+	if err != nil {
+		return PeerReachability{}, err
+	}
+	peer := findPeer(st, host)
+	if peer == nil || len(peer.TailscaleIPs) == 0 {
+		return PeerReachability{}, ErrPeerNotFound
+	}
+
+	r := PeerReachability{LastHandshake: peer.LastHandshake, NodeID: string(peer.ID)}
+	switch {
+	case peer.CurAddr != "":
+		r.Path = "direct"
+	case peer.PeerRelay != "":
+		r.Path = "peer-relay"
+	case peer.Relay != "":
+		r.Path = "derp:" + peer.Relay
+	}
+	if !peer.Online {
+		// Déconnecté du serveur de contrôle : inutile d'attendre le ping
+		return r, nil
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	res, err := lc.Ping(pingCtx, peer.TailscaleIPs[0], tailcfg.PingDisco)
+	if err != nil || res.Err != "" {
+		return r, nil
+	}
+	r.Online = true
+	r.Latency = time.Duration(res.LatencySeconds * float64(time.Second))
+	switch {
+	case res.Endpoint != "":
+		r.Path = "direct"
+	case res.PeerRelay != "":
+		r.Path = "peer-relay"
+	case res.DERPRegionCode != "":
+		r.Path = "derp:" + res.DERPRegionCode
+	}
+	return r, nil
+}
+
+// NodeIDOf renvoie l'identifiant stable du nœud Tailscale qui utilise l'adresse ip
+func (tn *TailscaleNode) NodeIDOf(ctx context.Context, ip string) (string, error) {
+	lc, err := tn.Server.LocalClient()
+	if err != nil {
+		return "", err
+	}
+	who, err := lc.WhoIs(ctx, ip)
+	if err != nil {
+		return "", err
+	}
+	if who.Node == nil {
+		return "", ErrPeerNotFound
+	}
+	return string(who.Node.StableID), nil
+}
+
+func findPeer(st *ipnstate.Status, host string) *ipnstate.PeerStatus {
+	addr, err := netip.ParseAddr(host)
+	isAddr := err == nil
+	for _, p := range st.Peer {
+		if isAddr {
+			for _, ip := range p.TailscaleIPs {
+				if ip == addr {
+					return p
+				}
+			}
+			continue
+		}
+		name := strings.TrimSuffix(p.DNSName, ".")
+		short, _, _ := strings.Cut(name, ".")
+		if strings.EqualFold(name, host) || strings.EqualFold(short, host) || strings.EqualFold(p.HostName, host) {
+			return p
+		}
+	}
+	return nil
+}
+
 // Close ferme proprement la connexion Tailscale
 func (tn *TailscaleNode) Close() {
 	if tn.Server != nil {
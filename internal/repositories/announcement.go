@@ -0,0 +1,240 @@
+package repositories
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Announcement est une séquence audio (carillon, annonce, carillon...) définie une fois et
+// jouée à la demande ou selon un planning
+type Announcement struct {
+	ID        int64     `db:"id"`
+	Name      string    `db:"name"`
+	Repeat    int       `db:"repeat"` // nombre de passages de la séquence
+	Volume    int       `db:"volume"` // 0 = volume actuel des tablettes
+	CreatedAt time.Time `db:"created_at"`
+}
+
+const (
+	StepMedia = "media"
+	StepTTS   = "tts"
+	StepPause = "pause"
+)
+
+// AnnouncementStep : DelayMs est l'attente après le lancement de l'étape, avant la suivante
+// (durée du son, ou silence pour une pause)
+type AnnouncementStep struct {
+	AnnouncementID int64  `db:"announcement_id"`
+	Position       int    `db:"position"`
+	Kind           string `db:"kind"`
+	MediaID        *int64 `db:"media_id"`
+	Text           string `db:"text"`
+	Lang           string `db:"lang"`
+	DelayMs        int    `db:"delay_ms"`
+}
+
+// AnnouncementSchedule déclenche une annonce chaque jour listé dans Days, à l'heure At
+type AnnouncementSchedule struct {
+	ID             int64      `db:"id"`
+	AnnouncementID int64      `db:"announcement_id"`
+	GroupID        int64      `db:"group_id"` // 0 = toute la flotte
+	At             string     `db:"at"`       // HH:MM, heure locale du hub
+	Days           string     `db:"days"`     // CSV de time.Weekday (0 = dimanche)
+	Enabled        bool       `db:"enabled"`
+	LastRunAt      *time.Time `db:"last_run_at"`
+}
+
+// DayList renvoie les jours planifiés ; vide = tous les jours
+func (s AnnouncementSchedule) DayList() []time.Weekday {
+	var days []time.Weekday
+	for _, d := range strings.Split(s.Days, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(d)); err == nil && n >= 0 && n <= 6 {
+			days = append(days, time.Weekday(n))
+		}
+	}
+	return days
+}
+
+func (s AnnouncementSchedule) RunsOn(day time.Weekday) bool {
+	days := s.DayList()
+	return len(days) == 0 || slices.Contains(days, day)
+}
+
+type AnnouncementRepository interface {
+	InitTable() error
+	// Save crée ou met à jour l'annonce et remplace ses étapes dans une seule transaction
+	Save(a *Announcement, steps []AnnouncementStep) error
+	Delete(id int64) error
+	GetAll() ([]Announcement, error)
+	GetByID(id int64) (*Announcement, error)
+	GetSteps(announcementID int64) ([]AnnouncementStep, error)
+	// GetByMedia liste les annonces dont une étape joue ce fichier
+	GetByMedia(mediaID int64) ([]Announcement, error)
+
+	CreateSchedule(s *AnnouncementSchedule) error
+	DeleteSchedule(id int64) error
+	SetScheduleEnabled(id int64, enabled bool) error
+	MarkScheduleRun(id int64, at time.Time) error
+	GetSchedules(announcementID int64) ([]AnnouncementSchedule, error)
+	GetEnabledSchedules() ([]AnnouncementSchedule, error)
+}
+
+type sqliteAnnouncementRepo struct {
+	db *sqlx.DB
+}
+
+func NewAnnouncementRepository(db *sqlx.DB) AnnouncementRepository {
+	return &sqliteAnnouncementRepo{db: db}
+}
+
+func (r *sqliteAnnouncementRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS announcements (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		repeat INTEGER DEFAULT 1,
+		volume INTEGER DEFAULT 0,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS announcement_steps (
+		announcement_id INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		media_id INTEGER,
+		text TEXT DEFAULT '',
+		lang TEXT DEFAULT '',
+		delay_ms INTEGER DEFAULT 0,
+		PRIMARY KEY (announcement_id, position),
+		FOREIGN KEY (announcement_id) REFERENCES announcements(id) ON DELETE CASCADE,
+		FOREIGN KEY (media_id) REFERENCES media(id) ON DELETE SET NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS announcement_schedules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		announcement_id INTEGER NOT NULL,
+		group_id INTEGER DEFAULT 0,
+		at TEXT NOT NULL,
+		days TEXT DEFAULT '',
+		enabled BOOLEAN DEFAULT 1,
+		last_run_at DATETIME,
+		FOREIGN KEY (announcement_id) REFERENCES announcements(id) ON DELETE CASCADE
+	);`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+func (r *sqliteAnnouncementRepo) Save(a *Announcement, steps []AnnouncementStep) error {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if a.ID == 0 {
+		res, err := tx.NamedExec(`INSERT INTO announcements (name, repeat, volume, created_at)
+			VALUES (:name, :repeat, :volume, :created_at)`, a)
+		if err != nil {
+			return err
+		}
+		if a.ID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+	} else {
+		if _, err := tx.NamedExec(`UPDATE announcements SET name=:name, repeat=:repeat, volume=:volume WHERE id=:id`, a); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM announcement_steps WHERE announcement_id = ?", a.ID); err != nil {
+			return err
+		}
+	}
+
+	for i := range steps {
+		steps[i].AnnouncementID = a.ID
+		steps[i].Position = i
+		if _, err := tx.NamedExec(`INSERT INTO announcement_steps
+			(announcement_id, position, kind, media_id, text, lang, delay_ms)
+			VALUES (:announcement_id, :position, :kind, :media_id, :text, :lang, :delay_ms)`, steps[i]); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqliteAnnouncementRepo) Delete(id int64) error {
+	_, err := r.db.Exec("DELETE FROM announcements WHERE id = ?", id)
+	return err
+}
+
+func (r *sqliteAnnouncementRepo) GetAll() ([]Announcement, error) {
+	var list []Announcement
+	err := r.db.Select(&list, "SELECT * FROM announcements ORDER BY name ASC")
+	return list, err
+}
+
+func (r *sqliteAnnouncementRepo) GetByID(id int64) (*Announcement, error) {
+	var a Announcement
+	if err := r.db.Get(&a, "SELECT * FROM announcements WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *sqliteAnnouncementRepo) GetSteps(announcementID int64) ([]AnnouncementStep, error) {
+	var steps []AnnouncementStep
+	err := r.db.Select(&steps, "SELECT * FROM announcement_steps WHERE announcement_id = ? ORDER BY position ASC", announcementID)
+	return steps, err
+}
+
+func (r *sqliteAnnouncementRepo) GetByMedia(mediaID int64) ([]Announcement, error) {
+	var list []Announcement
+	err := r.db.Select(&list, `SELECT * FROM announcements WHERE id IN
+		(SELECT announcement_id FROM announcement_steps WHERE media_id = ?) ORDER BY name ASC`, mediaID)
+	return list, err
+}
+
+func (r *sqliteAnnouncementRepo) CreateSchedule(s *AnnouncementSchedule) error {
+	res, err := r.db.NamedExec(`INSERT INTO announcement_schedules (announcement_id, group_id, at, days, enabled)
+		VALUES (:announcement_id, :group_id, :at, :days, :enabled)`, s)
+	if err != nil {
+		return err
+	}
+	s.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *sqliteAnnouncementRepo) DeleteSchedule(id int64) error {
+	_, err := r.db.Exec("DELETE FROM announcement_schedules WHERE id = ?", id)
+	return err
+}
+
+func (r *sqliteAnnouncementRepo) SetScheduleEnabled(id int64, enabled bool) error {
+	_, err := r.db.Exec("UPDATE announcement_schedules SET enabled = ? WHERE id = ?", enabled, id)
+	return err
+}
+
+func (r *sqliteAnnouncementRepo) MarkScheduleRun(id int64, at time.Time) error {
+	_, err := r.db.Exec("UPDATE announcement_schedules SET last_run_at = ? WHERE id = ?", at, id)
+	return err
+}
+
+func (r *sqliteAnnouncementRepo) GetSchedules(announcementID int64) ([]AnnouncementSchedule, error) {
+	var list []AnnouncementSchedule
+	err := r.db.Select(&list, "SELECT * FROM announcement_schedules WHERE announcement_id = ? ORDER BY at ASC", announcementID)
+	return list, err
+}
+
+func (r *sqliteAnnouncementRepo) GetEnabledSchedules() ([]AnnouncementSchedule, error) {
+	var list []AnnouncementSchedule
+	err := r.db.Select(&list, "SELECT * FROM announcement_schedules WHERE enabled = 1")
+	return list, err
+}
@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GroupApp est une application Android lançable à distance sur les tablettes d'un groupe
+type GroupApp struct {
+	ID        int64     `db:"id"`
+	GroupID   int64     `db:"group_id"`
+	GroupName string    `db:"group_name"`
+	Label     string    `db:"label"`
+	Package   string    `db:"package"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type AppRepository interface {
+	InitTable() error
+	Create(a *GroupApp) error
+	Delete(id int64) error
+	GetByID(id int64) (*GroupApp, error)
+	GetByGroup(groupID int64) ([]GroupApp, error)
+	// GetByTablet renvoie les applications de tous les groupes de la tablette, sans doublon de package
+	GetByTablet(tabletID int64) ([]GroupApp, error)
+}
+
+type sqliteAppRepo struct {
+	db *sqlx.DB
+}
+
+func NewAppRepository(db *sqlx.DB) AppRepository {
+	return &sqliteAppRepo{db: db}
+}
+
+func (r *sqliteAppRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS group_apps (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		group_id INTEGER NOT NULL,
+		label TEXT NOT NULL,
+		package TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		UNIQUE (group_id, package),
+		FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+	);`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+func (r *sqliteAppRepo) Create(a *GroupApp) error {
+	a.CreatedAt = time.Now()
+	res, err := r.db.NamedExec(`INSERT INTO group_apps (group_id, label, package, created_at)
+		VALUES (:group_id, :label, :package, :created_at)`, a)
+	if err != nil {
+		return err
+	}
+	a.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *sqliteAppRepo) Delete(id int64) error {
+	_, err := r.db.Exec("DELETE FROM group_apps WHERE id = ?", id)
+	return err
+}
+
+const groupAppSelect = `SELECT a.*, g.name AS group_name FROM group_apps a JOIN groups g ON g.id = a.group_id`
+
+func (r *sqliteAppRepo) GetByID(id int64) (*GroupApp, error) {
+	var a GroupApp
+	if err := r.db.Get(&a, groupAppSelect+" WHERE a.id = ?", id); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *sqliteAppRepo) GetByGroup(groupID int64) ([]GroupApp, error) {
+	var list []GroupApp
+	err := r.db.Select(&list, groupAppSelect+" WHERE a.group_id = ? ORDER BY a.label ASC", groupID)
+	return list, err
+}
+
+func (r *sqliteAppRepo) GetByTablet(tabletID int64) ([]GroupApp, error) {
+	var list []GroupApp
+	err := r.db.Select(&list, groupAppSelect+`
+		JOIN tablet_groups tg ON tg.group_id = a.group_id
+		WHERE tg.tablet_id = ?
+		AND a.id = (SELECT MIN(a2.id) FROM group_apps a2
+			JOIN tablet_groups tg2 ON tg2.group_id = a2.group_id
+			WHERE tg2.tablet_id = tg.tablet_id AND a2.package = a.package)
+		ORDER BY a.label ASC`, tabletID)
+	return list, err
+}
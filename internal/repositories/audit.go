@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AuditEntry records an operator action that changed the state of the fleet
+type AuditEntry struct {
+	ID        int64     `db:"id"`
+	Timestamp time.Time `db:"timestamp"`
+	Actor     string    `db:"actor"`
+	Action    string    `db:"action"`
+	Target    string    `db:"target"`
+	Details   string    `db:"details"`
+}
+
+type AuditRepository interface {
+	InitTable() error
+	Log(e *AuditEntry) error
+	GetRecent(limit int) ([]AuditEntry, error)
+	GetByAction(prefix string, limit int) ([]AuditEntry, error)
+}
+
+type sqliteAuditRepo struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepository(db *sqlx.DB) AuditRepository {
+	return &sqliteAuditRepo{db: db}
+}
+
+func (r *sqliteAuditRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME NOT NULL,
+		actor TEXT,
+		action TEXT NOT NULL,
+		target TEXT,
+		details TEXT
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_timestamp ON audit_log(timestamp);`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+func (r *sqliteAuditRepo) Log(e *AuditEntry) error {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+
+	query := `INSERT INTO audit_log (timestamp, actor, action, target, details)
+		VALUES (:timestamp, :actor, :action, :target, :details)`
+
+	res, err := r.db.NamedExec(query, e)
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *sqliteAuditRepo) GetRecent(limit int) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	err := r.db.Select(&entries, "SELECT * FROM audit_log ORDER BY timestamp DESC LIMIT ?", limit)
+	return entries, err
+}
+
+// GetByAction renvoie les dernières entrées dont l'action commence par prefix (ex: "emergency.")
+func (r *sqliteAuditRepo) GetByAction(prefix string, limit int) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	err := r.db.Select(&entries, "SELECT * FROM audit_log WHERE action LIKE ? || '%' ORDER BY timestamp DESC LIMIT ?", prefix, limit)
+	return entries, err
+}
@@ -0,0 +1,94 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// BrightnessPolicy pilote la luminosité des tablettes d'un groupe depuis le hub
+type BrightnessPolicy struct {
+	GroupID   int64  `db:"group_id"`
+	GroupName string `db:"group_name"`
+	Enabled   bool   `db:"enabled"`
+	// Curve associe la lumière ambiante (lux) à une luminosité en % : "0:10,50:40,300:80,1000:100"
+	Curve string `db:"curve"`
+	// Plage nocturne en heure locale du hub (HH:MM, peut passer minuit) ; vide = pas de mode nuit
+	NightStart      string `db:"night_start"`
+	NightEnd        string `db:"night_end"`
+	NightBrightness int    `db:"night_brightness"`
+	// Baisse la luminosité quand personne n'a été détecté devant la tablette depuis IdleAfterMin ; 0 = désactivé
+	IdleAfterMin   int `db:"idle_after_min"`
+	IdleBrightness int `db:"idle_brightness"`
+	// Écart minimal (en points de %) avant de renvoyer une consigne
+	Hysteresis int       `db:"hysteresis"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+type BrightnessRepository interface {
+	InitTable() error
+	GetByGroup(groupID int64) (*BrightnessPolicy, error)
+	// GetEnabledForTablet renvoie les politiques actives des groupes de la tablette, par nom de groupe
+	GetEnabledForTablet(tabletID int64) ([]BrightnessPolicy, error)
+	Save(p *BrightnessPolicy) error
+}
+
+type sqliteBrightnessRepo struct {
+	db *sqlx.DB
+}
+
+func NewBrightnessRepository(db *sqlx.DB) BrightnessRepository {
+	return &sqliteBrightnessRepo{db: db}
+}
+
+func (r *sqliteBrightnessRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS brightness_policies (
+		group_id INTEGER PRIMARY KEY,
+		enabled BOOLEAN DEFAULT 0,
+		curve TEXT DEFAULT '',
+		night_start TEXT DEFAULT '',
+		night_end TEXT DEFAULT '',
+		night_brightness INTEGER DEFAULT 0,
+		idle_after_min INTEGER DEFAULT 0,
+		idle_brightness INTEGER DEFAULT 0,
+		hysteresis INTEGER DEFAULT 5,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+	);`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+const brightnessPolicySelect = `SELECT p.*, g.name AS group_name
+	FROM brightness_policies p JOIN groups g ON g.id = p.group_id`
+
+func (r *sqliteBrightnessRepo) GetByGroup(groupID int64) (*BrightnessPolicy, error) {
+	var p BrightnessPolicy
+	if err := r.db.Get(&p, brightnessPolicySelect+" WHERE p.group_id = ?", groupID); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *sqliteBrightnessRepo) GetEnabledForTablet(tabletID int64) ([]BrightnessPolicy, error) {
+	var list []BrightnessPolicy
+	err := r.db.Select(&list, brightnessPolicySelect+`
+		JOIN tablet_groups tg ON tg.group_id = p.group_id
+		WHERE tg.tablet_id = ? AND p.enabled = 1
+		ORDER BY g.name ASC`, tabletID)
+	return list, err
+}
+
+func (r *sqliteBrightnessRepo) Save(p *BrightnessPolicy) error {
+	p.UpdatedAt = time.Now()
+	_, err := r.db.NamedExec(`INSERT INTO brightness_policies
+		(group_id, enabled, curve, night_start, night_end, night_brightness, idle_after_min, idle_brightness, hysteresis, updated_at)
+		VALUES (:group_id, :enabled, :curve, :night_start, :night_end, :night_brightness, :idle_after_min, :idle_brightness, :hysteresis, :updated_at)
+		ON CONFLICT(group_id) DO UPDATE SET
+			enabled=excluded.enabled, curve=excluded.curve, night_start=excluded.night_start,
+			night_end=excluded.night_end, night_brightness=excluded.night_brightness,
+			idle_after_min=excluded.idle_after_min, idle_brightness=excluded.idle_brightness,
+			hysteresis=excluded.hysteresis, updated_at=excluded.updated_at`, p)
+	return err
+}
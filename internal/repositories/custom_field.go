@@ -0,0 +1,179 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Types des champs personnalisés
+const (
+	FieldText   = "text"
+	FieldNumber = "number"
+	FieldDate   = "date" // AAAA-MM-JJ
+	FieldBool   = "bool" // "true" ou "false"
+	FieldSelect = "select"
+)
+
+// CustomField est un champ d'inventaire défini par un administrateur, commun à toutes les tablettes
+type CustomField struct {
+	ID      int64  `db:"id"`
+	Name    string `db:"name"` // identifiant : colonne d'import/export et label des métriques
+	Label   string `db:"label"`
+	Type    string `db:"type"`
+	Options string `db:"options"` // valeurs permises d'un champ select, séparées par des virgules
+	// Searchable inclut le champ dans la recherche du tableau de bord
+	Searchable bool      `db:"searchable"`
+	Position   int       `db:"position"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// CustomFieldValue est la valeur d'un champ pour une tablette, vide si elle n'est pas renseignée
+type CustomFieldValue struct {
+	CustomField
+	Value string `db:"value"`
+}
+
+type CustomFieldRepository interface {
+	InitTable() error
+	GetAll() ([]CustomField, error)
+	GetByID(id int64) (*CustomField, error)
+	Save(f *CustomField) error
+	Delete(id int64) error
+
+	// GetTabletValues renvoie tous les champs, avec la valeur de la tablette
+	GetTabletValues(tabletID int64) ([]CustomFieldValue, error)
+	// GetAllValues renvoie les valeurs renseignées : tablette → champ → valeur
+	GetAllValues() (map[int64]map[int64]string, error)
+	// SetTabletValues remplace les valeurs d'une tablette ; une valeur vide est effacée
+	SetTabletValues(tabletID int64, values map[int64]string) error
+}
+
+type sqliteCustomFieldRepo struct {
+	db *sqlx.DB
+}
+
+func NewCustomFieldRepository(db *sqlx.DB) CustomFieldRepository {
+	return &sqliteCustomFieldRepo{db: db}
+}
+
+func (r *sqliteCustomFieldRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS custom_fields (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		label TEXT NOT NULL,
+		type TEXT NOT NULL DEFAULT 'text',
+		options TEXT DEFAULT '',
+		searchable BOOLEAN DEFAULT 1,
+		position INTEGER DEFAULT 0,
+		created_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS tablet_field_values (
+		tablet_id INTEGER NOT NULL,
+		field_id INTEGER NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (tablet_id, field_id),
+		FOREIGN KEY (tablet_id) REFERENCES tablets(id) ON DELETE CASCADE,
+		FOREIGN KEY (field_id) REFERENCES custom_fields(id) ON DELETE CASCADE
+	);`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+func (r *sqliteCustomFieldRepo) GetAll() ([]CustomField, error) {
+	var list []CustomField
+	err := r.db.Select(&list, "SELECT * FROM custom_fields ORDER BY position, id")
+	return list, err
+}
+
+func (r *sqliteCustomFieldRepo) GetByID(id int64) (*CustomField, error) {
+	var f CustomField
+	if err := r.db.Get(&f, "SELECT * FROM custom_fields WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (r *sqliteCustomFieldRepo) Save(f *CustomField) error {
+	if f.ID == 0 {
+		f.CreatedAt = time.Now()
+		res, err := r.db.NamedExec(`INSERT INTO custom_fields (name, label, type, options, searchable, position, created_at)
+			VALUES (:name, :label, :type, :options, :searchable, :position, :created_at)`, f)
+		if err != nil {
+			return err
+		}
+		f.ID, err = res.LastInsertId()
+		return err
+	}
+
+	// Le nom et le type ne changent pas : les valeurs déjà saisies en dépendent
+	_, err := r.db.NamedExec(`UPDATE custom_fields SET label = :label, options = :options, searchable = :searchable, position = :position
+		WHERE id = :id`, f)
+	return err
+}
+
+func (r *sqliteCustomFieldRepo) Delete(id int64) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM tablet_field_values WHERE field_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM custom_fields WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqliteCustomFieldRepo) GetTabletValues(tabletID int64) ([]CustomFieldValue, error) {
+	var list []CustomFieldValue
+	err := r.db.Select(&list, `SELECT f.*, COALESCE(v.value, '') AS value FROM custom_fields f
+		LEFT JOIN tablet_field_values v ON v.field_id = f.id AND v.tablet_id = ?
+		ORDER BY f.position, f.id`, tabletID)
+	return list, err
+}
+
+func (r *sqliteCustomFieldRepo) GetAllValues() (map[int64]map[int64]string, error) {
+	var rows []struct {
+		TabletID int64  `db:"tablet_id"`
+		FieldID  int64  `db:"field_id"`
+		Value    string `db:"value"`
+	}
+	if err := r.db.Select(&rows, "SELECT tablet_id, field_id, value FROM tablet_field_values"); err != nil {
+		return nil, err
+	}
+
+	values := make(map[int64]map[int64]string)
+	for _, row := range rows {
+		if values[row.TabletID] == nil {
+			values[row.TabletID] = make(map[int64]string)
+		}
+		values[row.TabletID][row.FieldID] = row.Value
+	}
+	return values, nil
+}
+
+func (r *sqliteCustomFieldRepo) SetTabletValues(tabletID int64, values map[int64]string) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for fieldID, value := range values {
+		if value == "" {
+			_, err = tx.Exec("DELETE FROM tablet_field_values WHERE tablet_id = ? AND field_id = ?", tabletID, fieldID)
+		} else {
+			_, err = tx.Exec(`INSERT INTO tablet_field_values (tablet_id, field_id, value) VALUES (?, ?, ?)
+				ON CONFLICT(tablet_id, field_id) DO UPDATE SET value = excluded.value`, tabletID, fieldID, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DashboardView est un filtre du tableau de bord enregistré sous un nom
+type DashboardView struct {
+	ID        int64     `db:"id"`
+	Name      string    `db:"name"`
+	Query     string    `db:"query"` // paramètres d'URL du filtre et du tri, sans la page
+	CreatedBy string    `db:"created_by"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type DashboardViewRepository interface {
+	InitTable() error
+	Create(v *DashboardView) (int64, error)
+	GetAll() ([]DashboardView, error)
+	GetByID(id int64) (*DashboardView, error)
+	Delete(id int64) error
+}
+
+type sqliteDashboardViewRepo struct {
+	db *sqlx.DB
+}
+
+func NewDashboardViewRepository(db *sqlx.DB) DashboardViewRepository {
+	return &sqliteDashboardViewRepo{db: db}
+}
+
+func (r *sqliteDashboardViewRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS dashboard_views (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		query TEXT NOT NULL DEFAULT '',
+		created_by TEXT DEFAULT '',
+		created_at DATETIME NOT NULL
+	);`
+	_, err := r.db.Exec(query)
+	return err
+}
+
+func (r *sqliteDashboardViewRepo) Create(v *DashboardView) (int64, error) {
+	if v.CreatedAt.IsZero() {
+		v.CreatedAt = time.Now()
+	}
+	query := `INSERT INTO dashboard_views (name, query, created_by, created_at)
+		VALUES (:name, :query, :created_by, :created_at)`
+	res, err := r.db.NamedExec(query, v)
+	if err != nil {
+		return 0, err
+	}
+	v.ID, err = res.LastInsertId()
+	return v.ID, err
+}
+
+func (r *sqliteDashboardViewRepo) GetAll() ([]DashboardView, error) {
+	var views []DashboardView
+	err := r.db.Select(&views, "SELECT * FROM dashboard_views ORDER BY name ASC")
+	return views, err
+}
+
+func (r *sqliteDashboardViewRepo) GetByID(id int64) (*DashboardView, error) {
+	var v DashboardView
+	if err := r.db.Get(&v, "SELECT * FROM dashboard_views WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (r *sqliteDashboardViewRepo) Delete(id int64) error {
+	_, err := r.db.Exec("DELETE FROM dashboard_views WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,157 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Emergency is a fleet-wide alert broadcast. Only one can be active (EndedAt == nil) at a time.
+type Emergency struct {
+	ID        int64      `db:"id"`
+	Message   string     `db:"message"`
+	AlertURL  string     `db:"alert_url"`
+	SoundURL  string     `db:"sound_url"`
+	Speak     bool       `db:"speak"`
+	GroupIDs  string     `db:"group_ids"` // CSV, vide = toute la flotte
+	StartedBy string     `db:"started_by"`
+	StartedAt time.Time  `db:"started_at"`
+	EndedBy   string     `db:"ended_by"`
+	EndedAt   *time.Time `db:"ended_at"`
+}
+
+// EmergencySnapshot is the state of a tablet captured from its last report before the broadcast,
+// used to restore it on "all clear".
+type EmergencySnapshot struct {
+	EmergencyID       int64  `db:"emergency_id"`
+	TabletID          int64  `db:"tablet_id"`
+	HasReport         bool   `db:"has_report"`
+	CurrentURL        string `db:"current_url"`
+	AudioVolume       int    `db:"audio_volume"`
+	ScreenOn          bool   `db:"screen_on"`
+	ScreensaverActive bool   `db:"screensaver_active"`
+}
+
+var ErrEmergencyActive = errors.New("emergency_already_active")
+
+type EmergencyRepository interface {
+	InitTable() error
+	// Start enregistre l'alerte et les snapshots dans une seule transaction
+	Start(e *Emergency, snapshots []EmergencySnapshot) error
+	End(id int64, endedBy string) error
+	GetActive() (*Emergency, error)
+	GetSnapshots(emergencyID int64) ([]EmergencySnapshot, error)
+	GetRecent(limit int) ([]Emergency, error)
+}
+
+type sqliteEmergencyRepo struct {
+	db *sqlx.DB
+}
+
+func NewEmergencyRepository(db *sqlx.DB) EmergencyRepository {
+	return &sqliteEmergencyRepo{db: db}
+}
+
+func (r *sqliteEmergencyRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS emergencies (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message TEXT,
+		alert_url TEXT,
+		sound_url TEXT,
+		speak BOOLEAN DEFAULT 0,
+		group_ids TEXT,
+		started_by TEXT,
+		started_at DATETIME NOT NULL,
+		ended_by TEXT DEFAULT '',
+		ended_at DATETIME
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_emergencies_single_active ON emergencies((ended_at IS NULL)) WHERE ended_at IS NULL;
+
+	CREATE TABLE IF NOT EXISTS emergency_snapshots (
+		emergency_id INTEGER NOT NULL,
+		tablet_id INTEGER NOT NULL,
+		has_report BOOLEAN DEFAULT 0,
+		current_url TEXT,
+		audio_volume INTEGER,
+		screen_on BOOLEAN,
+		screensaver_active BOOLEAN,
+		PRIMARY KEY (emergency_id, tablet_id),
+		FOREIGN KEY (emergency_id) REFERENCES emergencies(id) ON DELETE CASCADE,
+		FOREIGN KEY (tablet_id) REFERENCES tablets(id) ON DELETE CASCADE
+	);`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+func (r *sqliteEmergencyRepo) Start(e *Emergency, snapshots []EmergencySnapshot) error {
+	if e.StartedAt.IsZero() {
+		e.StartedAt = time.Now()
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var active int
+	if err := tx.Get(&active, "SELECT COUNT(*) FROM emergencies WHERE ended_at IS NULL"); err != nil {
+		return err
+	}
+	if active > 0 {
+		return ErrEmergencyActive
+	}
+
+	res, err := tx.NamedExec(`INSERT INTO emergencies (message, alert_url, sound_url, speak, group_ids, started_by, started_at)
+		VALUES (:message, :alert_url, :sound_url, :speak, :group_ids, :started_by, :started_at)`, e)
+	if err != nil {
+		return err
+	}
+	if e.ID, err = res.LastInsertId(); err != nil {
+		return err
+	}
+
+	for i := range snapshots {
+		snapshots[i].EmergencyID = e.ID
+		if _, err := tx.NamedExec(`INSERT INTO emergency_snapshots
+			(emergency_id, tablet_id, has_report, current_url, audio_volume, screen_on, screensaver_active)
+			VALUES (:emergency_id, :tablet_id, :has_report, :current_url, :audio_volume, :screen_on, :screensaver_active)`, snapshots[i]); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqliteEmergencyRepo) End(id int64, endedBy string) error {
+	_, err := r.db.Exec("UPDATE emergencies SET ended_at = ?, ended_by = ? WHERE id = ? AND ended_at IS NULL", time.Now(), endedBy, id)
+	return err
+}
+
+// GetActive renvoie (nil, nil) si aucune alerte n'est en cours
+func (r *sqliteEmergencyRepo) GetActive() (*Emergency, error) {
+	var e Emergency
+	err := r.db.Get(&e, "SELECT * FROM emergencies WHERE ended_at IS NULL LIMIT 1")
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *sqliteEmergencyRepo) GetSnapshots(emergencyID int64) ([]EmergencySnapshot, error) {
+	var snaps []EmergencySnapshot
+	err := r.db.Select(&snaps, "SELECT * FROM emergency_snapshots WHERE emergency_id = ?", emergencyID)
+	return snaps, err
+}
+
+func (r *sqliteEmergencyRepo) GetRecent(limit int) ([]Emergency, error) {
+	var list []Emergency
+	err := r.db.Select(&list, "SELECT * FROM emergencies ORDER BY started_at DESC LIMIT ?", limit)
+	return list, err
+}
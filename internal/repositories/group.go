@@ -24,6 +24,8 @@ type GroupRepository interface {
 	AddTabletToGroup(tabletID, groupID int64) error
 	RemoveTabletFromGroup(tabletID, groupID int64) error
 	GetGroupsByTablet(tabletID int64) ([]Group, error)
+	// GetAllMemberships renvoie les groupes de chaque tablette en une seule requête
+	GetAllMemberships() (map[int64][]Group, error)
 	GetTabletsByGroup(groupID int64) ([]Tablet, error) // Ajouté
 }
 
@@ -116,6 +118,26 @@ func (r *sqliteGroupRepo) GetGroupsByTablet(tabletID int64) ([]Group, error) {
 	return groups, err
 }
 
+func (r *sqliteGroupRepo) GetAllMemberships() (map[int64][]Group, error) {
+	var rows []struct {
+		TabletID int64 `db:"tablet_id"`
+		Group
+	}
+	query := `
+        SELECT tg.tablet_id, g.* FROM tablet_groups tg
+        JOIN groups g ON g.id = tg.group_id
+        ORDER BY g.name ASC`
+	if err := r.db.Select(&rows, query); err != nil {
+		return nil, err
+	}
+
+	memberships := make(map[int64][]Group)
+	for _, row := range rows {
+		memberships[row.TabletID] = append(memberships[row.TabletID], row.Group)
+	}
+	return memberships, nil
+}
+
 // Récupère toutes les tablettes appartenant à un groupe spécifique
 func (r *sqliteGroupRepo) GetTabletsByGroup(groupID int64) ([]Tablet, error) {
 	var tablets []Tablet
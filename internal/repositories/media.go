@@ -0,0 +1,222 @@
+package repositories
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Media is a file of the hub media library, stored under MEDIA_DIR/<collection dir>/<file_name>
+type Media struct {
+	ID         int64     `db:"id"`
+	Collection string    `db:"collection"`
+	Name       string    `db:"name"`
+	FileName   string    `db:"file_name"`
+	MimeType   string    `db:"mime_type"`
+	Size       int64     `db:"size"`
+	SHA256     string    `db:"sha256"`
+	UploadedBy string    `db:"uploaded_by"`
+	Tags       string    `db:"tags"`
+	CreatedAt  time.Time `db:"created_at"`
+
+	// Résultat du dernier contrôle d'intégrité (scrub)
+	Status     string     `db:"status"` // ok, missing, corrupt
+	VerifiedAt *time.Time `db:"verified_at"`
+}
+
+const (
+	MediaStatusOK      = "ok"
+	MediaStatusMissing = "missing"
+	MediaStatusCorrupt = "corrupt"
+)
+
+// MediaAccess trace un téléchargement d'un fichier de la bibliothèque
+type MediaAccess struct {
+	ID         int64     `db:"id"`
+	MediaID    int64     `db:"media_id"`
+	TabletID   *int64    `db:"tablet_id"` // nil si l'IP ne correspond à aucune tablette connue
+	TabletName string    `db:"tablet_name"`
+	IP         string    `db:"ip"`
+	Status     int       `db:"status"`
+	Bytes      int64     `db:"bytes"`
+	AccessedAt time.Time `db:"accessed_at"`
+}
+
+func (m Media) TagList() []string {
+	return Preset{Tags: m.Tags}.TagList()
+}
+
+// Extension renvoie l'extension du fichier sans le point, pour l'affichage
+func (m Media) Extension() string {
+	if i := strings.LastIndex(m.FileName, "."); i >= 0 {
+		return m.FileName[i+1:]
+	}
+	return ""
+}
+
+type MediaRepository interface {
+	InitTable() error
+	Create(m *Media) (int64, error)
+	GetAll(collection string) ([]Media, error)
+	GetByID(id int64) (*Media, error)
+	GetByHash(sha string) (*Media, error)
+	GetByFile(collection, fileName string) (*Media, error)
+	Update(m *Media) error
+	Delete(id int64) error
+
+	TotalSize() (int64, error)
+	SetStatus(id int64, status string) error
+
+	// Journal d'accès
+	LogAccess(a *MediaAccess) error
+	// GetLastAccess renvoie le dernier téléchargement de chaque client pour un fichier
+	GetLastAccess(mediaID int64, limit int) ([]MediaAccess, error)
+	CleanupAccess(days int) error
+}
+
+type sqliteMediaRepo struct {
+	db *sqlx.DB
+}
+
+func NewMediaRepository(db *sqlx.DB) MediaRepository {
+	return &sqliteMediaRepo{db: db}
+}
+
+func (r *sqliteMediaRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS media (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		collection TEXT NOT NULL,
+		name TEXT NOT NULL,
+		file_name TEXT NOT NULL,
+		mime_type TEXT DEFAULT '',
+		size INTEGER DEFAULT 0,
+		sha256 TEXT NOT NULL,
+		uploaded_by TEXT DEFAULT '',
+		tags TEXT DEFAULT '',
+		created_at DATETIME NOT NULL,
+		UNIQUE (collection, file_name)
+	);
+	CREATE INDEX IF NOT EXISTS idx_media_sha256 ON media(sha256);
+
+	CREATE TABLE IF NOT EXISTS media_access (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		media_id INTEGER NOT NULL,
+		tablet_id INTEGER,
+		ip TEXT NOT NULL,
+		status INTEGER DEFAULT 0,
+		bytes INTEGER DEFAULT 0,
+		accessed_at DATETIME NOT NULL,
+		FOREIGN KEY (media_id) REFERENCES media(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_media_access_media ON media_access(media_id, accessed_at);`
+
+	if _, err := r.db.Exec(query); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(r.db, "media", "status", "TEXT DEFAULT 'ok'"); err != nil {
+		return err
+	}
+	return addColumnIfMissing(r.db, "media", "verified_at", "DATETIME")
+}
+
+func (r *sqliteMediaRepo) Create(m *Media) (int64, error) {
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	if m.Status == "" {
+		m.Status = MediaStatusOK
+	}
+	res, err := r.db.NamedExec(`INSERT INTO media (collection, name, file_name, mime_type, size, sha256, uploaded_by, tags, created_at, status)
+		VALUES (:collection, :name, :file_name, :mime_type, :size, :sha256, :uploaded_by, :tags, :created_at, :status)`, m)
+	if err != nil {
+		return 0, err
+	}
+	m.ID, err = res.LastInsertId()
+	return m.ID, err
+}
+
+// GetAll renvoie tout le contenu d'une collection, ou de toute la bibliothèque si collection est vide
+func (r *sqliteMediaRepo) GetAll(collection string) ([]Media, error) {
+	var media []Media
+	var err error
+	if collection == "" {
+		err = r.db.Select(&media, "SELECT * FROM media ORDER BY created_at DESC")
+	} else {
+		err = r.db.Select(&media, "SELECT * FROM media WHERE collection = ? ORDER BY created_at DESC", collection)
+	}
+	return media, err
+}
+
+func (r *sqliteMediaRepo) GetByID(id int64) (*Media, error) {
+	var m Media
+	if err := r.db.Get(&m, "SELECT * FROM media WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *sqliteMediaRepo) GetByHash(sha string) (*Media, error) {
+	var m Media
+	if err := r.db.Get(&m, "SELECT * FROM media WHERE sha256 = ? LIMIT 1", sha); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *sqliteMediaRepo) GetByFile(collection, fileName string) (*Media, error) {
+	var m Media
+	if err := r.db.Get(&m, "SELECT * FROM media WHERE collection = ? AND file_name = ?", collection, fileName); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Update ne modifie que les métadonnées éditables : le fichier sur disque (et donc son URL) ne change pas
+func (r *sqliteMediaRepo) Update(m *Media) error {
+	_, err := r.db.NamedExec(`UPDATE media SET name = :name, tags = :tags WHERE id = :id`, m)
+	return err
+}
+
+func (r *sqliteMediaRepo) Delete(id int64) error {
+	_, err := r.db.Exec("DELETE FROM media WHERE id = ?", id)
+	return err
+}
+
+func (r *sqliteMediaRepo) TotalSize() (int64, error) {
+	var total int64
+	err := r.db.Get(&total, "SELECT COALESCE(SUM(size), 0) FROM media")
+	return total, err
+}
+
+func (r *sqliteMediaRepo) SetStatus(id int64, status string) error {
+	_, err := r.db.Exec("UPDATE media SET status = ?, verified_at = ? WHERE id = ?", status, time.Now(), id)
+	return err
+}
+
+// LogAccess résout la tablette au moment du téléchargement, d'après son IP
+func (r *sqliteMediaRepo) LogAccess(a *MediaAccess) error {
+	if a.AccessedAt.IsZero() {
+		a.AccessedAt = time.Now()
+	}
+	_, err := r.db.Exec(`INSERT INTO media_access (media_id, tablet_id, ip, status, bytes, accessed_at)
+		VALUES (?, (SELECT id FROM tablets WHERE ip = ?), ?, ?, ?, ?)`,
+		a.MediaID, a.IP, a.IP, a.Status, a.Bytes, a.AccessedAt)
+	return err
+}
+
+func (r *sqliteMediaRepo) GetLastAccess(mediaID int64, limit int) ([]MediaAccess, error) {
+	var access []MediaAccess
+	query := `SELECT a.id, a.media_id, a.tablet_id, COALESCE(t.name, '') AS tablet_name, a.ip, a.status, a.bytes, a.accessed_at
+		FROM media_access a
+		LEFT JOIN tablets t ON t.id = a.tablet_id
+		WHERE a.id IN (SELECT MAX(id) FROM media_access WHERE media_id = ? GROUP BY ip)
+		ORDER BY a.accessed_at DESC LIMIT ?`
+	err := r.db.Select(&access, query, mediaID, limit)
+	return access, err
+}
+
+func (r *sqliteMediaRepo) CleanupAccess(days int) error {
+	_, err := r.db.Exec(`DELETE FROM media_access WHERE accessed_at < ?`, time.Now().AddDate(0, 0, -days))
+	return err
+}
@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Preset is a named URL from the content library that can be pushed to tablets
+type Preset struct {
+	ID        int64     `db:"id"`
+	Title     string    `db:"title"`
+	URL       string    `db:"url"`
+	Tags      string    `db:"tags"` // CSV
+	Thumbnail string    `db:"thumbnail"`
+	CreatedAt time.Time `db:"created_at"`
+
+	// Résultat du dernier test d'accessibilité depuis le hub
+	CheckedAt  *time.Time `db:"checked_at"`
+	Reachable  bool       `db:"reachable"`
+	CheckError string     `db:"check_error"`
+}
+
+// TagList découpe le champ Tags en liste propre
+func (p Preset) TagList() []string {
+	var tags []string
+	for _, t := range strings.Split(p.Tags, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+type PresetRepository interface {
+	InitTable() error
+	Create(p *Preset) (int64, error)
+	Update(p *Preset) error
+	Delete(id int64) error
+	GetAll() ([]Preset, error)
+	GetByID(id int64) (*Preset, error)
+	SaveCheck(id int64, reachable bool, checkErr string) error
+}
+
+type sqlitePresetRepo struct {
+	db *sqlx.DB
+}
+
+func NewPresetRepository(db *sqlx.DB) PresetRepository {
+	return &sqlitePresetRepo{db: db}
+}
+
+func (r *sqlitePresetRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS presets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT NOT NULL,
+		url TEXT NOT NULL,
+		tags TEXT DEFAULT '',
+		thumbnail TEXT DEFAULT '',
+		created_at DATETIME NOT NULL,
+		checked_at DATETIME,
+		reachable BOOLEAN DEFAULT 0,
+		check_error TEXT DEFAULT ''
+	);`
+	_, err := r.db.Exec(query)
+	return err
+}
+
+func (r *sqlitePresetRepo) Create(p *Preset) (int64, error) {
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = time.Now()
+	}
+	query := `INSERT INTO presets (title, url, tags, thumbnail, created_at)
+		VALUES (:title, :url, :tags, :thumbnail, :created_at)`
+	res, err := r.db.NamedExec(query, p)
+	if err != nil {
+		return 0, err
+	}
+	p.ID, err = res.LastInsertId()
+	return p.ID, err
+}
+
+func (r *sqlitePresetRepo) Update(p *Preset) error {
+	query := `UPDATE presets SET title=:title, url=:url, tags=:tags, thumbnail=:thumbnail WHERE id=:id`
+	_, err := r.db.NamedExec(query, p)
+	return err
+}
+
+func (r *sqlitePresetRepo) Delete(id int64) error {
+	_, err := r.db.Exec("DELETE FROM presets WHERE id = ?", id)
+	return err
+}
+
+func (r *sqlitePresetRepo) GetAll() ([]Preset, error) {
+	var presets []Preset
+	err := r.db.Select(&presets, "SELECT * FROM presets ORDER BY title ASC")
+	return presets, err
+}
+
+func (r *sqlitePresetRepo) GetByID(id int64) (*Preset, error) {
+	var p Preset
+	err := r.db.Get(&p, "SELECT * FROM presets WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *sqlitePresetRepo) SaveCheck(id int64, reachable bool, checkErr string) error {
+	_, err := r.db.Exec("UPDATE presets SET checked_at = ?, reachable = ?, check_error = ? WHERE id = ?", time.Now(), reachable, checkErr, id)
+	return err
+}
@@ -76,6 +76,14 @@ type TabletReport struct {
 	MemoryUsedPct   int  `db:"memory_used_percent"`
 	LowMemory       bool `db:"low_memory"`
 
+	// Tailnet (vu depuis le nœud Tailscale du hub, indépendamment de l'app)
+	TailnetChecked   bool       `db:"tailnet_checked"` // la tablette est un pair connu du tailnet
+	TailnetOnline    bool       `db:"tailnet_online"`
+	TailnetHandshake *time.Time `db:"tailnet_handshake"`
+	TailnetPath      string     `db:"tailnet_path"` // direct, derp:<région> ou peer-relay
+	TailnetLatencyMs float64    `db:"tailnet_latency_ms"`
+	TailnetNodeID    string     `db:"tailnet_node_id"` // identifiant stable du nœud Tailscale
+
 	Timestamp time.Time `db:"timestamp"`
 }
 
@@ -83,6 +91,8 @@ type ReportRepository interface {
 	InitTable() error
 	Add(r *TabletReport) error
 	GetLatestByTablet(tabletID int64, onlySuccess bool) (*TabletReport, error)
+	GetLatestAll(onlySuccess bool) ([]TabletReport, error)
+	GetByIDs(ids []int64) ([]TabletReport, error)
 	GetHistory(tabletID int64, limit int) ([]TabletReport, error)
 	Cleanup(days int) error
 }
@@ -116,8 +126,22 @@ func (r *sqliteReportRepo) InitTable() error {
 	);
 	CREATE INDEX IF NOT EXISTS idx_reports_tablet_id ON reports(tablet_id);`
 
-	_, err := r.db.Exec(query)
-	return err
+	if _, err := r.db.Exec(query); err != nil {
+		return err
+	}
+	for _, col := range [][2]string{
+		{"tailnet_checked", "BOOLEAN DEFAULT 0"},
+		{"tailnet_online", "BOOLEAN DEFAULT 0"},
+		{"tailnet_handshake", "DATETIME"},
+		{"tailnet_path", "TEXT DEFAULT ''"},
+		{"tailnet_latency_ms", "REAL DEFAULT 0"},
+		{"tailnet_node_id", "TEXT DEFAULT ''"},
+	} {
+		if err := addColumnIfMissing(r.db, "reports", col[0], col[1]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *sqliteReportRepo) Add(report *TabletReport) error {
@@ -136,6 +160,7 @@ func (r *sqliteReportRepo) Add(report *TabletReport) error {
 		auto_brightness_enabled, auto_brightness_min, auto_brightness_max, auto_brightness_current,
 		storage_total_mb, storage_available_mb, storage_used_mb, storage_used_percent,
 		memory_total_mb, memory_available_mb, memory_used_mb, memory_used_percent, low_memory,
+		tailnet_checked, tailnet_online, tailnet_handshake, tailnet_path, tailnet_latency_ms, tailnet_node_id,
 		timestamp
 	) VALUES (
 		:tablet_id, :success, :battery_level, :battery_charging, :battery_plugged,
@@ -148,6 +173,7 @@ func (r *sqliteReportRepo) Add(report *TabletReport) error {
 		:auto_brightness_enabled, :auto_brightness_min, :auto_brightness_max, :auto_brightness_current,
 		:storage_total_mb, :storage_available_mb, :storage_used_mb, :storage_used_percent,
 		:memory_total_mb, :memory_available_mb, :memory_used_mb, :memory_used_percent, :low_memory,
+		:tailnet_checked, :tailnet_online, :tailnet_handshake, :tailnet_path, :tailnet_latency_ms, :tailnet_node_id,
 		:timestamp
 	)`
 
@@ -171,6 +197,33 @@ func (r *sqliteReportRepo) GetLatestByTablet(tabletID int64, onlySuccess bool) (
 	return &rep, nil
 }
 
+// GetLatestAll renvoie le dernier rapport de chaque tablette en une seule requête
+func (r *sqliteReportRepo) GetLatestAll(onlySuccess bool) ([]TabletReport, error) {
+	var reports []TabletReport
+
+	inner := "SELECT MAX(id) FROM reports"
+	if onlySuccess {
+		inner += " WHERE success = 1"
+	}
+	inner += " GROUP BY tablet_id"
+
+	err := r.db.Select(&reports, "SELECT * FROM reports WHERE id IN ("+inner+")")
+	return reports, err
+}
+
+func (r *sqliteReportRepo) GetByIDs(ids []int64) ([]TabletReport, error) {
+	var reports []TabletReport
+	if len(ids) == 0 {
+		return reports, nil
+	}
+	query, args, err := sqlx.In("SELECT * FROM reports WHERE id IN (?)", ids)
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.Select(&reports, r.db.Rebind(query), args...)
+	return reports, err
+}
+
 func (r *sqliteReportRepo) GetHistory(tabletID int64, limit int) ([]TabletReport, error) {
 	var history []TabletReport
 	err := r.db.Select(&history, "SELECT * FROM reports WHERE tablet_id = ? ORDER BY timestamp DESC LIMIT ?", tabletID, limit)
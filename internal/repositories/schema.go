@@ -0,0 +1,22 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// addColumnIfMissing fait évoluer une table existante : CREATE TABLE IF NOT EXISTS
+// ne touche pas aux bases créées par une version précédente du hub.
+func addColumnIfMissing(db *sqlx.DB, table, column, definition string) error {
+	var count int
+	err := db.Get(&count, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
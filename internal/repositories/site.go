@@ -0,0 +1,146 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Site is a static HTML bundle hosted by the hub and served to tablets
+type Site struct {
+	ID              int64     `db:"id"`
+	Slug            string    `db:"slug"`
+	Name            string    `db:"name"`
+	CurrentVersion  int       `db:"current_version"`
+	PreviousVersion int       `db:"previous_version"`
+	CreatedAt       time.Time `db:"created_at"`
+}
+
+type SiteVersion struct {
+	ID         int64     `db:"id"`
+	SiteID     int64     `db:"site_id"`
+	Version    int       `db:"version"`
+	Files      int       `db:"files"`
+	Size       int64     `db:"size"`
+	Note       string    `db:"note"`
+	UploadedAt time.Time `db:"uploaded_at"`
+}
+
+type SiteRepository interface {
+	InitTable() error
+	Create(s *Site) (int64, error)
+	GetAll() ([]Site, error)
+	GetByID(id int64) (*Site, error)
+	GetBySlug(slug string) (*Site, error)
+	Delete(id int64) error
+
+	// Versions
+	AddVersion(v *SiteVersion) error
+	GetVersions(siteID int64) ([]SiteVersion, error)
+	NextVersion(siteID int64) (int, error)
+	SetCurrentVersion(siteID int64, version int) error
+}
+
+type sqliteSiteRepo struct {
+	db *sqlx.DB
+}
+
+func NewSiteRepository(db *sqlx.DB) SiteRepository {
+	return &sqliteSiteRepo{db: db}
+}
+
+func (r *sqliteSiteRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS sites (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		slug TEXT NOT NULL UNIQUE,
+		name TEXT NOT NULL,
+		current_version INTEGER DEFAULT 0,
+		previous_version INTEGER DEFAULT 0,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS site_versions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		site_id INTEGER NOT NULL,
+		version INTEGER NOT NULL,
+		files INTEGER DEFAULT 0,
+		size INTEGER DEFAULT 0,
+		note TEXT DEFAULT '',
+		uploaded_at DATETIME NOT NULL,
+		UNIQUE (site_id, version),
+		FOREIGN KEY (site_id) REFERENCES sites(id) ON DELETE CASCADE
+	);`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+func (r *sqliteSiteRepo) Create(s *Site) (int64, error) {
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+	res, err := r.db.NamedExec(`INSERT INTO sites (slug, name, created_at) VALUES (:slug, :name, :created_at)`, s)
+	if err != nil {
+		return 0, err
+	}
+	s.ID, err = res.LastInsertId()
+	return s.ID, err
+}
+
+func (r *sqliteSiteRepo) GetAll() ([]Site, error) {
+	var sites []Site
+	err := r.db.Select(&sites, "SELECT * FROM sites ORDER BY name ASC")
+	return sites, err
+}
+
+func (r *sqliteSiteRepo) GetByID(id int64) (*Site, error) {
+	var s Site
+	if err := r.db.Get(&s, "SELECT * FROM sites WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *sqliteSiteRepo) GetBySlug(slug string) (*Site, error) {
+	var s Site
+	if err := r.db.Get(&s, "SELECT * FROM sites WHERE slug = ?", slug); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *sqliteSiteRepo) Delete(id int64) error {
+	_, err := r.db.Exec("DELETE FROM sites WHERE id = ?", id)
+	return err
+}
+
+func (r *sqliteSiteRepo) AddVersion(v *SiteVersion) error {
+	if v.UploadedAt.IsZero() {
+		v.UploadedAt = time.Now()
+	}
+	res, err := r.db.NamedExec(`INSERT INTO site_versions (site_id, version, files, size, note, uploaded_at)
+		VALUES (:site_id, :version, :files, :size, :note, :uploaded_at)`, v)
+	if err != nil {
+		return err
+	}
+	v.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *sqliteSiteRepo) GetVersions(siteID int64) ([]SiteVersion, error) {
+	var versions []SiteVersion
+	err := r.db.Select(&versions, "SELECT * FROM site_versions WHERE site_id = ? ORDER BY version DESC", siteID)
+	return versions, err
+}
+
+func (r *sqliteSiteRepo) NextVersion(siteID int64) (int, error) {
+	var next int
+	err := r.db.Get(&next, "SELECT COALESCE(MAX(version), 0) + 1 FROM site_versions WHERE site_id = ?", siteID)
+	return next, err
+}
+
+// SetCurrentVersion active une version et garde l'ancienne pour un rollback immédiat
+func (r *sqliteSiteRepo) SetCurrentVersion(siteID int64, version int) error {
+	_, err := r.db.Exec(`UPDATE sites SET previous_version = current_version, current_version = ? WHERE id = ?`, version, siteID)
+	return err
+}
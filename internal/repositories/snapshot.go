@@ -0,0 +1,176 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Snapshot est une photo prise par la caméra d'une tablette, rangée dans la collection "snapshot"
+type Snapshot struct {
+	ID       int64     `db:"id"`
+	TabletID int64     `db:"tablet_id"`
+	MediaID  int64     `db:"media_id"`
+	Camera   string    `db:"camera"`  // front, back
+	Trigger  string    `db:"trigger"` // manual, schedule
+	TakenBy  string    `db:"taken_by"`
+	TakenAt  time.Time `db:"taken_at"`
+}
+
+// SnapshotSchedule déclenche une photo toutes les IntervalMinutes sur une tablette
+type SnapshotSchedule struct {
+	TabletID        int64      `db:"tablet_id"`
+	Camera          string     `db:"camera"`
+	IntervalMinutes int        `db:"interval_minutes"`
+	Enabled         bool       `db:"enabled"`
+	LastRunAt       *time.Time `db:"last_run_at"`
+}
+
+type SnapshotRepository interface {
+	InitTable() error
+	Create(s *Snapshot) error
+	GetByID(id int64) (*Snapshot, error)
+	GetByTablet(tabletID int64, limit int) ([]Snapshot, error)
+	Delete(id int64) error
+	// OrphanMedia liste les fichiers de la collection "snapshot" qui ne sont plus référencés
+	// (photos purgées, ou supprimées avec leur tablette)
+	OrphanMedia() ([]int64, error)
+	// Unreferenced garde parmi mediaIDs les fichiers de la collection "snapshot" qu'aucune photo n'utilise plus
+	Unreferenced(mediaIDs []int64) ([]int64, error)
+
+	// Rétention : photos plus anciennes que before, ou au-delà des keep plus récentes d'une tablette
+	GetOlderThan(before time.Time) ([]Snapshot, error)
+	GetBeyond(tabletID int64, keep int) ([]Snapshot, error)
+
+	GetSchedule(tabletID int64) (*SnapshotSchedule, error)
+	SaveSchedule(s *SnapshotSchedule) error
+	MarkScheduleRun(tabletID int64, at time.Time) error
+	GetEnabledSchedules() ([]SnapshotSchedule, error)
+}
+
+type sqliteSnapshotRepo struct {
+	db *sqlx.DB
+}
+
+func NewSnapshotRepository(db *sqlx.DB) SnapshotRepository {
+	return &sqliteSnapshotRepo{db: db}
+}
+
+func (r *sqliteSnapshotRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS snapshots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tablet_id INTEGER NOT NULL,
+		media_id INTEGER NOT NULL,
+		camera TEXT NOT NULL,
+		trigger TEXT NOT NULL,
+		taken_by TEXT DEFAULT '',
+		taken_at DATETIME NOT NULL,
+		FOREIGN KEY (tablet_id) REFERENCES tablets(id) ON DELETE CASCADE,
+		FOREIGN KEY (media_id) REFERENCES media(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_snapshots_tablet ON snapshots(tablet_id, taken_at);
+
+	CREATE TABLE IF NOT EXISTS snapshot_schedules (
+		tablet_id INTEGER PRIMARY KEY,
+		camera TEXT NOT NULL,
+		interval_minutes INTEGER NOT NULL,
+		enabled BOOLEAN DEFAULT 1,
+		last_run_at DATETIME,
+		FOREIGN KEY (tablet_id) REFERENCES tablets(id) ON DELETE CASCADE
+	);`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+func (r *sqliteSnapshotRepo) Create(s *Snapshot) error {
+	if s.TakenAt.IsZero() {
+		s.TakenAt = time.Now()
+	}
+	res, err := r.db.NamedExec(`INSERT INTO snapshots (tablet_id, media_id, camera, trigger, taken_by, taken_at)
+		VALUES (:tablet_id, :media_id, :camera, :trigger, :taken_by, :taken_at)`, s)
+	if err != nil {
+		return err
+	}
+	s.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *sqliteSnapshotRepo) GetByID(id int64) (*Snapshot, error) {
+	var s Snapshot
+	if err := r.db.Get(&s, "SELECT * FROM snapshots WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *sqliteSnapshotRepo) GetByTablet(tabletID int64, limit int) ([]Snapshot, error) {
+	var list []Snapshot
+	err := r.db.Select(&list, "SELECT * FROM snapshots WHERE tablet_id = ? ORDER BY taken_at DESC, id DESC LIMIT ?", tabletID, limit)
+	return list, err
+}
+
+func (r *sqliteSnapshotRepo) Delete(id int64) error {
+	_, err := r.db.Exec("DELETE FROM snapshots WHERE id = ?", id)
+	return err
+}
+
+func (r *sqliteSnapshotRepo) OrphanMedia() ([]int64, error) {
+	var ids []int64
+	err := r.db.Select(&ids, `SELECT id FROM media WHERE collection = 'snapshot'
+		AND id NOT IN (SELECT media_id FROM snapshots)`)
+	return ids, err
+}
+
+func (r *sqliteSnapshotRepo) Unreferenced(mediaIDs []int64) ([]int64, error) {
+	var ids []int64
+	if len(mediaIDs) == 0 {
+		return ids, nil
+	}
+	query, args, err := sqlx.In(`SELECT id FROM media WHERE id IN (?) AND collection = 'snapshot'
+		AND id NOT IN (SELECT media_id FROM snapshots)`, mediaIDs)
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.Select(&ids, r.db.Rebind(query), args...)
+	return ids, err
+}
+
+func (r *sqliteSnapshotRepo) GetOlderThan(before time.Time) ([]Snapshot, error) {
+	var list []Snapshot
+	err := r.db.Select(&list, "SELECT * FROM snapshots WHERE taken_at < ?", before)
+	return list, err
+}
+
+func (r *sqliteSnapshotRepo) GetBeyond(tabletID int64, keep int) ([]Snapshot, error) {
+	var list []Snapshot
+	err := r.db.Select(&list, `SELECT * FROM snapshots WHERE tablet_id = ?
+		ORDER BY taken_at DESC, id DESC LIMIT -1 OFFSET ?`, tabletID, keep)
+	return list, err
+}
+
+func (r *sqliteSnapshotRepo) GetSchedule(tabletID int64) (*SnapshotSchedule, error) {
+	var s SnapshotSchedule
+	if err := r.db.Get(&s, "SELECT * FROM snapshot_schedules WHERE tablet_id = ?", tabletID); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *sqliteSnapshotRepo) SaveSchedule(s *SnapshotSchedule) error {
+	_, err := r.db.NamedExec(`INSERT INTO snapshot_schedules (tablet_id, camera, interval_minutes, enabled)
+		VALUES (:tablet_id, :camera, :interval_minutes, :enabled)
+		ON CONFLICT(tablet_id) DO UPDATE SET camera=excluded.camera, interval_minutes=excluded.interval_minutes, enabled=excluded.enabled`, s)
+	return err
+}
+
+func (r *sqliteSnapshotRepo) MarkScheduleRun(tabletID int64, at time.Time) error {
+	_, err := r.db.Exec("UPDATE snapshot_schedules SET last_run_at = ? WHERE tablet_id = ?", at, tabletID)
+	return err
+}
+
+func (r *sqliteSnapshotRepo) GetEnabledSchedules() ([]SnapshotSchedule, error) {
+	var list []SnapshotSchedule
+	err := r.db.Select(&list, "SELECT * FROM snapshot_schedules WHERE enabled = 1 AND interval_minutes > 0")
+	return list, err
+}
@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Snippet est un script JavaScript réutilisable, paramétré par des {{nom}} dans son code
+type Snippet struct {
+	ID          int64     `db:"id"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	Code        string    `db:"code"`
+	Params      string    `db:"params"` // noms des paramètres, séparés par des virgules
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+// SnippetRun garde la trace d'une exécution et des sorties renvoyées par chaque tablette
+type SnippetRun struct {
+	ID          int64     `db:"id"`
+	SnippetID   *int64    `db:"snippet_id"`
+	SnippetName string    `db:"snippet_name"`
+	Target      string    `db:"target"`
+	Params      string    `db:"params"`  // JSON nom → valeur
+	Code        string    `db:"code"`    // code effectivement envoyé
+	Results     string    `db:"results"` // JSON []TabletResult
+	Actor       string    `db:"actor"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+type SnippetRepository interface {
+	InitTable() error
+	Create(s *Snippet) error
+	Update(s *Snippet) error
+	Delete(id int64) error
+	GetByID(id int64) (*Snippet, error)
+	GetAll() ([]Snippet, error)
+
+	CreateRun(r *SnippetRun) error
+	GetRun(id int64) (*SnippetRun, error)
+	GetRuns(limit int) ([]SnippetRun, error)
+}
+
+type sqliteSnippetRepo struct {
+	db *sqlx.DB
+}
+
+func NewSnippetRepository(db *sqlx.DB) SnippetRepository {
+	return &sqliteSnippetRepo{db: db}
+}
+
+func (r *sqliteSnippetRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS snippets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT DEFAULT '',
+		code TEXT NOT NULL,
+		params TEXT DEFAULT '',
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS snippet_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		snippet_id INTEGER,
+		snippet_name TEXT NOT NULL,
+		target TEXT DEFAULT '',
+		params TEXT DEFAULT '{}',
+		code TEXT NOT NULL,
+		results TEXT DEFAULT '[]',
+		actor TEXT DEFAULT '',
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE SET NULL
+	);`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+func (r *sqliteSnippetRepo) Create(s *Snippet) error {
+	s.CreatedAt = time.Now()
+	s.UpdatedAt = s.CreatedAt
+	res, err := r.db.NamedExec(`INSERT INTO snippets (name, description, code, params, created_at, updated_at)
+		VALUES (:name, :description, :code, :params, :created_at, :updated_at)`, s)
+	if err != nil {
+		return err
+	}
+	s.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *sqliteSnippetRepo) Update(s *Snippet) error {
+	s.UpdatedAt = time.Now()
+	_, err := r.db.NamedExec(`UPDATE snippets SET name = :name, description = :description, code = :code,
+		params = :params, updated_at = :updated_at WHERE id = :id`, s)
+	return err
+}
+
+func (r *sqliteSnippetRepo) Delete(id int64) error {
+	_, err := r.db.Exec("DELETE FROM snippets WHERE id = ?", id)
+	return err
+}
+
+func (r *sqliteSnippetRepo) GetByID(id int64) (*Snippet, error) {
+	var s Snippet
+	if err := r.db.Get(&s, "SELECT * FROM snippets WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *sqliteSnippetRepo) GetAll() ([]Snippet, error) {
+	var list []Snippet
+	err := r.db.Select(&list, "SELECT * FROM snippets ORDER BY name ASC")
+	return list, err
+}
+
+func (r *sqliteSnippetRepo) CreateRun(run *SnippetRun) error {
+	run.CreatedAt = time.Now()
+	res, err := r.db.NamedExec(`INSERT INTO snippet_runs (snippet_id, snippet_name, target, params, code, results, actor, created_at)
+		VALUES (:snippet_id, :snippet_name, :target, :params, :code, :results, :actor, :created_at)`, run)
+	if err != nil {
+		return err
+	}
+	run.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *sqliteSnippetRepo) GetRun(id int64) (*SnippetRun, error) {
+	var run SnippetRun
+	if err := r.db.Get(&run, "SELECT * FROM snippet_runs WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *sqliteSnippetRepo) GetRuns(limit int) ([]SnippetRun, error) {
+	var list []SnippetRun
+	err := r.db.Select(&list, "SELECT * FROM snippet_runs ORDER BY created_at DESC LIMIT ?", limit)
+	return list, err
+}
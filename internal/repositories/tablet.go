@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"fmt"
+	"net"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -13,6 +15,71 @@ type Tablet struct {
 	Version  string    `db:"version"`
 	Online   bool      `db:"online"`
 	LastSeen time.Time `db:"last_seen"`
+	DeviceID string    `db:"device_id"` // identité stable de l'appareil, voir DeviceIdentity
+
+	// Profil de connexion : vides ou nuls, les réglages globaux s'appliquent
+	Host       string `db:"host"`        // nom ou adresse à joindre à la place de l'IP (NAT, DNS)
+	Port       string `db:"port"`        // remplace KIOSK_PORT
+	TimeoutSec int    `db:"timeout_sec"` // délai maximal d'une requête vers la tablette
+	KeySource  string `db:"key_source"`  // clé d'API envoyée, voir KeySource*
+
+	// Cycle de vie : une tablette retirée n'est plus interrogée mais garde son historique ;
+	// en maintenance, ses alertes et commandes planifiées sont suspendues jusqu'à MaintenanceUntil
+	RetiredAt        *time.Time `db:"retired_at"`
+	MaintenanceUntil *time.Time `db:"maintenance_until"`
+	MaintenanceNote  string     `db:"maintenance_note"`
+
+	TabletInventory
+}
+
+func (t Tablet) Retired() bool {
+	return t.RetiredAt != nil
+}
+
+func (t Tablet) InMaintenance(now time.Time) bool {
+	return t.MaintenanceUntil != nil && now.Before(*t.MaintenanceUntil)
+}
+
+// TabletInventory est la fiche d'inventaire d'une tablette, complétée par les champs personnalisés
+type TabletInventory struct {
+	Location    string `db:"location"`
+	AssetTag    string `db:"asset_tag"`
+	Serial      string `db:"serial"`
+	Owner       string `db:"owner"`
+	InstallDate string `db:"install_date"` // AAAA-MM-JJ
+	Notes       string `db:"notes"`
+}
+
+// Clé d'API envoyée à une tablette
+const (
+	KeySourceAuto  = ""      // sa propre clé si elle en a une, sinon la clé de flotte
+	KeySourceFleet = "fleet" // toujours la clé de flotte (KIOSK_API_KEY)
+	KeySourceNone  = "none"  // aucune clé
+)
+
+// Addr renvoie l'adresse host:port à laquelle joindre la tablette
+func (t Tablet) Addr(defaultPort string) string {
+	host, port := t.IP, defaultPort
+	if t.Host != "" {
+		host = t.Host
+	}
+	if t.Port != "" {
+		port = t.Port
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// tabletAddrMatch retrouve une tablette (alias t) par l'adresse host:port utilisée pour la joindre.
+// Une tablette sans port propre répond à tous les ports de son hôte, après celles qui le fixent.
+const tabletAddrMatch = `(CASE WHEN t.host <> '' THEN t.host ELSE t.ip END) = ? AND t.port IN (?, '')
+	ORDER BY t.port = '' LIMIT 1`
+
+func splitAddr(addr string) (string, string) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, ""
+	}
+	return host, port
 }
 
 type TabletRepository interface {
@@ -20,6 +87,36 @@ type TabletRepository interface {
 	Save(t *Tablet) error
 	GetAll() ([]Tablet, error)
 	GetByID(id int64) (*Tablet, error)
+	// GetByAddr retrouve la tablette jointe à l'adresse host:port
+	GetByAddr(addr string) (*Tablet, error)
+	// SaveConnection enregistre le profil de connexion, que Save ne modifie pas
+	SaveConnection(t *Tablet) error
+	// SaveInventory enregistre la fiche d'inventaire, que Save ne modifie pas non plus
+	SaveInventory(t *Tablet) error
+	Rename(id int64, name string) error
+	// SetRetired retire la tablette à la date donnée, ou la remet en service si at est nil
+	SetRetired(id int64, at *time.Time) error
+	// SetMaintenance met la tablette en maintenance jusqu'à until, ou y met fin si until est nil
+	SetMaintenance(id int64, until *time.Time, note string) error
+	// Delete supprime la tablette avec ses rapports, événements et réglages
+	Delete(id int64) error
+
+	// GetByDeviceID renvoie les tablettes rattachées à une identité d'appareil
+	GetByDeviceID(deviceID string) ([]Tablet, error)
+	SetDeviceID(id int64, deviceID string) error
+	// RecordAddress note que la tablette a répondu à cette IP
+	RecordAddress(id int64, ip string) error
+	GetAddresses(id int64) ([]TabletAddress, error)
+	// SwapAddresses échange les IP de deux tablettes, quand leurs appareils ont échangé leurs baux DHCP
+	SwapAddresses(a, b int64) error
+	// Merge rattache rapports, groupes, événements et réglages du doublon à la tablette conservée,
+	// complète ses champs vides puis supprime le doublon ; takeAddress lui donne l'IP du doublon
+	Merge(survivorID, duplicateID int64, takeAddress bool) error
+
+	// QueryFleet filtre, trie et pagine la flotte en une requête
+	QueryFleet(q FleetQuery) (*FleetResult, error)
+	// GetVersions liste les versions de l'app présentes dans la flotte
+	GetVersions() ([]string, error)
 }
 
 type sqliteTabletRepo struct {
@@ -39,23 +136,49 @@ func (r *sqliteTabletRepo) InitTable() error {
 		online BOOLEAN DEFAULT 0,
 		last_seen DATETIME
 	);`
-	_, err := r.db.Exec(query)
-	return err
+	if _, err := r.db.Exec(query); err != nil {
+		return err
+	}
+
+	for _, col := range [][2]string{
+		{"host", "TEXT DEFAULT ''"},
+		{"port", "TEXT DEFAULT ''"},
+		{"timeout_sec", "INTEGER DEFAULT 0"},
+		{"key_source", "TEXT DEFAULT ''"},
+		{"location", "TEXT DEFAULT ''"},
+		{"asset_tag", "TEXT DEFAULT ''"},
+		{"serial", "TEXT DEFAULT ''"},
+		{"owner", "TEXT DEFAULT ''"},
+		{"install_date", "TEXT DEFAULT ''"},
+		{"notes", "TEXT DEFAULT ''"},
+		{"device_id", "TEXT DEFAULT ''"},
+		{"retired_at", "DATETIME"},
+		{"maintenance_until", "DATETIME"},
+		{"maintenance_note", "TEXT DEFAULT ''"},
+	} {
+		if err := addColumnIfMissing(r.db, "tablets", col[0], col[1]); err != nil {
+			return err
+		}
+	}
+	return r.initIdentity()
 }
 
+// Save ajoute une tablette, ou enregistre l'état relevé par un scan d'une tablette existante.
+// Le nom et l'IP d'une tablette existante ne changent que par Rename, SwapAddresses ou Merge, et une
+// tablette supprimée pendant un scan n'est pas recréée.
 func (r *sqliteTabletRepo) Save(t *Tablet) error {
 	if t.LastSeen.IsZero() {
 		t.LastSeen = time.Now()
 	}
 
-	query := `INSERT INTO tablets (id, ip, name, version, online, last_seen)
-        VALUES (NULLIF(:id, 0), :ip, :name, :version, :online, :last_seen)
-        ON CONFLICT(id) DO UPDATE SET
-            ip=excluded.ip,
-            name=excluded.name,
-            version=excluded.version,
-            online=excluded.online,
-            last_seen=excluded.last_seen
+	if t.ID != 0 {
+		_, err := r.db.NamedExec(`UPDATE tablets SET version = :version, online = :online, last_seen = :last_seen
+			WHERE id = :id`, t)
+		return err
+	}
+
+	query := `INSERT INTO tablets (ip, name, version, online, last_seen)
+        VALUES (:ip, :name, :version, :online, :last_seen)
         ON CONFLICT(ip) DO UPDATE SET
             name=excluded.name,
             version=excluded.version,
@@ -77,3 +200,60 @@ func (r *sqliteTabletRepo) GetByID(id int64) (*Tablet, error) {
 	err := r.db.Get(&t, "SELECT * FROM tablets WHERE id = ?", id)
 	return &t, err
 }
+
+func (r *sqliteTabletRepo) GetByAddr(addr string) (*Tablet, error) {
+	host, port := splitAddr(addr)
+	var t Tablet
+	if err := r.db.Get(&t, "SELECT t.* FROM tablets t WHERE "+tabletAddrMatch, host, port); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *sqliteTabletRepo) SaveConnection(t *Tablet) error {
+	_, err := r.db.NamedExec(`UPDATE tablets SET host = :host, port = :port, timeout_sec = :timeout_sec, key_source = :key_source
+		WHERE id = :id`, t)
+	return err
+}
+
+func (r *sqliteTabletRepo) SaveInventory(t *Tablet) error {
+	_, err := r.db.NamedExec(`UPDATE tablets SET location = :location, asset_tag = :asset_tag, serial = :serial,
+		owner = :owner, install_date = :install_date, notes = :notes
+		WHERE id = :id`, t)
+	return err
+}
+
+func (r *sqliteTabletRepo) Rename(id int64, name string) error {
+	_, err := r.db.Exec("UPDATE tablets SET name = ? WHERE id = ?", name, id)
+	return err
+}
+
+func (r *sqliteTabletRepo) SetRetired(id int64, at *time.Time) error {
+	_, err := r.db.Exec("UPDATE tablets SET retired_at = ?, online = 0 WHERE id = ?", at, id)
+	return err
+}
+
+func (r *sqliteTabletRepo) SetMaintenance(id int64, until *time.Time, note string) error {
+	_, err := r.db.Exec("UPDATE tablets SET maintenance_until = ?, maintenance_note = ? WHERE id = ?", until, note, id)
+	return err
+}
+
+func (r *sqliteTabletRepo) Delete(id int64) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Les rapports et les accès aux médias n'ont pas de suppression en cascade ; les autres tables
+	// sont vidées explicitement, les clés étrangères n'étant pas activées sur toutes les connexions
+	for _, table := range mergedTables {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE tablet_id = ?", id); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM tablets WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,198 @@
+package repositories
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FleetQuery est une recherche du tableau de bord, exécutée en une seule requête avec le dernier
+// rapport et les groupes de chaque tablette ; un champ vide ne filtre pas.
+type FleetQuery struct {
+	Terms         []string // chacun doit apparaître dans un champ d'inventaire ou un champ personnalisé cherchable
+	GroupID       int64
+	Health        string     // état de santé, calculé comme services.TabletHealth
+	MaintenanceAt *time.Time // ne garde que les tablettes en maintenance à cette date
+	Version       string
+	BatteryMin    int // bornes incluses ; sans rapport réussi, une tablette est exclue
+	BatteryMax    int
+	Sort          string // name, ip, status, battery, last_seen ou version
+	Desc          bool
+	Limit         int // 0 = toutes
+	Offset        int
+}
+
+// FleetRow est une tablette du tableau de bord ; ses rapports sont à relire par leur identifiant
+type FleetRow struct {
+	Tablet
+	Health   string        `db:"health"`
+	ReportID sql.NullInt64 `db:"report_id"` // dernier rapport réussi
+	ProbeID  sql.NullInt64 `db:"probe_id"`  // dernière tentative, réussie ou non
+	GroupIDs []int64       `db:"-"`
+}
+
+type FleetResult struct {
+	Rows  []FleetRow
+	Total int // tablettes de la recherche, toutes pages confondues
+	Fleet int // taille de la flotte
+}
+
+// fleetSelect rassemble chaque tablette avec son dernier rapport, sa dernière tentative et son état de santé.
+// Le CASE doit suivre services.TabletHealth.
+const fleetSelect = `WITH last_report AS (
+		SELECT tablet_id, MAX(id) AS id FROM reports WHERE success = 1 GROUP BY tablet_id
+	), last_probe AS (
+		SELECT tablet_id, MAX(id) AS id FROM reports GROUP BY tablet_id
+	), fleet AS (
+		SELECT t.*,
+			lr.id AS report_id, r.battery_level AS battery,
+			lp.id AS probe_id,
+			CASE
+				WHEN t.retired_at IS NOT NULL THEN 'retired'
+				WHEN t.online THEN 'online'
+				WHEN p.id IS NULL OR NOT p.tailnet_checked THEN 'unknown'
+				WHEN p.tailnet_online THEN 'app-down'
+				ELSE 'network-down'
+			END AS health,
+			(SELECT group_concat(tg.group_id) FROM tablet_groups tg WHERE tg.tablet_id = t.id) AS group_ids
+		FROM tablets t
+		LEFT JOIN last_report lr ON lr.tablet_id = t.id
+		LEFT JOIN reports r ON r.id = lr.id
+		LEFT JOIN last_probe lp ON lp.tablet_id = t.id
+		LEFT JOIN reports p ON p.id = lp.id
+	)`
+
+// fleetSearchColumns sont les champs d'inventaire parcourus par la recherche
+var fleetSearchColumns = []string{"name", "ip", "host", "location", "asset_tag", "serial", "owner", "install_date", "notes"}
+
+// ipv4Order trie une adresse IPv4 octet par octet ; un nom d'hôte vaut 0 et se départage sur le texte
+func ipv4Order(col string) []string {
+	keys := make([]string, 0, 5)
+	rest := col
+	for range 4 {
+		keys = append(keys, "CAST("+rest+" AS INTEGER)")
+		rest = "substr(" + rest + ", instr(" + rest + ", '.') + 1)"
+	}
+	return append(keys, col)
+}
+
+var fleetOrder = map[string][]string{
+	"name":      {"lower(coalesce(f.name, ''))"},
+	"ip":        ipv4Order("f.ip"),
+	"status":    {"CASE f.health WHEN 'network-down' THEN 0 WHEN 'app-down' THEN 1 WHEN 'unknown' THEN 2 WHEN 'online' THEN 3 ELSE 4 END"},
+	"battery":   {"coalesce(f.battery, -1)"},
+	"last_seen": {"f.last_seen"},
+	"version":   {"coalesce(f.version, '')"},
+}
+
+func (q FleetQuery) where() (string, []any) {
+	var conds []string
+	var args []any
+
+	if len(q.Terms) > 0 {
+		fields := make([]string, len(fleetSearchColumns))
+		for i, c := range fleetSearchColumns {
+			fields[i] = "coalesce(f." + c + ", '')"
+		}
+		haystack := "lower(" + strings.Join(fields, " || char(10) || ") + ")"
+		// lower() de SQLite ne traite que l'ASCII : les termes sont comparés tels que saisis, mis en minuscules
+		for _, term := range q.Terms {
+			conds = append(conds, `(instr(`+haystack+`, ?) > 0 OR EXISTS (
+				SELECT 1 FROM tablet_field_values v JOIN custom_fields cf ON cf.id = v.field_id
+				WHERE v.tablet_id = f.id AND cf.searchable AND instr(lower(v.value), ?) > 0))`)
+			term = strings.ToLower(term)
+			args = append(args, term, term)
+		}
+	}
+	if q.GroupID != 0 {
+		conds = append(conds, "EXISTS (SELECT 1 FROM tablet_groups tg WHERE tg.tablet_id = f.id AND tg.group_id = ?)")
+		args = append(args, q.GroupID)
+	}
+	if q.Health != "" {
+		conds = append(conds, "f.health = ?")
+		args = append(args, q.Health)
+	}
+	if q.MaintenanceAt != nil {
+		conds = append(conds, "f.maintenance_until > ?")
+		args = append(args, *q.MaintenanceAt)
+	}
+	if q.Version != "" {
+		conds = append(conds, "f.version = ?")
+		args = append(args, q.Version)
+	}
+	if q.BatteryMin > 0 || q.BatteryMax > 0 {
+		conds = append(conds, "f.report_id IS NOT NULL AND f.battery >= ?")
+		args = append(args, q.BatteryMin)
+		if q.BatteryMax > 0 {
+			conds = append(conds, "f.battery <= ?")
+			args = append(args, q.BatteryMax)
+		}
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// order trie par la colonne demandée puis par nom, le sens s'appliquant à l'ensemble
+func (q FleetQuery) order() string {
+	keys, ok := fleetOrder[q.Sort]
+	if !ok {
+		keys = fleetOrder["name"]
+	}
+	keys = append(keys[:len(keys):len(keys)], "lower(coalesce(f.name, ''))", "f.id")
+	dir := " ASC"
+	if q.Desc {
+		dir = " DESC"
+	}
+	return " ORDER BY " + strings.Join(keys, dir+", ") + dir
+}
+
+func (r *sqliteTabletRepo) QueryFleet(q FleetQuery) (*FleetResult, error) {
+	where, args := q.where()
+	query := fleetSelect + `
+		SELECT f.*, COUNT(*) OVER () AS total, (SELECT COUNT(*) FROM tablets) AS fleet_size
+		FROM fleet f` + where + q.order()
+	pageArgs := args
+	if q.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		pageArgs = append(pageArgs[:len(pageArgs):len(pageArgs)], q.Limit, q.Offset)
+	}
+
+	var rows []struct {
+		FleetRow
+		Battery sql.NullInt64  `db:"battery"`
+		Groups  sql.NullString `db:"group_ids"`
+		Total   int            `db:"total"`
+		Fleet   int            `db:"fleet_size"`
+	}
+	if err := r.db.Select(&rows, query, pageArgs...); err != nil {
+		return nil, err
+	}
+
+	res := &FleetResult{Rows: make([]FleetRow, len(rows))}
+	if len(rows) == 0 {
+		// Aucun résultat, ou page au-delà de la dernière : les totaux sont comptés à part
+		err := r.db.QueryRow(fleetSelect+`
+			SELECT (SELECT COUNT(*) FROM fleet f`+where+`), (SELECT COUNT(*) FROM tablets)`, args...).Scan(&res.Total, &res.Fleet)
+		return res, err
+	}
+	res.Total, res.Fleet = rows[0].Total, rows[0].Fleet
+	for i, row := range rows {
+		res.Rows[i] = row.FleetRow
+		for _, id := range strings.Split(row.Groups.String, ",") {
+			if gid, err := strconv.ParseInt(id, 10, 64); err == nil {
+				res.Rows[i].GroupIDs = append(res.Rows[i].GroupIDs, gid)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (r *sqliteTabletRepo) GetVersions() ([]string, error) {
+	var versions []string
+	err := r.db.Select(&versions, "SELECT DISTINCT version FROM tablets WHERE version <> '' ORDER BY version")
+	return versions, err
+}
@@ -0,0 +1,151 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+)
+
+// TabletAddress est une IP à laquelle la tablette a répondu
+type TabletAddress struct {
+	TabletID  int64     `db:"tablet_id"`
+	IP        string    `db:"ip"`
+	FirstSeen time.Time `db:"first_seen"`
+	LastSeen  time.Time `db:"last_seen"`
+}
+
+// mergedTables sont les tables rattachées à une tablette, reprises par Merge et vidées par Delete.
+// Pour celles à une ligne par tablette (ou par couple), la ligne de la tablette conservée l'emporte.
+var mergedTables = []string{
+	"reports",
+	"tamper_events",
+	"snapshots",
+	"media_access",
+	"tablet_groups",
+	"tablet_baselines",
+	"snapshot_schedules",
+	"emergency_snapshots",
+	"tablet_keys",
+	"tablet_tls",
+	"tablet_field_values",
+	"tablet_addresses",
+}
+
+func (r *sqliteTabletRepo) initIdentity() error {
+	_, err := r.db.Exec(`CREATE INDEX IF NOT EXISTS idx_tablets_device_id ON tablets(device_id);
+
+	CREATE TABLE IF NOT EXISTS tablet_addresses (
+		tablet_id INTEGER NOT NULL,
+		ip TEXT NOT NULL,
+		first_seen DATETIME NOT NULL,
+		last_seen DATETIME NOT NULL,
+		PRIMARY KEY (tablet_id, ip),
+		FOREIGN KEY (tablet_id) REFERENCES tablets(id) ON DELETE CASCADE
+	);`)
+	return err
+}
+
+func (r *sqliteTabletRepo) GetByDeviceID(deviceID string) ([]Tablet, error) {
+	var tablets []Tablet
+	err := r.db.Select(&tablets, "SELECT * FROM tablets WHERE device_id = ? AND device_id <> '' ORDER BY id", deviceID)
+	return tablets, err
+}
+
+func (r *sqliteTabletRepo) SetDeviceID(id int64, deviceID string) error {
+	_, err := r.db.Exec("UPDATE tablets SET device_id = ? WHERE id = ?", deviceID, id)
+	return err
+}
+
+func (r *sqliteTabletRepo) RecordAddress(id int64, ip string) error {
+	now := time.Now()
+	_, err := r.db.Exec(`INSERT INTO tablet_addresses (tablet_id, ip, first_seen, last_seen) VALUES (?, ?, ?, ?)
+		ON CONFLICT(tablet_id, ip) DO UPDATE SET last_seen = excluded.last_seen`, id, ip, now, now)
+	return err
+}
+
+func (r *sqliteTabletRepo) GetAddresses(id int64) ([]TabletAddress, error) {
+	var list []TabletAddress
+	err := r.db.Select(&list, "SELECT * FROM tablet_addresses WHERE tablet_id = ? ORDER BY last_seen DESC", id)
+	return list, err
+}
+
+func (r *sqliteTabletRepo) SwapAddresses(a, b int64) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ipA, ipB string
+	if err := tx.Get(&ipA, "SELECT ip FROM tablets WHERE id = ?", a); err != nil {
+		return err
+	}
+	if err := tx.Get(&ipB, "SELECT ip FROM tablets WHERE id = ?", b); err != nil {
+		return err
+	}
+	// L'IP est unique : on libère celle de a le temps de l'échange
+	if _, err := tx.Exec("UPDATE tablets SET ip = ? WHERE id = ?", fmt.Sprintf("swap-%d", a), a); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE tablets SET ip = ? WHERE id = ?", ipA, b); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE tablets SET ip = ? WHERE id = ?", ipB, a); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqliteTabletRepo) Merge(survivorID, duplicateID int64, takeAddress bool) error {
+	if survivorID == duplicateID {
+		return fmt.Errorf("cannot merge tablet %d into itself", survivorID)
+	}
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var dupIP string
+	if err := tx.Get(&dupIP, "SELECT ip FROM tablets WHERE id = ?", duplicateID); err != nil {
+		return err
+	}
+	if err := tx.Get(new(int64), "SELECT id FROM tablets WHERE id = ?", survivorID); err != nil {
+		return err
+	}
+
+	for _, table := range mergedTables {
+		// OR IGNORE laisse en place les lignes qui entreraient en conflit avec celles de la tablette conservée
+		if _, err := tx.Exec("UPDATE OR IGNORE "+table+" SET tablet_id = ? WHERE tablet_id = ?", survivorID, duplicateID); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE tablet_id = ?", duplicateID); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+
+	// Les champs vides de la tablette conservée reprennent ceux du doublon
+	if _, err := tx.Exec(`UPDATE tablets SET
+			device_id = CASE WHEN s.device_id <> '' THEN s.device_id ELSE d.device_id END,
+			host = CASE WHEN s.host <> '' THEN s.host ELSE d.host END,
+			port = CASE WHEN s.port <> '' THEN s.port ELSE d.port END,
+			location = CASE WHEN s.location <> '' THEN s.location ELSE d.location END,
+			asset_tag = CASE WHEN s.asset_tag <> '' THEN s.asset_tag ELSE d.asset_tag END,
+			serial = CASE WHEN s.serial <> '' THEN s.serial ELSE d.serial END,
+			owner = CASE WHEN s.owner <> '' THEN s.owner ELSE d.owner END,
+			install_date = CASE WHEN s.install_date <> '' THEN s.install_date ELSE d.install_date END,
+			notes = CASE WHEN s.notes <> '' THEN s.notes ELSE d.notes END
+		FROM tablets s, tablets d
+		WHERE tablets.id = s.id AND s.id = ? AND d.id = ?`, survivorID, duplicateID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM tablets WHERE id = ?", duplicateID); err != nil {
+		return err
+	}
+	if takeAddress {
+		if _, err := tx.Exec("UPDATE tablets SET ip = ? WHERE id = ?", dupIP, survivorID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
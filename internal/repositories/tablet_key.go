@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Clé à laquelle la tablette a répondu en dernier
+const (
+	KeyInUseCurrent  = "current"
+	KeyInUseRejected = "rejected" // aucune des clés connues n'a été acceptée
+)
+
+// TabletKey est la clé d'API propre à une tablette, chiffrée avec la clé maître du hub.
+// Pendant une rotation, NextKeyEnc contient la nouvelle clé, essayée en premier.
+type TabletKey struct {
+	TabletID   int64      `db:"tablet_id"`
+	KeyEnc     string     `db:"key_enc"`
+	NextKeyEnc string     `db:"next_key_enc"`
+	InUse      string     `db:"in_use"`
+	LastUsedAt *time.Time `db:"last_used_at"` // depuis quand InUse a cette valeur
+	RotatedAt  *time.Time `db:"rotated_at"`
+	UpdatedAt  time.Time  `db:"updated_at"`
+}
+
+type TabletKeyRepository interface {
+	InitTable() error
+	GetByTablet(tabletID int64) (*TabletKey, error)
+	GetAll() ([]TabletKey, error)
+	Save(k *TabletKey) error
+	Delete(tabletID int64) error
+	MarkUsed(tabletID int64, inUse string) error
+}
+
+type sqliteTabletKeyRepo struct {
+	db *sqlx.DB
+}
+
+func NewTabletKeyRepository(db *sqlx.DB) TabletKeyRepository {
+	return &sqliteTabletKeyRepo{db: db}
+}
+
+func (r *sqliteTabletKeyRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS tablet_keys (
+		tablet_id INTEGER PRIMARY KEY,
+		key_enc TEXT NOT NULL,
+		next_key_enc TEXT DEFAULT '',
+		in_use TEXT DEFAULT '',
+		last_used_at DATETIME,
+		rotated_at DATETIME,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (tablet_id) REFERENCES tablets(id) ON DELETE CASCADE
+	);`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+func (r *sqliteTabletKeyRepo) GetByTablet(tabletID int64) (*TabletKey, error) {
+	var k TabletKey
+	if err := r.db.Get(&k, "SELECT * FROM tablet_keys WHERE tablet_id = ?", tabletID); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (r *sqliteTabletKeyRepo) GetAll() ([]TabletKey, error) {
+	var list []TabletKey
+	err := r.db.Select(&list, "SELECT * FROM tablet_keys")
+	return list, err
+}
+
+func (r *sqliteTabletKeyRepo) Save(k *TabletKey) error {
+	k.UpdatedAt = time.Now()
+	_, err := r.db.NamedExec(`INSERT INTO tablet_keys (tablet_id, key_enc, next_key_enc, in_use, last_used_at, rotated_at, updated_at)
+		VALUES (:tablet_id, :key_enc, :next_key_enc, :in_use, :last_used_at, :rotated_at, :updated_at)
+		ON CONFLICT(tablet_id) DO UPDATE SET
+			key_enc = excluded.key_enc,
+			next_key_enc = excluded.next_key_enc,
+			in_use = excluded.in_use,
+			last_used_at = excluded.last_used_at,
+			rotated_at = excluded.rotated_at,
+			updated_at = excluded.updated_at`, k)
+	return err
+}
+
+func (r *sqliteTabletKeyRepo) Delete(tabletID int64) error {
+	_, err := r.db.Exec("DELETE FROM tablet_keys WHERE tablet_id = ?", tabletID)
+	return err
+}
+
+func (r *sqliteTabletKeyRepo) MarkUsed(tabletID int64, inUse string) error {
+	_, err := r.db.Exec("UPDATE tablet_keys SET in_use = ?, last_used_at = ? WHERE tablet_id = ?",
+		inUse, time.Now(), tabletID)
+	return err
+}
@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Vérification du certificat présenté par un kiosque en HTTPS
+const (
+	TLSVerifySystem = "system" // autorités du système
+	TLSVerifyCA     = "ca"     // autorité épinglée (CAPEM)
+	TLSVerifyTOFU   = "tofu"   // empreinte mémorisée à la première connexion
+)
+
+// TabletTLS décrit comment le hub joint une tablette hors Tailscale
+type TabletTLS struct {
+	TabletID    int64     `db:"tablet_id"`
+	Scheme      string    `db:"scheme"` // http ou https
+	Verify      string    `db:"verify"`
+	CAPEM       string    `db:"ca_pem"`
+	Fingerprint string    `db:"fingerprint"` // SHA-256 du certificat feuille, hexadécimal
+	ClientCert  bool      `db:"client_cert"` // présenter le certificat client émis par la CA du hub
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+type TabletTLSRepository interface {
+	InitTable() error
+	GetByTablet(tabletID int64) (*TabletTLS, error)
+	// GetByAddr retrouve les réglages par l'adresse host:port de la tablette
+	GetByAddr(addr string) (*TabletTLS, error)
+	GetAll() ([]TabletTLS, error)
+	Save(t *TabletTLS) error
+	SetFingerprint(tabletID int64, fingerprint string) error
+	// PinFingerprint n'enregistre l'empreinte que si aucune ne l'est encore ; false si une autre l'a devancée
+	PinFingerprint(tabletID int64, fingerprint string) (bool, error)
+}
+
+type sqliteTabletTLSRepo struct {
+	db *sqlx.DB
+}
+
+func NewTabletTLSRepository(db *sqlx.DB) TabletTLSRepository {
+	return &sqliteTabletTLSRepo{db: db}
+}
+
+func (r *sqliteTabletTLSRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS tablet_tls (
+		tablet_id INTEGER PRIMARY KEY,
+		scheme TEXT NOT NULL DEFAULT 'http',
+		verify TEXT NOT NULL DEFAULT 'system',
+		ca_pem TEXT DEFAULT '',
+		fingerprint TEXT DEFAULT '',
+		client_cert BOOLEAN DEFAULT 0,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (tablet_id) REFERENCES tablets(id) ON DELETE CASCADE
+	);`
+
+	_, err := r.db.Exec(query)
+	return err
+}
+
+func (r *sqliteTabletTLSRepo) GetByTablet(tabletID int64) (*TabletTLS, error) {
+	var t TabletTLS
+	if err := r.db.Get(&t, "SELECT * FROM tablet_tls WHERE tablet_id = ?", tabletID); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *sqliteTabletTLSRepo) GetByAddr(addr string) (*TabletTLS, error) {
+	host, port := splitAddr(addr)
+	var t TabletTLS
+	err := r.db.Get(&t, `SELECT tt.* FROM tablet_tls tt
+		JOIN tablets t ON t.id = tt.tablet_id
+		WHERE `+tabletAddrMatch, host, port)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *sqliteTabletTLSRepo) GetAll() ([]TabletTLS, error) {
+	var list []TabletTLS
+	err := r.db.Select(&list, "SELECT * FROM tablet_tls")
+	return list, err
+}
+
+func (r *sqliteTabletTLSRepo) Save(t *TabletTLS) error {
+	t.UpdatedAt = time.Now()
+	_, err := r.db.NamedExec(`INSERT INTO tablet_tls (tablet_id, scheme, verify, ca_pem, fingerprint, client_cert, updated_at)
+		VALUES (:tablet_id, :scheme, :verify, :ca_pem, :fingerprint, :client_cert, :updated_at)
+		ON CONFLICT(tablet_id) DO UPDATE SET
+			scheme = excluded.scheme,
+			verify = excluded.verify,
+			ca_pem = excluded.ca_pem,
+			fingerprint = excluded.fingerprint,
+			client_cert = excluded.client_cert,
+			updated_at = excluded.updated_at`, t)
+	return err
+}
+
+func (r *sqliteTabletTLSRepo) SetFingerprint(tabletID int64, fingerprint string) error {
+	_, err := r.db.Exec("UPDATE tablet_tls SET fingerprint = ?, updated_at = ? WHERE tablet_id = ?",
+		fingerprint, time.Now(), tabletID)
+	return err
+}
+
+func (r *sqliteTabletTLSRepo) PinFingerprint(tabletID int64, fingerprint string) (bool, error) {
+	res, err := r.db.Exec("UPDATE tablet_tls SET fingerprint = ?, updated_at = ? WHERE tablet_id = ? AND fingerprint = ''",
+		fingerprint, time.Now(), tabletID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,177 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	TamperMoved   = "moved"   // orientation différente de la position de repos
+	TamperRemoved = "removed" // orientation changée et capteur de proximité couvert (face contre table, sac...)
+	TamperNetwork = "network" // IP locale ou réseau WiFi différent
+)
+
+// TabletBaseline est la position de repos apprise d'une tablette et son dernier réseau connu
+type TabletBaseline struct {
+	TabletID  int64   `db:"tablet_id"`
+	AccelX    float64 `db:"accel_x"`
+	AccelY    float64 `db:"accel_y"`
+	AccelZ    float64 `db:"accel_z"`
+	Proximity float64 `db:"proximity"`
+	Samples   int     `db:"samples"` // relevés moyennés ; la détection commence une fois la position apprise
+	DeviceIP  string  `db:"device_ip"`
+	WifiSSID  string  `db:"wifi_ssid"`
+	// Displaced fige la référence tant que la tablette n'est pas revenue en place
+	Displaced bool      `db:"displaced"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// TamperEvent est une alerte levée par le moniteur, en attente d'acquittement
+type TamperEvent struct {
+	ID             int64      `db:"id"`
+	TabletID       int64      `db:"tablet_id"`
+	TabletName     string     `db:"tablet_name"`
+	Kind           string     `db:"kind"`
+	Details        string     `db:"details"`
+	Before         string     `db:"before_value"`
+	After          string     `db:"after_value"`
+	Labels         string     `db:"labels"` // inventaire de la tablette au moment de l'alerte
+	SnapshotID     *int64     `db:"snapshot_id"`
+	DetectedAt     time.Time  `db:"detected_at"`
+	AcknowledgedAt *time.Time `db:"acknowledged_at"`
+	AcknowledgedBy string     `db:"acknowledged_by"`
+}
+
+type TamperRepository interface {
+	InitTable() error
+	GetBaseline(tabletID int64) (*TabletBaseline, error)
+	SaveBaseline(b *TabletBaseline) error
+	// ResetPosition efface la position apprise pour qu'elle soit réapprise aux prochains relevés
+	ResetPosition(tabletID int64) error
+
+	CreateEvent(e *TamperEvent) error
+	SetEventSnapshot(id, snapshotID int64) error
+	Acknowledge(id int64, actor string) error
+	GetEvent(id int64) (*TamperEvent, error)
+	// GetEvents renvoie les alertes ouvertes puis les plus récentes acquittées
+	GetEvents(limit int) ([]TamperEvent, error)
+	CountOpen(tabletID int64) (int, error)
+}
+
+type sqliteTamperRepo struct {
+	db *sqlx.DB
+}
+
+func NewTamperRepository(db *sqlx.DB) TamperRepository {
+	return &sqliteTamperRepo{db: db}
+}
+
+func (r *sqliteTamperRepo) InitTable() error {
+	query := `CREATE TABLE IF NOT EXISTS tablet_baselines (
+		tablet_id INTEGER PRIMARY KEY,
+		accel_x REAL DEFAULT 0,
+		accel_y REAL DEFAULT 0,
+		accel_z REAL DEFAULT 0,
+		proximity REAL DEFAULT 0,
+		samples INTEGER DEFAULT 0,
+		device_ip TEXT DEFAULT '',
+		wifi_ssid TEXT DEFAULT '',
+		displaced BOOLEAN DEFAULT 0,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (tablet_id) REFERENCES tablets(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS tamper_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tablet_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		details TEXT DEFAULT '',
+		before_value TEXT DEFAULT '',
+		after_value TEXT DEFAULT '',
+		snapshot_id INTEGER,
+		detected_at DATETIME NOT NULL,
+		acknowledged_at DATETIME,
+		acknowledged_by TEXT DEFAULT '',
+		FOREIGN KEY (tablet_id) REFERENCES tablets(id) ON DELETE CASCADE,
+		FOREIGN KEY (snapshot_id) REFERENCES snapshots(id) ON DELETE SET NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_tamper_events_tablet ON tamper_events(tablet_id, acknowledged_at);`
+
+	if _, err := r.db.Exec(query); err != nil {
+		return err
+	}
+	return addColumnIfMissing(r.db, "tamper_events", "labels", "TEXT DEFAULT ''")
+}
+
+func (r *sqliteTamperRepo) GetBaseline(tabletID int64) (*TabletBaseline, error) {
+	var b TabletBaseline
+	if err := r.db.Get(&b, "SELECT * FROM tablet_baselines WHERE tablet_id = ?", tabletID); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *sqliteTamperRepo) SaveBaseline(b *TabletBaseline) error {
+	b.UpdatedAt = time.Now()
+	_, err := r.db.NamedExec(`INSERT INTO tablet_baselines
+		(tablet_id, accel_x, accel_y, accel_z, proximity, samples, device_ip, wifi_ssid, displaced, updated_at)
+		VALUES (:tablet_id, :accel_x, :accel_y, :accel_z, :proximity, :samples, :device_ip, :wifi_ssid, :displaced, :updated_at)
+		ON CONFLICT(tablet_id) DO UPDATE SET
+			accel_x=excluded.accel_x, accel_y=excluded.accel_y, accel_z=excluded.accel_z,
+			proximity=excluded.proximity, samples=excluded.samples, device_ip=excluded.device_ip,
+			wifi_ssid=excluded.wifi_ssid, displaced=excluded.displaced, updated_at=excluded.updated_at`, b)
+	return err
+}
+
+func (r *sqliteTamperRepo) ResetPosition(tabletID int64) error {
+	_, err := r.db.Exec("UPDATE tablet_baselines SET samples = 0, displaced = 0 WHERE tablet_id = ?", tabletID)
+	return err
+}
+
+func (r *sqliteTamperRepo) CreateEvent(e *TamperEvent) error {
+	if e.DetectedAt.IsZero() {
+		e.DetectedAt = time.Now()
+	}
+	res, err := r.db.NamedExec(`INSERT INTO tamper_events (tablet_id, kind, details, before_value, after_value, labels, detected_at)
+		VALUES (:tablet_id, :kind, :details, :before_value, :after_value, :labels, :detected_at)`, e)
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *sqliteTamperRepo) SetEventSnapshot(id, snapshotID int64) error {
+	_, err := r.db.Exec("UPDATE tamper_events SET snapshot_id = ? WHERE id = ?", snapshotID, id)
+	return err
+}
+
+func (r *sqliteTamperRepo) Acknowledge(id int64, actor string) error {
+	_, err := r.db.Exec("UPDATE tamper_events SET acknowledged_at = ?, acknowledged_by = ? WHERE id = ? AND acknowledged_at IS NULL",
+		time.Now(), actor, id)
+	return err
+}
+
+const tamperEventSelect = `SELECT e.*, COALESCE(t.name, '') AS tablet_name
+	FROM tamper_events e LEFT JOIN tablets t ON t.id = e.tablet_id`
+
+func (r *sqliteTamperRepo) GetEvent(id int64) (*TamperEvent, error) {
+	var e TamperEvent
+	if err := r.db.Get(&e, tamperEventSelect+" WHERE e.id = ?", id); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (r *sqliteTamperRepo) GetEvents(limit int) ([]TamperEvent, error) {
+	var list []TamperEvent
+	err := r.db.Select(&list, tamperEventSelect+` ORDER BY e.acknowledged_at IS NOT NULL, e.detected_at DESC LIMIT ?`, limit)
+	return list, err
+}
+
+func (r *sqliteTamperRepo) CountOpen(tabletID int64) (int, error) {
+	var n int
+	err := r.db.Get(&n, "SELECT COUNT(*) FROM tamper_events WHERE tablet_id = ? AND acknowledged_at IS NULL", tabletID)
+	return n, err
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+var (
+	ErrAnnouncementNotFound = errors.New("announcement_not_found")
+	ErrAnnouncementEmpty    = errors.New("announcement_has_no_steps")
+	ErrAnnouncementBusy     = errors.New("tablets_busy_with_announcement")
+	ErrRunNotFound          = errors.New("announcement_run_not_found")
+)
+
+// Au-delà, une occurrence planifiée manquée (hub arrêté, redémarrage) n'est plus jouée
+const scheduleGrace = 5 * time.Minute
+
+// AnnouncementRun est une diffusion en cours
+type AnnouncementRun struct {
+	ID             int64
+	AnnouncementID int64
+	Name           string
+	Actor          string
+	Tablets        int
+	Step           int // étapes jouées, toutes répétitions confondues
+	Steps          int
+	StartedAt      time.Time
+
+	tabletIDs []int64
+	cancel    context.CancelFunc
+}
+
+type AnnouncementService interface {
+	// Play lance la séquence en arrière-plan ; une tablette ne peut suivre qu'une séquence à la fois
+	Play(id int64, t Target, actor string) (*AnnouncementRun, error)
+	// Stop interrompt une diffusion : le son est coupé et les volumes restaurés
+	Stop(runID int64, actor string) error
+	Runs() []AnnouncementRun
+	RunScheduler(ctx context.Context)
+}
+
+type announcementService struct {
+	mu         sync.Mutex
+	repo       repositories.AnnouncementRepository
+	reportRepo repositories.ReportRepository
+	emRepo     repositories.EmergencyRepository
+	auditRepo  repositories.AuditRepository
+	kService   KioskService
+	tts        TTSService
+	media      MediaService
+
+	runs   map[int64]*AnnouncementRun
+	busy   map[int64]int64 // tablette -> diffusion
+	nextID int64
+}
+
+func NewAnnouncementService(
+	repo repositories.AnnouncementRepository,
+	rr repositories.ReportRepository,
+	er repositories.EmergencyRepository,
+	ar repositories.AuditRepository,
+	ks KioskService,
+	tts TTSService,
+	mes MediaService,
+) AnnouncementService {
+	return &announcementService{
+		repo:       repo,
+		reportRepo: rr,
+		emRepo:     er,
+		auditRepo:  ar,
+		kService:   ks,
+		tts:        tts,
+		media:      mes,
+		runs:       make(map[int64]*AnnouncementRun),
+		busy:       make(map[int64]int64),
+	}
+}
+
+func (s *announcementService) Play(id int64, t Target, actor string) (*AnnouncementRun, error) {
+	a, err := s.repo.GetByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAnnouncementNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	steps, err := s.repo.GetSteps(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return nil, ErrAnnouncementEmpty
+	}
+
+	tablets, err := s.kService.Resolve(t)
+	if err != nil {
+		return nil, err
+	}
+
+	repeat := max(a.Repeat, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &AnnouncementRun{
+		AnnouncementID: a.ID,
+		Name:           a.Name,
+		Actor:          actor,
+		Tablets:        len(tablets),
+		Steps:          len(steps) * repeat,
+		StartedAt:      time.Now(),
+		cancel:         cancel,
+	}
+	for _, tab := range tablets {
+		// Une cible par IP n'a pas de rapport pour restaurer le volume ni d'identifiant à réserver
+		if tab.ID == 0 {
+			cancel()
+			return nil, ErrInvalidTarget
+		}
+		run.tabletIDs = append(run.tabletIDs, tab.ID)
+	}
+
+	s.mu.Lock()
+	for _, tabID := range run.tabletIDs {
+		if _, taken := s.busy[tabID]; taken {
+			s.mu.Unlock()
+			cancel()
+			return nil, ErrAnnouncementBusy
+		}
+	}
+	s.nextID++
+	run.ID = s.nextID
+	s.runs[run.ID] = run
+	for _, tabID := range run.tabletIDs {
+		s.busy[tabID] = run.ID
+	}
+	snapshot := *run
+	s.mu.Unlock()
+
+	go s.execute(ctx, run, a, steps, repeat)
+
+	slog.Info("📢 Announcement started", "announcement", a.Name, "run", run.ID, "tablets", run.Tablets, "by", actor)
+	return &snapshot, nil
+}
+
+// execute joue la séquence sur toutes les tablettes en même temps, étape par étape,
+// puis remet chaque tablette au volume relevé dans son dernier rapport
+func (s *announcementService) execute(ctx context.Context, run *AnnouncementRun, a *repositories.Announcement, steps []repositories.AnnouncementStep, repeat int) {
+	defer run.cancel()
+
+	target := Target{TabletIDs: run.tabletIDs}
+	failures := 0
+	record := func(r *ActionReport, err error) {
+		if err != nil {
+			failures++
+			slog.Error("announcement: step failed", "run", run.ID, "err", err)
+			return
+		}
+		for _, res := range r.Results {
+			if !res.Executed {
+				failures++
+			}
+		}
+	}
+
+	previous := make(map[int64]int)
+	for _, id := range run.tabletIDs {
+		if last, err := s.reportRepo.GetLatestByTablet(id, true); err == nil {
+			previous[id] = last.AudioVolume
+		}
+	}
+
+	// Les annonces vocales sont générées avant de commencer, pour ne pas décaler la séquence
+	for _, step := range steps {
+		if step.Kind == repositories.StepTTS {
+			if err := s.tts.Prepare(step.Text, "", step.Lang); err != nil {
+				slog.Warn("announcement: could not pre-render TTS", "run", run.ID, "err", err)
+			}
+		}
+	}
+
+	volume := 100
+	if a.Volume > 0 {
+		volume = a.Volume
+		record(s.kService.SetVolume(target, a.Volume))
+	}
+
+	stopped, preempted := false, false
+sequence:
+	for i := 0; i < repeat; i++ {
+		for _, step := range steps {
+			if ctx.Err() != nil {
+				stopped = true
+				break sequence
+			}
+			// Une alerte en cours a la main sur le son et le volume : on s'efface sans rien restaurer
+			if active, _ := s.emRepo.GetActive(); active != nil {
+				preempted = true
+				break sequence
+			}
+
+			switch step.Kind {
+			case repositories.StepMedia:
+				if step.MediaID == nil {
+					break
+				}
+				m, err := s.media.Get(*step.MediaID)
+				if err != nil {
+					slog.Warn("announcement: media no longer exists", "run", run.ID, "media", *step.MediaID)
+					break
+				}
+				record(s.kService.PlayAudio(target, s.media.URL(m), false, volume))
+			case repositories.StepTTS:
+				record(s.tts.Announce(target, step.Text, "", step.Lang, false, volume))
+			}
+
+			s.mu.Lock()
+			run.Step++
+			s.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				stopped = true
+				break sequence
+			case <-time.After(time.Duration(step.DelayMs) * time.Millisecond):
+			}
+		}
+	}
+
+	if stopped {
+		record(s.kService.StopAudio(target))
+	}
+	if a.Volume > 0 && !preempted {
+		s.restoreVolumes(run.tabletIDs, previous)
+	}
+
+	s.mu.Lock()
+	delete(s.runs, run.ID)
+	for _, id := range run.tabletIDs {
+		if s.busy[id] == run.ID {
+			delete(s.busy, id)
+		}
+	}
+	s.mu.Unlock()
+
+	outcome := "completed"
+	switch {
+	case preempted:
+		outcome = "interrupted by emergency"
+	case stopped:
+		outcome = "stopped"
+	}
+	recordAudit(s.auditRepo, run.Actor, "announcement.play", fmt.Sprintf("announcement:%d", a.ID),
+		fmt.Sprintf("%s — %s on %d tablet(s), %d/%d steps, %d failure(s)", a.Name, outcome, run.Tablets, run.Step, run.Steps, failures))
+	slog.Info("📢 Announcement finished", "announcement", a.Name, "run", run.ID, "outcome", outcome, "failures", failures)
+}
+
+// restoreVolumes regroupe les tablettes par volume d'origine pour limiter le nombre d'appels
+func (s *announcementService) restoreVolumes(tabletIDs []int64, previous map[int64]int) {
+	byVolume := make(map[int][]int64)
+	for _, id := range tabletIDs {
+		if vol, ok := previous[id]; ok {
+			byVolume[vol] = append(byVolume[vol], id)
+		}
+	}
+	for vol, ids := range byVolume {
+		if _, err := s.kService.SetVolume(Target{TabletIDs: ids}, vol); err != nil {
+			slog.Error("announcement: failed to restore volume", "volume", vol, "err", err)
+		}
+	}
+}
+
+func (s *announcementService) Stop(runID int64, actor string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[runID]
+	if !ok {
+		return ErrRunNotFound
+	}
+	run.cancel()
+	slog.Info("📢 Announcement stop requested", "run", runID, "by", actor)
+	return nil
+}
+
+func (s *announcementService) Runs() []AnnouncementRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := make([]AnnouncementRun, 0, len(s.runs))
+	for _, r := range s.runs {
+		runs = append(runs, *r)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID < runs[j].ID })
+	return runs
+}
+
+func (s *announcementService) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runDue(now)
+		}
+	}
+}
+
+// runDue lance les plannings dont l'heure est passée depuis moins de scheduleGrace
+// et qui n'ont pas encore tourné pour cette occurrence
+func (s *announcementService) runDue(now time.Time) {
+	schedules, err := s.repo.GetEnabledSchedules()
+	if err != nil {
+		slog.Error("database error: failed to fetch announcement schedules", "err", err)
+		return
+	}
+
+	for _, sch := range schedules {
+		at, err := time.Parse("15:04", sch.At)
+		if err != nil || !sch.RunsOn(now.Weekday()) {
+			continue
+		}
+		due := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+		if now.Before(due) || now.Sub(due) > scheduleGrace {
+			continue
+		}
+		if sch.LastRunAt != nil && !sch.LastRunAt.Before(due) {
+			continue
+		}
+
+		// Marqué avant l'envoi : un échec ne doit pas relancer l'annonce à chaque tick
+		if err := s.repo.MarkScheduleRun(sch.ID, now); err != nil {
+			slog.Error("database error: failed to mark schedule run", "id", sch.ID, "err", err)
+			continue
+		}
+
+		if active, _ := s.emRepo.GetActive(); active != nil {
+			slog.Warn("announcement: scheduled run skipped during emergency", "schedule", sch.ID)
+			continue
+		}
+
+		target := Target{GroupID: sch.GroupID, All: sch.GroupID == 0, Scheduled: true}
+		if _, err := s.Play(sch.AnnouncementID, target, "schedule"); err != nil {
+			slog.Error("announcement: scheduled run failed", "schedule", sch.ID, "err", err)
+		}
+	}
+}
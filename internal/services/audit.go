@@ -0,0 +1,19 @@
+package services
+
+import (
+	"log/slog"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+// recordAudit trace une action opérateur ; un échec d'écriture est loggé mais ne bloque pas l'action
+func recordAudit(repo repositories.AuditRepository, actor, action, target, details string) {
+	if err := repo.Log(&repositories.AuditEntry{
+		Actor:   actor,
+		Action:  action,
+		Target:  target,
+		Details: details,
+	}); err != nil {
+		slog.Error("audit: failed to record entry", "action", action, "err", err)
+	}
+}
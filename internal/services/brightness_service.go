@@ -0,0 +1,259 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+var (
+	ErrInvalidCurve      = errors.New("invalid_brightness_curve")
+	ErrInvalidNightRange = errors.New("invalid_night_range")
+	ErrInvalidBrightness = errors.New("invalid_brightness")
+)
+
+// Modes d'une consigne de luminosité, du moins au plus prioritaire
+const (
+	BrightnessModeCurve = "curve"
+	BrightnessModeNight = "night"
+	BrightnessModeIdle  = "idle"
+)
+
+// DefaultBrightnessCurve est proposée pour une nouvelle politique : pénombre, bureau, vitrine, plein jour
+const DefaultBrightnessCurve = "0:15,50:35,300:70,1000:100"
+
+type curvePoint struct {
+	lux        float64
+	brightness int
+}
+
+type BrightnessService interface {
+	ReportObserver
+	// Policy renvoie la politique du groupe, ou une politique désactivée par défaut
+	Policy(groupID int64) (*repositories.BrightnessPolicy, error)
+	SavePolicy(p *repositories.BrightnessPolicy, actor string) error
+}
+
+// brightnessState est ce que le hub sait d'une tablette entre deux rapports
+type brightnessState struct {
+	lastPresence time.Time
+	mode         string // dernier mode appliqué ; un changement de mode ignore l'hystérésis
+}
+
+type brightnessService struct {
+	repo      repositories.BrightnessRepository
+	auditRepo repositories.AuditRepository
+	kService  KioskService
+
+	mu     sync.Mutex
+	states map[int64]*brightnessState
+}
+
+func NewBrightnessService(repo repositories.BrightnessRepository, ar repositories.AuditRepository, ks KioskService) BrightnessService {
+	return &brightnessService{repo: repo, auditRepo: ar, kService: ks, states: make(map[int64]*brightnessState)}
+}
+
+// parseCurve lit "lux:brightness,..." et trie les points par lux croissant
+func parseCurve(s string) ([]curvePoint, error) {
+	var points []curvePoint
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		luxStr, valStr, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, ErrInvalidCurve
+		}
+		lux, err := strconv.ParseFloat(strings.TrimSpace(luxStr), 64)
+		if err != nil || lux < 0 {
+			return nil, ErrInvalidCurve
+		}
+		val, err := strconv.Atoi(strings.TrimSpace(valStr))
+		if err != nil || val < 0 || val > 100 {
+			return nil, ErrInvalidCurve
+		}
+		points = append(points, curvePoint{lux: lux, brightness: val})
+	}
+	if len(points) == 0 {
+		return nil, ErrInvalidCurve
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i].lux < points[j].lux })
+	for i := 1; i < len(points); i++ {
+		if points[i].lux == points[i-1].lux {
+			return nil, ErrInvalidCurve
+		}
+	}
+	return points, nil
+}
+
+// interpolate renvoie la luminosité pour un niveau de lumière, bornée aux extrémités de la courbe
+func interpolate(points []curvePoint, lux float64) int {
+	if lux <= points[0].lux {
+		return points[0].brightness
+	}
+	for i := 1; i < len(points); i++ {
+		if lux <= points[i].lux {
+			a, b := points[i-1], points[i]
+			ratio := (lux - a.lux) / (b.lux - a.lux)
+			return a.brightness + int(float64(b.brightness-a.brightness)*ratio+0.5)
+		}
+	}
+	return points[len(points)-1].brightness
+}
+
+// inNight indique si l'heure locale tombe dans la plage [start, end), qui peut passer minuit
+func inNight(now time.Time, start, end string) bool {
+	if start == "" || end == "" {
+		return false
+	}
+	s, err1 := time.Parse("15:04", start)
+	e, err2 := time.Parse("15:04", end)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	minutes := now.Hour()*60 + now.Minute()
+	from, to := s.Hour()*60+s.Minute(), e.Hour()*60+e.Minute()
+	if from <= to {
+		return minutes >= from && minutes < to
+	}
+	return minutes >= from || minutes < to
+}
+
+// evaluate calcule la consigne : courbe, remplacée la nuit, plafonnée quand personne n'est devant la tablette
+func evaluate(p *repositories.BrightnessPolicy, points []curvePoint, lux float64, now, lastPresence time.Time) (int, string) {
+	target, mode := interpolate(points, lux), BrightnessModeCurve
+	if inNight(now, p.NightStart, p.NightEnd) {
+		target, mode = p.NightBrightness, BrightnessModeNight
+	}
+	if p.IdleAfterMin > 0 && now.Sub(lastPresence) >= time.Duration(p.IdleAfterMin)*time.Minute && p.IdleBrightness < target {
+		target, mode = p.IdleBrightness, BrightnessModeIdle
+	}
+	return target, mode
+}
+
+func (s *brightnessService) Observe(t repositories.Tablet, r *repositories.TabletReport) {
+	policies, err := s.repo.GetEnabledForTablet(t.ID)
+	if err != nil {
+		slog.Error("database error: failed to fetch brightness policies", "tablet", t.ID, "err", err)
+		return
+	}
+
+	s.mu.Lock()
+	if len(policies) == 0 {
+		delete(s.states, t.ID)
+		s.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	st, ok := s.states[t.ID]
+	if !ok {
+		st = &brightnessState{lastPresence: now}
+		s.states[t.ID] = st
+	}
+	// Capteur de proximité couvert : quelqu'un est devant l'écran
+	if r.Proximity < 1 {
+		st.lastPresence = now
+	}
+	lastPresence, lastMode := st.lastPresence, st.mode
+	s.mu.Unlock()
+
+	// Tablette dans plusieurs groupes pilotés : le premier par ordre alphabétique l'emporte
+	p := &policies[0]
+	points, err := parseCurve(p.Curve)
+	if err != nil {
+		slog.Warn("brightness: invalid curve, policy ignored", "group", p.GroupName, "curve", p.Curve)
+		return
+	}
+
+	target, mode := evaluate(p, points, r.LightLevel, now, lastPresence)
+	// Les rapports donnent la luminosité sur 0-255, les consignes sont en %
+	current := (r.ScreenBrightness*100 + 127) / 255
+	if mode == lastMode && abs(target-current) < max(p.Hysteresis, 1) {
+		return
+	}
+
+	if _, err := s.kService.SetBrightness(Target{TabletID: t.ID}, target); err != nil {
+		slog.Warn("brightness: failed to apply policy", "tablet", t.Name, "err", err)
+		return
+	}
+	slog.Info("💡 Brightness policy applied", "tablet", t.Name, "group", p.GroupName, "mode", mode,
+		"light", r.LightLevel, "from", current, "to", target)
+
+	s.mu.Lock()
+	st.mode = mode
+	s.mu.Unlock()
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (s *brightnessService) Policy(groupID int64) (*repositories.BrightnessPolicy, error) {
+	p, err := s.repo.GetByGroup(groupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &repositories.BrightnessPolicy{
+			GroupID:         groupID,
+			Curve:           DefaultBrightnessCurve,
+			NightBrightness: 10,
+			IdleBrightness:  20,
+			Hysteresis:      5,
+		}, nil
+	}
+	return p, err
+}
+
+func (s *brightnessService) SavePolicy(p *repositories.BrightnessPolicy, actor string) error {
+	points, err := parseCurve(p.Curve)
+	if err != nil {
+		return err
+	}
+	if (p.NightStart == "") != (p.NightEnd == "") {
+		return ErrInvalidNightRange
+	}
+	for _, v := range []int{p.NightBrightness, p.IdleBrightness, p.Hysteresis} {
+		if v < 0 || v > 100 {
+			return ErrInvalidBrightness
+		}
+	}
+	if p.IdleAfterMin < 0 {
+		p.IdleAfterMin = 0
+	}
+
+	// Forme canonique : points triés, sans espaces
+	parts := make([]string, len(points))
+	for i, pt := range points {
+		parts[i] = fmt.Sprintf("%s:%d", strconv.FormatFloat(pt.lux, 'f', -1, 64), pt.brightness)
+	}
+	p.Curve = strings.Join(parts, ",")
+
+	if err := s.repo.Save(p); err != nil {
+		return err
+	}
+
+	details := "disabled"
+	if p.Enabled {
+		details = "curve " + p.Curve
+		if p.NightStart != "" {
+			details += fmt.Sprintf(", night %s-%s at %d%%", p.NightStart, p.NightEnd, p.NightBrightness)
+		}
+		if p.IdleAfterMin > 0 {
+			details += fmt.Sprintf(", idle after %d min at %d%%", p.IdleAfterMin, p.IdleBrightness)
+		}
+	}
+	recordAudit(s.auditRepo, actor, "brightness.policy", fmt.Sprintf("group:%d", p.GroupID), details)
+	return nil
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/sse"
+)
+
+var ErrMergeIntoSelf = errors.New("merge_into_itself")
+
+// Préfixes des identités d'appareil
+const (
+	identityTailnet  = "ts:"   // identifiant stable du nœud Tailscale
+	identityHostname = "host:" // nom d'hôte annoncé par l'app, à défaut
+)
+
+// DeviceIdentity renvoie l'identité stable de l'appareil qui a produit le rapport :
+// son nœud Tailscale s'il est connu, sinon le nom d'hôte annoncé par l'app ; vide si aucun n'est fiable
+func DeviceIdentity(r *repositories.TabletReport) string {
+	if r.TailnetNodeID != "" {
+		return identityTailnet + r.TailnetNodeID
+	}
+	host := strings.ToLower(strings.TrimSpace(r.DeviceHostname))
+	if host == "" || host == "localhost" {
+		return ""
+	}
+	return identityHostname + host
+}
+
+// DeviceIdentityService rattache les rapports à l'appareil plutôt qu'à l'IP interrogée,
+// pour qu'un changement de bail DHCP ne crée pas une nouvelle tablette
+type DeviceIdentityService interface {
+	// Resolve renvoie la tablette à laquelle appartient le rapport reçu à l'adresse de t :
+	// t elle-même, ou la tablette connue de l'appareil qui y répond désormais (t a alors été
+	// fusionnée dans celle-ci, ou lui a cédé son adresse)
+	Resolve(t repositories.Tablet, r *repositories.TabletReport) repositories.Tablet
+
+	Addresses(tabletID int64) ([]repositories.TabletAddress, error)
+	// Candidates liste les autres tablettes, celles de même identité d'abord
+	Candidates(tabletID int64) ([]repositories.Tablet, error)
+	// Merge fusionne le doublon dans la tablette conservée, qui garde son IP
+	Merge(survivorID, duplicateID int64, actor string) error
+	// Forget efface l'identité, par exemple après une réinitialisation de l'appareil
+	Forget(tabletID int64, actor string) error
+	// IsDevice indique si une requête venue de ip provient de l'appareil de la tablette
+	IsDevice(ctx context.Context, tabletID int64, ip string) bool
+}
+
+type deviceIdentityService struct {
+	tabletRepo repositories.TabletRepository
+	auditRepo  repositories.AuditRepository
+	prober     TailnetProber // nil sans Tailscale
+}
+
+func NewDeviceIdentityService(tr repositories.TabletRepository, ar repositories.AuditRepository, tp TailnetProber) DeviceIdentityService {
+	return &deviceIdentityService{tabletRepo: tr, auditRepo: ar, prober: tp}
+}
+
+func (s *deviceIdentityService) Resolve(t repositories.Tablet, r *repositories.TabletReport) repositories.Tablet {
+	id := DeviceIdentity(r)
+	if id == "" || id == t.DeviceID {
+		s.recordAddress(t)
+		return t
+	}
+	// Le nom d'hôte ne remplace pas un nœud Tailscale qui n'a simplement pas été trouvé à ce scan
+	if strings.HasPrefix(t.DeviceID, identityTailnet) && !strings.HasPrefix(id, identityTailnet) {
+		s.recordAddress(t)
+		return t
+	}
+
+	owners, err := s.tabletRepo.GetByDeviceID(id)
+	if err != nil {
+		slog.Error("Failed to look up device identity", "id", t.ID, "device", id, "error", err)
+		return t
+	}
+	owners = slices.DeleteFunc(owners, func(o repositories.Tablet) bool { return o.ID == t.ID })
+	if len(owners) == 0 {
+		s.adopt(t, id)
+		s.recordAddress(t)
+		return t
+	}
+
+	o := owners[0]
+	// Un autre travailleur du même scan a déjà déplacé o à cette adresse
+	if o.IP == t.IP {
+		return o
+	}
+	// Un nœud Tailscale est unique : un autre enregistrement qui le connaît est le même appareil.
+	// Un nom d'hôte peut être partagé par des tablettes identiques : on ne déplace l'enregistrement
+	// que s'il est le seul à le connaître et ne répond plus à son adresse, sinon l'administrateur
+	// tranche avec la fusion.
+	if !strings.HasPrefix(id, identityTailnet) && (len(owners) > 1 || o.Online) {
+		slog.Warn("Several tablets report the same device identity", "id", t.ID, "device", id, "count", len(owners)+1)
+		if t.DeviceID == "" {
+			s.adopt(t, id)
+		}
+		s.recordAddress(t)
+		return t
+	}
+
+	if t.DeviceID == "" || strings.HasPrefix(id, identityTailnet) && !strings.HasPrefix(t.DeviceID, identityTailnet) {
+		// t a été ajoutée à la nouvelle adresse, ou n'était connue que par son nom d'hôte : c'est un doublon de o
+		if err := s.tabletRepo.Merge(o.ID, t.ID, true); err != nil {
+			slog.Error("Failed to merge duplicate tablet", "survivor", o.ID, "duplicate", t.ID, "error", err)
+			return t
+		}
+		slog.Info("Device moved, duplicate merged", "device", id, "survivor", o.ID, "duplicate", t.ID, "ip", t.IP)
+		recordAudit(s.auditRepo, "monitor", "tablet.merge", fmt.Sprintf("tablet:%d", o.ID),
+			fmt.Sprintf("%s answered at %s, merged tablet %d", id, t.IP, t.ID))
+		sse.Instance.Publish(sse.Event{Type: sse.EventFleet, TabletID: t.ID})
+	} else {
+		// L'appareil de t est ailleurs : les deux tablettes échangent leurs adresses
+		if err := s.tabletRepo.SwapAddresses(o.ID, t.ID); err != nil {
+			slog.Error("Failed to swap tablet addresses", "a", o.ID, "b", t.ID, "error", err)
+			return t
+		}
+		slog.Info("Device moved, addresses swapped", "device", id, "tablet", o.ID, "ip", t.IP, "previous_holder", t.ID)
+		recordAudit(s.auditRepo, "monitor", "tablet.address", fmt.Sprintf("tablet:%d", o.ID),
+			fmt.Sprintf("%s moved from %s to %s (tablet %d gets %s)", id, o.IP, t.IP, t.ID, o.IP))
+	}
+
+	o.IP = t.IP
+	s.recordAddress(o)
+	return o
+}
+
+func (s *deviceIdentityService) adopt(t repositories.Tablet, id string) {
+	if err := s.tabletRepo.SetDeviceID(t.ID, id); err != nil {
+		slog.Error("Failed to save device identity", "id", t.ID, "device", id, "error", err)
+		return
+	}
+	if t.DeviceID != "" {
+		recordAudit(s.auditRepo, "monitor", "tablet.identity", fmt.Sprintf("tablet:%d", t.ID), fmt.Sprintf("%s → %s", t.DeviceID, id))
+	}
+}
+
+// IsDevice accepte l'adresse actuelle de la tablette, celles auxquelles elle a déjà répondu,
+// les noms d'hôte qui résolvent vers ip, et sur le tailnet, le nœud Tailscale de l'appareil
+func (s *deviceIdentityService) IsDevice(ctx context.Context, tabletID int64, ip string) bool {
+	t, err := s.tabletRepo.GetByID(tabletID)
+	if err != nil {
+		return false
+	}
+	hosts := []string{t.IP}
+	if t.Host != "" {
+		hosts = append(hosts, t.Host)
+	}
+	addrs, err := s.tabletRepo.GetAddresses(tabletID)
+	if err != nil {
+		slog.Error("Failed to fetch tablet addresses", "id", tabletID, "error", err)
+	}
+	for _, a := range addrs {
+		hosts = append(hosts, a.IP)
+	}
+	if slices.Contains(hosts, ip) {
+		return true
+	}
+
+	if strings.HasPrefix(t.DeviceID, identityTailnet) && s.prober != nil {
+		if node, err := s.prober.NodeIDOf(ctx, ip); err == nil && identityTailnet+node == t.DeviceID {
+			return true
+		}
+	}
+
+	for _, h := range hosts {
+		if net.ParseIP(h) != nil {
+			continue
+		}
+		resolved, err := net.DefaultResolver.LookupHost(ctx, h)
+		if err == nil && slices.Contains(resolved, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *deviceIdentityService) recordAddress(t repositories.Tablet) {
+	if err := s.tabletRepo.RecordAddress(t.ID, t.IP); err != nil {
+		slog.Error("Failed to record tablet address", "id", t.ID, "ip", t.IP, "error", err)
+	}
+}
+
+func (s *deviceIdentityService) Addresses(tabletID int64) ([]repositories.TabletAddress, error) {
+	return s.tabletRepo.GetAddresses(tabletID)
+}
+
+func (s *deviceIdentityService) Candidates(tabletID int64) ([]repositories.Tablet, error) {
+	t, err := s.tabletRepo.GetByID(tabletID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTabletNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.tabletRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var same, others []repositories.Tablet
+	for _, o := range all {
+		switch {
+		case o.ID == t.ID:
+		case t.DeviceID != "" && o.DeviceID == t.DeviceID:
+			same = append(same, o)
+		default:
+			others = append(others, o)
+		}
+	}
+	return append(same, others...), nil
+}
+
+func (s *deviceIdentityService) Merge(survivorID, duplicateID int64, actor string) error {
+	if survivorID == duplicateID {
+		return ErrMergeIntoSelf
+	}
+	survivor, err := s.tabletRepo.GetByID(survivorID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTabletNotFound
+	}
+	if err != nil {
+		return err
+	}
+	duplicate, err := s.tabletRepo.GetByID(duplicateID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTabletNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.tabletRepo.Merge(survivorID, duplicateID, false); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "tablet.merge", fmt.Sprintf("tablet:%d", survivorID),
+		fmt.Sprintf("merged tablet %d (%s, %s) into %s", duplicateID, duplicate.Name, duplicate.IP, survivor.Name))
+	sse.Instance.Publish(sse.Event{Type: sse.EventFleet, TabletID: duplicateID})
+	return nil
+}
+
+func (s *deviceIdentityService) Forget(tabletID int64, actor string) error {
+	t, err := s.tabletRepo.GetByID(tabletID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTabletNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.tabletRepo.SetDeviceID(tabletID, ""); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "tablet.identity", fmt.Sprintf("tablet:%d", tabletID), fmt.Sprintf("%s forgotten", t.DeviceID))
+	return nil
+}
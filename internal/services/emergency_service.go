@@ -0,0 +1,289 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+var ErrNoActiveEmergency = errors.New("no_active_emergency")
+
+// EmergencyOptions décrit une alerte à diffuser
+type EmergencyOptions struct {
+	GroupIDs []int64 // vide = toute la flotte
+	Message  string
+	AlertURL string // vide = page d'alerte hébergée par le hub
+	SoundURL string // son d'alarme joué en boucle, optionnel
+	Speak    bool   // lit le message via le TTS de la tablette
+	Actor    string
+}
+
+type EmergencyService interface {
+	Trigger(opts EmergencyOptions) (*repositories.Emergency, *ActionReport, error)
+	AllClear(actor string) (*ActionReport, error)
+	Active() (*repositories.Emergency, error)
+	AlertPageURL() string
+}
+
+type emergencyServiceImpl struct {
+	mu         sync.Mutex
+	emRepo     repositories.EmergencyRepository
+	tabRepo    repositories.TabletRepository
+	reportRepo repositories.ReportRepository
+	groupRepo  repositories.GroupRepository
+	auditRepo  repositories.AuditRepository
+	kService   KioskService
+	baseURL    string
+}
+
+func NewEmergencyService(
+	er repositories.EmergencyRepository,
+	tr repositories.TabletRepository,
+	rr repositories.ReportRepository,
+	gr repositories.GroupRepository,
+	ar repositories.AuditRepository,
+	ks KioskService,
+	baseURL string,
+) EmergencyService {
+	return &emergencyServiceImpl{
+		emRepo:     er,
+		tabRepo:    tr,
+		reportRepo: rr,
+		groupRepo:  gr,
+		auditRepo:  ar,
+		kService:   ks,
+		baseURL:    baseURL,
+	}
+}
+
+func (s *emergencyServiceImpl) AlertPageURL() string {
+	return fmt.Sprintf("http://%s/emergency/page", strings.TrimSuffix(s.baseURL, "/"))
+}
+
+func (s *emergencyServiceImpl) Active() (*repositories.Emergency, error) {
+	return s.emRepo.GetActive()
+}
+
+// resolveFleet renvoie les tablettes visées, dédupliquées si elles appartiennent à plusieurs groupes
+func (s *emergencyServiceImpl) resolveFleet(groupIDs []int64) ([]repositories.Tablet, error) {
+	if len(groupIDs) == 0 {
+		tablets, err := s.tabRepo.GetAll()
+		return activeTablets(tablets, false), err
+	}
+
+	seen := make(map[int64]bool)
+	var tablets []repositories.Tablet
+	for _, gID := range groupIDs {
+		members, err := s.groupRepo.GetTabletsByGroup(gID)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range members {
+			if !seen[t.ID] {
+				seen[t.ID] = true
+				tablets = append(tablets, t)
+			}
+		}
+	}
+	return activeTablets(tablets, false), nil
+}
+
+func (s *emergencyServiceImpl) Trigger(opts EmergencyOptions) (*repositories.Emergency, *ActionReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tablets, err := s.resolveFleet(opts.GroupIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tablets) == 0 {
+		return nil, nil, ErrInvalidTarget
+	}
+
+	ids := make([]int64, len(tablets))
+	snapshots := make([]repositories.EmergencySnapshot, len(tablets))
+	for i, t := range tablets {
+		ids[i] = t.ID
+		snapshots[i] = repositories.EmergencySnapshot{TabletID: t.ID}
+		if last, err := s.reportRepo.GetLatestByTablet(t.ID, true); err == nil {
+			snapshots[i].HasReport = true
+			snapshots[i].CurrentURL = last.CurrentURL
+			snapshots[i].AudioVolume = last.AudioVolume
+			snapshots[i].ScreenOn = last.ScreenOn
+			snapshots[i].ScreensaverActive = last.ScreensaverActive
+		}
+	}
+
+	alertURL := opts.AlertURL
+	if alertURL == "" {
+		alertURL = s.AlertPageURL()
+	}
+
+	groupIDs := make([]string, len(opts.GroupIDs))
+	for i, id := range opts.GroupIDs {
+		groupIDs[i] = strconv.FormatInt(id, 10)
+	}
+
+	em := &repositories.Emergency{
+		Message:   opts.Message,
+		AlertURL:  alertURL,
+		SoundURL:  opts.SoundURL,
+		Speak:     opts.Speak,
+		GroupIDs:  strings.Join(groupIDs, ","),
+		StartedBy: opts.Actor,
+	}
+
+	// L'état est persisté avant tout envoi : si la base refuse, rien n'est diffusé
+	if err := s.emRepo.Start(em, snapshots); err != nil {
+		return nil, nil, err
+	}
+
+	target := Target{TabletIDs: ids}
+	steps := []*ActionReport{}
+	run := func(r *ActionReport, err error) {
+		if err != nil {
+			slog.Error("emergency: broadcast step failed", "err", err)
+			return
+		}
+		steps = append(steps, r)
+	}
+
+	run(s.kService.Wake(target))
+	run(s.kService.SetScreensaver(target, false))
+	run(s.kService.SetScreen(target, true))
+	run(s.kService.SetVolume(target, 100))
+	run(s.kService.Navigate(target, alertURL))
+	if opts.SoundURL != "" {
+		run(s.kService.PlayAudio(target, opts.SoundURL, true, 100))
+	}
+	if opts.Speak && opts.Message != "" {
+		run(s.kService.Speak(target, opts.Message))
+	}
+
+	report := mergeReports("emergency", steps...)
+
+	recordAudit(s.auditRepo, opts.Actor, "emergency.trigger", fmt.Sprintf("emergency:%d", em.ID),
+		fmt.Sprintf("groups=[%s] tablets=%d message=%q url=%s sound=%s speak=%t — %s",
+			em.GroupIDs, len(tablets), opts.Message, alertURL, opts.SoundURL, opts.Speak, report.Summary))
+
+	slog.Warn("🚨 Emergency broadcast started", "id", em.ID, "tablets", len(tablets), "by", opts.Actor)
+	return em, report, nil
+}
+
+func (s *emergencyServiceImpl) AllClear(actor string) (*ActionReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	em, err := s.emRepo.GetActive()
+	if err != nil {
+		return nil, err
+	}
+	if em == nil {
+		return nil, ErrNoActiveEmergency
+	}
+
+	snapshots, err := s.emRepo.GetSnapshots(em.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]*ActionReport, len(snapshots))
+	var wg sync.WaitGroup
+	for i, snap := range snapshots {
+		wg.Add(1)
+		go func(index int, snap repositories.EmergencySnapshot) {
+			defer wg.Done()
+			reports[index] = s.restoreTablet(snap, em.SoundURL != "")
+		}(i, snap)
+	}
+	wg.Wait()
+
+	report := &ActionReport{Command: "allClear", Timestamp: time.Now().Unix()}
+	for _, r := range reports {
+		report.Results = append(report.Results, r.Results...)
+	}
+	report.Summary = summarize(report.Results)
+
+	if err := s.emRepo.End(em.ID, actor); err != nil {
+		return report, err
+	}
+
+	recordAudit(s.auditRepo, actor, "emergency.all_clear", fmt.Sprintf("emergency:%d", em.ID), report.Summary)
+	slog.Info("✅ Emergency cleared", "id", em.ID, "by", actor)
+	return report, nil
+}
+
+// restoreTablet remet une tablette dans l'état capturé avant l'alerte
+func (s *emergencyServiceImpl) restoreTablet(snap repositories.EmergencySnapshot, stopAudio bool) *ActionReport {
+	target := Target{TabletID: snap.TabletID}
+	steps := []*ActionReport{}
+	run := func(r *ActionReport, err error) {
+		if err == nil {
+			steps = append(steps, r)
+		}
+	}
+
+	if stopAudio {
+		run(s.kService.StopAudio(target))
+	}
+	if snap.HasReport {
+		if snap.CurrentURL != "" {
+			run(s.kService.Navigate(target, snap.CurrentURL))
+		}
+		run(s.kService.SetVolume(target, snap.AudioVolume))
+		if snap.ScreensaverActive {
+			run(s.kService.SetScreensaver(target, true))
+		}
+		if !snap.ScreenOn {
+			run(s.kService.SetScreen(target, false))
+		}
+	} else {
+		run(s.kService.Reload(target))
+	}
+
+	return mergeReports("restore", steps...)
+}
+
+// mergeReports fusionne plusieurs étapes en un résultat par tablette :
+// une tablette n'est "executed" que si toutes les étapes ont réussi.
+func mergeReports(command string, reports ...*ActionReport) *ActionReport {
+	merged := &ActionReport{Command: command, Timestamp: time.Now().Unix()}
+	index := make(map[string]int)
+
+	for _, r := range reports {
+		for _, res := range r.Results {
+			key := fmt.Sprintf("%d/%s", res.ID, res.IP)
+			i, ok := index[key]
+			if !ok {
+				index[key] = len(merged.Results)
+				merged.Results = append(merged.Results, res)
+				continue
+			}
+			cur := &merged.Results[i]
+			cur.Executed = cur.Executed && res.Executed
+			cur.Success = cur.Success && res.Success
+			if res.Error != "" {
+				cur.Error = strings.TrimPrefix(cur.Error+"; "+r.Command+": "+res.Error, "; ")
+			}
+		}
+	}
+
+	merged.Summary = summarize(merged.Results)
+	return merged
+}
+
+func summarize(results []TabletResult) string {
+	successCount := 0
+	for _, r := range results {
+		if r.Executed {
+			successCount++
+		}
+	}
+	return fmt.Sprintf("%d/%d tablettes ont exécuté la commande avec succès", successCount, len(results))
+}
@@ -0,0 +1,361 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/models"
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+var (
+	ErrInvalidViewName = errors.New("invalid_view_name")
+	ErrViewNameTaken   = errors.New("view_name_taken")
+	ErrViewNotFound    = errors.New("view_not_found")
+)
+
+// StatusMaintenance filtre les tablettes en maintenance, en plus des états de santé
+const StatusMaintenance = "maintenance"
+
+// Tris du tableau de bord
+const (
+	SortName     = "name"
+	SortIP       = "ip"
+	SortStatus   = "status"
+	SortBattery  = "battery"
+	SortLastSeen = "last_seen"
+	SortVersion  = "version"
+)
+
+const (
+	DefaultPageSize = 48
+	MaxPageSize     = 200
+)
+
+// FleetStatuses sont les statuts proposés par le filtre, FleetSorts les tris
+var (
+	FleetStatuses = []string{HealthOnline, HealthAppDown, HealthNetworkDown, HealthUnknown, StatusMaintenance, HealthRetired}
+	FleetSorts    = []string{SortName, SortIP, SortStatus, SortBattery, SortLastSeen, SortVersion}
+)
+
+// FleetFilter décrit la recherche, le tri et la page du tableau de bord ; la valeur zéro montre toute la flotte.
+// Les bornes de batterie sont incluses, 0 signifiant absente.
+type FleetFilter struct {
+	Query      string
+	GroupID    int64
+	Status     string // état de santé (Health*) ou StatusMaintenance
+	Version    string
+	BatteryMin int
+	BatteryMax int
+	Sort       string
+	Desc       bool
+	Page       int
+	PageSize   int
+}
+
+// ParseFleetFilter lit le filtre dans les paramètres d'URL ; les valeurs inconnues sont ignorées
+func ParseFleetFilter(v url.Values) FleetFilter {
+	f := FleetFilter{
+		Query:   strings.TrimSpace(v.Get("q")),
+		Version: v.Get("version"),
+		Sort:    v.Get("sort"),
+		Desc:    v.Get("order") == "desc",
+	}
+	f.GroupID, _ = strconv.ParseInt(v.Get("group"), 10, 64)
+	if s := v.Get("status"); slices.Contains(FleetStatuses, s) {
+		f.Status = s
+	}
+	if !slices.Contains(FleetSorts, f.Sort) {
+		f.Sort = SortName
+	}
+	f.BatteryMin, _ = strconv.Atoi(v.Get("battery_min"))
+	f.BatteryMax, _ = strconv.Atoi(v.Get("battery_max"))
+	f.BatteryMin = min(max(f.BatteryMin, 0), 100)
+	f.BatteryMax = min(max(f.BatteryMax, 0), 100)
+
+	f.Page, _ = strconv.Atoi(v.Get("page"))
+	f.Page = max(f.Page, 1)
+	f.PageSize, _ = strconv.Atoi(v.Get("per_page"))
+	if f.PageSize <= 0 {
+		f.PageSize = DefaultPageSize
+	}
+	f.PageSize = min(f.PageSize, MaxPageSize)
+	return f
+}
+
+// Values renvoie les paramètres d'URL du filtre, sans ceux laissés à leur valeur par défaut
+func (f FleetFilter) Values() url.Values {
+	v := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set("q", f.Query)
+	if f.GroupID != 0 {
+		v.Set("group", strconv.FormatInt(f.GroupID, 10))
+	}
+	set("status", f.Status)
+	set("version", f.Version)
+	if f.BatteryMin > 0 {
+		v.Set("battery_min", strconv.Itoa(f.BatteryMin))
+	}
+	if f.BatteryMax > 0 {
+		v.Set("battery_max", strconv.Itoa(f.BatteryMax))
+	}
+	if f.Sort != "" && f.Sort != SortName {
+		v.Set("sort", f.Sort)
+	}
+	if f.Desc {
+		v.Set("order", "desc")
+	}
+	if f.PageSize > 0 && f.PageSize != DefaultPageSize {
+		v.Set("per_page", strconv.Itoa(f.PageSize))
+	}
+	if f.Page > 1 {
+		v.Set("page", strconv.Itoa(f.Page))
+	}
+	return v
+}
+
+// WithPage renvoie le même filtre positionné sur une autre page
+func (f FleetFilter) WithPage(page int) FleetFilter {
+	f.Page = page
+	return f
+}
+
+// FleetPage est une page du tableau de bord
+type FleetPage struct {
+	Filter  FleetFilter
+	Tablets []models.TabletDisplay
+	Total   int // tablettes correspondant au filtre, toutes pages confondues
+	Fleet   int // taille de la flotte
+	Pages   int
+
+	// Choix proposés par le formulaire de filtre
+	Groups   []repositories.Group
+	Versions []string
+}
+
+// FleetViewService filtre, trie et pagine la flotte pour le tableau de bord et gère les vues enregistrées
+type FleetViewService interface {
+	// List renvoie la page demandée en un nombre fixe de requêtes, quelle que soit la taille de la flotte
+	List(f FleetFilter) (*FleetPage, error)
+	// Matching renvoie toutes les tablettes du filtre, triées et sans pagination, pour les exports
+	Matching(f FleetFilter) ([]repositories.Tablet, error)
+	// Card renvoie l'affichage d'une seule tablette, pour mettre à jour sa carte
+	Card(id int64) (*models.TabletDisplay, error)
+
+	Views() ([]repositories.DashboardView, error)
+	SaveView(name string, f FleetFilter, actor string) (*repositories.DashboardView, error)
+	DeleteView(id int64, actor string) error
+}
+
+type fleetViewService struct {
+	tabletRepo repositories.TabletRepository
+	reportRepo repositories.ReportRepository
+	groupRepo  repositories.GroupRepository
+	viewRepo   repositories.DashboardViewRepository
+	auditRepo  repositories.AuditRepository
+	tlsSvc     KioskTLSService
+}
+
+func NewFleetViewService(tr repositories.TabletRepository, rr repositories.ReportRepository, gr repositories.GroupRepository,
+	vr repositories.DashboardViewRepository, ar repositories.AuditRepository, ts KioskTLSService) FleetViewService {
+	return &fleetViewService{
+		tabletRepo: tr,
+		reportRepo: rr,
+		groupRepo:  gr,
+		viewRepo:   vr,
+		auditRepo:  ar,
+		tlsSvc:     ts,
+	}
+}
+
+// query traduit le filtre pour le dépôt, sans la pagination
+func (f FleetFilter) query(now time.Time) repositories.FleetQuery {
+	q := repositories.FleetQuery{
+		Terms:      strings.Fields(f.Query),
+		GroupID:    f.GroupID,
+		Version:    f.Version,
+		BatteryMin: f.BatteryMin,
+		BatteryMax: f.BatteryMax,
+		Sort:       f.Sort,
+		Desc:       f.Desc,
+	}
+	if f.Status == StatusMaintenance {
+		q.MaintenanceAt = &now
+	} else {
+		q.Health = f.Status
+	}
+	return q
+}
+
+func (s *fleetViewService) List(f FleetFilter) (*FleetPage, error) {
+	page := &FleetPage{Filter: f}
+	if page.Filter.PageSize <= 0 {
+		page.Filter.PageSize = DefaultPageSize
+	}
+	page.Filter.Page = max(f.Page, 1)
+
+	q := f.query(time.Now())
+	q.Limit = page.Filter.PageSize
+	q.Offset = (page.Filter.Page - 1) * q.Limit
+	res, err := s.tabletRepo.QueryFleet(q)
+	if err != nil {
+		return nil, err
+	}
+	page.Total, page.Fleet = res.Total, res.Fleet
+	page.Pages = max((page.Total+q.Limit-1)/q.Limit, 1)
+	if page.Filter.Page > page.Pages {
+		// La page demandée n'existe plus (filtre plus étroit, tablettes supprimées) : on montre la dernière
+		page.Filter.Page = page.Pages
+		q.Offset = (page.Filter.Page - 1) * q.Limit
+		if res, err = s.tabletRepo.QueryFleet(q); err != nil {
+			return nil, err
+		}
+	}
+
+	if page.Groups, err = s.groupRepo.GetAll(); err != nil {
+		return nil, err
+	}
+	if page.Tablets, err = s.displays(res.Rows, page.Groups); err != nil {
+		return nil, err
+	}
+	if page.Versions, err = s.tabletRepo.GetVersions(); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// displays complète les tablettes d'une page : leurs rapports, relus par identifiant, leurs groupes
+// et l'état de leur connexion
+func (s *fleetViewService) displays(rows []repositories.FleetRow, groups []repositories.Group) ([]models.TabletDisplay, error) {
+	var ids []int64
+	for _, row := range rows {
+		if row.ReportID.Valid {
+			ids = append(ids, row.ReportID.Int64)
+		}
+		if row.ProbeID.Valid && row.ProbeID != row.ReportID {
+			ids = append(ids, row.ProbeID.Int64)
+		}
+	}
+	reports, err := s.reportRepo.GetByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*repositories.TabletReport, len(reports))
+	for i := range reports {
+		byID[reports[i].ID] = &reports[i]
+	}
+
+	shown := make([]repositories.Tablet, len(rows))
+	for i, row := range rows {
+		shown[i] = row.Tablet
+	}
+	plaintext := s.tlsSvc.PlaintextAll(shown)
+
+	list := make([]models.TabletDisplay, len(rows))
+	for i, row := range rows {
+		td := models.TabletDisplay{Tablet: row.Tablet, Health: row.Health, Plaintext: plaintext[row.ID]}
+		if row.ReportID.Valid {
+			td.LastReport = byID[row.ReportID.Int64]
+		}
+		if row.ProbeID.Valid {
+			td.LastProbe = byID[row.ProbeID.Int64]
+		}
+		// groups est trié par nom : les badges gardent cet ordre
+		for _, g := range groups {
+			if slices.Contains(row.GroupIDs, g.ID) {
+				td.Groups = append(td.Groups, g)
+			}
+		}
+		list[i] = td
+	}
+	return list, nil
+}
+
+func (s *fleetViewService) Matching(f FleetFilter) ([]repositories.Tablet, error) {
+	res, err := s.tabletRepo.QueryFleet(f.query(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]repositories.Tablet, len(res.Rows))
+	for i, row := range res.Rows {
+		out[i] = row.Tablet
+	}
+	return out, nil
+}
+
+func (s *fleetViewService) Card(id int64) (*models.TabletDisplay, error) {
+	t, err := s.tabletRepo.GetByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTabletNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	report, _ := s.reportRepo.GetLatestByTablet(id, true)
+	probe, _ := s.reportRepo.GetLatestByTablet(id, false)
+	groups, err := s.groupRepo.GetGroupsByTablet(id)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TabletDisplay{
+		Tablet:     *t,
+		LastReport: report,
+		Groups:     groups,
+		LastProbe:  probe,
+		Health:     TabletHealth(*t, probe),
+		Plaintext:  s.tlsSvc.Plaintext(id),
+	}, nil
+}
+
+func (s *fleetViewService) Views() ([]repositories.DashboardView, error) {
+	return s.viewRepo.GetAll()
+}
+
+func (s *fleetViewService) SaveView(name string, f FleetFilter, actor string) (*repositories.DashboardView, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return nil, ErrInvalidViewName
+	}
+	views, err := s.viewRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range views {
+		if strings.EqualFold(v.Name, name) {
+			return nil, ErrViewNameTaken
+		}
+	}
+
+	// Une vue rouvre toujours la première page
+	view := &repositories.DashboardView{Name: name, Query: f.WithPage(0).Values().Encode(), CreatedBy: actor}
+	if _, err := s.viewRepo.Create(view); err != nil {
+		return nil, err
+	}
+	recordAudit(s.auditRepo, actor, "view.create", fmt.Sprintf("view:%d", view.ID), fmt.Sprintf("%s (%s)", view.Name, view.Query))
+	return view, nil
+}
+
+func (s *fleetViewService) DeleteView(id int64, actor string) error {
+	view, err := s.viewRepo.GetByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrViewNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.viewRepo.Delete(id); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "view.delete", fmt.Sprintf("view:%d", id), view.Name)
+	return nil
+}
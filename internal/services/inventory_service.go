@@ -0,0 +1,289 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/sse"
+)
+
+var (
+	ErrInvalidField      = errors.New("invalid_custom_field")
+	ErrFieldNameTaken    = errors.New("field_name_taken")
+	ErrFieldNotFound     = errors.New("field_not_found")
+	ErrInvalidFieldValue = errors.New("invalid_field_value")
+)
+
+// fieldName : le nom sert de colonne CSV et de label Prometheus
+var fieldName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// inventoryColumns sont les champs fixes de la fiche, dans l'ordre des exports
+var inventoryColumns = []string{"location", "asset_tag", "serial", "owner", "install_date", "notes"}
+
+// reservedFieldNames sont déjà des colonnes d'import/export ou des labels des métriques
+var reservedFieldNames = append([]string{"ip", "name", "host", "port", "timeout", "scheme", "key", "tablet_id"}, inventoryColumns...)
+
+// FieldError précise le champ dont la valeur est refusée
+type FieldError struct {
+	Field string
+}
+
+func (e *FieldError) Error() string { return "invalid value for " + e.Field }
+func (e *FieldError) Unwrap() error { return ErrInvalidFieldValue }
+
+// InventoryService gère la fiche d'inventaire des tablettes et les champs personnalisés
+type InventoryService interface {
+	Fields() ([]repositories.CustomField, error)
+	SaveField(f *repositories.CustomField, actor string) error
+	DeleteField(id int64, actor string) error
+
+	TabletFields(tabletID int64) ([]repositories.CustomFieldValue, error)
+	// SaveInventory vérifie puis enregistre la fiche et les champs personnalisés (nom → valeur) donnés ;
+	// les champs personnalisés absents de custom gardent leur valeur
+	SaveInventory(t *repositories.Tablet, custom map[string]string, actor string) error
+
+	// Labels décrit chaque tablette pour les métriques et les alertes : fiche puis champs personnalisés
+	Labels(tablets []repositories.Tablet) map[int64]map[string]string
+	// Rows renvoie l'en-tête et les colonnes d'inventaire des exports, une ligne par tablette
+	Rows(tablets []repositories.Tablet) ([]string, [][]string, error)
+}
+
+type inventoryService struct {
+	repo       repositories.CustomFieldRepository
+	tabletRepo repositories.TabletRepository
+	auditRepo  repositories.AuditRepository
+}
+
+func NewInventoryService(repo repositories.CustomFieldRepository, tr repositories.TabletRepository, ar repositories.AuditRepository) InventoryService {
+	return &inventoryService{repo: repo, tabletRepo: tr, auditRepo: ar}
+}
+
+func (s *inventoryService) Fields() ([]repositories.CustomField, error) {
+	return s.repo.GetAll()
+}
+
+func fieldOptions(f repositories.CustomField) []string {
+	var opts []string
+	for _, o := range strings.Split(f.Options, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			opts = append(opts, o)
+		}
+	}
+	return opts
+}
+
+func (s *inventoryService) SaveField(f *repositories.CustomField, actor string) error {
+	f.Label = strings.TrimSpace(f.Label)
+	if f.Label == "" {
+		return ErrInvalidField
+	}
+
+	action := "field.update"
+	if f.ID == 0 {
+		action = "field.create"
+		f.Name = strings.TrimSpace(f.Name)
+		if !fieldName.MatchString(f.Name) || slices.Contains(reservedFieldNames, f.Name) {
+			return ErrInvalidField
+		}
+		switch f.Type {
+		case repositories.FieldText, repositories.FieldNumber, repositories.FieldDate, repositories.FieldBool, repositories.FieldSelect:
+		default:
+			return ErrInvalidField
+		}
+
+		fields, err := s.repo.GetAll()
+		if err != nil {
+			return err
+		}
+		for _, other := range fields {
+			if other.Name == f.Name {
+				return ErrFieldNameTaken
+			}
+		}
+	} else {
+		current, err := s.repo.GetByID(f.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrFieldNotFound
+		}
+		if err != nil {
+			return err
+		}
+		f.Name, f.Type = current.Name, current.Type
+	}
+
+	f.Options = strings.Join(fieldOptions(*f), ",")
+	if f.Type == repositories.FieldSelect && f.Options == "" {
+		return ErrInvalidField
+	}
+
+	if err := s.repo.Save(f); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, action, fmt.Sprintf("field:%d", f.ID), fmt.Sprintf("%s (%s)", f.Name, f.Type))
+	return nil
+}
+
+func (s *inventoryService) DeleteField(id int64, actor string) error {
+	f, err := s.repo.GetByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrFieldNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "field.delete", fmt.Sprintf("field:%d", id), f.Name)
+	return nil
+}
+
+func (s *inventoryService) TabletFields(tabletID int64) ([]repositories.CustomFieldValue, error) {
+	return s.repo.GetTabletValues(tabletID)
+}
+
+// normalizeFieldValue vérifie une valeur selon le type du champ et la met sous sa forme enregistrée
+func normalizeFieldValue(f repositories.CustomField, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	invalid := &FieldError{Field: f.Name}
+
+	switch f.Type {
+	case repositories.FieldNumber:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", invalid
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	case repositories.FieldDate:
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			return "", invalid
+		}
+	case repositories.FieldBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", invalid
+		}
+		return strconv.FormatBool(b), nil
+	case repositories.FieldSelect:
+		if !slices.Contains(fieldOptions(f), value) {
+			return "", invalid
+		}
+	}
+	return value, nil
+}
+
+func (s *inventoryService) SaveInventory(t *repositories.Tablet, custom map[string]string, actor string) error {
+	inv := &t.TabletInventory
+	for _, v := range []*string{&inv.Location, &inv.AssetTag, &inv.Serial, &inv.Owner, &inv.InstallDate, &inv.Notes} {
+		*v = strings.TrimSpace(*v)
+	}
+	if inv.InstallDate != "" {
+		if _, err := time.Parse(time.DateOnly, inv.InstallDate); err != nil {
+			return &FieldError{Field: "install_date"}
+		}
+	}
+
+	fields, err := s.repo.GetAll()
+	if err != nil {
+		return err
+	}
+	values := make(map[int64]string)
+	for _, f := range fields {
+		raw, ok := custom[f.Name]
+		if !ok {
+			continue
+		}
+		if values[f.ID], err = normalizeFieldValue(f, raw); err != nil {
+			return err
+		}
+	}
+
+	if err := s.tabletRepo.SaveInventory(t); err != nil {
+		return err
+	}
+	if err := s.repo.SetTabletValues(t.ID, values); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "tablet.inventory", fmt.Sprintf("tablet:%d", t.ID),
+		fmt.Sprintf("location=%q asset_tag=%q serial=%q owner=%q, %d custom field(s)", inv.Location, inv.AssetTag, inv.Serial, inv.Owner, len(values)))
+	sse.Instance.Publish(sse.Event{Type: sse.EventStatus, TabletID: t.ID})
+	return nil
+}
+
+// builtinLabels renvoie les champs fixes renseignés ; les notes, texte libre, n'en font pas partie
+func builtinLabels(inv repositories.TabletInventory) map[string]string {
+	labels := make(map[string]string)
+	for name, v := range map[string]string{
+		"location":     inv.Location,
+		"asset_tag":    inv.AssetTag,
+		"serial":       inv.Serial,
+		"owner":        inv.Owner,
+		"install_date": inv.InstallDate,
+	} {
+		if v != "" {
+			labels[name] = v
+		}
+	}
+	return labels
+}
+
+func (s *inventoryService) Labels(tablets []repositories.Tablet) map[int64]map[string]string {
+	fields, _ := s.repo.GetAll()
+	values, _ := s.repo.GetAllValues()
+
+	labels := make(map[int64]map[string]string, len(tablets))
+	for _, t := range tablets {
+		l := builtinLabels(t.TabletInventory)
+		for _, f := range fields {
+			if v := values[t.ID][f.ID]; v != "" {
+				l[f.Name] = v
+			}
+		}
+		labels[t.ID] = l
+	}
+	return labels
+}
+
+// FormatLabels écrit des labels triés sous la forme "nom=valeur, nom=valeur"
+func FormatLabels(labels map[string]string) string {
+	parts := make([]string, 0, len(labels))
+	for name, v := range labels {
+		parts = append(parts, name+"="+v)
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, ", ")
+}
+
+func (s *inventoryService) Rows(tablets []repositories.Tablet) ([]string, [][]string, error) {
+	fields, err := s.repo.GetAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := s.repo.GetAllValues()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := slices.Clone(inventoryColumns)
+	for _, f := range fields {
+		header = append(header, f.Name)
+	}
+	rows := make([][]string, len(tablets))
+	for i, t := range tablets {
+		rows[i] = []string{t.Location, t.AssetTag, t.Serial, t.Owner, t.InstallDate, t.Notes}
+		for _, f := range fields {
+			rows[i] = append(rows[i], values[t.ID][f.ID])
+		}
+	}
+	return header, rows, nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+var ErrInvalidConnection = errors.New("invalid_connection_settings")
+
+// maxKioskTimeout borne le délai réglable par tablette
+const maxKioskTimeout = 300
+
+// KioskConnectionService gère le profil de connexion de chaque tablette (hôte, port,
+// délai, clé d'API envoyée), utilisé aussi bien par la supervision que par les commandes.
+type KioskConnectionService interface {
+	Save(t *repositories.Tablet, actor string) error
+	// Transport applique le délai de chaque tablette aux requêtes qui lui sont adressées
+	Transport(base http.RoundTripper) http.RoundTripper
+}
+
+type kioskConnectionService struct {
+	tabletRepo     repositories.TabletRepository
+	auditRepo      repositories.AuditRepository
+	defaultTimeout time.Duration
+
+	// Le délai est gardé par adresse : chaque requête vers un kiosque en a besoin
+	mu       sync.Mutex
+	timeouts map[string]cachedTimeout
+}
+
+type cachedTimeout struct {
+	timeout  time.Duration
+	loadedAt time.Time
+}
+
+func NewKioskConnectionService(tr repositories.TabletRepository, ar repositories.AuditRepository, defaultTimeout time.Duration) KioskConnectionService {
+	return &kioskConnectionService{
+		tabletRepo:     tr,
+		auditRepo:      ar,
+		defaultTimeout: defaultTimeout,
+		timeouts:       make(map[string]cachedTimeout),
+	}
+}
+
+// normalizeConnection vérifie le profil et le ramène à sa forme enregistrée
+func normalizeConnection(t *repositories.Tablet) error {
+	t.Host = strings.Trim(strings.TrimSpace(t.Host), "[]")
+	t.Port = strings.TrimSpace(t.Port)
+	if strings.ContainsAny(t.Host, " /@") {
+		return ErrInvalidConnection
+	}
+	// Seule une adresse IPv6 peut contenir ":", le port a son propre champ
+	if strings.Contains(t.Host, ":") && net.ParseIP(t.Host) == nil {
+		return ErrInvalidConnection
+	}
+	if t.Port != "" {
+		if p, err := strconv.Atoi(t.Port); err != nil || p < 1 || p > 65535 {
+			return ErrInvalidConnection
+		}
+	}
+	if t.TimeoutSec < 0 || t.TimeoutSec > maxKioskTimeout {
+		return ErrInvalidConnection
+	}
+	switch t.KeySource {
+	case repositories.KeySourceAuto, repositories.KeySourceFleet, repositories.KeySourceNone:
+	default:
+		return ErrInvalidConnection
+	}
+	return nil
+}
+
+func (s *kioskConnectionService) Save(t *repositories.Tablet, actor string) error {
+	if err := normalizeConnection(t); err != nil {
+		return err
+	}
+	if err := s.tabletRepo.SaveConnection(t); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	clear(s.timeouts)
+	s.mu.Unlock()
+
+	details := fmt.Sprintf("host=%q port=%q timeout=%ds key=%q", t.Host, t.Port, t.TimeoutSec, t.KeySource)
+	recordAudit(s.auditRepo, actor, "tablet.connection", fmt.Sprintf("tablet:%d", t.ID), details)
+	return nil
+}
+
+func (s *kioskConnectionService) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &timeoutTransport{svc: s, base: base}
+}
+
+func (s *kioskConnectionService) timeout(addr string) time.Duration {
+	s.mu.Lock()
+	c, ok := s.timeouts[addr]
+	s.mu.Unlock()
+	if ok && time.Since(c.loadedAt) < addrCacheTTL {
+		return c.timeout
+	}
+
+	d := s.loadTimeout(addr)
+	s.mu.Lock()
+	s.timeouts[addr] = cachedTimeout{timeout: d, loadedAt: time.Now()}
+	s.mu.Unlock()
+	return d
+}
+
+func (s *kioskConnectionService) loadTimeout(addr string) time.Duration {
+	t, err := s.tabletRepo.GetByAddr(addr)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("database error: failed to fetch tablet", "addr", addr, "err", err)
+		}
+		return s.defaultTimeout
+	}
+	if t.TimeoutSec > 0 {
+		return time.Duration(t.TimeoutSec) * time.Second
+	}
+	return s.defaultTimeout
+}
+
+type timeoutTransport struct {
+	svc  *kioskConnectionService
+	base http.RoundTripper
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	d := t.svc.timeout(req.URL.Host)
+	if d <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), d)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// Le délai couvre aussi la lecture du corps (photos, etc.)
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,459 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid_api_key")
+	ErrNoTabletKey   = errors.New("no_tablet_key")
+	ErrNoRotation    = errors.New("no_rotation_pending")
+)
+
+// Longueur minimale d'une clé d'API de tablette
+const minAPIKeyLength = 16
+
+// addrCacheTTL : les réglages gardés par adresse (clés déchiffrées, délai, TLS) sont relus au plus tard
+// après ce délai, pour suivre les changements d'adresse ou de réglage faits ailleurs
+const addrCacheTTL = time.Minute
+
+// KeyStatus résume la clé d'une tablette pour l'écran de rotation
+type KeyStatus struct {
+	Tablet     repositories.Tablet
+	HasKey     bool // clé propre ; sinon la clé commune KIOSK_API_KEY est envoyée
+	Rotating   bool
+	InUse      string
+	LastUsedAt *time.Time
+	RotatedAt  *time.Time
+}
+
+// KioskKeyService gère une clé d'API par tablette, chiffrée au repos, et leur rotation par étapes :
+// pendant une rotation, la nouvelle clé est essayée d'abord et l'ancienne sert de repli
+// jusqu'à ce que la tablette accepte la nouvelle, qui remplace alors l'ancienne.
+type KioskKeyService interface {
+	// Transport ajoute à chaque requête la clé de la tablette visée
+	Transport(base http.RoundTripper) http.RoundTripper
+
+	Statuses() ([]KeyStatus, error)
+	SetKey(tabletID int64, key, actor string) error
+	// ClearKey fait revenir la tablette à la clé commune
+	ClearKey(tabletID int64, actor string) error
+	// StartRotation prépare une nouvelle clé (générée si vide) et la renvoie
+	StartRotation(tabletID int64, newKey, actor string) (string, error)
+	CancelRotation(tabletID int64, actor string) error
+	// Reveal déchiffre les clés d'une tablette pour les reporter sur l'appareil
+	Reveal(tabletID int64, actor string) (current, next string, err error)
+}
+
+type kioskKeyService struct {
+	repo       repositories.TabletKeyRepository
+	tabletRepo repositories.TabletRepository
+	auditRepo  repositories.AuditRepository
+	fleetKey   string
+	aead       cipher.AEAD
+
+	// Chaque requête vers un kiosque passe par lookup : les clés déchiffrées sont gardées par adresse,
+	// et la dernière clé acceptée par tablette, pour n'écrire in_use que lorsqu'il change
+	mu    sync.Mutex
+	cache map[string]cachedKeys
+	inUse map[int64]string
+}
+
+type cachedKeys struct {
+	keys     tabletKeys
+	loadedAt time.Time
+}
+
+func NewKioskKeyService(repo repositories.TabletKeyRepository, tr repositories.TabletRepository, ar repositories.AuditRepository, fleetKey, masterKey, masterKeyPath string) (KioskKeyService, error) {
+	master := sha256.Sum256(loadMasterKey(masterKeyPath, masterKey))
+	block, err := aes.NewCipher(master[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &kioskKeyService{
+		repo:       repo,
+		tabletRepo: tr,
+		auditRepo:  ar,
+		fleetKey:   fleetKey,
+		aead:       aead,
+		cache:      make(map[string]cachedKeys),
+		inUse:      make(map[int64]string),
+	}, nil
+}
+
+// loadMasterKey garde la même clé maître d'un redémarrage à l'autre, sinon les clés enregistrées seraient illisibles
+func loadMasterKey(path, configured string) []byte {
+	if configured != "" {
+		return []byte(configured)
+	}
+
+	if data, err := os.ReadFile(path); err == nil {
+		if key, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil && len(key) >= 32 {
+			return key
+		}
+		slog.Warn("keys: invalid master key file, generating a new one", "path", path)
+	}
+
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)), 0600); err != nil {
+		slog.Warn("keys: could not persist master key, tablet keys will not survive a restart", "err", err)
+	}
+	return key
+}
+
+func (s *kioskKeyService) seal(plain string) string {
+	nonce := make([]byte, s.aead.NonceSize())
+	_, _ = rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(s.aead.Seal(nonce, nonce, []byte(plain), nil))
+}
+
+func (s *kioskKeyService) open(sealed string) (string, error) {
+	if sealed == "" {
+		return "", nil
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < s.aead.NonceSize() {
+		return "", errors.New("keys: malformed sealed key")
+	}
+	plain, err := s.aead.Open(nil, data[:s.aead.NonceSize()], data[s.aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("keys: cannot decrypt key, wrong master key? %w", err)
+	}
+	return string(plain), nil
+}
+
+func validAPIKey(key string) bool {
+	return len(key) >= minAPIKeyLength && !strings.ContainsAny(key, " \t\r\n")
+}
+
+func generateAPIKey() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (s *kioskKeyService) Statuses() ([]KeyStatus, error) {
+	tablets, err := s.tabletRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	byTablet := make(map[int64]repositories.TabletKey, len(keys))
+	for _, k := range keys {
+		byTablet[k.TabletID] = k
+	}
+
+	statuses := make([]KeyStatus, 0, len(tablets))
+	for _, t := range tablets {
+		st := KeyStatus{Tablet: t}
+		if k, ok := byTablet[t.ID]; ok {
+			st.HasKey = true
+			st.Rotating = k.NextKeyEnc != ""
+			st.InUse = k.InUse
+			st.LastUsedAt = k.LastUsedAt
+			st.RotatedAt = k.RotatedAt
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+func (s *kioskKeyService) SetKey(tabletID int64, key, actor string) error {
+	key = strings.TrimSpace(key)
+	if !validAPIKey(key) {
+		return ErrInvalidAPIKey
+	}
+	if _, err := s.tabletRepo.GetByID(tabletID); err != nil {
+		return ErrTabletNotFound
+	}
+
+	// Une clé saisie à la main remplace tout, rotation en cours comprise
+	if err := s.repo.Save(&repositories.TabletKey{TabletID: tabletID, KeyEnc: s.seal(key)}); err != nil {
+		return err
+	}
+	s.invalidate()
+	recordAudit(s.auditRepo, actor, "key.set", fmt.Sprintf("tablet:%d", tabletID), "")
+	return nil
+}
+
+func (s *kioskKeyService) ClearKey(tabletID int64, actor string) error {
+	if err := s.repo.Delete(tabletID); err != nil {
+		return err
+	}
+	s.invalidate()
+	recordAudit(s.auditRepo, actor, "key.clear", fmt.Sprintf("tablet:%d", tabletID), "")
+	return nil
+}
+
+func (s *kioskKeyService) StartRotation(tabletID int64, newKey, actor string) (string, error) {
+	newKey = strings.TrimSpace(newKey)
+	if newKey == "" {
+		newKey = generateAPIKey()
+	}
+	if !validAPIKey(newKey) {
+		return "", ErrInvalidAPIKey
+	}
+
+	k, err := s.repo.GetByTablet(tabletID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// La tablette utilisait la clé commune : c'est elle qui sert de repli
+		if _, err := s.tabletRepo.GetByID(tabletID); err != nil {
+			return "", ErrTabletNotFound
+		}
+		k = &repositories.TabletKey{TabletID: tabletID, KeyEnc: s.seal(s.fleetKey)}
+	} else if err != nil {
+		return "", err
+	}
+
+	k.NextKeyEnc = s.seal(newKey)
+	k.InUse = ""
+	if err := s.repo.Save(k); err != nil {
+		return "", err
+	}
+	s.invalidate()
+	recordAudit(s.auditRepo, actor, "key.rotate", fmt.Sprintf("tablet:%d", tabletID), "rotation started")
+	return newKey, nil
+}
+
+func (s *kioskKeyService) CancelRotation(tabletID int64, actor string) error {
+	k, err := s.repo.GetByTablet(tabletID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && k.NextKeyEnc == "") {
+		return ErrNoRotation
+	}
+	if err != nil {
+		return err
+	}
+
+	k.NextKeyEnc = ""
+	k.InUse = ""
+	if err := s.repo.Save(k); err != nil {
+		return err
+	}
+	s.invalidate()
+	recordAudit(s.auditRepo, actor, "key.rotate", fmt.Sprintf("tablet:%d", tabletID), "rotation cancelled")
+	return nil
+}
+
+func (s *kioskKeyService) Reveal(tabletID int64, actor string) (string, string, error) {
+	k, err := s.repo.GetByTablet(tabletID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", ErrNoTabletKey
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	current, err := s.open(k.KeyEnc)
+	if err != nil {
+		return "", "", err
+	}
+	next, err := s.open(k.NextKeyEnc)
+	if err != nil {
+		return "", "", err
+	}
+	recordAudit(s.auditRepo, actor, "key.reveal", fmt.Sprintf("tablet:%d", tabletID), "")
+	return current, next, nil
+}
+
+// tabletKeys sont les clés à essayer pour une adresse, dans l'ordre
+type tabletKeys struct {
+	tabletID int64
+	stored   bool
+	current  string
+	next     string
+}
+
+// invalidate fait relire les clés après une modification
+func (s *kioskKeyService) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.cache)
+	clear(s.inUse)
+}
+
+func (s *kioskKeyService) lookup(addr string) tabletKeys {
+	s.mu.Lock()
+	c, ok := s.cache[addr]
+	s.mu.Unlock()
+	if ok && time.Since(c.loadedAt) < addrCacheTTL {
+		return c.keys
+	}
+
+	keys := s.load(addr)
+	s.mu.Lock()
+	s.cache[addr] = cachedKeys{keys: keys, loadedAt: time.Now()}
+	s.mu.Unlock()
+	return keys
+}
+
+func (s *kioskKeyService) load(addr string) tabletKeys {
+	t, err := s.tabletRepo.GetByAddr(addr)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("database error: failed to fetch tablet", "addr", addr, "err", err)
+		}
+		return tabletKeys{current: s.fleetKey}
+	}
+	switch t.KeySource {
+	case repositories.KeySourceFleet:
+		return tabletKeys{current: s.fleetKey}
+	case repositories.KeySourceNone:
+		return tabletKeys{}
+	}
+
+	k, err := s.repo.GetByTablet(t.ID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("database error: failed to fetch tablet key", "tablet", t.ID, "err", err)
+		}
+		return tabletKeys{current: s.fleetKey}
+	}
+
+	s.mu.Lock()
+	if _, ok := s.inUse[k.TabletID]; !ok {
+		s.inUse[k.TabletID] = k.InUse
+	}
+	s.mu.Unlock()
+
+	keys := tabletKeys{tabletID: k.TabletID, stored: true}
+	if keys.current, err = s.open(k.KeyEnc); err != nil {
+		slog.Error("keys: unreadable tablet key, falling back to the fleet key", "tablet", k.TabletID, "err", err)
+		return tabletKeys{current: s.fleetKey}
+	}
+	if keys.next, err = s.open(k.NextKeyEnc); err != nil {
+		slog.Error("keys: unreadable next key, rotation ignored", "tablet", k.TabletID, "err", err)
+		keys.next = ""
+	}
+	return keys
+}
+
+// promote remplace l'ancienne clé dès que la tablette a accepté la nouvelle
+func (s *kioskKeyService) promote(tabletID int64) {
+	k, err := s.repo.GetByTablet(tabletID)
+	if err != nil || k.NextKeyEnc == "" {
+		return
+	}
+	now := time.Now()
+	k.KeyEnc, k.NextKeyEnc = k.NextKeyEnc, ""
+	k.InUse = repositories.KeyInUseCurrent
+	k.LastUsedAt, k.RotatedAt = &now, &now
+	if err := s.repo.Save(k); err != nil {
+		slog.Error("database error: failed to promote tablet key", "tablet", tabletID, "err", err)
+		return
+	}
+	s.invalidate()
+	slog.Info("keys: tablet accepted its new API key, rotation complete", "tablet", tabletID)
+	recordAudit(s.auditRepo, "monitor", "key.promote", fmt.Sprintf("tablet:%d", tabletID), "rotation complete")
+}
+
+// markUsed n'écrit que lorsque la tablette change de clé acceptée : last_used_at date ce changement
+func (s *kioskKeyService) markUsed(tabletID int64, inUse string) {
+	s.mu.Lock()
+	unchanged := s.inUse[tabletID] == inUse
+	s.inUse[tabletID] = inUse
+	s.mu.Unlock()
+	if unchanged {
+		return
+	}
+	if err := s.repo.MarkUsed(tabletID, inUse); err != nil {
+		s.mu.Lock()
+		delete(s.inUse, tabletID)
+		s.mu.Unlock()
+		slog.Error("database error: failed to record tablet key use", "tablet", tabletID, "err", err)
+	}
+}
+
+func (s *kioskKeyService) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &keyTransport{svc: s, base: base}
+}
+
+type keyTransport struct {
+	svc  *kioskKeyService
+	base http.RoundTripper
+}
+
+// keyRejected : le kiosque a refusé la clé présentée
+func keyRejected(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden
+}
+
+func (t *keyTransport) send(req *http.Request, key string) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	if key != "" {
+		r.Header.Set("X-Api-Key", key)
+	}
+	return t.base.RoundTrip(r)
+}
+
+func (t *keyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	keys := t.svc.lookup(req.URL.Host)
+
+	if keys.next == "" {
+		resp, err := t.send(req, keys.current)
+		if err == nil && keys.stored {
+			inUse := repositories.KeyInUseCurrent
+			if keyRejected(resp) {
+				inUse = repositories.KeyInUseRejected
+			}
+			t.svc.markUsed(keys.tabletID, inUse)
+		}
+		return resp, err
+	}
+
+	resp, err := t.send(req, keys.next)
+	if err != nil {
+		return nil, err
+	}
+	if !keyRejected(resp) {
+		t.svc.promote(keys.tabletID)
+		return resp, nil
+	}
+
+	// La tablette a encore l'ancienne clé : on rejoue la requête avec celle-ci
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	resp, err = t.send(retry, keys.current)
+	if err == nil {
+		inUse := repositories.KeyInUseCurrent
+		if keyRejected(resp) {
+			inUse = repositories.KeyInUseRejected
+		}
+		t.svc.markUsed(keys.tabletID, inUse)
+	}
+	return resp, err
+}
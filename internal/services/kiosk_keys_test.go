@@ -0,0 +1,189 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wared2003/freekiosk-hub/internal/databases"
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+const (
+	oldKey = "old-key-0123456789"
+	newKey = "new-key-0123456789"
+)
+
+// newKeyService prépare une tablette à l'adresse 127.0.0.1, sans port pour répondre à celui du serveur de test
+func newKeyService(t *testing.T) (*kioskKeyService, repositories.TabletKeyRepository, int64) {
+	t.Helper()
+	db, err := databases.Open(t.TempDir() + "/hub.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tr := repositories.NewTabletRepository(db)
+	kr := repositories.NewTabletKeyRepository(db)
+	ar := repositories.NewAuditRepository(db)
+	for _, init := range []func() error{tr.InitTable, kr.InitTable, ar.InitTable} {
+		if err := init(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Save(&repositories.Tablet{IP: "127.0.0.1", Name: "kiosk"}); err != nil {
+		t.Fatal(err)
+	}
+	tablet, err := tr.GetByAddr("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc, err := NewKioskKeyService(kr, tr, ar, "fleet-key-0123456789", "master", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc.(*kioskKeyService), kr, tablet.ID
+}
+
+func TestKeyTransportRotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		accepted string // clé configurée sur l'appareil
+		rotate   bool
+		// attendus après la requête
+		wantStatus  int
+		wantSent    []string
+		wantCurrent string
+		wantNext    string
+		wantInUse   string
+	}{
+		{
+			name:        "no rotation, key accepted",
+			accepted:    oldKey,
+			wantStatus:  http.StatusOK,
+			wantSent:    []string{oldKey},
+			wantCurrent: oldKey,
+			wantInUse:   repositories.KeyInUseCurrent,
+		},
+		{
+			name:        "new key accepted, rotation completes",
+			accepted:    newKey,
+			rotate:      true,
+			wantStatus:  http.StatusOK,
+			wantSent:    []string{newKey},
+			wantCurrent: newKey,
+			wantInUse:   repositories.KeyInUseCurrent,
+		},
+		{
+			name:        "new key refused, old key still works",
+			accepted:    oldKey,
+			rotate:      true,
+			wantStatus:  http.StatusOK,
+			wantSent:    []string{newKey, oldKey},
+			wantCurrent: oldKey,
+			wantNext:    newKey,
+			wantInUse:   repositories.KeyInUseCurrent,
+		},
+		{
+			name:        "both keys refused",
+			accepted:    "device-key-0123456789",
+			rotate:      true,
+			wantStatus:  http.StatusUnauthorized,
+			wantSent:    []string{newKey, oldKey},
+			wantCurrent: oldKey,
+			wantNext:    newKey,
+			wantInUse:   repositories.KeyInUseRejected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent, bodies []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				sent = append(sent, r.Header.Get("X-Api-Key"))
+				bodies = append(bodies, string(body))
+				if r.Header.Get("X-Api-Key") != tt.accepted {
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+			}))
+			defer srv.Close()
+
+			svc, kr, tabletID := newKeyService(t)
+			if err := svc.SetKey(tabletID, oldKey, "test"); err != nil {
+				t.Fatal(err)
+			}
+			if tt.rotate {
+				if _, err := svc.StartRotation(tabletID, newKey, "test"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			client := &http.Client{Transport: svc.Transport(nil)}
+			resp, err := client.Post(srv.URL+"/api/url", "application/json", strings.NewReader(`{"url":"x"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if strings.Join(sent, ",") != strings.Join(tt.wantSent, ",") {
+				t.Errorf("keys sent = %v, want %v", sent, tt.wantSent)
+			}
+			for _, b := range bodies {
+				if b != `{"url":"x"}` {
+					t.Errorf("request body not replayed: %q", b)
+				}
+			}
+
+			k, err := kr.GetByTablet(tabletID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			current, _ := svc.open(k.KeyEnc)
+			next, _ := svc.open(k.NextKeyEnc)
+			if current != tt.wantCurrent || next != tt.wantNext {
+				t.Errorf("stored keys = (%q, %q), want (%q, %q)", current, next, tt.wantCurrent, tt.wantNext)
+			}
+			if k.InUse != tt.wantInUse {
+				t.Errorf("in_use = %q, want %q", k.InUse, tt.wantInUse)
+			}
+		})
+	}
+}
+
+// Une requête dont le corps ne peut pas être relu n'est pas rejouée avec l'ancienne clé
+func TestKeyTransportKeepsUnreplayableBody(t *testing.T) {
+	var sent []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Header.Get("X-Api-Key"))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	svc, _, tabletID := newKeyService(t)
+	if err := svc.SetKey(tabletID, oldKey, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.StartRotation(tabletID, newKey, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/url", io.NopCloser(strings.NewReader("x")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: svc.Transport(nil)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || len(sent) != 1 {
+		t.Errorf("got status %d after %d attempts, want the first 401", resp.StatusCode, len(sent))
+	}
+}
@@ -2,13 +2,14 @@ package services
 
 import (
 	"errors"
-	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/wared2003/freekiosk-hub/internal/clients"
 	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/sse"
 )
 
 var (
@@ -19,9 +20,12 @@ var (
 )
 
 type Target struct {
-	TabletID int64
-	GroupID  int64
-	IPs      []string
+	TabletID  int64
+	TabletIDs []int64
+	GroupID   int64
+	IPs       []string
+	All       bool // toute la flotte
+	Scheduled bool // envoi automatique : les tablettes en maintenance en sont écartées
 }
 
 type TabletResult struct {
@@ -32,6 +36,8 @@ type TabletResult struct {
 	Executed bool   `json:"executed"`
 	Error    string `json:"error,omitempty"`
 	Duration string `json:"duration"`
+	// Output est la valeur renvoyée par la tablette, pour les commandes qui en produisent une
+	Output string `json:"output,omitempty"`
 }
 
 type ActionReport struct {
@@ -55,6 +61,9 @@ type StatusReport struct {
 }
 
 type KioskService interface {
+	// Resolve renvoie les tablettes visées par une Target
+	Resolve(t Target) ([]repositories.Tablet, error)
+
 	// Affichage & UI
 	SetBrightness(t Target, val int) (*ActionReport, error)
 	SetVolume(t Target, vol int) (*ActionReport, error)
@@ -94,14 +103,15 @@ type kioskServiceImpl struct {
 	groupRepo repositories.GroupRepository
 	client    clients.KioskClient
 	kPort     string
+	signer    URLSigner
 }
 
-func NewKioskService(r repositories.TabletRepository, gr repositories.GroupRepository, c clients.KioskClient, kp string) KioskService {
-	return &kioskServiceImpl{tabRepo: r, groupRepo: gr, client: c, kPort: kp}
+func NewKioskService(r repositories.TabletRepository, gr repositories.GroupRepository, c clients.KioskClient, kp string, signer URLSigner) KioskService {
+	return &kioskServiceImpl{tabRepo: r, groupRepo: gr, client: c, kPort: kp, signer: signer}
 }
 
-func (s *kioskServiceImpl) getAddr(ip string) string {
-	return fmt.Sprintf("%s:%s", ip, s.kPort)
+func (s *kioskServiceImpl) getAddr(t repositories.Tablet) string {
+	return t.Addr(s.kPort)
 }
 
 // resolveTablets transforme une Target en liste d'objets tablettes réels
@@ -120,18 +130,62 @@ func (s *kioskServiceImpl) resolveTablets(t Target) ([]repositories.Tablet, erro
 		}
 		return []repositories.Tablet{*tab}, nil
 	}
+	if len(t.TabletIDs) > 0 {
+		tabs := make([]repositories.Tablet, 0, len(t.TabletIDs))
+		for _, id := range t.TabletIDs {
+			tab, err := s.tabRepo.GetByID(id)
+			if err != nil {
+				return nil, ErrTabletNotFound
+			}
+			tabs = append(tabs, *tab)
+		}
+		return tabs, nil
+	}
 	if t.GroupID > 0 {
 		tablets, err := s.groupRepo.GetTabletsByGroup(t.GroupID)
 		if err != nil || len(tablets) == 0 {
 			return nil, ErrGroupNotFound
 		}
-		return tablets, nil
+		return activeTablets(tablets, t.Scheduled), nil
+	}
+	if t.All {
+		tablets, err := s.tabRepo.GetAll()
+		if err != nil || len(tablets) == 0 {
+			return nil, ErrInvalidTarget
+		}
+		return activeTablets(tablets, t.Scheduled), nil
 	}
 	return nil, ErrInvalidTarget
 }
 
+// activeTablets écarte d'un envoi de groupe ou de flotte les tablettes retirées,
+// et celles en maintenance si l'envoi est planifié
+func activeTablets(tablets []repositories.Tablet, scheduled bool) []repositories.Tablet {
+	now := time.Now()
+	return slices.DeleteFunc(tablets, func(t repositories.Tablet) bool {
+		return t.Retired() || scheduled && t.InMaintenance(now)
+	})
+}
+
+func (s *kioskServiceImpl) Resolve(t Target) ([]repositories.Tablet, error) {
+	return s.resolveTablets(t)
+}
+
 // executeAndWait est le moteur centralisé de parallélisme
 func (s *kioskServiceImpl) executeAndWait(t Target, cmdName string, action func(ip string) error) (*ActionReport, error) {
+	return s.executeEach(t, cmdName, func(_ repositories.Tablet, addr string) error { return action(addr) })
+}
+
+// executeEach est la variante de executeAndWait pour les commandes dont le contenu dépend de la tablette
+func (s *kioskServiceImpl) executeEach(t Target, cmdName string, action func(tablet repositories.Tablet, addr string) error) (*ActionReport, error) {
+	return s.executeIndexed(t, cmdName, func(_ int, tablet repositories.Tablet, addr string) error {
+		return action(tablet, addr)
+	})
+}
+
+// executeIndexed passe aussi à l'action la position de son résultat dans le rapport, qui identifie
+// la cible même quand elle n'est pas une tablette enregistrée (Target.IPs : ID 0)
+func (s *kioskServiceImpl) executeIndexed(t Target, cmdName string, action func(index int, tablet repositories.Tablet, addr string) error) (*ActionReport, error) {
 	tablets, err := s.resolveTablets(t)
 	if err != nil {
 		return nil, err
@@ -152,8 +206,8 @@ func (s *kioskServiceImpl) executeAndWait(t Target, cmdName string, action func(
 			defer wg.Done()
 			start := time.Now()
 
-			fullAddr := s.getAddr(tablet.IP)
-			err := action(fullAddr)
+			fullAddr := s.getAddr(tablet)
+			err := action(index, tablet, fullAddr)
 			duration := time.Since(start).Round(time.Millisecond).String()
 
 			res := TabletResult{
@@ -176,18 +230,21 @@ func (s *kioskServiceImpl) executeAndWait(t Target, cmdName string, action func(
 			mu.Lock()
 			report.Results[index] = res
 			mu.Unlock()
+
+			// Les adresses saisies à la main (Target.IPs) ne correspondent à aucune tablette enregistrée
+			if tablet.ID != 0 {
+				sse.Instance.Publish(sse.Event{Type: sse.EventCommand, TabletID: tablet.ID, Data: sse.CommandResult{
+					Command: cmdName,
+					Success: res.Success,
+					Error:   res.Error,
+				}})
+			}
 		}(i, tab)
 	}
 
 	wg.Wait()
 
-	successCount := 0
-	for _, r := range report.Results {
-		if r.Executed {
-			successCount++
-		}
-	}
-	report.Summary = fmt.Sprintf("%d/%d tablettes ont exécuté la commande avec succès", successCount, len(tablets))
+	report.Summary = summarize(report.Results)
 
 	return report, nil
 }
@@ -212,7 +269,7 @@ func (s *kioskServiceImpl) FetchStatus(t Target) (*StatusReport, error) {
 			defer wg.Done()
 
 			// Appel du client FetchStatus (celui que tu as écrit)
-			fullAddr := s.getAddr(tablet.IP)
+			fullAddr := s.getAddr(tablet)
 			data, err := s.client.FetchStatus(fullAddr)
 
 			res := StatusResult{
@@ -269,7 +326,9 @@ func (s *kioskServiceImpl) Reboot(t Target) (*ActionReport, error) {
 }
 
 func (s *kioskServiceImpl) Navigate(t Target, url string) (*ActionReport, error) {
-	return s.executeAndWait(t, "navigate", func(ip string) error { return s.client.Navigate(ip, url) })
+	return s.executeEach(t, "navigate", func(tab repositories.Tablet, ip string) error {
+		return s.client.Navigate(ip, s.signer.SignURL(url, tab.ID))
+	})
 }
 
 func (s *kioskServiceImpl) NavigateAlias(t Target, url string) (*ActionReport, error) {
@@ -285,7 +344,24 @@ func (s *kioskServiceImpl) ClearCache(t Target) (*ActionReport, error) {
 }
 
 func (s *kioskServiceImpl) ExecuteJS(t Target, code string) (*ActionReport, error) {
-	return s.executeAndWait(t, "executeJS", func(ip string) error { return s.client.ExecuteJS(ip, code) })
+	var mu sync.Mutex
+	outputs := make(map[int]string)
+
+	report, err := s.executeIndexed(t, "executeJS", func(index int, _ repositories.Tablet, addr string) error {
+		out, err := s.client.ExecuteJS(addr, code)
+		mu.Lock()
+		outputs[index] = out
+		mu.Unlock()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range report.Results {
+		report.Results[i].Output = outputs[i]
+	}
+	return report, nil
 }
 
 func (s *kioskServiceImpl) SetRotation(t Target, start bool) (*ActionReport, error) {
@@ -297,7 +373,9 @@ func (s *kioskServiceImpl) Speak(t Target, text string) (*ActionReport, error) {
 }
 
 func (s *kioskServiceImpl) PlayAudio(t Target, url string, loop bool, volume int) (*ActionReport, error) {
-	return s.executeAndWait(t, "playAudio", func(ip string) error { return s.client.PlayAudio(ip, url, loop, volume) })
+	return s.executeEach(t, "playAudio", func(tab repositories.Tablet, ip string) error {
+		return s.client.PlayAudio(ip, s.signer.SignURL(url, tab.ID), loop, volume)
+	})
 }
 
 func (s *kioskServiceImpl) StopAudio(t Target) (*ActionReport, error) {
@@ -321,5 +399,5 @@ func (s *kioskServiceImpl) GetPhoto(tabletID int64, camera string, quality int)
 	if err != nil {
 		return nil, ErrTabletNotFound
 	}
-	return s.client.TakePhoto(tab.IP, camera, quality)
+	return s.client.TakePhoto(s.getAddr(*tab), camera, quality)
 }
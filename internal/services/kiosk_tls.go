@@ -0,0 +1,459 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+var (
+	ErrInvalidTLSSettings  = errors.New("invalid_tls_settings")
+	ErrInvalidCAPEM        = errors.New("invalid_ca_pem")
+	ErrFingerprintMismatch = errors.New("fingerprint_mismatch")
+)
+
+// Durées de vie des certificats émis par la CA du hub
+const (
+	hubCAValidity         = 10 * 365 * 24 * time.Hour
+	hubClientCertValidity = 2 * 365 * 24 * time.Hour
+	hubClientCertRenewal  = 30 * 24 * time.Hour
+)
+
+// KioskTLSService choisit, tablette par tablette, comment le hub la joint hors Tailscale :
+// HTTP en clair ou HTTPS vérifié par les autorités du système, une CA épinglée ou
+// l'empreinte mémorisée au premier contact, avec un certificat client en option.
+type KioskTLSService interface {
+	// Scheme renvoie "http" ou "https" pour une adresse host:port
+	Scheme(host string) string
+	// Wrap fait établir les connexions TLS du transport selon les réglages de chaque tablette
+	Wrap(t *http.Transport)
+	// Plaintext indique que les échanges avec la tablette, clé d'API comprise, circulent en clair
+	Plaintext(tabletID int64) bool
+	// PlaintextAll fait le même calcul pour plusieurs tablettes en une seule requête
+	PlaintextAll(tablets []repositories.Tablet) map[int64]bool
+
+	Settings(tabletID int64) (*repositories.TabletTLS, error)
+	Save(t *repositories.TabletTLS, actor string) error
+	ForgetFingerprint(tabletID int64, actor string) error
+
+	// CACertPEM est le certificat de la CA du hub, à installer sur les kiosques qui exigent un certificat client
+	CACertPEM() []byte
+}
+
+type kioskTLSService struct {
+	repo        repositories.TabletTLSRepository
+	auditRepo   repositories.AuditRepository
+	dir         string
+	overTailnet bool // WireGuard chiffre déjà tout le trafic
+
+	caCert *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	caPEM  []byte
+
+	mu     sync.Mutex
+	client *tls.Certificate
+
+	// Transports dont les connexions ouvertes sont fermées quand un réglage change
+	transports []*http.Transport
+
+	// Réglages gardés par adresse : chaque requête vers un kiosque en a besoin, pour le schéma puis la poignée de main
+	settingsMu sync.Mutex
+	settings   map[string]cachedTLS
+}
+
+type cachedTLS struct {
+	settings repositories.TabletTLS
+	loadedAt time.Time
+}
+
+func NewKioskTLSService(repo repositories.TabletTLSRepository, ar repositories.AuditRepository, dir string, overTailnet bool) (KioskTLSService, error) {
+	s := &kioskTLSService{repo: repo, auditRepo: ar, dir: dir, overTailnet: overTailnet, settings: make(map[string]cachedTLS)}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := s.loadCA(); err != nil {
+		return nil, fmt.Errorf("hub CA: %w", err)
+	}
+	if _, err := s.clientCertificate(); err != nil {
+		return nil, fmt.Errorf("hub client certificate: %w", err)
+	}
+	return s, nil
+}
+
+func (s *kioskTLSService) Scheme(host string) string {
+	if t := s.lookup(host); t.Scheme == "https" {
+		return "https"
+	}
+	return "http"
+}
+
+func (s *kioskTLSService) Plaintext(tabletID int64) bool {
+	if s.overTailnet {
+		return false
+	}
+	t, err := s.Settings(tabletID)
+	return err != nil || t.Scheme != "https"
+}
+
+func (s *kioskTLSService) PlaintextAll(tablets []repositories.Tablet) map[int64]bool {
+	plain := make(map[int64]bool, len(tablets))
+	if s.overTailnet {
+		return plain
+	}
+	settings, err := s.repo.GetAll()
+	if err != nil {
+		slog.Error("database error: failed to fetch tablet TLS settings", "err", err)
+	}
+	https := make(map[int64]bool, len(settings))
+	for _, t := range settings {
+		https[t.TabletID] = t.Scheme == "https"
+	}
+	for _, t := range tablets {
+		plain[t.ID] = !https[t.ID]
+	}
+	return plain
+}
+
+// lookup renvoie les réglages d'une adresse, ou les réglages par défaut (HTTP)
+func (s *kioskTLSService) lookup(addr string) repositories.TabletTLS {
+	s.settingsMu.Lock()
+	c, ok := s.settings[addr]
+	s.settingsMu.Unlock()
+	if ok && time.Since(c.loadedAt) < addrCacheTTL {
+		return c.settings
+	}
+
+	t := s.load(addr)
+	s.settingsMu.Lock()
+	s.settings[addr] = cachedTLS{settings: t, loadedAt: time.Now()}
+	s.settingsMu.Unlock()
+	return t
+}
+
+// invalidate fait relire les réglages après une modification
+func (s *kioskTLSService) invalidate() {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	clear(s.settings)
+}
+
+func (s *kioskTLSService) load(addr string) repositories.TabletTLS {
+	t, err := s.repo.GetByAddr(addr)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("database error: failed to fetch tablet TLS settings", "addr", addr, "err", err)
+		}
+		return repositories.TabletTLS{Scheme: "http", Verify: repositories.TLSVerifySystem}
+	}
+	return *t
+}
+
+func (s *kioskTLSService) Wrap(t *http.Transport) {
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 10 * time.Second}).DialContext
+	}
+	t.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := s.tlsConfig(host, s.lookup(addr))
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+
+	s.mu.Lock()
+	s.transports = append(s.transports, t)
+	s.mu.Unlock()
+}
+
+// closeIdle oblige les prochaines requêtes à refaire la poignée de main avec les nouveaux réglages
+func (s *kioskTLSService) closeIdle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.transports {
+		t.CloseIdleConnections()
+	}
+}
+
+func (s *kioskTLSService) tlsConfig(host string, t repositories.TabletTLS) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+
+	switch t.Verify {
+	case repositories.TLSVerifyCA:
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(t.CAPEM)) {
+			return nil, ErrInvalidCAPEM
+		}
+		cfg.RootCAs = pool
+	case repositories.TLSVerifyTOFU:
+		// La chaîne n'est pas vérifiée : seule compte l'empreinte du certificat feuille
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = s.pinFingerprint(t)
+	}
+
+	if t.ClientCert {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return s.clientCertificate()
+		}
+	}
+	return cfg, nil
+}
+
+// pinFingerprint mémorise l'empreinte au premier contact puis refuse tout autre certificat
+func (s *kioskTLSService) pinFingerprint(t repositories.TabletTLS) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("tls: kiosk presented no certificate")
+		}
+		fp := Fingerprint(rawCerts[0])
+
+		pinned := t.Fingerprint
+		if pinned == "" {
+			ok, err := s.repo.PinFingerprint(t.TabletID, fp)
+			if err != nil {
+				return err
+			}
+			if ok {
+				s.invalidate()
+				slog.Info("tls: pinned kiosk certificate on first use", "tablet", t.TabletID, "fingerprint", fp)
+				recordAudit(s.auditRepo, "monitor", "tls.pin", fmt.Sprintf("tablet:%d", t.TabletID), fp)
+				return nil
+			}
+			// Une autre connexion a épinglé entre-temps : c'est son empreinte qui fait foi
+			current, err := s.repo.GetByTablet(t.TabletID)
+			if err != nil {
+				return err
+			}
+			pinned = current.Fingerprint
+		}
+		if fp != pinned {
+			return fmt.Errorf("%w: kiosk presented %s", ErrFingerprintMismatch, fp)
+		}
+		return nil
+	}
+}
+
+// Fingerprint renvoie l'empreinte SHA-256 d'un certificat DER, en hexadécimal
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *kioskTLSService) Settings(tabletID int64) (*repositories.TabletTLS, error) {
+	t, err := s.repo.GetByTablet(tabletID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &repositories.TabletTLS{TabletID: tabletID, Scheme: "http", Verify: repositories.TLSVerifySystem}, nil
+	}
+	return t, err
+}
+
+func (s *kioskTLSService) Save(t *repositories.TabletTLS, actor string) error {
+	if t.Scheme != "http" && t.Scheme != "https" {
+		return ErrInvalidTLSSettings
+	}
+	switch t.Verify {
+	case repositories.TLSVerifySystem, repositories.TLSVerifyTOFU:
+		t.CAPEM = ""
+	case repositories.TLSVerifyCA:
+		t.CAPEM = strings.TrimSpace(t.CAPEM)
+		if !x509.NewCertPool().AppendCertsFromPEM([]byte(t.CAPEM)) {
+			return ErrInvalidCAPEM
+		}
+	default:
+		return ErrInvalidTLSSettings
+	}
+
+	// L'empreinte mémorisée n'a de sens qu'en mode TOFU
+	current, err := s.Settings(t.TabletID)
+	if err != nil {
+		return err
+	}
+	t.Fingerprint = ""
+	if t.Verify == repositories.TLSVerifyTOFU {
+		t.Fingerprint = current.Fingerprint
+	}
+
+	if err := s.repo.Save(t); err != nil {
+		return err
+	}
+	s.invalidate()
+	s.closeIdle()
+	recordAudit(s.auditRepo, actor, "tls.update", fmt.Sprintf("tablet:%d", t.TabletID),
+		fmt.Sprintf("scheme=%s verify=%s client_cert=%t", t.Scheme, t.Verify, t.ClientCert))
+	return nil
+}
+
+func (s *kioskTLSService) ForgetFingerprint(tabletID int64, actor string) error {
+	current, err := s.Settings(tabletID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetFingerprint(tabletID, ""); err != nil {
+		return err
+	}
+	s.invalidate()
+	s.closeIdle()
+	recordAudit(s.auditRepo, actor, "tls.forget", fmt.Sprintf("tablet:%d", tabletID), current.Fingerprint)
+	return nil
+}
+
+func (s *kioskTLSService) CACertPEM() []byte {
+	return s.caPEM
+}
+
+// loadCA recharge la CA du hub depuis dir, ou la crée au premier démarrage
+func (s *kioskTLSService) loadCA() error {
+	certPath, keyPath := filepath.Join(s.dir, "ca.pem"), filepath.Join(s.dir, "ca.key")
+
+	if cert, key, certPEM, err := loadKeyPair(certPath, keyPath); err == nil {
+		s.caCert, s.caKey, s.caPEM = cert, key, certPEM
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "FreeKiosk Hub CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(hubCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	if err := writeKeyPair(certPath, keyPath, der, key); err != nil {
+		return err
+	}
+	slog.Info("🔏 Hub certificate authority created", "path", certPath)
+
+	s.caCert, _ = x509.ParseCertificate(der)
+	s.caKey = key
+	s.caPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return nil
+}
+
+// clientCertificate renvoie le certificat client du hub, réémis par la CA à l'approche de son expiration
+func (s *kioskTLSService) clientCertificate() (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != nil && time.Until(s.client.Leaf.NotAfter) > hubClientCertRenewal {
+		return s.client, nil
+	}
+
+	certPath, keyPath := filepath.Join(s.dir, "client.pem"), filepath.Join(s.dir, "client.key")
+	if cert, key, _, err := loadKeyPair(certPath, keyPath); err == nil && time.Until(cert.NotAfter) > hubClientCertRenewal {
+		s.client = &tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}
+		return s.client, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: "freekiosk-hub"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(hubClientCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.caCert, &key.PublicKey, s.caKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeKeyPair(certPath, keyPath, der, key); err != nil {
+		return nil, err
+	}
+	slog.Info("🔏 Hub client certificate issued", "path", certPath)
+
+	leaf, _ := x509.ParseCertificate(der)
+	s.client = &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	return s.client, nil
+}
+
+func loadKeyPair(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, []byte, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, nil, fmt.Errorf("%s: unreadable PEM", certPath)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cert, key, certPEM, nil
+}
+
+func writeKeyPair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+func randomSerial() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	return serial
+}
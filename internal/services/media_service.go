@@ -1,15 +1,71 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+var (
+	ErrMediaNotFound    = errors.New("media_not_found")
+	ErrMediaDuplicate   = errors.New("media_duplicate")
+	ErrMediaInUse       = errors.New("media_in_use")
+	ErrUnsupportedMedia = errors.New("unsupported_media_type")
+	ErrFileTooLarge     = errors.New("file_too_large")
+	ErrQuotaExceeded    = errors.New("storage_quota_exceeded")
+	ErrChecksumMismatch = errors.New("checksum_mismatch")
 )
 
+// MediaLimits borne l'espace occupé par la bibliothèque (0 = pas de quota global)
+type MediaLimits struct {
+	MaxFileSize int64
+	Quota       int64
+	// Durée de conservation du journal des téléchargements
+	AccessRetentionDays int
+}
+
+// MediaCollection est une famille de fichiers rangée dans son propre dossier de MEDIA_DIR
+type MediaCollection struct {
+	Key   string
+	Dir   string
+	Label string
+	Kind  string // type de contenu accepté (audio, image, video, document)
+}
+
+// L'audio reste dans "sounds" pour ne pas casser les URLs déjà envoyées aux tablettes.
+// Les photos prises par les caméras des tablettes ont leur propre collection, purgée par rétention.
+var MediaCollections = []MediaCollection{
+	{Key: "audio", Dir: "sounds", Label: "Audio", Kind: "audio"},
+	{Key: "image", Dir: "images", Label: "Images", Kind: "image"},
+	{Key: "video", Dir: "videos", Label: "Video", Kind: "video"},
+	{Key: "document", Dir: "documents", Label: "Documents", Kind: "document"},
+	{Key: "snapshot", Dir: "snapshots", Label: "Snapshots", Kind: "image"},
+}
+
+func collectionByKey(key string) (MediaCollection, bool) {
+	for _, c := range MediaCollections {
+		if c.Key == key {
+			return c, true
+		}
+	}
+	return MediaCollection{}, false
+}
+
 // Sound info structure for the UI
 type SoundFileInfo struct {
 	Name      string `json:"name"`
@@ -17,90 +73,523 @@ type SoundFileInfo struct {
 	URL       string `json:"url"`
 }
 
+// MediaUsage décrit un élément du hub qui référence un fichier de la bibliothèque
+type MediaUsage struct {
+	Kind  string
+	Label string
+	Link  string
+}
+
+// UploadOptions complète un envoi de fichier ; Collection restreint le type accepté si renseigné
+type UploadOptions struct {
+	Collection string
+	Uploader   string
+	Tags       string
+	SHA256     string // empreinte annoncée par le client, vérifiée après réception
+}
+
 // Service definition
 type MediaService interface {
-	Upload(name string, content io.ReadSeeker) (*SoundFileInfo, error)
-	List() ([]SoundFileInfo, error)
-	Delete(name string) error
+	Upload(name string, content io.Reader, opts UploadOptions) (*repositories.Media, error)
+	List(collection string) ([]repositories.Media, error)
+	Get(id int64) (*repositories.Media, error)
+	// Lookup retrouve un fichier de la collection par son nom sur disque, s'il est toujours présent
+	Lookup(collection, fileName string) (*repositories.Media, error)
+	Update(id int64, name, tags string) error
+	// Delete refuse de supprimer un fichier encore référencé, sauf si force est vrai
+	Delete(id int64, force bool) error
+	Usage(m *repositories.Media) ([]MediaUsage, error)
+
+	// URL renvoie une adresse adressée par contenu (?v=<empreinte>), cachable indéfiniment par les tablettes
+	URL(m *repositories.Media) string
+	Path(m *repositories.Media) string
+	// Resolve retrouve le média servi sous /media/<dir>/<file>
+	Resolve(dir, file string) (*repositories.Media, error)
+	// Variant choisit le fichier à servir : une variante pré-compressée si le client l'accepte
+	Variant(m *repositories.Media, acceptEncoding string, ranged bool) (path string, encoding string)
+	LogAccess(m *repositories.Media, ip string, status int, bytes int64)
+
+	// URLs signées : les collections non publiques ne sont servies qu'avec une signature valide
+	URLSigner
+	VerifyURL(dir, file string, q url.Values) (tabletID int64, err error)
+	PublicCollection(dir string) bool
+	LastAccess(m *repositories.Media) ([]repositories.MediaAccess, error)
+	// Sounds liste la collection audio sous la forme attendue par les sélecteurs de son
+	Sounds() ([]SoundFileInfo, error)
+
+	// Envoi par morceaux, reprenable après une coupure réseau
+	StartUpload(name string, size int64, opts UploadOptions) (*UploadSession, error)
+	GetUpload(id string) (*UploadSession, error)
+	WriteChunk(id string, offset int64, chunk io.Reader) (*UploadSession, error)
+	CompleteUpload(id string) (*repositories.Media, error)
+
+	// Storage renvoie l'espace utilisé et le quota configuré (0 = illimité)
+	Storage() (used int64, quota int64, err error)
+	// Scrub réconcilie la base avec les fichiers réellement présents dans MEDIA_DIR
+	Scrub() (*ScrubReport, error)
+	RunScrubber(ctx context.Context, interval time.Duration)
 }
 
 type mediaService struct {
+	mu         sync.Mutex
+	mediaRepo  repositories.MediaRepository
+	presetRepo repositories.PresetRepository
+	emRepo     repositories.EmergencyRepository
+	annRepo    repositories.AnnouncementRepository
 	storageDir string
 	baseURL    string
-	soundDir   string
-}
+	limits     MediaLimits
+	signing    MediaSigning
+	signingKey []byte
 
-func NewMediaService(storageDir, baseURL string) MediaService {
-	// Create storage dir if not exists
-	_ = os.MkdirAll(storageDir, 0755)
-	_ = os.MkdirAll(filepath.Join(storageDir, "sounds"), 0755)
+	sessionsMu sync.Mutex
+	sessions   map[string]*UploadSession
+}
 
-	return &mediaService{
+func NewMediaService(
+	mr repositories.MediaRepository,
+	pr repositories.PresetRepository,
+	er repositories.EmergencyRepository,
+	anr repositories.AnnouncementRepository,
+	storageDir, baseURL string,
+	limits MediaLimits,
+	signing MediaSigning,
+) MediaService {
+	s := &mediaService{
+		mediaRepo:  mr,
+		presetRepo: pr,
+		emRepo:     er,
+		annRepo:    anr,
 		storageDir: storageDir,
 		baseURL:    baseURL,
-		soundDir:   filepath.Join(storageDir, "sounds"),
+		limits:     limits,
+		signing:    signing,
+		sessions:   make(map[string]*UploadSession),
 	}
+	s.signingKey = loadSigningKey(storageDir, signing.Key)
+
+	// Create storage dirs if not exists
+	for _, c := range MediaCollections {
+		_ = os.MkdirAll(filepath.Join(storageDir, c.Dir), 0755)
+	}
+	_ = os.MkdirAll(s.uploadDir(), 0755)
+	s.adoptUntracked()
+
+	return s
 }
 
-func (s *mediaService) Upload(name string, content io.ReadSeeker) (*SoundFileInfo, error) {
-	buffer := make([]byte, 512)
-	if _, err := content.Read(buffer); err != nil {
-		return nil, fmt.Errorf("failed to read file header: %w", err)
+// adoptUntracked enregistre les fichiers présents sur disque mais inconnus de la base
+// (déposés avant l'existence de la table media, ou copiés à la main dans MEDIA_DIR)
+func (s *mediaService) adoptUntracked() int {
+	adopted := 0
+	for _, c := range MediaCollections {
+		entries, err := os.ReadDir(filepath.Join(s.storageDir, c.Dir))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") || isVariant(e.Name()) {
+				continue
+			}
+			if _, err := s.mediaRepo.GetByFile(c.Key, e.Name()); err == nil {
+				continue
+			}
+
+			path := filepath.Join(s.storageDir, c.Dir, e.Name())
+			sum, size, err := hashFile(path)
+			if err != nil {
+				slog.Warn("media: could not hash untracked file", "path", path, "err", err)
+				continue
+			}
+			m := &repositories.Media{
+				Collection: c.Key,
+				Name:       e.Name(),
+				FileName:   e.Name(),
+				MimeType:   mime.TypeByExtension(filepath.Ext(e.Name())),
+				Size:       size,
+				SHA256:     sum,
+				UploadedBy: "system",
+			}
+			if _, err := s.mediaRepo.Create(m); err != nil {
+				slog.Error("database error: failed to register untracked media", "path", path, "err", err)
+				continue
+			}
+			adopted++
+			slog.Info("resource created: untracked media registered", "collection", c.Key, "file", e.Name())
+		}
+	}
+	return adopted
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
 	}
-	content.Seek(0, 0)
+	defer f.Close()
 
-	contentType := http.DetectContentType(buffer)
-	if contentType != "audio/mpeg" && contentType != "audio/wav" && contentType != "audio/ogg" {
-		return nil, fmt.Errorf("unsupported file type: %s", contentType)
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
 	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
 
-	safeName := filepath.Base(name)
-	dstPath := filepath.Join(s.soundDir, safeName)
+// detectCollection classe un fichier d'après son contenu, l'extension servant à lever les ambiguïtés
+// (DetectContentType renvoie par exemple "application/ogg" pour l'audio comme pour la vidéo Ogg)
+func detectCollection(header []byte, name string) (string, string, error) {
+	sniffed := http.DetectContentType(header)
+	byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))
 
-	dst, err := os.Create(dstPath)
+	contentType := strings.Split(sniffed, ";")[0]
+	if contentType == "application/octet-stream" || contentType == "application/ogg" || contentType == "text/plain" {
+		if byExt != "" {
+			contentType = strings.Split(byExt, ";")[0]
+		} else if contentType == "application/ogg" {
+			contentType = "audio/ogg"
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(contentType, "audio/"):
+		return "audio", contentType, nil
+	case strings.HasPrefix(contentType, "image/"):
+		return "image", contentType, nil
+	case strings.HasPrefix(contentType, "video/"):
+		return "video", contentType, nil
+	case contentType == "application/pdf":
+		return "document", contentType, nil
+	}
+	return "", "", fmt.Errorf("%w: %s", ErrUnsupportedMedia, contentType)
+}
+
+func (s *mediaService) Upload(name string, content io.Reader, opts UploadOptions) (*repositories.Media, error) {
+	// Simple refus anticipé : la place est vérifiée pour de bon par ingest
+	if err := s.checkQuota(0, ""); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(s.uploadDir(), "direct-*.part")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file: %w", err)
 	}
-	defer dst.Close()
+	defer os.Remove(tmp.Name())
 
-	if _, err = io.Copy(dst, content); err != nil {
+	// Un octet de plus que la limite suffit à savoir si le fichier la dépasse
+	size, err := io.Copy(tmp, io.LimitReader(content, s.limits.MaxFileSize+1))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to save file: %w", err)
 	}
+	if size > s.limits.MaxFileSize {
+		return nil, ErrFileTooLarge
+	}
 
-	return &SoundFileInfo{
-		Name:      safeName,
-		Extension: filepath.Ext(safeName),
-		URL:       fmt.Sprintf("%s/media/sounds%s", s.baseURL, name),
-	}, nil
+	return s.ingest(tmp.Name(), name, opts, "")
 }
 
-func (s *mediaService) List() ([]SoundFileInfo, error) {
-	files, err := os.ReadDir(s.soundDir)
+// ingest contrôle un fichier complet déposé dans le dossier temporaire puis le range
+// dans sa collection par un renommage atomique : un fichier visible est toujours complet.
+// session est l'envoi par morceaux dont provient le fichier, dont la place réservée lui revient.
+func (s *mediaService) ingest(tmpPath, name string, opts UploadOptions, session string) (*repositories.Media, error) {
+	f, err := os.Open(tmpPath)
 	if err != nil {
 		return nil, err
 	}
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	f.Close()
+	if n == 0 {
+		return nil, fmt.Errorf("empty file")
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read file header: %w", err)
+	}
 
-	var list []SoundFileInfo
-	for _, f := range files {
-		if !f.IsDir() {
-			name := f.Name()
-			list = append(list, SoundFileInfo{
-				Name:      name,
-				Extension: filepath.Ext(name),
-				URL:       s.getSoundURL(name),
-			})
+	kind, contentType, err := detectCollection(header[:n], name)
+	if err != nil {
+		return nil, err
+	}
+	collection := kind
+	if opts.Collection != "" {
+		target, ok := collectionByKey(opts.Collection)
+		if !ok || target.Kind != kind {
+			return nil, fmt.Errorf("%w: expected %s, got %s", ErrUnsupportedMedia, opts.Collection, contentType)
 		}
+		collection = target.Key
 	}
-	return list, nil
+	c, _ := collectionByKey(collection)
+
+	sum, size, err := hashFile(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SHA256 != "" && !strings.EqualFold(opts.SHA256, sum) {
+		return nil, fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, opts.SHA256, sum)
+	}
+
+	// Le doublon est cherché sous s.mu : deux envois identiques simultanés (rendus TTS, captures planifiées)
+	// ne peuvent pas tous deux le manquer avant l'enregistrement
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, err := s.mediaRepo.GetByHash(sum); err == nil {
+		return existing, ErrMediaDuplicate
+	}
+	if err := s.checkQuota(size, session); err != nil {
+		return nil, err
+	}
+
+	fileName := s.uniqueFileName(c, filepath.Base(name))
+	dst := filepath.Join(s.storageDir, c.Dir, fileName)
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return nil, fmt.Errorf("failed to save file: %w", err)
+	}
+
+	m := &repositories.Media{
+		Collection: collection,
+		Name:       strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)),
+		FileName:   fileName,
+		MimeType:   contentType,
+		Size:       size,
+		SHA256:     sum,
+		UploadedBy: opts.Uploader,
+		Tags:       strings.Join(repositories.Media{Tags: opts.Tags}.TagList(), ","),
+	}
+	if _, err := s.mediaRepo.Create(m); err != nil {
+		_ = os.Remove(dst)
+		return nil, err
+	}
+
+	if compressible(contentType) {
+		if err := writeGzipVariant(dst); err != nil {
+			slog.Warn("media: could not pre-compress file", "file", fileName, "err", err)
+		}
+	}
+
+	slog.Info("resource created: media uploaded", "collection", collection, "file", fileName, "size", size)
+	return m, nil
+}
+
+// checkQuota vérifie qu'il reste la place pour `extra` octets dans la bibliothèque, en comptant
+// la taille annoncée des envois par morceaux en cours, sauf celui d'identifiant session.
+// Appelée sous s.mu, sans quoi deux envois simultanés pourraient se voir accorder la même place.
+func (s *mediaService) checkQuota(extra int64, session string) error {
+	if s.limits.Quota <= 0 {
+		return nil
+	}
+	used, err := s.mediaRepo.TotalSize()
+	if err != nil {
+		return err
+	}
+	s.sessionsMu.Lock()
+	for id, pending := range s.sessions {
+		if id != session {
+			used += pending.Size
+		}
+	}
+	s.sessionsMu.Unlock()
+	if used+extra > s.limits.Quota {
+		return ErrQuotaExceeded
+	}
+	return nil
 }
 
-func (s *mediaService) Delete(name string) error {
-	safeName := filepath.Base(name)
-	return os.Remove(filepath.Join(s.storageDir, safeName))
+func (s *mediaService) Storage() (int64, int64, error) {
+	used, err := s.mediaRepo.TotalSize()
+	return used, s.limits.Quota, err
 }
 
-func (s *mediaService) getSoundURL(filename string) string {
+// uniqueFileName évite d'écraser un fichier existant portant le même nom (photo.jpg -> photo-2.jpg)
+func (s *mediaService) uniqueFileName(c MediaCollection, name string) string {
+	name = strings.ReplaceAll(name, " ", "_")
+	if name == "" || name == "." || strings.HasPrefix(name, ".") {
+		name = "file" + name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(s.storageDir, c.Dir, candidate)); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+func (s *mediaService) List(collection string) ([]repositories.Media, error) {
+	return s.mediaRepo.GetAll(collection)
+}
+
+func (s *mediaService) Get(id int64) (*repositories.Media, error) {
+	m, err := s.mediaRepo.GetByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMediaNotFound
+	}
+	return m, err
+}
+
+func (s *mediaService) Lookup(collection, fileName string) (*repositories.Media, error) {
+	m, err := s.mediaRepo.GetByFile(collection, fileName)
+	if err != nil {
+		return nil, ErrMediaNotFound
+	}
+	if _, err := os.Stat(s.Path(m)); err != nil {
+		return nil, ErrMediaNotFound
+	}
+	return m, nil
+}
+
+func (s *mediaService) Update(id int64, name, tags string) error {
+	m, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if name = strings.TrimSpace(name); name != "" {
+		m.Name = name
+	}
+	m.Tags = strings.Join(repositories.Media{Tags: tags}.TagList(), ",")
+	return s.mediaRepo.Update(m)
+}
+
+func (s *mediaService) Delete(id int64, force bool) error {
+	m, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		usage, err := s.Usage(m)
+		if err != nil {
+			return err
+		}
+		if len(usage) > 0 {
+			return ErrMediaInUse
+		}
+	}
+
+	if err := s.mediaRepo.Delete(id); err != nil {
+		return err
+	}
+	if err := os.Remove(s.Path(m)); err != nil && !os.IsNotExist(err) {
+		slog.Warn("failed to remove media file", "path", s.Path(m), "err", err)
+	}
+	for _, v := range variantEncodings {
+		_ = os.Remove(s.Path(m) + v.ext)
+	}
+	slog.Info("resource deleted: media removed", "collection", m.Collection, "file", m.FileName)
+	return nil
+}
+
+// Usage recherche l'URL du fichier dans les presets et les alertes récentes
+func (s *mediaService) Usage(m *repositories.Media) ([]MediaUsage, error) {
+	c, _ := collectionByKey(m.Collection)
+	ref := fmt.Sprintf("/media/%s/%s", c.Dir, url.PathEscape(m.FileName))
+
+	var usage []MediaUsage
+
+	presets, err := s.presetRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range presets {
+		if strings.Contains(p.URL, ref) || strings.Contains(p.Thumbnail, ref) {
+			usage = append(usage, MediaUsage{Kind: "preset", Label: p.Title, Link: "/presets"})
+		}
+	}
+
+	emergencies, err := s.emRepo.GetRecent(50)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range emergencies {
+		if strings.Contains(e.SoundURL, ref) || strings.Contains(e.AlertURL, ref) {
+			label := fmt.Sprintf("Alert of %s", e.StartedAt.Format("02/01 15:04"))
+			if e.EndedAt == nil {
+				label += " (active)"
+			}
+			usage = append(usage, MediaUsage{Kind: "emergency", Label: label, Link: "/emergency"})
+		}
+	}
+
+	announcements, err := s.annRepo.GetByMedia(m.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range announcements {
+		usage = append(usage, MediaUsage{Kind: "announcement", Label: a.Name, Link: "/announcements"})
+	}
+
+	return usage, nil
+}
+
+// MediaVersion est le paramètre v des URLs de médias : il change avec le contenu du fichier,
+// ce qui permet aux tablettes de garder en cache une URL qui le porte
+func MediaVersion(m *repositories.Media) string {
+	return m.SHA256[:min(12, len(m.SHA256))]
+}
+
+func (s *mediaService) URL(m *repositories.Media) string {
+	c, _ := collectionByKey(m.Collection)
 	base := strings.TrimSuffix(s.baseURL, "/")
-	safeName := url.PathEscape(filename)
-	return fmt.Sprintf("http://%s/media/sounds/%s", base, safeName)
+	return fmt.Sprintf("http://%s/media/%s/%s?v=%s", base, c.Dir, url.PathEscape(m.FileName), MediaVersion(m))
+}
+
+func (s *mediaService) Resolve(dir, file string) (*repositories.Media, error) {
+	for _, c := range MediaCollections {
+		if c.Dir != dir {
+			continue
+		}
+		m, err := s.mediaRepo.GetByFile(c.Key, file)
+		if err != nil || m.Status == repositories.MediaStatusMissing {
+			return nil, ErrMediaNotFound
+		}
+		return m, nil
+	}
+	return nil, ErrMediaNotFound
+}
+
+func (s *mediaService) LogAccess(m *repositories.Media, ip string, status int, bytes int64) {
+	err := s.mediaRepo.LogAccess(&repositories.MediaAccess{
+		MediaID: m.ID,
+		IP:      ip,
+		Status:  status,
+		Bytes:   bytes,
+	})
+	if err != nil {
+		slog.Error("database error: failed to log media access", "id", m.ID, "err", err)
+	}
+}
+
+func (s *mediaService) LastAccess(m *repositories.Media) ([]repositories.MediaAccess, error) {
+	return s.mediaRepo.GetLastAccess(m.ID, 10)
+}
+
+func (s *mediaService) Path(m *repositories.Media) string {
+	c, _ := collectionByKey(m.Collection)
+	return filepath.Join(s.storageDir, c.Dir, filepath.Base(m.FileName))
+}
+
+func (s *mediaService) Sounds() ([]SoundFileInfo, error) {
+	media, err := s.mediaRepo.GetAll("audio")
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]SoundFileInfo, 0, len(media))
+	for _, m := range media {
+		list = append(list, SoundFileInfo{
+			Name:      m.Name,
+			Extension: filepath.Ext(m.FileName),
+			URL:       s.URL(&m),
+		})
+	}
+	return list, nil
 }
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMediaURLUnsigned = errors.New("media_url_unsigned")
+	ErrMediaURLExpired  = errors.New("media_url_expired")
+)
+
+// Paramètres ajoutés aux URLs de médias signées
+var signatureParams = []string{"exp", "tid", "sig"}
+
+// MediaSigning règle l'accès aux fichiers servis sous /media
+type MediaSigning struct {
+	Key        string        // secret HMAC ; vide = clé générée et conservée dans MEDIA_DIR/.signing-key
+	TTL        time.Duration // durée de validité d'une URL signée
+	BindTablet bool          // l'URL n'est valable que depuis l'appareil de la tablette à qui elle a été envoyée
+	Public     []string      // collections servies sans signature ("all" = signature désactivée)
+}
+
+// URLSigner signe les URLs de médias du hub au moment de les envoyer à une tablette
+type URLSigner interface {
+	SignURL(rawURL string, tabletID int64) string
+}
+
+// loadSigningKey garde la même clé d'un redémarrage à l'autre, sinon toutes les URLs déjà
+// envoyées aux tablettes deviendraient invalides
+func loadSigningKey(storageDir, configured string) []byte {
+	if configured != "" {
+		return []byte(configured)
+	}
+
+	path := filepath.Join(storageDir, ".signing-key")
+	if data, err := os.ReadFile(path); err == nil {
+		if key, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil && len(key) >= 32 {
+			return key
+		}
+		slog.Warn("media: invalid signing key file, generating a new one", "path", path)
+	}
+
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)), 0600); err != nil {
+		slog.Warn("media: could not persist signing key, signed URLs will not survive a restart", "err", err)
+	}
+	return key
+}
+
+// PublicCollection indique si un dossier de MEDIA_DIR est servi sans signature
+func (s *mediaService) PublicCollection(dir string) bool {
+	if slices.Contains(s.signing.Public, "all") {
+		return true
+	}
+	for _, c := range MediaCollections {
+		if c.Dir == dir {
+			return slices.Contains(s.signing.Public, c.Key)
+		}
+	}
+	return false
+}
+
+func (s *mediaService) signature(dir, file string, exp, tabletID int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	fmt.Fprintf(mac, "%s/%s\n%d\n%d", dir, file, exp, tabletID)
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// SignURL ajoute expiration, tablette et signature aux URLs pointant vers /media sur le hub.
+// Les autres URLs (sites externes, /sites, collections publiques) sont renvoyées telles quelles ;
+// une URL déjà signée est re-signée, ce qui permet de renvoyer une URL mémorisée après expiration.
+func (s *mediaService) SignURL(rawURL string, tabletID int64) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host != strings.TrimSuffix(s.baseURL, "/") || !strings.HasPrefix(u.Path, "/media/") {
+		return rawURL
+	}
+	dir, file, ok := strings.Cut(strings.TrimPrefix(u.Path, "/media/"), "/")
+	if !ok || s.PublicCollection(dir) {
+		return rawURL
+	}
+	if !s.signing.BindTablet {
+		tabletID = 0
+	}
+
+	q := u.Query()
+	for _, p := range signatureParams {
+		q.Del(p)
+	}
+	exp := time.Now().Add(s.signing.TTL).Unix()
+	q.Set("exp", strconv.FormatInt(exp, 10))
+	if tabletID > 0 {
+		q.Set("tid", strconv.FormatInt(tabletID, 10))
+	}
+	q.Set("sig", s.signature(dir, file, exp, tabletID))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// VerifyURL contrôle la signature d'une requête /media/<dir>/<file> et renvoie la tablette
+// à laquelle l'URL est liée (0 si aucune) ; c'est à l'appelant de vérifier qui la présente.
+func (s *mediaService) VerifyURL(dir, file string, q url.Values) (int64, error) {
+	if s.PublicCollection(dir) {
+		return 0, nil
+	}
+	if q.Get("sig") == "" {
+		return 0, ErrMediaURLUnsigned
+	}
+
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil {
+		return 0, ErrMediaURLUnsigned
+	}
+	var tabletID int64
+	if tid := q.Get("tid"); tid != "" {
+		if tabletID, err = strconv.ParseInt(tid, 10, 64); err != nil {
+			return 0, ErrMediaURLUnsigned
+		}
+	}
+
+	if !hmac.Equal([]byte(q.Get("sig")), []byte(s.signature(dir, file, exp, tabletID))) {
+		return 0, ErrMediaURLUnsigned
+	}
+	if time.Now().Unix() > exp {
+		return 0, ErrMediaURLExpired
+	}
+	return tabletID, nil
+}
+
+// stripSignature retire les paramètres de signature : une URL signée et l'URL d'origine
+// désignent le même contenu (comparaison avec les presets, URL affichée par une tablette)
+func stripSignature(u *url.URL) {
+	q := u.Query()
+	if q.Get("sig") == "" {
+		return
+	}
+	for _, p := range signatureParams {
+		q.Del(p)
+	}
+	u.RawQuery = q.Encode()
+}
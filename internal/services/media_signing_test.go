@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSigner(key string, bind bool) *mediaService {
+	return &mediaService{
+		baseURL:    "hub.local:8080",
+		signing:    MediaSigning{TTL: time.Hour, BindTablet: bind, Public: []string{"image"}},
+		signingKey: []byte(key),
+	}
+}
+
+// signedQuery signe l'URL d'un fichier et renvoie ses paramètres
+func signedQuery(t *testing.T, s *mediaService, tabletID int64) url.Values {
+	t.Helper()
+	u, err := url.Parse(s.SignURL("http://hub.local:8080/media/videos/clip.mp4?v=abc", tabletID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query()
+}
+
+func TestVerifyURL(t *testing.T) {
+	tests := []struct {
+		name string
+		// query renvoie les paramètres présentés au hub
+		query   func(t *testing.T) url.Values
+		dir     string
+		wantTID int64
+		wantErr error
+	}{
+		{
+			name:  "valid URL",
+			query: func(t *testing.T) url.Values { return signedQuery(t, newSigner("k1", false), 7) },
+		},
+		{
+			name:    "valid URL bound to a tablet",
+			query:   func(t *testing.T) url.Values { return signedQuery(t, newSigner("k1", true), 7) },
+			wantTID: 7,
+		},
+		{
+			name:    "unsigned URL",
+			query:   func(t *testing.T) url.Values { return url.Values{"v": {"abc"}} },
+			wantErr: ErrMediaURLUnsigned,
+		},
+		{
+			name:  "public collection needs no signature",
+			query: func(t *testing.T) url.Values { return url.Values{} },
+			dir:   "images",
+		},
+		{
+			name: "expired URL",
+			query: func(t *testing.T) url.Values {
+				s := newSigner("k1", false)
+				s.signing.TTL = -time.Minute
+				return signedQuery(t, s, 0)
+			},
+			wantErr: ErrMediaURLExpired,
+		},
+		{
+			name: "extended expiry",
+			query: func(t *testing.T) url.Values {
+				q := signedQuery(t, newSigner("k1", false), 0)
+				exp, _ := strconv.ParseInt(q.Get("exp"), 10, 64)
+				q.Set("exp", strconv.FormatInt(exp+3600, 10))
+				return q
+			},
+			wantErr: ErrMediaURLUnsigned,
+		},
+		{
+			name: "malformed expiry",
+			query: func(t *testing.T) url.Values {
+				q := signedQuery(t, newSigner("k1", false), 0)
+				q.Set("exp", "never")
+				return q
+			},
+			wantErr: ErrMediaURLUnsigned,
+		},
+		{
+			name: "tablet swapped",
+			query: func(t *testing.T) url.Values {
+				q := signedQuery(t, newSigner("k1", true), 7)
+				q.Set("tid", "8")
+				return q
+			},
+			wantErr: ErrMediaURLUnsigned,
+		},
+		{
+			name: "tablet binding removed",
+			query: func(t *testing.T) url.Values {
+				q := signedQuery(t, newSigner("k1", true), 7)
+				q.Del("tid")
+				return q
+			},
+			wantErr: ErrMediaURLUnsigned,
+		},
+		{
+			name:    "signed with another key",
+			query:   func(t *testing.T) url.Values { return signedQuery(t, newSigner("k2", false), 0) },
+			wantErr: ErrMediaURLUnsigned,
+		},
+		{
+			name:    "signed for another file",
+			query:   func(t *testing.T) url.Values { return signedQuery(t, newSigner("k1", false), 0) },
+			dir:     "sounds",
+			wantErr: ErrMediaURLUnsigned,
+		},
+	}
+
+	verifier := newSigner("k1", true)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := tt.dir
+			if dir == "" {
+				dir = "videos"
+			}
+			tid, err := verifier.VerifyURL(dir, "clip.mp4", tt.query(t))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tid != tt.wantTID {
+				t.Errorf("tablet = %d, want %d", tid, tt.wantTID)
+			}
+		})
+	}
+}
+
+func TestSignURL(t *testing.T) {
+	s := newSigner("k1", false)
+	tests := []struct {
+		name     string
+		raw      string
+		unsigned bool
+	}{
+		{name: "hub media", raw: "http://hub.local:8080/media/videos/clip.mp4"},
+		{name: "already signed", raw: "http://hub.local:8080/media/videos/clip.mp4?exp=1&sig=old"},
+		{name: "public collection", raw: "http://hub.local:8080/media/images/logo.png", unsigned: true},
+		{name: "external site", raw: "https://example.com/media/videos/clip.mp4", unsigned: true},
+		{name: "hosted site", raw: "http://hub.local:8080/sites/menu/index.html", unsigned: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := s.SignURL(tt.raw, 7)
+			if tt.unsigned {
+				if signed != tt.raw {
+					t.Errorf("got %q, want the URL unchanged", signed)
+				}
+				return
+			}
+			u, err := url.Parse(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := u.Query()
+			if q.Has("tid") {
+				t.Errorf("unbound signer added a tablet: %s", signed)
+			}
+			if strings.Contains(signed, "sig=old") {
+				t.Errorf("previous signature kept: %s", signed)
+			}
+			if _, err := s.VerifyURL("videos", "clip.mp4", q); err != nil {
+				t.Errorf("signed URL rejected: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+// Au-delà, une session inactive et son fichier partiel sont abandonnés
+const uploadSessionTTL = 24 * time.Hour
+
+var (
+	ErrUploadNotFound = errors.New("upload_not_found")
+	ErrUploadOffset   = errors.New("upload_offset_mismatch")
+)
+
+// UploadSession suit un envoi par morceaux ; Received sert de point de reprise au client.
+// Received et UpdatedAt changent sous mu : les sessions renvoyées par le service en sont des copies.
+type UploadSession struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	Received  int64     `json:"received"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	opts UploadOptions
+	mu   sync.Mutex
+}
+
+// snapshot copie l'état de la session ; à appeler sous session.mu
+func (session *UploadSession) snapshot() *UploadSession {
+	return &UploadSession{
+		ID:        session.ID,
+		Name:      session.Name,
+		Size:      session.Size,
+		Received:  session.Received,
+		UpdatedAt: session.UpdatedAt,
+		opts:      session.opts,
+	}
+}
+
+// ScrubReport résume un passage de contrôle d'intégrité
+type ScrubReport struct {
+	Checked     int
+	Missing     int
+	Corrupt     int
+	Adopted     int
+	TempRemoved int
+}
+
+func (r ScrubReport) String() string {
+	return fmt.Sprintf("%d checked, %d missing, %d corrupt, %d adopted, %d temp files removed",
+		r.Checked, r.Missing, r.Corrupt, r.Adopted, r.TempRemoved)
+}
+
+// Les fichiers en cours de réception restent hors des collections, donc jamais servis aux tablettes
+func (s *mediaService) uploadDir() string {
+	return filepath.Join(s.storageDir, ".uploads")
+}
+
+func (s *mediaService) partPath(id string) string {
+	return filepath.Join(s.uploadDir(), id+".part")
+}
+
+func (s *mediaService) StartUpload(name string, size int64, opts UploadOptions) (*UploadSession, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("empty file")
+	}
+	if size > s.limits.MaxFileSize {
+		return nil, ErrFileTooLarge
+	}
+	// La taille annoncée est réservée jusqu'à la fin de la session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkQuota(size, ""); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	session := &UploadSession{
+		ID:        hex.EncodeToString(buf),
+		Name:      filepath.Base(name),
+		Size:      size,
+		UpdatedAt: time.Now(),
+		opts:      opts,
+	}
+
+	f, err := os.Create(s.partPath(session.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	f.Close()
+
+	s.sessionsMu.Lock()
+	s.sessions[session.ID] = session
+	s.sessionsMu.Unlock()
+
+	slog.Debug("media: upload session started", "id", session.ID, "name", session.Name, "size", size)
+	return session.snapshot(), nil
+}
+
+// session renvoie la session en cours, partagée avec les autres requêtes
+func (s *mediaService) session(id string) (*UploadSession, error) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrUploadNotFound
+	}
+	return session, nil
+}
+
+func (s *mediaService) GetUpload(id string) (*UploadSession, error) {
+	session, err := s.session(id)
+	if err != nil {
+		return nil, err
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.snapshot(), nil
+}
+
+// WriteChunk ajoute un morceau à la position offset, qui doit correspondre à ce qui a déjà été reçu :
+// après une coupure, le client relit Received via GetUpload et reprend à partir de là.
+func (s *mediaService) WriteChunk(id string, offset int64, chunk io.Reader) (*UploadSession, error) {
+	session, err := s.session(id)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if offset != session.Received {
+		return session.snapshot(), ErrUploadOffset
+	}
+
+	f, err := os.OpenFile(s.partPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Un morceau interrompu est tronqué : seul ce qui a été écrit en entier compte
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(f, io.LimitReader(chunk, session.Size-offset+1))
+	if err == nil && offset+n > session.Size {
+		err = ErrFileTooLarge
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		_ = f.Truncate(offset)
+		return session.snapshot(), err
+	}
+
+	session.Received = offset + n
+	session.UpdatedAt = time.Now()
+	return session.snapshot(), nil
+}
+
+func (s *mediaService) CompleteUpload(id string) (*repositories.Media, error) {
+	session, err := s.session(id)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if session.Received != session.Size {
+		return nil, fmt.Errorf("%w: received %d of %d bytes", ErrUploadOffset, session.Received, session.Size)
+	}
+
+	// La session est terminée quel que soit le résultat : un fichier refusé ne se reprend pas.
+	// Elle garde sa réservation jusque-là, ingest la déduisant du quota qu'il vérifie.
+	defer func() {
+		s.sessionsMu.Lock()
+		delete(s.sessions, id)
+		s.sessionsMu.Unlock()
+	}()
+	defer os.Remove(s.partPath(id))
+
+	return s.ingest(s.partPath(id), session.Name, session.opts, id)
+}
+
+func (s *mediaService) Scrub() (*ScrubReport, error) {
+	report := &ScrubReport{}
+
+	media, err := s.mediaRepo.GetAll("")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range media {
+		report.Checked++
+		status := repositories.MediaStatusOK
+
+		sum, _, err := hashFile(s.Path(&m))
+		switch {
+		case os.IsNotExist(err):
+			status = repositories.MediaStatusMissing
+			report.Missing++
+		case err != nil:
+			slog.Warn("media scrub: could not read file", "path", s.Path(&m), "err", err)
+			continue
+		case sum != m.SHA256:
+			status = repositories.MediaStatusCorrupt
+			report.Corrupt++
+		}
+
+		if status != repositories.MediaStatusOK {
+			slog.Warn("media scrub: integrity problem", "id", m.ID, "file", m.FileName, "status", status)
+		}
+		if err := s.mediaRepo.SetStatus(m.ID, status); err != nil {
+			slog.Error("database error: failed to store media status", "id", m.ID, "err", err)
+		}
+	}
+
+	report.Adopted = s.adoptUntracked()
+	report.TempRemoved = s.cleanUploads()
+
+	if s.limits.AccessRetentionDays > 0 {
+		if err := s.mediaRepo.CleanupAccess(s.limits.AccessRetentionDays); err != nil {
+			slog.Error("database error: failed to clean media access log", "err", err)
+		}
+	}
+
+	slog.Info("media scrub finished", "report", report.String())
+	return report, nil
+}
+
+// cleanUploads supprime les fichiers partiels orphelins et expire les sessions abandonnées
+func (s *mediaService) cleanUploads() int {
+	// session.mu se prend avant sessionsMu (voir CompleteUpload) : les dates sont lues hors de sessionsMu
+	s.sessionsMu.Lock()
+	sessions := make(map[string]*UploadSession, len(s.sessions))
+	for id, session := range s.sessions {
+		sessions[id] = session
+	}
+	s.sessionsMu.Unlock()
+
+	var expired []string
+	for id, session := range sessions {
+		session.mu.Lock()
+		if time.Since(session.UpdatedAt) > uploadSessionTTL {
+			expired = append(expired, id)
+		}
+		session.mu.Unlock()
+	}
+
+	s.sessionsMu.Lock()
+	for _, id := range expired {
+		delete(s.sessions, id)
+	}
+	active := make(map[string]bool, len(s.sessions))
+	for id := range s.sessions {
+		active[id] = true
+	}
+	s.sessionsMu.Unlock()
+
+	entries, err := os.ReadDir(s.uploadDir())
+	if err != nil {
+		return 0
+	}
+
+	removed := 0
+	for _, e := range entries {
+		id := strings.TrimSuffix(e.Name(), ".part")
+		if active[id] {
+			continue
+		}
+		info, err := e.Info()
+		// Les envois directs en cours n'ont pas de session : on leur laisse le temps de finir
+		if err != nil || time.Since(info.ModTime()) < time.Hour {
+			continue
+		}
+		if os.Remove(filepath.Join(s.uploadDir(), e.Name())) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+func (s *mediaService) RunScrubber(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Scrub(); err != nil {
+				slog.Error("media scrub failed", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+// Variantes pré-compressées déposées à côté du fichier d'origine (photo.svg -> photo.svg.gz),
+// par ordre de préférence. Le hub génère le gzip ; un .br peut être ajouté à la main.
+var variantEncodings = []struct {
+	encoding string
+	ext      string
+}{
+	{encoding: "br", ext: ".br"},
+	{encoding: "gzip", ext: ".gz"},
+}
+
+func isVariant(name string) bool {
+	for _, v := range variantEncodings {
+		if strings.HasSuffix(name, v.ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressible : les formats audio, vidéo et image matriciels sont déjà compressés
+func compressible(contentType string) bool {
+	switch contentType {
+	case "image/svg+xml", "image/bmp", "audio/wav", "audio/wave", "audio/x-wav":
+		return true
+	}
+	return false
+}
+
+// writeGzipVariant écrit <path>.gz, et ne le garde que s'il fait gagner au moins 10 %
+func writeGzipVariant(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	zw, _ := gzip.NewWriterLevel(dst, gzip.BestCompression)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	srcInfo, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	gzInfo, err := os.Stat(tmp)
+	if err != nil {
+		return err
+	}
+	if gzInfo.Size()*10 > srcInfo.Size()*9 {
+		return nil
+	}
+	return os.Rename(tmp, path+".gz")
+}
+
+// acceptsEncoding interprète grossièrement Accept-Encoding : présent et non refusé par q=0
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(name) != encoding {
+			continue
+		}
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
+
+// Variant ne sert jamais de variante compressée à une requête Range : les lecteurs audio/vidéo
+// des tablettes déplacent leur position en octets du fichier d'origine.
+func (s *mediaService) Variant(m *repositories.Media, acceptEncoding string, ranged bool) (string, string) {
+	path := s.Path(m)
+	if ranged {
+		return path, ""
+	}
+	for _, v := range variantEncodings {
+		if !acceptsEncoding(acceptEncoding, v.encoding) {
+			continue
+		}
+		if _, err := os.Stat(path + v.ext); err == nil {
+			return path + v.ext, v.encoding
+		}
+	}
+	return path, ""
+}
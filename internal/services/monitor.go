@@ -2,12 +2,14 @@ package services
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/wared2003/freekiosk-hub/internal/clients"
+	"github.com/wared2003/freekiosk-hub/internal/network"
 	"github.com/wared2003/freekiosk-hub/internal/repositories"
 	"github.com/wared2003/freekiosk-hub/internal/sse"
 )
@@ -15,12 +17,56 @@ import (
 type MonitorService interface {
 	Start(ctx context.Context) error
 	ScanAll()
+	// AddObserver branche un traitement sur chaque rapport réussi
+	AddObserver(o ReportObserver)
+}
+
+// ReportObserver reçoit les rapports des tablettes en ligne, une fois enregistrés
+type ReportObserver interface {
+	Observe(t repositories.Tablet, r *repositories.TabletReport)
+}
+
+// TailnetProber donne l'état réseau d'une tablette vu depuis le tailnet, indépendamment de l'app
+type TailnetProber interface {
+	Reachability(ctx context.Context, host string) (network.PeerReachability, error)
+	// NodeIDOf renvoie le nœud qui utilise une adresse du tailnet
+	NodeIDOf(ctx context.Context, ip string) (string, error)
+}
+
+// États de santé affichés sur le tableau de bord
+const (
+	HealthOnline      = "online"
+	HealthAppDown     = "app-down"
+	HealthNetworkDown = "network-down"
+	HealthUnknown     = "unknown"
+	HealthRetired     = "retired"
+)
+
+// TabletHealth croise la réponse de l'app et la présence sur le tailnet du dernier rapport :
+// une tablette joignable sur le tailnet mais muette a l'app plantée, sinon elle est hors réseau.
+func TabletHealth(t repositories.Tablet, last *repositories.TabletReport) string {
+	switch {
+	case t.Retired():
+		return HealthRetired
+	case t.Online:
+		return HealthOnline
+	case last == nil || !last.TailnetChecked:
+		return HealthUnknown
+	case last.TailnetOnline:
+		return HealthAppDown
+	}
+	return HealthNetworkDown
 }
 
 type monitorServiceImpl struct {
+	mu        sync.RWMutex
+	observers []ReportObserver
+
 	tabletRepo    repositories.TabletRepository
 	reportRepo    repositories.ReportRepository
 	kioskClient   clients.KioskClient
+	prober        TailnetProber
+	identity      DeviceIdentityService
 	maxWorkers    int
 	kioskPort     string
 	pollInterval  time.Duration
@@ -31,6 +77,8 @@ func NewMonitorService(
 	tr repositories.TabletRepository,
 	rr repositories.ReportRepository,
 	kc clients.KioskClient,
+	tp TailnetProber,
+	ids DeviceIdentityService,
 	maxWorkers int,
 	kioskPort string,
 	pollInterval time.Duration,
@@ -40,6 +88,8 @@ func NewMonitorService(
 		tabletRepo:    tr,
 		reportRepo:    rr,
 		kioskClient:   kc,
+		prober:        tp,
+		identity:      ids,
 		maxWorkers:    maxWorkers,
 		kioskPort:     kioskPort,
 		pollInterval:  pollInterval,
@@ -54,6 +104,9 @@ func (s *monitorServiceImpl) ScanAll() {
 		return
 	}
 
+	// Les tablettes retirées gardent leur historique mais ne sont plus interrogées
+	tablets = slices.DeleteFunc(tablets, repositories.Tablet.Retired)
+
 	if len(tablets) == 0 {
 		slog.Info("No tablets found in database for scanning")
 		return
@@ -91,7 +144,8 @@ func (s *monitorServiceImpl) worker(wg *sync.WaitGroup, jobs <-chan repositories
 	defer wg.Done()
 
 	for t := range jobs {
-		host := fmt.Sprintf("%s:%s", t.IP, s.kioskPort)
+		host := t.Addr(s.kioskPort)
+		wasOnline := t.Online
 
 		report, err := s.kioskClient.FetchStatus(host)
 
@@ -106,20 +160,84 @@ func (s *monitorServiceImpl) worker(wg *sync.WaitGroup, jobs <-chan repositories
 			t.Online = false
 			slog.Info("Tablet offline or returned error", "id", t.ID, "ip", t.IP, "error", err)
 		}
+		s.probeTailnet(t, report)
+
+		// Le rapport revient à l'appareil qui a répondu, même s'il a changé d'adresse
+		if t.Online && s.identity != nil {
+			if owner := s.identity.Resolve(t, report); owner.ID != t.ID {
+				owner.Online, owner.LastSeen, owner.Version = true, t.LastSeen, t.Version
+				t = owner
+				report.TabletID = t.ID
+			}
+		}
 
 		if err := s.tabletRepo.Save(&t); err != nil {
 			slog.Error("Failed to update tablet status", "id", t.ID, "error", err)
-		} else {
-			sse.Instance.NotifyNewReport(report.TabletID)
 		}
 
 		if err := s.reportRepo.Add(report); err != nil {
 			slog.Error("Failed to save report", "id", t.ID, "error", err)
+			continue
+		}
+		s.publish(t, report, wasOnline)
+
+		if t.InMaintenance(time.Now()) {
+			// Pas d'alerte ni de réglage automatique pendant l'intervention d'un technicien
+			slog.Debug("Tablet in maintenance, observers skipped", "id", t.ID)
+		} else if t.Online {
+			s.mu.RLock()
+			for _, o := range s.observers {
+				o.Observe(t, report)
+			}
+			s.mu.RUnlock()
 		}
 
 	}
 }
 
+// publish annonce le rapport enregistré, et le changement d'état si la tablette est passée en ligne ou hors ligne
+func (s *monitorServiceImpl) publish(t repositories.Tablet, report *repositories.TabletReport, wasOnline bool) {
+	status := sse.Status{
+		Online:   t.Online,
+		Health:   TabletHealth(t, report),
+		Battery:  report.BatteryLevel,
+		LastSeen: t.LastSeen,
+	}
+	if t.Online != wasOnline {
+		sse.Instance.Publish(sse.Event{Type: sse.EventStatus, TabletID: t.ID, Data: status})
+	}
+	sse.Instance.Publish(sse.Event{Type: sse.EventReport, TabletID: t.ID, Data: status})
+}
+
+// probeTailnet complète le rapport avec la présence de la tablette sur le tailnet
+func (s *monitorServiceImpl) probeTailnet(t repositories.Tablet, report *repositories.TabletReport) {
+	if s.prober == nil {
+		return
+	}
+	r, err := s.prober.Reachability(context.Background(), t.IP)
+	if err != nil {
+		if !errors.Is(err, network.ErrPeerNotFound) {
+			slog.Warn("Tailnet probe failed", "id", t.ID, "ip", t.IP, "error", err)
+		}
+		return
+	}
+
+	report.TailnetChecked = true
+	report.TailnetOnline = r.Online
+	report.TailnetPath = r.Path
+	report.TailnetLatencyMs = float64(r.Latency.Microseconds()) / 1000
+	report.TailnetNodeID = r.NodeID
+	if !r.LastHandshake.IsZero() {
+		report.TailnetHandshake = &r.LastHandshake
+	}
+}
+
+func (s *monitorServiceImpl) AddObserver(o ReportObserver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observers = append(s.observers, o)
+}
+
 func (s *monitorServiceImpl) Start(ctx context.Context) error {
 	slog.Info("Starting monitor service", "interval", s.pollInterval)
 
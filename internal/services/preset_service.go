@@ -0,0 +1,134 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+type PresetService interface {
+	// Usage renvoie, pour chaque preset, les tablettes qui l'affichent actuellement (d'après CurrentURL)
+	Usage() (map[int64][]repositories.Tablet, error)
+	// Check teste l'accessibilité de l'URL depuis le hub et enregistre le résultat
+	Check(p *repositories.Preset) error
+}
+
+type presetServiceImpl struct {
+	presetRepo repositories.PresetRepository
+	tabRepo    repositories.TabletRepository
+	reportRepo repositories.ReportRepository
+	signer     URLSigner
+	httpClient *http.Client
+}
+
+func NewPresetService(pr repositories.PresetRepository, tr repositories.TabletRepository, rr repositories.ReportRepository, signer URLSigner) PresetService {
+	return &presetServiceImpl{
+		presetRepo: pr,
+		tabRepo:    tr,
+		reportRepo: rr,
+		signer:     signer,
+		// Client dédié : on ne veut surtout pas envoyer la clé API des kiosques à des sites tiers
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (s *presetServiceImpl) Usage() (map[int64][]repositories.Tablet, error) {
+	presets, err := s.presetRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	tablets, err := s.tabRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	reports, err := s.reportRepo.GetLatestAll(true)
+	if err != nil {
+		return nil, err
+	}
+
+	urlByTablet := make(map[int64]string, len(reports))
+	for _, r := range reports {
+		urlByTablet[r.TabletID] = r.CurrentURL
+	}
+
+	usage := make(map[int64][]repositories.Tablet)
+	for _, t := range tablets {
+		if p := MatchPreset(urlByTablet[t.ID], presets); p != nil {
+			usage[p.ID] = append(usage[p.ID], t)
+		}
+	}
+	return usage, nil
+}
+
+// MatchPreset renvoie le preset correspondant à l'URL affichée : égalité stricte,
+// sinon le preset dont l'URL est le plus long préfixe (navigation interne au site).
+func MatchPreset(current string, presets []repositories.Preset) *repositories.Preset {
+	cur := normalizeURL(current)
+	if cur == "" {
+		return nil
+	}
+
+	var best *repositories.Preset
+	bestLen := 0
+	for i := range presets {
+		p := normalizeURL(presets[i].URL)
+		if p == "" {
+			continue
+		}
+		if cur == p {
+			return &presets[i]
+		}
+		if strings.HasPrefix(cur, p+"/") || strings.HasPrefix(cur, p+"?") || strings.HasPrefix(cur, p+"#") {
+			if len(p) > bestLen {
+				best, bestLen = &presets[i], len(p)
+			}
+		}
+	}
+	return best
+}
+
+func normalizeURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	stripSignature(u)
+	return strings.TrimSuffix(u.String(), "/")
+}
+
+func (s *presetServiceImpl) Check(p *repositories.Preset) error {
+	reachable, checkErr := true, ""
+	// Les médias du hub ne répondent qu'aux URLs signées
+	if err := s.probe(s.signer.SignURL(p.URL, 0)); err != nil {
+		reachable, checkErr = false, err.Error()
+		slog.Warn("preset unreachable from hub", "preset", p.Title, "url", p.URL, "err", err)
+	}
+
+	now := time.Now()
+	p.CheckedAt, p.Reachable, p.CheckError = &now, reachable, checkErr
+	return s.presetRepo.SaveCheck(p.ID, reachable, checkErr)
+}
+
+func (s *presetServiceImpl) probe(rawURL string) error {
+	resp, err := s.httpClient.Head(rawURL)
+	if err == nil && resp.StatusCode == http.StatusMethodNotAllowed {
+		resp.Body.Close()
+		resp, err = s.httpClient.Get(rawURL)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+var (
+	ErrInvalidRemoteAction = errors.New("invalid_remote_action")
+	ErrInvalidPackage      = errors.New("invalid_package_name")
+	ErrAppNotFound         = errors.New("app_not_found")
+	ErrDuplicateApp        = errors.New("duplicate_app")
+)
+
+// RemoteActions sont les touches de télécommande acceptées par /api/remote/{action} de FreeKiosk
+var RemoteActions = []string{"up", "down", "left", "right", "select", "back", "home", "menu", "playpause"}
+
+// Nom de package Android : au moins deux segments, chacun commençant par une lettre
+var packagePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(\.[A-Za-z][A-Za-z0-9_]*)+$`)
+
+type RemoteService interface {
+	Send(tabletID int64, action, actor string) (*ActionReport, error)
+
+	// Apps renvoie les applications lançables sur la tablette, toutes sources de groupe confondues
+	Apps(tabletID int64) ([]repositories.GroupApp, error)
+	// Launch lance une application de la liste de la tablette ; une autre application est refusée
+	Launch(tabletID, appID int64, actor string) (*ActionReport, *repositories.GroupApp, error)
+
+	GroupApps(groupID int64) ([]repositories.GroupApp, error)
+	AddApp(a *repositories.GroupApp, actor string) error
+	DeleteApp(id int64, actor string) error
+}
+
+type remoteService struct {
+	appRepo   repositories.AppRepository
+	auditRepo repositories.AuditRepository
+	kService  KioskService
+}
+
+func NewRemoteService(apr repositories.AppRepository, ar repositories.AuditRepository, ks KioskService) RemoteService {
+	return &remoteService{appRepo: apr, auditRepo: ar, kService: ks}
+}
+
+func (s *remoteService) Send(tabletID int64, action, actor string) (*ActionReport, error) {
+	if !slices.Contains(RemoteActions, action) {
+		return nil, ErrInvalidRemoteAction
+	}
+
+	report, err := s.kService.SendRemoteCommand(Target{TabletID: tabletID}, action)
+	if err != nil {
+		return nil, err
+	}
+	recordAudit(s.auditRepo, actor, "remote."+action, fmt.Sprintf("tablet:%d", tabletID), report.Summary)
+	return report, nil
+}
+
+func (s *remoteService) Apps(tabletID int64) ([]repositories.GroupApp, error) {
+	return s.appRepo.GetByTablet(tabletID)
+}
+
+func (s *remoteService) Launch(tabletID, appID int64, actor string) (*ActionReport, *repositories.GroupApp, error) {
+	apps, err := s.appRepo.GetByTablet(tabletID)
+	if err != nil {
+		return nil, nil, err
+	}
+	idx := slices.IndexFunc(apps, func(a repositories.GroupApp) bool { return a.ID == appID })
+	if idx < 0 {
+		return nil, nil, ErrAppNotFound
+	}
+	app := apps[idx]
+
+	report, err := s.kService.LaunchApp(Target{TabletID: tabletID}, app.Package)
+	if err != nil {
+		return nil, nil, err
+	}
+	recordAudit(s.auditRepo, actor, "app.launch", fmt.Sprintf("tablet:%d", tabletID),
+		fmt.Sprintf("%s (%s): %s", app.Label, app.Package, report.Summary))
+	return report, &app, nil
+}
+
+func (s *remoteService) GroupApps(groupID int64) ([]repositories.GroupApp, error) {
+	return s.appRepo.GetByGroup(groupID)
+}
+
+func (s *remoteService) AddApp(a *repositories.GroupApp, actor string) error {
+	a.Package = strings.TrimSpace(a.Package)
+	a.Label = strings.TrimSpace(a.Label)
+	if !packagePattern.MatchString(a.Package) {
+		return ErrInvalidPackage
+	}
+	if a.Label == "" {
+		a.Label = a.Package
+	}
+
+	existing, err := s.appRepo.GetByGroup(a.GroupID)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(existing, func(e repositories.GroupApp) bool { return e.Package == a.Package }) {
+		return ErrDuplicateApp
+	}
+
+	if err := s.appRepo.Create(a); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "app.add", fmt.Sprintf("group:%d", a.GroupID), fmt.Sprintf("%s (%s)", a.Label, a.Package))
+	return nil
+}
+
+func (s *remoteService) DeleteApp(id int64, actor string) error {
+	app, err := s.appRepo.GetByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAppNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.appRepo.Delete(id); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "app.delete", fmt.Sprintf("group:%d", app.GroupID), fmt.Sprintf("%s (%s)", app.Label, app.Package))
+	return nil
+}
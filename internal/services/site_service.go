@@ -0,0 +1,337 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+const (
+	maxSiteFiles = 5000
+	maxSiteSize  = 512 << 20 // 512 MB décompressés
+)
+
+var (
+	ErrSiteNotFound    = errors.New("site_not_found")
+	ErrVersionNotFound = errors.New("site_version_not_found")
+	ErrInvalidArchive  = errors.New("invalid_site_archive")
+	ErrNoPrevVersion   = errors.New("no_previous_version")
+)
+
+var slugCleaner = regexp.MustCompile(`[^a-z0-9]+`)
+
+type SiteService interface {
+	Create(name string) (*repositories.Site, error)
+	// UploadVersion extrait une archive zip dans un nouveau dossier de version (sans l'activer)
+	UploadVersion(siteID int64, archive io.ReaderAt, size int64, note string) (*repositories.SiteVersion, error)
+	// Activate bascule le site sur une version et renvoie toutes les tablettes qui l'affichent vers celle-ci
+	Activate(siteID int64, version int, actor string) (*ActionReport, error)
+	Rollback(siteID int64, actor string) (*ActionReport, error)
+	Delete(siteID int64, actor string) error
+
+	Dir(slug string, version int) string
+	VersionURL(slug string, version int) string
+	// Viewers renvoie les tablettes qui affichent actuellement une version du site
+	Viewers(slug string) ([]repositories.Tablet, error)
+}
+
+type siteServiceImpl struct {
+	siteRepo   repositories.SiteRepository
+	tabRepo    repositories.TabletRepository
+	reportRepo repositories.ReportRepository
+	auditRepo  repositories.AuditRepository
+	kService   KioskService
+	sitesDir   string
+	baseURL    string
+}
+
+func NewSiteService(
+	sr repositories.SiteRepository,
+	tr repositories.TabletRepository,
+	rr repositories.ReportRepository,
+	ar repositories.AuditRepository,
+	ks KioskService,
+	mediaDir, baseURL string,
+) SiteService {
+	sitesDir := filepath.Join(mediaDir, "sites")
+	_ = os.MkdirAll(sitesDir, 0755)
+
+	return &siteServiceImpl{
+		siteRepo:   sr,
+		tabRepo:    tr,
+		reportRepo: rr,
+		auditRepo:  ar,
+		kService:   ks,
+		sitesDir:   sitesDir,
+		baseURL:    baseURL,
+	}
+}
+
+func Slugify(name string) string {
+	return strings.Trim(slugCleaner.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+func (s *siteServiceImpl) Dir(slug string, version int) string {
+	return filepath.Join(s.sitesDir, slug, fmt.Sprintf("v%d", version))
+}
+
+func (s *siteServiceImpl) VersionURL(slug string, version int) string {
+	base := strings.TrimSuffix(s.baseURL, "/")
+	return fmt.Sprintf("http://%s/sites/%s/v%d/", base, url.PathEscape(slug), version)
+}
+
+func (s *siteServiceImpl) Create(name string) (*repositories.Site, error) {
+	slug := Slugify(name)
+	if slug == "" {
+		return nil, fmt.Errorf("invalid site name")
+	}
+
+	site := &repositories.Site{Slug: slug, Name: strings.TrimSpace(name)}
+	if _, err := s.siteRepo.Create(site); err != nil {
+		return nil, err
+	}
+	return site, nil
+}
+
+func (s *siteServiceImpl) UploadVersion(siteID int64, archive io.ReaderAt, size int64, note string) (*repositories.SiteVersion, error) {
+	site, err := s.siteRepo.GetByID(siteID)
+	if err != nil {
+		return nil, ErrSiteNotFound
+	}
+
+	zr, err := zip.NewReader(archive, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	version, err := s.siteRepo.NextVersion(siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extraction dans un dossier temporaire puis renommage : une version n'existe sur disque que complète
+	finalDir := s.Dir(site.Slug, version)
+	tmpDir := finalDir + ".tmp"
+	_ = os.RemoveAll(tmpDir)
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, err
+	}
+
+	files, total, err := extractSite(zr, tmpDir)
+	if err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	if err := os.Rename(tmpDir, finalDir); err != nil {
+		_ = os.RemoveAll(tmpDir)
+		return nil, err
+	}
+
+	v := &repositories.SiteVersion{
+		SiteID:  siteID,
+		Version: version,
+		Files:   files,
+		Size:    total,
+		Note:    note,
+	}
+	if err := s.siteRepo.AddVersion(v); err != nil {
+		_ = os.RemoveAll(finalDir)
+		return nil, err
+	}
+
+	slog.Info("resource created: site version uploaded", "site", site.Slug, "version", version, "files", files)
+	return v, nil
+}
+
+// extractSite décompresse l'archive en refusant les chemins qui sortent du dossier (zip slip).
+// Si tout le contenu est dans un unique dossier racine, celui-ci est retiré.
+func extractSite(zr *zip.Reader, dst string) (int, int64, error) {
+	prefix := commonRoot(zr.File)
+
+	var files int
+	var total int64
+	hasIndex := false
+
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(f.Name, prefix)
+		if name == "" || strings.HasSuffix(name, "/") || strings.HasPrefix(path.Base(name), "__MACOSX") {
+			continue
+		}
+
+		if slices.Contains(strings.Split(name, "/"), "..") {
+			return 0, 0, fmt.Errorf("%w: unsafe path %s", ErrInvalidArchive, f.Name)
+		}
+		clean := path.Clean("/" + name)
+		target := filepath.Join(dst, filepath.FromSlash(clean))
+
+		files++
+		// La taille déclarée permet de refuser tôt ; seuls les octets réellement écrits font foi
+		if files > maxSiteFiles || f.UncompressedSize64 > uint64(maxSiteSize-total) {
+			return 0, 0, fmt.Errorf("%w: archive too large", ErrInvalidArchive)
+		}
+		if clean == "/index.html" {
+			hasIndex = true
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return 0, 0, err
+		}
+		n, err := extractFile(f, target, maxSiteSize-total)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += n
+	}
+
+	if !hasIndex {
+		return 0, 0, fmt.Errorf("%w: index.html missing at archive root", ErrInvalidArchive)
+	}
+	return files, total, nil
+}
+
+// extractFile écrit au plus remaining octets et renvoie le nombre écrit ; au-delà, l'archive est refusée
+func extractFile(f *zip.File, target string, remaining int64) (int64, error) {
+	src, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	// On ne fait pas confiance à la taille déclarée dans l'en-tête zip : un octet de plus que le budget suffit à refuser
+	n, err := io.Copy(dst, io.LimitReader(src, remaining+1))
+	if err != nil {
+		return n, err
+	}
+	if n > remaining {
+		return n, fmt.Errorf("%w: archive too large", ErrInvalidArchive)
+	}
+	return n, nil
+}
+
+func commonRoot(files []*zip.File) string {
+	root := ""
+	for _, f := range files {
+		first, _, found := strings.Cut(f.Name, "/")
+		if !found {
+			return ""
+		}
+		if strings.HasPrefix(first, "__MACOSX") {
+			continue
+		}
+		if root == "" {
+			root = first
+		} else if root != first {
+			return ""
+		}
+	}
+	if root == "" {
+		return ""
+	}
+	return root + "/"
+}
+
+func (s *siteServiceImpl) Viewers(slug string) ([]repositories.Tablet, error) {
+	tablets, err := s.tabRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	reports, err := s.reportRepo.GetLatestAll(true)
+	if err != nil {
+		return nil, err
+	}
+
+	showing := make(map[int64]bool)
+	prefix := "/sites/" + slug + "/"
+	for _, r := range reports {
+		if u, err := url.Parse(r.CurrentURL); err == nil && strings.HasPrefix(u.Path, prefix) {
+			showing[r.TabletID] = true
+		}
+	}
+
+	var viewers []repositories.Tablet
+	for _, t := range tablets {
+		if showing[t.ID] {
+			viewers = append(viewers, t)
+		}
+	}
+	return viewers, nil
+}
+
+func (s *siteServiceImpl) Activate(siteID int64, version int, actor string) (*ActionReport, error) {
+	site, err := s.siteRepo.GetByID(siteID)
+	if err != nil {
+		return nil, ErrSiteNotFound
+	}
+	if _, err := os.Stat(s.Dir(site.Slug, version)); err != nil {
+		return nil, ErrVersionNotFound
+	}
+
+	// Les spectateurs sont calculés avant la bascule, d'après l'URL qu'ils affichent
+	viewers, err := s.Viewers(site.Slug)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.siteRepo.SetCurrentVersion(siteID, version); err != nil {
+		return nil, err
+	}
+
+	report := &ActionReport{Command: "navigate", Summary: "no tablet is showing this site"}
+	if len(viewers) > 0 {
+		ids := make([]int64, len(viewers))
+		for i, t := range viewers {
+			ids[i] = t.ID
+		}
+		if report, err = s.kService.Navigate(Target{TabletIDs: ids}, s.VersionURL(site.Slug, version)); err != nil {
+			return nil, err
+		}
+	}
+
+	recordAudit(s.auditRepo, actor, "site.activate", fmt.Sprintf("site:%s", site.Slug),
+		fmt.Sprintf("v%d -> v%d, %s", site.CurrentVersion, version, report.Summary))
+	return report, nil
+}
+
+func (s *siteServiceImpl) Rollback(siteID int64, actor string) (*ActionReport, error) {
+	site, err := s.siteRepo.GetByID(siteID)
+	if err != nil {
+		return nil, ErrSiteNotFound
+	}
+	if site.PreviousVersion == 0 {
+		return nil, ErrNoPrevVersion
+	}
+	return s.Activate(siteID, site.PreviousVersion, actor)
+}
+
+func (s *siteServiceImpl) Delete(siteID int64, actor string) error {
+	site, err := s.siteRepo.GetByID(siteID)
+	if err != nil {
+		return ErrSiteNotFound
+	}
+	if err := s.siteRepo.Delete(siteID); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(s.sitesDir, site.Slug)); err != nil {
+		slog.Warn("failed to remove site files", "site", site.Slug, "err", err)
+	}
+	recordAudit(s.auditRepo, actor, "site.delete", fmt.Sprintf("site:%s", site.Slug), "")
+	return nil
+}
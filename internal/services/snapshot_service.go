@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+var (
+	ErrSnapshotNotFound = errors.New("snapshot_not_found")
+	ErrInvalidCamera    = errors.New("invalid_camera")
+	ErrSnapshotBusy     = errors.New("snapshot_in_progress")
+)
+
+// Qualité JPEG demandée à la tablette
+const snapshotQuality = 80
+
+// SnapshotRetention borne l'historique des photos (0 = pas de limite)
+type SnapshotRetention struct {
+	Days      int
+	PerTablet int
+}
+
+type SnapshotService interface {
+	// Capture demande une photo à la tablette et la range dans la collection "snapshot"
+	Capture(tabletID int64, camera, trigger, actor string) (*repositories.Snapshot, error)
+	List(tabletID int64, limit int) ([]repositories.Snapshot, error)
+	Delete(id int64, actor string) error
+	// Photo renvoie le fichier de la bibliothèque correspondant à la photo
+	Photo(s repositories.Snapshot) (*repositories.Media, error)
+
+	GetSchedule(tabletID int64) (*repositories.SnapshotSchedule, error)
+	SaveSchedule(s *repositories.SnapshotSchedule) error
+	// RunScheduler prend les photos périodiques et applique la rétention
+	RunScheduler(ctx context.Context)
+}
+
+type snapshotService struct {
+	repo      repositories.SnapshotRepository
+	tabRepo   repositories.TabletRepository
+	auditRepo repositories.AuditRepository
+	kService  KioskService
+	media     MediaService
+	retention SnapshotRetention
+
+	// Une seule prise de vue à la fois par tablette : la caméra met plusieurs secondes à répondre
+	mu      sync.Mutex
+	pending map[int64]bool
+
+	// storeMu couvre l'enregistrement d'une photo, du fichier à sa ligne, et la suppression des fichiers
+	// qui ne sont plus référencés : sans lui, une photo à peine envoyée passerait pour orpheline
+	storeMu sync.Mutex
+}
+
+func NewSnapshotService(
+	repo repositories.SnapshotRepository,
+	tr repositories.TabletRepository,
+	ar repositories.AuditRepository,
+	ks KioskService,
+	mes MediaService,
+	retention SnapshotRetention,
+) SnapshotService {
+	return &snapshotService{
+		repo:      repo,
+		tabRepo:   tr,
+		auditRepo: ar,
+		kService:  ks,
+		media:     mes,
+		retention: retention,
+		pending:   make(map[int64]bool),
+	}
+}
+
+func validCamera(camera string) bool {
+	return camera == "front" || camera == "back"
+}
+
+func (s *snapshotService) Capture(tabletID int64, camera, trigger, actor string) (*repositories.Snapshot, error) {
+	if !validCamera(camera) {
+		return nil, ErrInvalidCamera
+	}
+	tab, err := s.tabRepo.GetByID(tabletID)
+	if err != nil {
+		return nil, ErrTabletNotFound
+	}
+
+	s.mu.Lock()
+	if s.pending[tabletID] {
+		s.mu.Unlock()
+		return nil, ErrSnapshotBusy
+	}
+	s.pending[tabletID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, tabletID)
+		s.mu.Unlock()
+	}()
+
+	photo, err := s.kService.GetPhoto(tabletID, camera, snapshotQuality)
+	if err != nil {
+		return nil, fmt.Errorf("camera: %w", err)
+	}
+
+	takenAt := time.Now()
+	s.storeMu.Lock()
+	snap, m, err := s.store(tabletID, tab.Name, camera, trigger, actor, takenAt, photo)
+	s.storeMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("resource created: snapshot", "tablet", tab.Name, "camera", camera, "trigger", trigger, "file", m.FileName)
+
+	if s.retention.PerTablet > 0 {
+		if extra, err := s.repo.GetBeyond(tabletID, s.retention.PerTablet); err == nil {
+			s.purge(extra)
+		}
+	}
+	return snap, nil
+}
+
+// store range la photo dans la bibliothèque puis l'enregistre ; à appeler sous storeMu
+func (s *snapshotService) store(tabletID int64, tabletName, camera, trigger, actor string, takenAt time.Time, photo []byte) (*repositories.Snapshot, *repositories.Media, error) {
+	name := fmt.Sprintf("%s-%s-%s.jpg", strings.ReplaceAll(tabletName, "/", "_"), camera, takenAt.Format("20060102-150405"))
+	m, err := s.media.Upload(name, bytes.NewReader(photo), UploadOptions{
+		Collection: "snapshot",
+		Uploader:   actor,
+		Tags:       fmt.Sprintf("snapshot,%s,%s", camera, trigger),
+	})
+	// Une image identique (caméra masquée, écran noir) est déjà stockée : on la réutilise
+	if err != nil && !errors.Is(err, ErrMediaDuplicate) {
+		return nil, nil, err
+	}
+
+	snap := &repositories.Snapshot{
+		TabletID: tabletID,
+		MediaID:  m.ID,
+		Camera:   camera,
+		Trigger:  trigger,
+		TakenBy:  actor,
+		TakenAt:  takenAt,
+	}
+	if err := s.repo.Create(snap); err != nil {
+		return nil, nil, err
+	}
+	return snap, m, nil
+}
+
+func (s *snapshotService) List(tabletID int64, limit int) ([]repositories.Snapshot, error) {
+	return s.repo.GetByTablet(tabletID, limit)
+}
+
+func (s *snapshotService) Photo(snap repositories.Snapshot) (*repositories.Media, error) {
+	return s.media.Get(snap.MediaID)
+}
+
+func (s *snapshotService) Delete(id int64, actor string) error {
+	snap, err := s.repo.GetByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSnapshotNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	s.purge([]repositories.Snapshot{*snap})
+	recordAudit(s.auditRepo, actor, "snapshot.delete", fmt.Sprintf("tablet:%d", snap.TabletID),
+		fmt.Sprintf("%s photo of %s", snap.Camera, snap.TakenAt.Format("02/01 15:04:05")))
+	return nil
+}
+
+// purge supprime les photos, puis leurs fichiers qu'aucune autre photo ne réutilise
+func (s *snapshotService) purge(snaps []repositories.Snapshot) {
+	if len(snaps) == 0 {
+		return
+	}
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+
+	var mediaIDs []int64
+	for _, snap := range snaps {
+		if err := s.repo.Delete(snap.ID); err != nil {
+			slog.Error("database error: failed to delete snapshot", "id", snap.ID, "err", err)
+			continue
+		}
+		mediaIDs = append(mediaIDs, snap.MediaID)
+	}
+
+	unused, err := s.repo.Unreferenced(mediaIDs)
+	if err != nil {
+		slog.Error("database error: failed to list unused snapshot files", "err", err)
+		return
+	}
+	s.deleteMedia(unused)
+}
+
+// sweep retire les fichiers des photos supprimées avec leur tablette
+func (s *snapshotService) sweep() {
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+
+	orphans, err := s.repo.OrphanMedia()
+	if err != nil {
+		slog.Error("database error: failed to list orphan snapshot files", "err", err)
+		return
+	}
+	s.deleteMedia(orphans)
+}
+
+func (s *snapshotService) deleteMedia(ids []int64) {
+	for _, id := range ids {
+		if err := s.media.Delete(id, true); err != nil && !errors.Is(err, ErrMediaNotFound) {
+			slog.Error("snapshot: failed to delete photo file", "media", id, "err", err)
+		}
+	}
+}
+
+func (s *snapshotService) GetSchedule(tabletID int64) (*repositories.SnapshotSchedule, error) {
+	sch, err := s.repo.GetSchedule(tabletID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &repositories.SnapshotSchedule{TabletID: tabletID, Camera: "back"}, nil
+	}
+	return sch, err
+}
+
+func (s *snapshotService) SaveSchedule(sch *repositories.SnapshotSchedule) error {
+	if !validCamera(sch.Camera) {
+		return ErrInvalidCamera
+	}
+	return s.repo.SaveSchedule(sch)
+}
+
+func (s *snapshotService) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	lastCleanup := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runDue(now)
+			if now.Sub(lastCleanup) >= time.Hour {
+				s.cleanup(now)
+				lastCleanup = now
+			}
+		}
+	}
+}
+
+func (s *snapshotService) runDue(now time.Time) {
+	schedules, err := s.repo.GetEnabledSchedules()
+	if err != nil {
+		slog.Error("database error: failed to fetch snapshot schedules", "err", err)
+		return
+	}
+
+	for _, sch := range schedules {
+		interval := time.Duration(sch.IntervalMinutes) * time.Minute
+		if sch.LastRunAt != nil && now.Sub(*sch.LastRunAt) < interval {
+			continue
+		}
+		if t, err := s.tabRepo.GetByID(sch.TabletID); err == nil && (t.Retired() || t.InMaintenance(now)) {
+			continue
+		}
+		// Marqué avant la prise de vue : une tablette hors ligne ne doit pas être relancée à chaque tick
+		if err := s.repo.MarkScheduleRun(sch.TabletID, now); err != nil {
+			slog.Error("database error: failed to mark snapshot schedule", "tablet", sch.TabletID, "err", err)
+			continue
+		}
+		go func(sch repositories.SnapshotSchedule) {
+			if _, err := s.Capture(sch.TabletID, sch.Camera, "schedule", "schedule"); err != nil {
+				slog.Warn("snapshot: scheduled capture failed", "tablet", sch.TabletID, "err", err)
+			}
+		}(sch)
+	}
+}
+
+// cleanup applique la durée de conservation et retire les fichiers des tablettes supprimées
+func (s *snapshotService) cleanup(now time.Time) {
+	var old []repositories.Snapshot
+	if s.retention.Days > 0 {
+		var err error
+		if old, err = s.repo.GetOlderThan(now.AddDate(0, 0, -s.retention.Days)); err != nil {
+			slog.Error("database error: failed to fetch expired snapshots", "err", err)
+			return
+		}
+	}
+	s.purge(old)
+	if len(old) > 0 {
+		slog.Info("🧹 Snapshot retention applied", "deleted", len(old), "days", s.retention.Days)
+	}
+	s.sweep()
+}
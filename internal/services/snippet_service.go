@@ -0,0 +1,193 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+var (
+	ErrSnippetNotFound    = errors.New("snippet_not_found")
+	ErrInvalidSnippet     = errors.New("invalid_snippet")
+	ErrInvalidParamName   = errors.New("invalid_param_name")
+	ErrDuplicateSnippet   = errors.New("duplicate_snippet")
+	ErrSnippetRunNotFound = errors.New("snippet_run_not_found")
+)
+
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SnippetParams renvoie les noms de paramètres déclarés d'un snippet
+func SnippetParams(s repositories.Snippet) []string {
+	var names []string
+	for _, n := range strings.Split(s.Params, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// RenderSnippet remplace chaque {{nom}} par la valeur encodée en littéral JavaScript :
+// une valeur saisie ne peut pas sortir de sa chaîne pour injecter du code
+func RenderSnippet(s repositories.Snippet, values map[string]string) string {
+	code := s.Code
+	for _, name := range SnippetParams(s) {
+		literal, _ := json.Marshal(values[name])
+		code = strings.ReplaceAll(code, "{{"+name+"}}", string(literal))
+	}
+	return code
+}
+
+// RunResults décode les résultats par tablette enregistrés avec une exécution
+func RunResults(run repositories.SnippetRun) []TabletResult {
+	var results []TabletResult
+	if err := json.Unmarshal([]byte(run.Results), &results); err != nil {
+		slog.Warn("snippets: unreadable run results", "run", run.ID, "err", err)
+	}
+	return results
+}
+
+type SnippetService interface {
+	List() ([]repositories.Snippet, error)
+	Get(id int64) (*repositories.Snippet, error)
+	Save(s *repositories.Snippet, actor string) error
+	Delete(id int64, actor string) error
+
+	// Run exécute le snippet sur la cible et enregistre la sortie de chaque tablette
+	Run(id int64, values map[string]string, t Target, targetLabel, actor string) (*repositories.SnippetRun, error)
+	Runs(limit int) ([]repositories.SnippetRun, error)
+	GetRun(id int64) (*repositories.SnippetRun, error)
+}
+
+type snippetService struct {
+	repo      repositories.SnippetRepository
+	auditRepo repositories.AuditRepository
+	kService  KioskService
+}
+
+func NewSnippetService(repo repositories.SnippetRepository, ar repositories.AuditRepository, ks KioskService) SnippetService {
+	return &snippetService{repo: repo, auditRepo: ar, kService: ks}
+}
+
+func (s *snippetService) List() ([]repositories.Snippet, error) {
+	return s.repo.GetAll()
+}
+
+func (s *snippetService) Get(id int64) (*repositories.Snippet, error) {
+	snippet, err := s.repo.GetByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSnippetNotFound
+	}
+	return snippet, err
+}
+
+func (s *snippetService) Save(snippet *repositories.Snippet, actor string) error {
+	snippet.Name = strings.TrimSpace(snippet.Name)
+	if snippet.Name == "" || strings.TrimSpace(snippet.Code) == "" {
+		return ErrInvalidSnippet
+	}
+
+	// Forme canonique : noms valides, sans doublon
+	var params []string
+	for _, name := range SnippetParams(*snippet) {
+		if !paramNamePattern.MatchString(name) {
+			return ErrInvalidParamName
+		}
+		if !slices.Contains(params, name) {
+			params = append(params, name)
+		}
+	}
+	snippet.Params = strings.Join(params, ",")
+
+	all, err := s.repo.GetAll()
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(all, func(o repositories.Snippet) bool {
+		return o.ID != snippet.ID && strings.EqualFold(o.Name, snippet.Name)
+	}) {
+		return ErrDuplicateSnippet
+	}
+
+	action := "snippet.update"
+	if snippet.ID == 0 {
+		action = "snippet.create"
+		err = s.repo.Create(snippet)
+	} else {
+		err = s.repo.Update(snippet)
+	}
+	if err != nil {
+		return err
+	}
+
+	recordAudit(s.auditRepo, actor, action, fmt.Sprintf("snippet:%d", snippet.ID), snippet.Name)
+	return nil
+}
+
+func (s *snippetService) Delete(id int64, actor string) error {
+	snippet, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "snippet.delete", fmt.Sprintf("snippet:%d", id), snippet.Name)
+	return nil
+}
+
+func (s *snippetService) Run(id int64, values map[string]string, t Target, targetLabel, actor string) (*repositories.SnippetRun, error) {
+	snippet, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	code := RenderSnippet(*snippet, values)
+	report, err := s.kService.ExecuteJS(t, code)
+	if err != nil {
+		return nil, err
+	}
+
+	params, _ := json.Marshal(values)
+	results, _ := json.Marshal(report.Results)
+	run := &repositories.SnippetRun{
+		SnippetID:   &snippet.ID,
+		SnippetName: snippet.Name,
+		Target:      targetLabel,
+		Params:      string(params),
+		Code:        code,
+		Results:     string(results),
+		Actor:       actor,
+	}
+	if err := s.repo.CreateRun(run); err != nil {
+		slog.Error("database error: failed to record snippet run", "snippet", snippet.ID, "err", err)
+	}
+
+	auditTarget := fmt.Sprintf("group:%d", t.GroupID)
+	if t.TabletID != 0 {
+		auditTarget = fmt.Sprintf("tablet:%d", t.TabletID)
+	}
+	// Le code complet est journalisé : c'est de l'exécution de code à distance
+	recordAudit(s.auditRepo, actor, "snippet.run", auditTarget,
+		fmt.Sprintf("%s: %s\n%s", snippet.Name, report.Summary, code))
+	return run, nil
+}
+
+func (s *snippetService) Runs(limit int) ([]repositories.SnippetRun, error) {
+	return s.repo.GetRuns(limit)
+}
+
+func (s *snippetService) GetRun(id int64) (*repositories.SnippetRun, error) {
+	run, err := s.repo.GetRun(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSnippetRunNotFound
+	}
+	return run, err
+}
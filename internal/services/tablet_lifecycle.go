@@ -0,0 +1,138 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/sse"
+)
+
+var (
+	ErrInvalidTabletName  = errors.New("invalid_tablet_name")
+	ErrInvalidMaintenance = errors.New("invalid_maintenance_window")
+)
+
+// maxMaintenance borne une maintenance oubliée : les alertes ne restent pas coupées indéfiniment
+const maxMaintenance = 7 * 24 * time.Hour
+
+// TabletLifecycleService renomme, retire, supprime et met en maintenance les tablettes
+type TabletLifecycleService interface {
+	Rename(id int64, name, actor string) error
+	// Retire arrête d'interroger la tablette et l'écarte des envois de groupe, en gardant son historique
+	Retire(id int64, actor string) error
+	Reactivate(id int64, actor string) error
+	// Delete supprime la tablette et tout son historique
+	Delete(id int64, actor string) error
+
+	// StartMaintenance suspend alertes et commandes planifiées jusqu'à until
+	StartMaintenance(id int64, until time.Time, note, actor string) error
+	EndMaintenance(id int64, actor string) error
+}
+
+type tabletLifecycleService struct {
+	tabletRepo repositories.TabletRepository
+	auditRepo  repositories.AuditRepository
+}
+
+func NewTabletLifecycleService(tr repositories.TabletRepository, ar repositories.AuditRepository) TabletLifecycleService {
+	return &tabletLifecycleService{tabletRepo: tr, auditRepo: ar}
+}
+
+func (s *tabletLifecycleService) get(id int64) (*repositories.Tablet, error) {
+	t, err := s.tabletRepo.GetByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTabletNotFound
+	}
+	return t, err
+}
+
+func (s *tabletLifecycleService) Rename(id int64, name, actor string) error {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return ErrInvalidTabletName
+	}
+	t, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.tabletRepo.Rename(id, name); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "tablet.rename", fmt.Sprintf("tablet:%d", id), fmt.Sprintf("%s → %s", t.Name, name))
+	sse.Instance.Publish(sse.Event{Type: sse.EventStatus, TabletID: id})
+	return nil
+}
+
+func (s *tabletLifecycleService) Retire(id int64, actor string) error {
+	t, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := s.tabletRepo.SetRetired(id, &now); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "tablet.retire", fmt.Sprintf("tablet:%d", id), fmt.Sprintf("%s (%s)", t.Name, t.IP))
+	sse.Instance.Publish(sse.Event{Type: sse.EventStatus, TabletID: id})
+	return nil
+}
+
+func (s *tabletLifecycleService) Reactivate(id int64, actor string) error {
+	t, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.tabletRepo.SetRetired(id, nil); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "tablet.reactivate", fmt.Sprintf("tablet:%d", id), fmt.Sprintf("%s (%s)", t.Name, t.IP))
+	sse.Instance.Publish(sse.Event{Type: sse.EventStatus, TabletID: id})
+	return nil
+}
+
+func (s *tabletLifecycleService) Delete(id int64, actor string) error {
+	t, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.tabletRepo.Delete(id); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "tablet.delete", fmt.Sprintf("tablet:%d", id), fmt.Sprintf("%s (%s)", t.Name, t.IP))
+	sse.Instance.Publish(sse.Event{Type: sse.EventFleet, TabletID: id})
+	return nil
+}
+
+func (s *tabletLifecycleService) StartMaintenance(id int64, until time.Time, note, actor string) error {
+	now := time.Now()
+	if !until.After(now) || until.Sub(now) > maxMaintenance {
+		return ErrInvalidMaintenance
+	}
+	note = strings.TrimSpace(note)
+	if _, err := s.get(id); err != nil {
+		return err
+	}
+	if err := s.tabletRepo.SetMaintenance(id, &until, note); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "tablet.maintenance", fmt.Sprintf("tablet:%d", id),
+		fmt.Sprintf("until %s: %s", until.Format("02/01 15:04"), note))
+	sse.Instance.Publish(sse.Event{Type: sse.EventStatus, TabletID: id})
+	return nil
+}
+
+func (s *tabletLifecycleService) EndMaintenance(id int64, actor string) error {
+	if _, err := s.get(id); err != nil {
+		return err
+	}
+	if err := s.tabletRepo.SetMaintenance(id, nil, ""); err != nil {
+		return err
+	}
+	recordAudit(s.auditRepo, actor, "tablet.maintenance", fmt.Sprintf("tablet:%d", id), "ended")
+	sse.Instance.Publish(sse.Event{Type: sse.EventStatus, TabletID: id})
+	return nil
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+	"github.com/wared2003/freekiosk-hub/internal/sse"
+)
+
+var ErrTamperEventNotFound = errors.New("tamper_event_not_found")
+
+const (
+	// Relevés moyennés pour apprendre la position de repos
+	baselineSamples = 3
+	// Poids d'un relevé stable dans la position de repos, pour suivre une lente dérive du capteur
+	baselineDrift = 0.05
+	// En dessous, le capteur est absent ou en chute libre : pas de comparaison possible
+	minGravity = 1.0
+)
+
+// TamperConfig règle la détection ; Camera vide = pas de photo automatique
+type TamperConfig struct {
+	AngleDeg     float64
+	WatchNetwork bool
+	Camera       string
+}
+
+type TamperService interface {
+	ReportObserver
+	Events(limit int) ([]repositories.TamperEvent, error)
+	Event(id int64) (*repositories.TamperEvent, error)
+	// Acknowledge clôt l'alerte ; relearn fait réapprendre la position de repos (tablette déplacée volontairement)
+	Acknowledge(id int64, actor string, relearn bool) error
+	OpenCount(tabletID int64) int
+}
+
+type tamperService struct {
+	repo        repositories.TamperRepository
+	auditRepo   repositories.AuditRepository
+	snapService SnapshotService
+	inventory   InventoryService
+	cfg         TamperConfig
+}
+
+func NewTamperService(repo repositories.TamperRepository, ar repositories.AuditRepository, ss SnapshotService, inv InventoryService, cfg TamperConfig) TamperService {
+	return &tamperService{repo: repo, auditRepo: ar, snapService: ss, inventory: inv, cfg: cfg}
+}
+
+func gravity(x, y, z float64) float64 {
+	return math.Sqrt(x*x + y*y + z*z)
+}
+
+// tilt renvoie l'angle en degrés entre la position de repos et le relevé
+func tilt(b *repositories.TabletBaseline, r *repositories.TabletReport) float64 {
+	cos := (b.AccelX*r.AccelX + b.AccelY*r.AccelY + b.AccelZ*r.AccelZ) /
+		(gravity(b.AccelX, b.AccelY, b.AccelZ) * gravity(r.AccelX, r.AccelY, r.AccelZ))
+	return math.Acos(math.Max(-1, math.Min(1, cos))) * 180 / math.Pi
+}
+
+func (s *tamperService) Observe(t repositories.Tablet, r *repositories.TabletReport) {
+	b, err := s.repo.GetBaseline(t.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		b = &repositories.TabletBaseline{TabletID: t.ID, DeviceIP: r.DeviceIP, WifiSSID: r.WifiSSID}
+	} else if err != nil {
+		slog.Error("database error: failed to fetch tablet baseline", "tablet", t.ID, "err", err)
+		return
+	}
+
+	if gravity(r.AccelX, r.AccelY, r.AccelZ) >= minGravity {
+		s.checkPosition(t, b, r)
+	}
+	if s.cfg.WatchNetwork {
+		s.checkNetwork(t, b, r)
+	}
+
+	if err := s.repo.SaveBaseline(b); err != nil {
+		slog.Error("database error: failed to save tablet baseline", "tablet", t.ID, "err", err)
+	}
+}
+
+func (s *tamperService) checkPosition(t repositories.Tablet, b *repositories.TabletBaseline, r *repositories.TabletReport) {
+	// Apprentissage : moyenne des premiers relevés
+	if b.Samples < baselineSamples {
+		n := float64(b.Samples)
+		b.AccelX = (b.AccelX*n + r.AccelX) / (n + 1)
+		b.AccelY = (b.AccelY*n + r.AccelY) / (n + 1)
+		b.AccelZ = (b.AccelZ*n + r.AccelZ) / (n + 1)
+		b.Proximity = (b.Proximity*n + r.Proximity) / (n + 1)
+		b.Samples++
+		b.Displaced = false
+		return
+	}
+
+	angle := tilt(b, r)
+	if angle <= s.cfg.AngleDeg {
+		// Revenue en place : une nouvelle sortie de position lèvera une nouvelle alerte
+		b.Displaced = false
+		b.AccelX += (r.AccelX - b.AccelX) * baselineDrift
+		b.AccelY += (r.AccelY - b.AccelY) * baselineDrift
+		b.AccelZ += (r.AccelZ - b.AccelZ) * baselineDrift
+		b.Proximity += (r.Proximity - b.Proximity) * baselineDrift
+		return
+	}
+	if b.Displaced {
+		return
+	}
+	b.Displaced = true
+
+	kind := repositories.TamperMoved
+	details := fmt.Sprintf("Tilted %.0f° from its resting orientation", angle)
+	// Capteur couvert alors qu'il ne l'était pas au repos : tablette retournée, décrochée ou emportée
+	if r.Proximity < 1 && b.Proximity >= 1 {
+		kind = repositories.TamperRemoved
+		details += ", proximity sensor covered"
+	}
+
+	s.raise(t, &repositories.TamperEvent{
+		Kind:    kind,
+		Details: details,
+		Before:  fmt.Sprintf("x=%.2f y=%.2f z=%.2f, proximity %.1f", b.AccelX, b.AccelY, b.AccelZ, b.Proximity),
+		After:   fmt.Sprintf("x=%.2f y=%.2f z=%.2f, proximity %.1f", r.AccelX, r.AccelY, r.AccelZ, r.Proximity),
+	})
+}
+
+func (s *tamperService) checkNetwork(t repositories.Tablet, b *repositories.TabletBaseline, r *repositories.TabletReport) {
+	var changes, before, after []string
+	if r.DeviceIP != "" && b.DeviceIP != "" && r.DeviceIP != b.DeviceIP {
+		changes = append(changes, "local IP")
+		before = append(before, "IP "+b.DeviceIP)
+		after = append(after, "IP "+r.DeviceIP)
+	}
+	if r.WifiSSID != "" && b.WifiSSID != "" && r.WifiSSID != b.WifiSSID {
+		changes = append(changes, "WiFi network")
+		before = append(before, "SSID "+b.WifiSSID)
+		after = append(after, "SSID "+r.WifiSSID)
+	}
+
+	// La nouvelle valeur devient la référence : un seul événement par changement
+	if r.DeviceIP != "" {
+		b.DeviceIP = r.DeviceIP
+	}
+	if r.WifiSSID != "" {
+		b.WifiSSID = r.WifiSSID
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	s.raise(t, &repositories.TamperEvent{
+		Kind:    repositories.TamperNetwork,
+		Details: "Changed " + strings.Join(changes, " and "),
+		Before:  strings.Join(before, ", "),
+		After:   strings.Join(after, ", "),
+	})
+}
+
+func (s *tamperService) raise(t repositories.Tablet, e *repositories.TamperEvent) {
+	e.TabletID = t.ID
+	if s.inventory != nil {
+		e.Labels = FormatLabels(s.inventory.Labels([]repositories.Tablet{t})[t.ID])
+	}
+	if err := s.repo.CreateEvent(e); err != nil {
+		slog.Error("database error: failed to record tamper event", "tablet", t.ID, "err", err)
+		return
+	}
+
+	slog.Warn("🚨 Tamper alert", "tablet", t.Name, "kind", e.Kind, "details", e.Details, "before", e.Before, "after", e.After, "labels", e.Labels)
+	recordAudit(s.auditRepo, "monitor", "tamper."+e.Kind, fmt.Sprintf("tablet:%d", t.ID),
+		fmt.Sprintf("%s: %s (%s → %s) [%s]", t.Name, e.Details, e.Before, e.After, e.Labels))
+	sse.Instance.Publish(sse.Event{Type: sse.EventAlert, TabletID: t.ID, Data: sse.Alert{
+		Kind:    "tamper." + e.Kind,
+		Tablet:  t.Name,
+		Message: e.Details,
+	}})
+
+	if s.cfg.Camera == "" || s.snapService == nil {
+		return
+	}
+	// La prise de vue prend plusieurs secondes : elle ne doit pas retarder le scan
+	go func(eventID int64) {
+		snap, err := s.snapService.Capture(t.ID, s.cfg.Camera, "tamper", "tamper")
+		if err != nil {
+			slog.Warn("tamper: automatic snapshot failed", "tablet", t.Name, "err", err)
+			return
+		}
+		if err := s.repo.SetEventSnapshot(eventID, snap.ID); err != nil {
+			slog.Error("database error: failed to link tamper snapshot", "event", eventID, "err", err)
+		}
+	}(e.ID)
+}
+
+func (s *tamperService) Events(limit int) ([]repositories.TamperEvent, error) {
+	return s.repo.GetEvents(limit)
+}
+
+func (s *tamperService) Event(id int64) (*repositories.TamperEvent, error) {
+	e, err := s.repo.GetEvent(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTamperEventNotFound
+	}
+	return e, err
+}
+
+func (s *tamperService) Acknowledge(id int64, actor string, relearn bool) error {
+	e, err := s.Event(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Acknowledge(id, actor); err != nil {
+		return err
+	}
+	if relearn && e.Kind != repositories.TamperNetwork {
+		if err := s.repo.ResetPosition(e.TabletID); err != nil {
+			return err
+		}
+	}
+
+	details := fmt.Sprintf("%s: %s", e.TabletName, e.Details)
+	if relearn {
+		details += " — new position accepted"
+	}
+	recordAudit(s.auditRepo, actor, "tamper.acknowledge", fmt.Sprintf("tablet:%d", e.TabletID), details)
+	return nil
+}
+
+func (s *tamperService) OpenCount(tabletID int64) int {
+	n, err := s.repo.CountOpen(tabletID)
+	if err != nil {
+		slog.Error("database error: failed to count tamper events", "tablet", tabletID, "err", err)
+	}
+	return n
+}
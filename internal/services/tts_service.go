@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wared2003/freekiosk-hub/internal/repositories"
+)
+
+// Durée maximale accordée au moteur pour produire un fichier
+const ttsTimeout = 30 * time.Second
+
+var (
+	ErrTTSUnavailable = errors.New("tts_engine_unavailable")
+	ErrInvalidVoice   = errors.New("invalid_tts_voice")
+)
+
+// TTSProvider produit un fichier WAV à partir d'un texte, sans service externe
+type TTSProvider interface {
+	Name() string
+	Synthesize(ctx context.Context, text, voice, lang, dst string) error
+}
+
+// TTSConfig décrit le moteur local installé sur le hub (Engine vide = pas de moteur)
+type TTSConfig struct {
+	Engine    string // "espeak" ou "piper"
+	Binary    string // chemin du binaire, sinon recherché dans le PATH
+	Voice     string // voix espeak ou modèle piper par défaut
+	ModelsDir string // dossier des modèles .onnx de piper
+}
+
+// NewTTSProvider renvoie nil, sans erreur, quand aucun moteur n'est configuré
+func NewTTSProvider(cfg TTSConfig) (TTSProvider, error) {
+	switch cfg.Engine {
+	case "":
+		return nil, nil
+	case "espeak":
+		bin, err := lookPath(cfg.Binary, "espeak-ng", "espeak")
+		if err != nil {
+			return nil, err
+		}
+		return &espeakProvider{bin: bin, voice: cfg.Voice}, nil
+	case "piper":
+		bin, err := lookPath(cfg.Binary, "piper")
+		if err != nil {
+			return nil, err
+		}
+		return &piperProvider{bin: bin, voice: cfg.Voice, modelsDir: cfg.ModelsDir}, nil
+	}
+	return nil, fmt.Errorf("unknown TTS engine %q", cfg.Engine)
+}
+
+func lookPath(configured string, names ...string) (string, error) {
+	if configured != "" {
+		names = []string{configured}
+	}
+	for _, name := range names {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s not found", ErrTTSUnavailable, strings.Join(names, ", "))
+}
+
+func runEngine(ctx context.Context, text string, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = strings.NewReader(text)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", filepath.Base(name), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// espeakVoice : nom de voix ou de langue espeak (fr, en-us, mb-fr1, fr+f3), sans chemin ni option
+var espeakVoice = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_+-]*$`)
+
+type espeakProvider struct {
+	bin   string
+	voice string
+}
+
+func (p *espeakProvider) Name() string { return "espeak" }
+
+// La voix espeak par défaut est la langue elle-même (fr, en, de...)
+func (p *espeakProvider) Synthesize(ctx context.Context, text, voice, lang, dst string) error {
+	if voice == "" {
+		voice = p.voice
+	}
+	if voice == "" {
+		voice = lang
+	}
+	if voice == "" {
+		return runEngine(ctx, text, p.bin, "-w", dst, "--stdin")
+	}
+	// La voix et la langue viennent du formulaire, comme pour piper
+	if !espeakVoice.MatchString(voice) {
+		return fmt.Errorf("%w: %q", ErrInvalidVoice, voice)
+	}
+	return runEngine(ctx, text, p.bin, "-v", voice, "-w", dst, "--stdin")
+}
+
+type piperProvider struct {
+	bin       string
+	voice     string
+	modelsDir string
+}
+
+func (p *piperProvider) Name() string { return "piper" }
+
+// Synthesize choisit le modèle demandé, sinon le premier modèle de ModelsDir pour la langue
+// (fr_FR-siwis-medium.onnx pour "fr"), sinon le modèle par défaut
+func (p *piperProvider) Synthesize(ctx context.Context, text, voice, lang, dst string) error {
+	model, err := p.model(voice, lang)
+	if err != nil {
+		return err
+	}
+	if model == "" {
+		return fmt.Errorf("%w: no piper model for %q", ErrTTSUnavailable, lang)
+	}
+	return runEngine(ctx, text, p.bin, "--model", model, "--output_file", dst)
+}
+
+// model n'accepte comme voix demandée que le nom d'un modèle .onnx présent dans ModelsDir,
+// avec ou sans extension : la voix vient du formulaire et ne doit pas désigner un autre fichier du hub
+func (p *piperProvider) model(voice, lang string) (string, error) {
+	if voice != "" {
+		name := voice
+		if !strings.HasSuffix(name, ".onnx") {
+			name += ".onnx"
+		}
+		if p.modelsDir == "" || strings.ContainsAny(name, `/\`) || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			return "", fmt.Errorf("%w: %q", ErrInvalidVoice, voice)
+		}
+		path := filepath.Join(p.modelsDir, name)
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			return "", fmt.Errorf("%w: %q", ErrInvalidVoice, voice)
+		}
+		return path, nil
+	}
+	// La langue vient aussi du formulaire : pas de séparateur ni de motif dans le glob
+	if p.modelsDir != "" && lang != "" && !strings.ContainsAny(lang, `/\.*?[`) {
+		lang = strings.ReplaceAll(lang, "-", "_")
+		if matches, _ := filepath.Glob(filepath.Join(p.modelsDir, lang+"*.onnx")); len(matches) > 0 {
+			return matches[0], nil
+		}
+	}
+	return p.voice, nil
+}
+
+type TTSService interface {
+	// Engine renvoie le nom du moteur local, ou "" si les annonces passent par le TTS des tablettes
+	Engine() string
+	// Announce fait dire le texte aux tablettes : fichier généré par le hub et joué via PlayAudio,
+	// ou Speak de la tablette si aucun moteur n'est disponible
+	Announce(t Target, text, voice, lang string, loop bool, volume int) (*ActionReport, error)
+	// Prepare génère le fichier à l'avance pour qu'une séquence ne prenne pas de retard
+	Prepare(text, voice, lang string) error
+}
+
+type ttsService struct {
+	mu           sync.Mutex
+	provider     TTSProvider
+	mediaService MediaService
+	kService     KioskService
+}
+
+func NewTTSService(cfg TTSConfig, mes MediaService, ks KioskService) TTSService {
+	provider, err := NewTTSProvider(cfg)
+	if err != nil {
+		slog.Warn("TTS engine unavailable, announcements will use the tablets' own speech", "engine", cfg.Engine, "err", err)
+	}
+	return &ttsService{provider: provider, mediaService: mes, kService: ks}
+}
+
+func (s *ttsService) Engine() string {
+	if s.provider == nil {
+		return ""
+	}
+	return s.provider.Name()
+}
+
+func (s *ttsService) Announce(t Target, text, voice, lang string, loop bool, volume int) (*ActionReport, error) {
+	if s.provider == nil {
+		return s.kService.Speak(t, text)
+	}
+
+	m, err := s.render(text, voice, lang)
+	if err != nil {
+		slog.Warn("TTS generation failed, falling back to the tablets' own speech", "engine", s.provider.Name(), "err", err)
+		return s.kService.Speak(t, text)
+	}
+	return s.kService.PlayAudio(t, s.mediaService.URL(m), loop, volume)
+}
+
+func (s *ttsService) Prepare(text, voice, lang string) error {
+	if s.provider == nil {
+		return nil
+	}
+	_, err := s.render(text, voice, lang)
+	return err
+}
+
+// render renvoie le fichier de la bibliothèque correspondant à (moteur, texte, voix, langue),
+// en le générant au premier passage
+func (s *ttsService) render(text, voice, lang string) (*repositories.Media, error) {
+	sum := sha256.Sum256([]byte(strings.Join([]string{s.provider.Name(), voice, lang, text}, "\x00")))
+	fileName := "tts-" + hex.EncodeToString(sum[:8]) + ".wav"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m, err := s.mediaService.Lookup("audio", fileName); err == nil {
+		return m, nil
+	}
+
+	tmp, err := os.CreateTemp("", "tts-*.wav")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	ctx, cancel := context.WithTimeout(context.Background(), ttsTimeout)
+	defer cancel()
+	if err := s.provider.Synthesize(ctx, text, voice, lang, tmp.Name()); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := s.mediaService.Upload(fileName, f, UploadOptions{
+		Collection: "audio",
+		Uploader:   "tts:" + s.provider.Name(),
+		Tags:       "tts," + lang,
+	})
+	if errors.Is(err, ErrMediaDuplicate) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Le nom affiché reprend le texte pour retrouver l'annonce dans la bibliothèque
+	name := text
+	if len([]rune(name)) > 60 {
+		name = string([]rune(name)[:60]) + "…"
+	}
+	if err := s.mediaService.Update(m.ID, name, m.Tags); err == nil {
+		m.Name = name
+	}
+	slog.Info("resource created: TTS announcement rendered", "engine", s.provider.Name(), "lang", lang, "file", m.FileName)
+	return m, nil
+}
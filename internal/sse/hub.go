@@ -1,74 +1,399 @@
 package sse
 
 import (
+	"cmp"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-type NotificationHub interface {
-	SubscribeGlobal() chan bool
-	SubscribeTablet(id int64) chan bool
-	Unsubscribe(ch chan bool, id int64)
-	Notify(id int64)
+// Types d'événements
+const (
+	EventStatus  = "tablet-status"  // la tablette a changé d'état : en ligne, renommée, retirée, en maintenance
+	EventReport  = "tablet-report"  // nouveau rapport de la tablette
+	EventCommand = "command-result" // résultat d'une commande envoyée à la tablette
+	EventAlert   = "alert"          // alerte levée sur une tablette
+	EventFleet   = "fleet"          // tablette ajoutée ou supprimée : les listes sont à recharger
+	EventReset   = "reset"          // des événements ont été perdus : le client doit recharger tout son état
+)
+
+const (
+	// CoalesceWindow est l'attente entre le premier événement d'une rafale et l'envoi du lot
+	CoalesceWindow = 500 * time.Millisecond
+	// HeartbeatInterval espace les commentaires qui empêchent les proxys de fermer un flux inactif
+	HeartbeatInterval = 25 * time.Second
+
+	// replaySize borne les derniers événements non regroupés gardés pour les reconnexions avec Last-Event-ID ;
+	// des événements regroupés, le hub garde le dernier de chaque tablette, quelle que soit la taille de la flotte
+	replaySize = 512
+	// maxPending borne les événements en attente d'un abonné qui ne lit plus
+	maxPending = 4096
+	// groupCacheTTL : les appartenances aux groupes sont relues au plus tard après ce délai
+	groupCacheTTL = 30 * time.Second
+)
+
+// Event est une notification typée ; Data est la charge utile envoyée en JSON aux clients
+type Event struct {
+	ID       uint64 `json:"id"`
+	Type     string `json:"type"`
+	TabletID int64  `json:"tablet_id,omitempty"`
+	Data     any    `json:"data,omitempty"`
+}
+
+// Status est la charge utile des EventStatus et EventReport publiés par le moniteur
+type Status struct {
+	Online   bool      `json:"online"`
+	Health   string    `json:"health"`
+	Battery  int       `json:"battery"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// CommandResult est la charge utile d'un EventCommand
+type CommandResult struct {
+	Command string `json:"command"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Alert est la charge utile d'un EventAlert
+type Alert struct {
+	Kind    string `json:"kind"`
+	Tablet  string `json:"tablet"`
+	Message string `json:"message"`
+}
+
+// coalesced indique les événements dont seul le dernier compte : un lot n'en garde qu'un par tablette
+func (e Event) coalesced() bool {
+	return e.Type == EventStatus || e.Type == EventReport || e.Type == EventFleet
+}
+
+// Filter restreint un abonnement ; un champ vide ne filtre pas.
+// Une tablette est retenue si elle est listée dans Tablets ou appartient à l'un des Groups.
+type Filter struct {
+	Tablets []int64
+	Groups  []int64
+	Types   []string
+	// AllAlerts reçoit les alertes de toute la flotte, hors du périmètre des tablettes et des groupes
+	AllAlerts bool
+}
+
+// GroupResolver renvoie les groupes de chaque tablette
+type GroupResolver func() (map[int64][]int64, error)
+
+// Stats sont les compteurs du hub, exposés dans les métriques
+type Stats struct {
+	Subscribers int
+	Published   uint64
+	Dropped     uint64 // événements perdus par des abonnés trop lents, remplacés pour eux par un EventReset
+	Replayed    uint64 // événements renvoyés à des clients reconnectés avec Last-Event-ID
+}
+
+// Subscription reçoit les événements d'une partie de la flotte
+type Subscription struct {
+	tablets   map[int64]bool // nil : pas de restriction par tablette
+	groups    map[int64]bool
+	types     map[string]bool
+	allAlerts bool
+
+	ready    chan struct{}
+	mu       sync.Mutex
+	pending  []Event
+	index    map[string]int // position dans pending des événements regroupés
+	overflow bool
+}
+
+func toSet[T comparable](values []T) map[T]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[T]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// C signale que des événements attendent d'être lus par Drain
+func (s *Subscription) C() <-chan struct{} {
+	return s.ready
+}
+
+// Drain renvoie et vide les événements en attente par ordre d'identifiant ; si certains ont été perdus,
+// le lot commence par un EventReset
+func (s *Subscription) Drain() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := s.pending
+	s.pending = nil
+	clear(s.index)
+	slices.SortFunc(events, func(a, b Event) int { return cmp.Compare(a.ID, b.ID) })
+	if s.overflow {
+		s.overflow = false
+		events = append([]Event{{Type: EventReset}}, events...)
+	}
+	return events
+}
+
+// wants applique le filtre ; tabletGroups n'est renseigné que pour les abonnements par groupe
+func (s *Subscription) wants(e Event, tabletGroups []int64) bool {
+	if s.types != nil && !s.types[e.Type] {
+		return false
+	}
+	if s.tablets == nil && s.groups == nil {
+		return true
+	}
+	if e.Type == EventFleet || e.Type == EventAlert && s.allAlerts || s.tablets[e.TabletID] {
+		return true
+	}
+	for _, g := range tabletGroups {
+		if s.groups[g] {
+			return true
+		}
+	}
+	return false
+}
+
+func (e Event) key() string {
+	return fmt.Sprintf("%s/%d", e.Type, e.TabletID)
+}
+
+// push met l'événement en attente ; il renvoie false s'il a dû être abandonné
+func (s *Subscription) push(e Event) bool {
+	s.mu.Lock()
+	key := e.key()
+	kept := true
+	if i, ok := s.index[key]; ok && e.coalesced() {
+		// Un événement rejoué peut arriver après un plus récent : le plus récent l'emporte
+		if e.ID > s.pending[i].ID {
+			s.pending[i] = e
+		}
+	} else if len(s.pending) < maxPending {
+		if e.coalesced() {
+			s.index[key] = len(s.pending)
+		}
+		s.pending = append(s.pending, e)
+	} else {
+		if !s.overflow {
+			slog.Warn("sse: subscriber too slow, events dropped until it catches up")
+		}
+		s.overflow = true
+		kept = false
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+	return kept
 }
 
 type Hub struct {
-	mu            sync.Mutex
-	globalClients map[chan bool]bool
-	tabletClients map[int64]map[chan bool]bool
+	mu      sync.Mutex
+	subs    map[*Subscription]bool
+	firstID uint64 // identifiants antérieurs : publiés avant le démarrage
+	lastID  uint64
+	replay  []Event          // derniers événements non regroupés, du plus ancien au plus récent
+	evicted uint64           // identifiant du dernier événement sorti de replay
+	latest  map[string]Event // dernier événement regroupé de chaque type et tablette
+
+	gmu          sync.Mutex
+	resolver     GroupResolver
+	tabletGroups map[int64][]int64
+	groupsLoaded time.Time
+
+	published atomic.Uint64
+	dropped   atomic.Uint64
+	replayed  atomic.Uint64
 }
 
-var Instance = &Hub{
-	globalClients: make(map[chan bool]bool),
-	tabletClients: make(map[int64]map[chan bool]bool),
+// NewHub numérote les événements à partir de l'heure de démarrage en microsecondes : les identifiants
+// restent croissants d'un redémarrage à l'autre, et un client reconnecté après un redémarrage reçoit un EventReset
+func NewHub() *Hub {
+	start := uint64(time.Now().UnixMicro())
+	return &Hub{
+		subs:    make(map[*Subscription]bool),
+		firstID: start,
+		lastID:  start,
+		latest:  make(map[string]Event),
+	}
 }
 
-func (h *Hub) SubscribeGlobal() chan bool {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	ch := make(chan bool, 1)
-	h.globalClients[ch] = true
-	return ch
+var Instance = NewHub()
+
+// SetGroupResolver fournit les appartenances aux groupes utilisées par les abonnements par groupe
+func (h *Hub) SetGroupResolver(r GroupResolver) {
+	h.gmu.Lock()
+	defer h.gmu.Unlock()
+	h.resolver = r
+	h.tabletGroups, h.groupsLoaded = nil, time.Time{}
 }
 
-func (h *Hub) SubscribeTablet(id int64) chan bool {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	if h.tabletClients[id] == nil {
-		h.tabletClients[id] = make(map[chan bool]bool)
+// InvalidateGroups fait relire les appartenances aux groupes après une modification
+func (h *Hub) InvalidateGroups() {
+	h.gmu.Lock()
+	defer h.gmu.Unlock()
+	h.groupsLoaded = time.Time{}
+}
+
+func (h *Hub) groupsOf(tabletID int64) []int64 {
+	h.gmu.Lock()
+	defer h.gmu.Unlock()
+	if h.resolver == nil {
+		return nil
 	}
-	ch := make(chan bool, 1)
-	h.tabletClients[id][ch] = true
-	return ch
+	if time.Since(h.groupsLoaded) > groupCacheTTL {
+		m, err := h.resolver()
+		if err != nil {
+			slog.Error("sse: failed to resolve group memberships", "err", err)
+		} else {
+			h.tabletGroups, h.groupsLoaded = m, time.Now()
+		}
+	}
+	return h.tabletGroups[tabletID]
 }
 
-func (h *Hub) Unsubscribe(ch chan bool, id int64) {
+// Subscribe ouvre un abonnement ; avec lastEventID non nul, les événements publiés depuis sont d'abord rejoués,
+// ou un EventReset est envoyé si certains sont perdus : sortis du tampon, ou publiés avant le démarrage.
+// Des événements regroupés, seul le dernier de chaque tablette est rejoué, comme dans un lot.
+func (h *Hub) Subscribe(f Filter, lastEventID uint64) *Subscription {
+	s := &Subscription{
+		tablets:   toSet(f.Tablets),
+		groups:    toSet(f.Groups),
+		types:     toSet(f.Types),
+		allAlerts: f.AllAlerts,
+		ready:     make(chan struct{}, 1),
+		index:     make(map[string]int),
+	}
+
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	delete(h.globalClients, ch)
-	if id != 0 && h.tabletClients[id] != nil {
-		delete(h.tabletClients[id], ch)
+	h.subs[s] = true
+	var missed []Event
+	gap := false
+	if lastEventID != 0 && lastEventID != h.lastID {
+		gap = lastEventID > h.lastID || lastEventID < h.firstID || lastEventID < h.evicted
+		if !gap {
+			for _, e := range h.replay {
+				if e.ID > lastEventID {
+					missed = append(missed, e)
+				}
+			}
+			for _, e := range h.latest {
+				if e.ID > lastEventID {
+					missed = append(missed, e)
+				}
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	// Les événements publiés entre-temps sont déjà en attente : Drain les remet dans l'ordre
+	if gap {
+		s.mu.Lock()
+		s.overflow = true
+		s.mu.Unlock()
+		select {
+		case s.ready <- struct{}{}:
+		default:
+		}
+		return s
+	}
+	for _, e := range missed {
+		if s.wants(e, h.groupsFor(s, e)) {
+			s.push(e)
+			h.replayed.Add(1)
+		}
 	}
+	return s
 }
 
-func (h *Hub) NotifyNewReport(tabId int64) {
+func (h *Hub) Unsubscribe(s *Subscription) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	delete(h.subs, s)
+}
 
-	for ch := range h.globalClients {
-		select {
-		case ch <- true:
-		default:
+func (h *Hub) groupsFor(s *Subscription, e Event) []int64 {
+	if s.groups == nil || e.TabletID == 0 {
+		return nil
+	}
+	return h.groupsOf(e.TabletID)
+}
 
+// Publish numérote l'événement et le transmet aux abonnés concernés sans jamais bloquer l'émetteur
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	h.lastID++
+	e.ID = h.lastID
+	if e.coalesced() {
+		h.latest[e.key()] = e
+	} else {
+		h.replay = append(h.replay, e)
+		if len(h.replay) > replaySize {
+			h.evicted = h.replay[len(h.replay)-replaySize-1].ID
+			h.replay = slices.Delete(h.replay, 0, len(h.replay)-replaySize)
 		}
 	}
+	subs := make([]*Subscription, 0, len(h.subs))
+	for s := range h.subs {
+		subs = append(subs, s)
+	}
+	h.mu.Unlock()
 
-	if clients, ok := h.tabletClients[tabId]; ok {
-		for ch := range clients {
-			select {
-			case ch <- true:
-			default:
-
-			}
+	h.published.Add(1)
+	if e.Type == EventFleet {
+		h.InvalidateGroups()
+	}
+	for _, s := range subs {
+		if s.wants(e, h.groupsFor(s, e)) && !s.push(e) {
+			h.dropped.Add(1)
 		}
 	}
 }
+
+func (h *Hub) Stats() Stats {
+	h.mu.Lock()
+	subscribers := len(h.subs)
+	h.mu.Unlock()
+	return Stats{
+		Subscribers: subscribers,
+		Published:   h.published.Load(),
+		Dropped:     h.dropped.Load(),
+		Replayed:    h.replayed.Load(),
+	}
+}
+
+// WriteEvent écrit un événement au format text/event-stream, une ligne data: par ligne de contenu ;
+// un identifiant nul n'est pas écrit
+func WriteEvent(w io.Writer, id uint64, name, data string) error {
+	var b strings.Builder
+	if id != 0 {
+		fmt.Fprintf(&b, "id: %d\n", id)
+	}
+	if name != "" {
+		fmt.Fprintf(&b, "event: %s\n", name)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteID avance l'identifiant retenu par le client sans lui envoyer d'événement
+func WriteID(w io.Writer, id uint64) error {
+	_, err := fmt.Fprintf(w, "id: %d\n\n", id)
+	return err
+}
+
+// WriteHeartbeat écrit un commentaire, ignoré par les clients
+func WriteHeartbeat(w io.Writer) error {
+	_, err := io.WriteString(w, ": ping\n\n")
+	return err
+}
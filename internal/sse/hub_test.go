@@ -0,0 +1,186 @@
+package sse
+
+import "testing"
+
+// publishAll publie les événements et renvoie l'identifiant du dernier
+func publishAll(h *Hub, events ...Event) uint64 {
+	for _, e := range events {
+		h.Publish(e)
+	}
+	return h.lastID
+}
+
+func alerts(n int) []Event {
+	events := make([]Event, n)
+	for i := range events {
+		events[i] = Event{Type: EventAlert, TabletID: int64(i + 1)}
+	}
+	return events
+}
+
+func reports(n int) []Event {
+	events := make([]Event, n)
+	for i := range events {
+		events[i] = Event{Type: EventReport, TabletID: int64(i + 1)}
+	}
+	return events
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		// setup publie des événements et renvoie le Last-Event-ID présenté à la reconnexion
+		setup     func(h *Hub) uint64
+		wantReset bool
+		wantLen   int
+		check     func(t *testing.T, h *Hub, events []Event)
+	}{
+		{
+			name: "first connection replays nothing",
+			setup: func(h *Hub) uint64 {
+				publishAll(h, alerts(3)...)
+				return 0
+			},
+		},
+		{
+			name: "up to date client replays nothing",
+			setup: func(h *Hub) uint64 {
+				return publishAll(h, alerts(3)...)
+			},
+		},
+		{
+			name: "missed events are replayed in order",
+			setup: func(h *Hub) uint64 {
+				last := publishAll(h, alerts(2)...)
+				publishAll(h, Event{Type: EventCommand, TabletID: 1}, Event{Type: EventAlert, TabletID: 2})
+				return last
+			},
+			wantLen: 2,
+			check: func(t *testing.T, h *Hub, events []Event) {
+				if events[0].Type != EventCommand || events[1].Type != EventAlert || events[0].ID >= events[1].ID {
+					t.Errorf("events out of order: %+v", events)
+				}
+			},
+		},
+		{
+			name: "coalesced events replay only the latest state",
+			setup: func(h *Hub) uint64 {
+				last := publishAll(h, Event{Type: EventStatus, TabletID: 1})
+				publishAll(h,
+					Event{Type: EventStatus, TabletID: 1, Data: "old"},
+					Event{Type: EventStatus, TabletID: 1, Data: "new"},
+				)
+				return last
+			},
+			wantLen: 1,
+			check: func(t *testing.T, h *Hub, events []Event) {
+				if events[0].Data != "new" || events[0].ID != h.lastID {
+					t.Errorf("want latest status, got %+v", events[0])
+				}
+			},
+		},
+		{
+			name: "a fleet poll larger than the ring is replayed without reset",
+			setup: func(h *Hub) uint64 {
+				last := publishAll(h, Event{Type: EventFleet})
+				publishAll(h, reports(replaySize*2)...)
+				return last
+			},
+			wantLen: replaySize * 2,
+		},
+		{
+			name:   "the filter applies to replayed events",
+			filter: Filter{Tablets: []int64{2}},
+			setup: func(h *Hub) uint64 {
+				last := publishAll(h, Event{Type: EventFleet})
+				publishAll(h, reports(3)...)
+				publishAll(h, alerts(3)...)
+				return last
+			},
+			wantLen: 2,
+		},
+		{
+			name: "events evicted from the ring force a reset",
+			setup: func(h *Hub) uint64 {
+				last := publishAll(h, alerts(1)...)
+				publishAll(h, alerts(replaySize+1)...)
+				return last
+			},
+			wantReset: true,
+		},
+		{
+			name: "the oldest event still in the ring is not a gap",
+			setup: func(h *Hub) uint64 {
+				publishAll(h, alerts(replaySize)...)
+				// L'événement suivant fait sortir le premier : le client qui l'a reçu n'a rien perdu
+				last := h.replay[0].ID
+				publishAll(h, alerts(1)...)
+				return last
+			},
+			wantLen: replaySize,
+		},
+		{
+			name: "an identifier from before the restart forces a reset",
+			setup: func(h *Hub) uint64 {
+				publishAll(h, alerts(1)...)
+				return h.firstID - 10
+			},
+			wantReset: true,
+		},
+		{
+			name: "an identifier ahead of the hub forces a reset",
+			setup: func(h *Hub) uint64 {
+				return publishAll(h, alerts(1)...) + 10
+			},
+			wantReset: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHub()
+			last := tt.setup(h)
+			sub := h.Subscribe(tt.filter, last)
+			defer h.Unsubscribe(sub)
+
+			events := sub.Drain()
+			reset := len(events) > 0 && events[0].Type == EventReset
+			if reset != tt.wantReset {
+				t.Fatalf("reset = %v, want %v (%d events)", reset, tt.wantReset, len(events))
+			}
+			if tt.wantReset {
+				if len(events) != 1 {
+					t.Errorf("a reset replays nothing else, got %d events", len(events))
+				}
+				return
+			}
+			if len(events) != tt.wantLen {
+				t.Fatalf("replayed %d events, want %d", len(events), tt.wantLen)
+			}
+			for _, e := range events {
+				if e.ID <= last {
+					t.Errorf("replayed event %d not after Last-Event-ID %d", e.ID, last)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, h, events)
+			}
+		})
+	}
+}
+
+func TestPublishCountsDroppedEvents(t *testing.T) {
+	h := NewHub()
+	sub := h.Subscribe(Filter{}, 0)
+	defer h.Unsubscribe(sub)
+
+	publishAll(h, alerts(maxPending+5)...)
+	if got := h.Stats().Dropped; got != 5 {
+		t.Errorf("dropped = %d, want 5", got)
+	}
+	events := sub.Drain()
+	if events[0].Type != EventReset || len(events) != maxPending+1 {
+		t.Errorf("want a reset followed by %d events, got %d events starting with %q", maxPending, len(events), events[0].Type)
+	}
+}
@@ -8,6 +8,8 @@ package ui
 import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
+import "fmt"
+
 func AdminImport() templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
@@ -41,7 +43,7 @@ func AdminImport() templ.Component {
 				}()
 			}
 			ctx = templ.InitializeContext(ctx)
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div class=\"p-6 max-w-2xl mx-auto\"><div class=\"card bg-base-100 shadow-xl\"><div class=\"card-body\"><h2 class=\"card-title text-2xl mb-4\">Importation des Tablettes</h2><p class=\"text-sm text-base-content/70 mb-6\">Collez ici la liste des adresses IP (une par ligne).  Le Hub tentera de les contacter lors du prochain scan.</p><form hx-post=\"/api/v1/tablets/import\" hx-target=\"#result-message\"><div class=\"form-control\"><textarea name=\"ips\" class=\"textarea textarea-bordered h-64 font-mono\" placeholder=\"192.168.1.10&#10;192.168.1.11&#10;...\"></textarea></div><div id=\"result-message\" class=\"mt-4\"></div><div class=\"card-actions justify-end mt-6\"><button type=\"submit\" class=\"btn btn-primary\">Lancer l'importation</button></div></form></div></div></div>")
+			templ_7745c5c3_Err = AdminImportContent().Render(ctx, templ_7745c5c3_Buffer)
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
@@ -55,4 +57,116 @@ func AdminImport() templ.Component {
 	})
 }
 
+func AdminImportContent() templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var3 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var3 == nil {
+			templ_7745c5c3_Var3 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div class=\"p-6 max-w-2xl mx-auto\"><div class=\"card bg-base-100 shadow-xl\"><div class=\"card-body\"><h2 class=\"card-title text-2xl mb-4\">Importation des Tablettes</h2><p class=\"text-sm text-base-content/70 mb-6\">Collez ici la liste des adresses IP (une par ligne).  Le Hub tentera de les contacter lors du prochain scan. Une clé d'API propre peut suivre l'adresse sur la même ligne (<code>192.168.1.10 ma-cle-secrete</code>), ainsi qu'un profil de connexion : <code>192.168.1.10:8443 host=kiosk-3.example.com timeout=30 scheme=https</code> et l'inventaire : <code>192.168.1.10 name=Accueil location=Hall asset_tag=A-042 etage=2</code>. Un CSV exporté depuis le tableau de bord (en-tête <code>ip,name,…</code>) peut aussi être collé tel quel.</p><form hx-post=\"/api/v1/tablets/import\" hx-target=\"#result-message\"><div class=\"form-control\"><textarea name=\"ips\" class=\"textarea textarea-bordered h-64 font-mono\" placeholder=\"192.168.1.10&#10;192.168.1.11&#10;...\"></textarea></div><div class=\"form-control mt-4\"><label class=\"label text-xs font-bold uppercase text-slate-500\">Clé d'API des tablettes importées</label> <input name=\"api_key\" type=\"text\" autocomplete=\"off\" class=\"input input-bordered w-full font-mono text-sm\" placeholder=\"Optionnelle : sinon KIOSK_API_KEY\"> <span class=\"label-text-alt text-slate-400 mt-1\">Utilisée pour les lignes sans clé ; chiffrée avec la clé maître du hub</span></div><div class=\"grid grid-cols-3 gap-3 mt-4\"><div class=\"form-control\"><label class=\"label text-xs font-bold uppercase text-slate-500\">Port</label> <input name=\"port\" type=\"number\" min=\"1\" max=\"65535\" class=\"input input-bordered w-full font-mono text-sm\" placeholder=\"KIOSK_PORT\"></div><div class=\"form-control\"><label class=\"label text-xs font-bold uppercase text-slate-500\">Délai (s)</label> <input name=\"timeout\" type=\"number\" min=\"0\" max=\"300\" class=\"input input-bordered w-full font-mono text-sm\" placeholder=\"KIOSK_TIMEOUT\"></div><div class=\"form-control\"><label class=\"label text-xs font-bold uppercase text-slate-500\">Schéma</label> <select name=\"scheme\" class=\"select select-bordered w-full\"><option value=\"\">Inchangé</option> <option value=\"http\">HTTP</option> <option value=\"https\">HTTPS</option></select></div></div><span class=\"label-text-alt text-slate-400 mt-1 block\">Appliqués aux lignes qui ne les précisent pas</span><div id=\"result-message\" class=\"mt-4\"></div><div class=\"card-actions justify-end mt-6\"><button type=\"submit\" class=\"btn btn-primary\">Lancer l'importation</button></div></form></div></div></div>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		return nil
+	})
+}
+
+func ImportResult(created, existing, keys int, errors []string) templ.Component {
+	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
+		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
+			return templ_7745c5c3_CtxErr
+		}
+		templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
+		if !templ_7745c5c3_IsBuffer {
+			defer func() {
+				templ_7745c5c3_BufErr := templruntime.ReleaseBuffer(templ_7745c5c3_Buffer)
+				if templ_7745c5c3_Err == nil {
+					templ_7745c5c3_Err = templ_7745c5c3_BufErr
+				}
+			}()
+		}
+		ctx = templ.InitializeContext(ctx)
+		templ_7745c5c3_Var4 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var4 == nil {
+			templ_7745c5c3_Var4 = templ.NopComponent
+		}
+		ctx = templ.ClearChildren(ctx)
+		var templ_7745c5c3_Var5 = []any{"alert", templ.KV("alert-success", len(errors) == 0), templ.KV("alert-warning", len(errors) > 0)}
+		templ_7745c5c3_Err = templ.RenderCSSItems(ctx, templ_7745c5c3_Buffer, templ_7745c5c3_Var5...)
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<div class=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var6 string
+		templ_7745c5c3_Var6, templ_7745c5c3_Err = templ.JoinStringErrs(templ.CSSClasses(templ_7745c5c3_Var5).String())
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `ui/admin_import.templ`, Line: 1, Col: 0}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var6))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "\"><div><p class=\"font-bold\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var7 string
+		templ_7745c5c3_Var7, templ_7745c5c3_Err = templ.JoinStringErrs(fmt.Sprintf("✅ %d tablette(s) ajoutée(s), %d déjà connue(s), %d clé(s) enregistrée(s)", created, existing, keys))
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `ui/admin_import.templ`, Line: 75, Col: 154}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var7))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "</p>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		for _, e := range errors {
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "<p class=\"text-xs\">")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			var templ_7745c5c3_Var8 string
+			templ_7745c5c3_Var8, templ_7745c5c3_Err = templ.JoinStringErrs(e)
+			if templ_7745c5c3_Err != nil {
+				return templ.Error{Err: templ_7745c5c3_Err, FileName: `ui/admin_import.templ`, Line: 77, Col: 38}
+			}
+			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var8))
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "</p>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "</div></div>")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		return nil
+	})
+}
+
 var _ = templruntime.GeneratedTemplate
@@ -47,7 +47,7 @@ func Layout(title string) templ.Component {
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, " | FreeKiosk Hub</title><link href=\"https://cdn.jsdelivr.net/npm/daisyui@4.7.2/dist/full.min.css\" rel=\"stylesheet\" type=\"text/css\"><script src=\"https://cdn.tailwindcss.com\"></script><script src=\"https://unpkg.com/htmx.org@1.9.10\"></script><script src=\"https://unpkg.com/htmx.org/dist/ext/sse.js\"></script><script src=\"https://cdn.jsdelivr.net/npm/chart.js\"></script><style>\n                .glass-nav {\n                    background: rgba(255, 255, 255, 0.8);\n                    backdrop-filter: blur(10px);\n                    border-bottom: 1px solid rgba(0,0,0,0.1);\n                }\n            </style></head><body class=\"min-h-screen bg-slate-50 text-slate-900 font-sans\"><div class=\"sticky top-0 z-50 glass-nav\"><div class=\"navbar max-w-7xl mx-auto px-4\"><div class=\"flex-1 gap-2\"><div class=\"bg-primary text-primary-content p-2 rounded-xl shadow-lg\"><svg xmlns=\"http://www.w3.org/2000/svg\" class=\"h-6 w-6\" fill=\"none\" viewBox=\"0 0 24 24\" stroke=\"currentColor\"><path stroke-linecap=\"round\" stroke-linejoin=\"round\" stroke-width=\"2\" d=\"M9 3v2m6-2v2M9 19v2m6-2v2M5 9H3m2 6H3m18-6h-2m2 6h-2M7 19h10a2 2 0 002-2V7a2 2 0 00-2-2H7a2 2 0 00-2 2v10a2 2 0 002 2zM9 9h6v6H9V9z\"></path></svg></div><a hx-get=\"/\" hx-target=\"main\" hx-push-url=\"true\" class=\"text-xl font-black tracking-tighter uppercase ml-2 cursor-pointer\">FreeKiosk<span class=\"text-primary\">Hub</span></a></div><div class=\"flex-none gap-4\"><ul class=\"menu menu-horizontal px-1 font-medium gap-1\"><li><a hx-get=\"/\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Dashboard</a></li><li><a hx-get=\"/groups\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Groups</a></li><li><a hx-get=\"/admin/import\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Importation</a></li></ul><div class=\"avatar placeholder\"><div class=\"bg-neutral text-neutral-content rounded-full w-8\"><span class=\"text-xs\">FK</span></div></div></div></div></div><div id=\"toast-container\" class=\"toast toast-end fixed bottom-6 right-6 z-[9999]\"></div><main class=\"max-w-7xl mx-auto py-8\" id=\"main-container\">")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, " | FreeKiosk Hub</title><link href=\"https://cdn.jsdelivr.net/npm/daisyui@4.7.2/dist/full.min.css\" rel=\"stylesheet\" type=\"text/css\"><script src=\"https://cdn.tailwindcss.com\"></script><script src=\"https://unpkg.com/htmx.org@1.9.10\"></script><script src=\"https://unpkg.com/htmx.org/dist/ext/sse.js\"></script><script src=\"https://cdn.jsdelivr.net/npm/chart.js\"></script><style>\n                .glass-nav {\n                    background: rgba(255, 255, 255, 0.8);\n                    backdrop-filter: blur(10px);\n                    border-bottom: 1px solid rgba(0,0,0,0.1);\n                }\n            </style></head><body class=\"min-h-screen bg-slate-50 text-slate-900 font-sans\"><div class=\"sticky top-0 z-50 glass-nav\"><div class=\"navbar max-w-7xl mx-auto px-4\"><div class=\"flex-1 gap-2\"><div class=\"bg-primary text-primary-content p-2 rounded-xl shadow-lg\"><svg xmlns=\"http://www.w3.org/2000/svg\" class=\"h-6 w-6\" fill=\"none\" viewBox=\"0 0 24 24\" stroke=\"currentColor\"><path stroke-linecap=\"round\" stroke-linejoin=\"round\" stroke-width=\"2\" d=\"M9 3v2m6-2v2M9 19v2m6-2v2M5 9H3m2 6H3m18-6h-2m2 6h-2M7 19h10a2 2 0 002-2V7a2 2 0 00-2-2H7a2 2 0 00-2 2v10a2 2 0 002 2zM9 9h6v6H9V9z\"></path></svg></div><a hx-get=\"/\" hx-target=\"main\" hx-push-url=\"true\" class=\"text-xl font-black tracking-tighter uppercase ml-2 cursor-pointer\">FreeKiosk<span class=\"text-primary\">Hub</span></a></div><div class=\"flex-none gap-4\"><ul class=\"menu menu-horizontal px-1 font-medium gap-1\"><li><a hx-get=\"/\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Dashboard</a></li><li><a hx-get=\"/groups\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Groups</a></li><li><a hx-get=\"/presets\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Presets</a></li><li><a hx-get=\"/library\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Library</a></li><li><a hx-get=\"/announcements\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Announcements</a></li><li><a hx-get=\"/sites\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Sites</a></li><li><a hx-get=\"/snippets\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Snippets</a></li><li><a hx-get=\"/keys\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">API keys</a></li><li><a hx-get=\"/fields\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Inventory fields</a></li><li><a hx-get=\"/admin/import\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Importation</a></li><li><a hx-get=\"/tamper\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg hover:bg-primary/10 transition-colors cursor-pointer\">Tamper</a></li><li><a hx-get=\"/emergency\" hx-target=\"main\" hx-push-url=\"true\" class=\"rounded-lg text-error hover:bg-error/10 transition-colors cursor-pointer\">Emergency</a></li></ul><div class=\"avatar placeholder\"><div class=\"bg-neutral text-neutral-content rounded-full w-8\"><span class=\"text-xs\">FK</span></div></div></div></div></div><div id=\"emergency-banner\" hx-get=\"/emergency/banner\" hx-trigger=\"load, every 15s, emergency from:body\" hx-swap=\"innerHTML\"></div><div id=\"toast-container\" class=\"toast toast-end fixed bottom-6 right-6 z-[9999]\"></div><main class=\"max-w-7xl mx-auto py-8\" id=\"main-container\">")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -102,7 +102,7 @@ func Toast(message string, status string) templ.Component {
 		var templ_7745c5c3_Var5 string
 		templ_7745c5c3_Var5, templ_7745c5c3_Err = templ.JoinStringErrs(toastID)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `ui/layout.templ`, Line: 120, Col: 20}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `ui/layout.templ`, Line: 193, Col: 20}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var5))
 		if templ_7745c5c3_Err != nil {
@@ -143,7 +143,7 @@ func Toast(message string, status string) templ.Component {
 		var templ_7745c5c3_Var7 string
 		templ_7745c5c3_Var7, templ_7745c5c3_Err = templ.JoinStringErrs(message)
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `ui/layout.templ`, Line: 131, Col: 53}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `ui/layout.templ`, Line: 204, Col: 53}
 		}
 		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var7))
 		if templ_7745c5c3_Err != nil {